@@ -0,0 +1,190 @@
+// Package auth holds the identities, roles and role bindings that decide
+// what callers of the manager API may do.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"cube/pki"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Verb string
+
+const (
+	Get    Verb = "get"
+	List   Verb = "list"
+	Create Verb = "create"
+	Update Verb = "update"
+	Delete Verb = "delete"
+)
+
+// Roles that can be bound to identities.
+const (
+	Viewer   = "viewer"
+	Operator = "operator"
+	Admin    = "admin"
+)
+
+// AdminGroup is the group of the admin token and of client certificates
+// issued to the cube:admins organization, whose members are admins of the
+// whole cluster.
+const AdminGroup = "cube:admins"
+
+// node is the role of the workers, which read the services they serve. It
+// can't be bound by users.
+const node = "node"
+
+// namespaced are the resources that live in a namespace.
+var namespaced = []string{"tasks", "tasks/exec", "deployments", "jobs", "cronjobs", "services",
+	"ingresses", "secrets", "quotas", "limitranges"}
+
+var (
+	read  = []Verb{Get, List}
+	write = []Verb{Create, Update, Delete}
+)
+
+type rule struct {
+	verbs     []Verb
+	resources []string
+}
+
+// viewable are the resources viewers can read. Secrets and the credentials
+// of the cluster are left out.
+var viewable = []string{"tasks", "deployments", "jobs", "cronjobs", "services", "ingresses",
+	"quotas", "limitranges", "namespaces", "priorityclasses", "nodes"}
+
+// workloads are the resources operators can change.
+var workloads = []string{"tasks", "tasks/exec", "deployments", "jobs", "cronjobs", "services",
+	"ingresses", "secrets"}
+
+var roles = map[string][]rule{
+	Viewer:   {{read, viewable}},
+	Operator: {{read, viewable}, {read, []string{"secrets"}}, {write, workloads}},
+	Admin:    {{[]Verb{Get, List, Create, Update, Delete}, []string{"*"}}},
+	node:     {{read, []string{"services"}}},
+}
+
+// Builtin are the bindings of the built-in identities, which always apply
+// besides the stored ones.
+var Builtin = []*RoleBinding{
+	{Name: "cube:admins", Role: Admin, Groups: []string{AdminGroup}},
+	{Name: "cube:nodes", Role: node, Groups: []string{pki.NodeGroup}},
+}
+
+// Namespaced reports whether a resource lives in a namespace.
+func Namespaced(resource string) bool {
+	return slices.Contains(namespaced, resource)
+}
+
+// Allows reports whether a role may use verb on resource.
+func Allows(role string, verb Verb, resource string) bool {
+	for _, r := range roles[role] {
+		if slices.Contains(r.verbs, verb) &&
+			(slices.Contains(r.resources, "*") || slices.Contains(r.resources, resource)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Identity is who a request comes from.
+type Identity struct {
+	User   string
+	Groups []string `json:",omitempty"`
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context that carries an identity.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFrom returns the identity of a context, if it has one.
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// RoleBinding grants a role to users and groups, in one namespace, or in
+// all of them and on the resources outside namespaces if Namespace is
+// empty.
+type RoleBinding struct {
+	Name       string
+	Namespace  string `json:",omitempty"`
+	Role       string
+	Users      []string `json:",omitempty"`
+	Groups     []string `json:",omitempty"`
+	CreateTime time.Time
+}
+
+func (b *RoleBinding) Validate() error {
+	if b.Name == "" {
+		return errors.New("role binding name must not be empty")
+	}
+	if b.Role != Viewer && b.Role != Operator && b.Role != Admin {
+		return fmt.Errorf("role must be %s, %s or %s, not %q", Viewer, Operator, Admin, b.Role)
+	}
+	if len(b.Users) == 0 && len(b.Groups) == 0 {
+		return errors.New("role binding needs users or groups")
+	}
+	return nil
+}
+
+// Applies reports whether the binding grants its role to an identity.
+func (b *RoleBinding) Applies(id Identity) bool {
+	if slices.Contains(b.Users, id.User) {
+		return true
+	}
+	for _, g := range id.Groups {
+		if slices.Contains(b.Groups, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize reports whether the bindings let an identity use verb on
+// resource in namespace ns. An empty ns asks for every namespace, as do
+// requests for resources outside namespaces.
+func Authorize(bindings []*RoleBinding, id Identity, verb Verb, resource, ns string) bool {
+	for _, b := range append(slices.Clone(Builtin), bindings...) {
+		if b.Namespace != "" && (b.Namespace != ns || !Namespaced(resource)) {
+			continue
+		}
+		if b.Applies(id) && Allows(b.Role, verb, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// Token is an API token of a user. Only its hash is stored.
+type Token struct {
+	ID         uuid.UUID
+	Hash       string
+	User       string
+	Groups     []string `json:",omitempty"`
+	CreateTime time.Time
+}
+
+// NewToken returns a random token for a user and its record.
+func NewToken(user string, groups []string) (string, *Token) {
+	b := make([]byte, 24)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	return token, &Token{
+		ID:         uuid.New(),
+		Hash:       pki.TokenHash(token),
+		User:       user,
+		Groups:     groups,
+		CreateTime: time.Now().UTC(),
+	}
+}
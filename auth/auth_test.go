@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"cube/pki"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	bindings := []*RoleBinding{
+		{Name: "team-a-viewers", Namespace: "team-a", Role: Viewer, Users: []string{"alice"}},
+		{Name: "operators", Role: Operator, Groups: []string{"ops"}},
+	}
+	alice := Identity{User: "alice"}
+	bob := Identity{User: "bob", Groups: []string{"ops"}}
+	admin := Identity{User: "admin", Groups: []string{AdminGroup}}
+	node := Identity{User: "node:w1", Groups: []string{pki.NodeGroup}}
+
+	tests := []struct {
+		id       Identity
+		verb     Verb
+		resource string
+		ns       string
+		want     bool
+	}{
+		{alice, List, "tasks", "team-a", true},
+		{alice, Get, "deployments", "team-a", true},
+		{alice, List, "tasks", "team-b", false},
+		{alice, List, "tasks", "", false},
+		{alice, List, "nodes", "", false},
+		{alice, Create, "tasks", "team-a", false},
+		{alice, Get, "secrets", "team-a", false},
+		{bob, Create, "deployments", "team-b", true},
+		{bob, List, "tasks", "", true},
+		{bob, Get, "secrets", "team-a", true},
+		{bob, Create, "namespaces", "", false},
+		{bob, Create, "rolebindings", "", false},
+		{admin, Create, "rolebindings", "", true},
+		{node, List, "services", "", true},
+		{node, List, "tasks", "team-a", false},
+		{Identity{User: "eve"}, List, "tasks", "team-a", false},
+	}
+	for _, tt := range tests {
+		got := Authorize(bindings, tt.id, tt.verb, tt.resource, tt.ns)
+		if got != tt.want {
+			t.Errorf("Authorize(%s, %s %s in %q) = %v, want %v", tt.id.User, tt.verb, tt.resource, tt.ns, got, tt.want)
+		}
+	}
+}
+
+func TestRoleBindingValidate(t *testing.T) {
+	for _, b := range []RoleBinding{
+		{Role: Viewer, Users: []string{"alice"}},
+		{Name: "nodes", Role: node, Groups: []string{"ops"}},
+		{Name: "owners", Role: "owner", Users: []string{"alice"}},
+	} {
+		if err := b.Validate(); err == nil {
+			t.Errorf("binding %+v is valid", b)
+		}
+	}
+	b := RoleBinding{Name: "viewers", Role: Viewer, Users: []string{"alice"}}
+	if err := b.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
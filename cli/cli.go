@@ -0,0 +1,219 @@
+// Package cli is the cube command-line client, which drives a cluster
+// through the manager API.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(e *env, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "NAME --image IMAGE [flags]", "Start a task", runRun},
+		{"ls", "[flags]", "List tasks", runLs},
+		{"get", "KIND [NAME] [flags]", "Show objects of a kind, or one of them", runGet},
+		{"stop", "TASK [flags]", "Stop a task", runStop},
+		{"logs", "TASK [flags]", "Print the output of a task", runLogs},
+		{"exec", "TASK [flags] -- COMMAND [ARG...]", "Run a command in a task's container", runExec},
+		{"events", "TASK [flags]", "Show the events of a task", runEvents},
+		{"nodes", "[flags]", "List the worker nodes", runNodes},
+		{"apply", "-f FILE [flags]", "Create or update the objects in a manifest file", runApply},
+		{"drain", "NODE [flags]", "Move the tasks off a node", runDrain},
+		{"token", "[flags]", "Create a one-time join token for a new worker", runToken},
+		{"revoke", "SERIAL [flags]", "Revoke a certificate of the cluster CA", runRevoke},
+		{"apitoken", "USER [flags]", "Create an API token for a user", runAPIToken},
+		{"bind", "NAME --role ROLE [flags]", "Grant a role to users and groups", runBind},
+		{"whoami", "[flags]", "Show who the client authenticates as", runWhoAmI},
+	}
+}
+
+// env is what a command runs with.
+type env struct {
+	cmd       command
+	client    *Client
+	namespace string
+	// allNamespaces is set by -A on the commands that list objects.
+	allNamespaces bool
+	output        string
+	out           io.Writer
+}
+
+// usageError is returned for commands that were called wrongly.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// exitError carries the exit code of a command run by exec.
+type exitError struct {
+	code int
+}
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit code %d", e.code)
+}
+
+// Run runs the command named by args[0] with the rest of args and returns
+// its exit code.
+func Run(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return 2
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(os.Stdout)
+		return 0
+	}
+	var c *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			c = &commands[i]
+		}
+	}
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "cube: unknown command %q\n\n", args[0])
+		usage(os.Stderr)
+		return 2
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	client, err := NewClient(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	e := &env{
+		cmd:       *c,
+		client:    client,
+		namespace: config.Namespace,
+		output:    Table,
+		out:       os.Stdout,
+	}
+	if e.namespace == "" {
+		e.namespace = "default"
+	}
+
+	err = c.run(e, args[1:])
+	var uerr usageError
+	var xerr exitError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, &uerr):
+		if uerr.msg != "" {
+			fmt.Fprintf(os.Stderr, "cube %s: %s\n", c.name, uerr.msg)
+		}
+		fmt.Fprintf(os.Stderr, "Usage: cube %s %s\n", c.name, c.args)
+		return 2
+	case errors.As(err, &xerr):
+		return xerr.code
+	default:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: cube COMMAND [ARGS] [FLAGS]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run cube COMMAND -h for the flags of a command. The manager address and")
+	fmt.Fprintln(w, "credentials are read from ~/.cube/config (or $CUBE_CONFIG), and the")
+	fmt.Fprintln(w, "CUBE_MANAGER, CUBE_TOKEN and CUBE_NAMESPACE environment variables.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "cube manager and cube worker run the nodes of a cluster; run them with -h")
+	fmt.Fprintln(w, "for their settings. Without a command, cube runs a manager and three")
+	fmt.Fprintln(w, "workers in one process.")
+}
+
+// flags returns the flag set of the command with the flags every command
+// takes. Commands that list objects also take -A.
+func (e *env) flags(list bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(e.cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cube %s %s\n\n%s.\n\nFlags:\n", e.cmd.name, e.cmd.args, e.cmd.summary)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&e.namespace, "n", e.namespace, "namespace")
+	fs.StringVar(&e.namespace, "namespace", e.namespace, "namespace")
+	fs.StringVar(&e.output, "o", e.output, "output format: table, json or yaml")
+	fs.StringVar(&e.output, "output", e.output, "output format: table, json or yaml")
+	if list {
+		fs.BoolVar(&e.allNamespaces, "A", false, "list objects of all namespaces")
+		fs.BoolVar(&e.allNamespaces, "all-namespaces", false, "list objects of all namespaces")
+	}
+	return fs
+}
+
+// parse parses the flags of a command, which may come before, between or
+// after its arguments, and returns the arguments. Everything after "--" is
+// an argument.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		err := fs.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, usageError{}
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// parseArgs parses the flags of a command and checks that it got between
+// min and max arguments. A negative max means there is no upper limit.
+func parseArgs(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	args, err := parse(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return nil, usageError{msg: "wrong number of arguments"}
+	}
+	return args, nil
+}
+
+// namespacePath returns the path of a kind of object in the namespace of
+// the command.
+func (e *env) namespacePath(path string) string {
+	return "/namespaces/" + url.PathEscape(e.namespace) + path
+}
+
+func (e *env) print(v any, t *table) error {
+	return printObject(e.out, strings.ToLower(e.output), v, t)
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"bytes"
+	"cube/manager"
+	"cube/namespace"
+	"cube/task"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// newTestEnv returns the env of a command against a manager with in-memory
+// stores, and the buffer the command prints to.
+func newTestEnv(t *testing.T, name string) (*env, *manager.Manager, *bytes.Buffer) {
+	t.Helper()
+	m, err := manager.New([]string{}, "roundrobin", "memory", "", "token")
+	if err != nil {
+		t.Fatalf("creating manager: %v", err)
+	}
+	srv := httptest.NewServer((&manager.Api{Manager: m}).Handler())
+	t.Cleanup(srv.Close)
+	client, err := NewClient(Config{Manager: srv.URL})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	e := &env{cmd: lookup(t, name), client: client, namespace: namespace.Default, output: Table, out: out}
+	return e, m, out
+}
+
+func lookup(t *testing.T, name string) command {
+	t.Helper()
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	t.Fatalf("no command %s", name)
+	return command{}
+}
+
+func TestParseTakesFlagsAnywhere(t *testing.T) {
+	e, _, _ := newTestEnv(t, "exec")
+	fs := e.flags(false)
+	args, err := parse(fs, []string{"web", "-n", "team-a", "--", "ls", "-l"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if strings.Join(args, " ") != "web ls -l" || e.namespace != "team-a" {
+		t.Errorf("got args %q in namespace %s, want web ls -l in team-a", args, e.namespace)
+	}
+}
+
+func TestParseArgsChecksCount(t *testing.T) {
+	e, _, _ := newTestEnv(t, "stop")
+	_, err := parseArgs(e.flags(false), []string{"a", "b"}, 1, 1)
+	var uerr usageError
+	if !errors.As(err, &uerr) {
+		t.Errorf("got %v for too many arguments, want a usage error", err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"512", 512},
+		{"2K", 2 << 10},
+		{"512Mi", 512 << 20},
+		{"1G", 1 << 30},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"G", "-1", "1T", "lots"} {
+		if _, err := parseSize(bad); err == nil {
+			t.Errorf("parseSize(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRunAndStopTask(t *testing.T) {
+	e, m, out := newTestEnv(t, "run")
+	err := e.cmd.run(e, []string{"web", "--image", "nginx", "--memory", "1Mi", "--label", "app=web", "--port", "80"})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	tasks := m.GetTasks()
+	if len(tasks) != 1 {
+		t.Fatalf("manager has %d tasks, want 1", len(tasks))
+	}
+	got := tasks[0]
+	if got.Name != "web" || got.Memory != 1<<20 || got.Labels["app"] != "web" {
+		t.Errorf("task is %+v", got)
+	}
+	if _, ok := got.ExposedPort["80/tcp"]; !ok {
+		t.Errorf("port 80/tcp is not exposed: %v", got.ExposedPort)
+	}
+	if !strings.Contains(out.String(), "web") {
+		t.Errorf("run printed %q", out.String())
+	}
+
+	e.cmd = lookup(t, "stop")
+	out.Reset()
+	if err := e.cmd.run(e, []string{"web"}); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "Stopping task web") {
+		t.Errorf("stop printed %q", out.String())
+	}
+}
+
+func TestRunRequiresImage(t *testing.T) {
+	e, _, _ := newTestEnv(t, "run")
+	var uerr usageError
+	if err := e.cmd.run(e, []string{"web"}); !errors.As(err, &uerr) {
+		t.Errorf("got %v without --image, want a usage error", err)
+	}
+}
+
+func TestFindTaskByIDStaysInNamespace(t *testing.T) {
+	e, m, _ := newTestEnv(t, "get")
+	if err := m.CreateNamespace(&namespace.Namespace{Name: "team-a"}); err != nil {
+		t.Fatalf("CreateNamespace: %v", err)
+	}
+	te := task.TaskEvent{State: task.Scheduled,
+		Task: task.Task{ID: uuid.New(), Name: "web", Namespace: "team-a", Image: "nginx"}}
+	if err := m.SubmitTask(&te); err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+
+	if _, err := e.findTask(te.Task.ID.String()); err == nil {
+		t.Error("task of another namespace was found by ID")
+	}
+	e.namespace = "team-a"
+	got, err := e.findTask(te.Task.ID.String())
+	if err != nil || got.ID != te.Task.ID {
+		t.Errorf("findTask in team-a: got %v, %v", got, err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(path, []byte("manager: 10.0.0.1:5555/\nnamespace: team-a\ntoken: abc\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CUBE_CONFIG", path)
+	t.Setenv("CUBE_MANAGER", "")
+	t.Setenv("CUBE_TOKEN", "")
+	t.Setenv("CUBE_NAMESPACE", "team-b")
+
+	c, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if c.Manager != "http://10.0.0.1:5555" || c.Token != "abc" || c.Namespace != "team-b" {
+		t.Errorf("got %+v", c)
+	}
+}
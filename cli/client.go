@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/x509"
+	"cube/manager"
+	"cube/pki"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Client calls the manager API.
+type Client struct {
+	config Config
+	http   *http.Client
+}
+
+// NewClient returns a client of the manager in config. Over https, the
+// manager's certificate is verified against the CA of the config, or else
+// the system roots, and the client certificate of the config is presented.
+func NewClient(config Config) (*Client, error) {
+	if config.CA == "" && config.Cert == "" {
+		return &Client{config: config, http: &http.Client{}}, nil
+	}
+	var pool *x509.CertPool
+	if config.CA != "" {
+		p, err := pki.LoadPool(config.CA)
+		if err != nil {
+			return nil, err
+		}
+		pool = p
+	}
+	var kp *pki.KeyPair
+	if config.Cert != "" {
+		k, err := pki.LoadKeyPair(config.Cert, config.Key)
+		if err != nil {
+			return nil, err
+		}
+		kp = k
+	}
+	return &Client{config: config, http: pki.NewClient(pki.ClientConfig(kp, pool))}, nil
+}
+
+// Do sends a request to the manager and returns the response if it was
+// successful. Error responses are returned as errors.
+func (c *Client) Do(method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.config.Manager+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		e := manager.ErrorResponse{}
+		err := json.NewDecoder(resp.Body).Decode(&e)
+		if err != nil || e.Message == "" {
+			return nil, fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+		return nil, fmt.Errorf("%s (%d)", e.Message, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// Get decodes the response to a GET request into out.
+func (c *Client) Get(path string, out any) error {
+	return c.Send(http.MethodGet, path, nil, out)
+}
+
+// Send sends in as JSON, unless it is nil, and decodes the response into
+// out, unless it is nil.
+func (c *Client) Send(method, path string, in, out any) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	resp, err := c.Do(method, path, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
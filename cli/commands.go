@@ -0,0 +1,554 @@
+package cli
+
+import (
+	"bytes"
+	"cube/auth"
+	"cube/manager"
+	"cube/pki"
+	"cube/task"
+	"cube/worker"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+)
+
+// listFlag collects the values of a flag given several times.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func runRun(e *env, args []string) error {
+	fs := e.flags(false)
+	image := fs.String("image", "", "container image (required)")
+	cpu := fs.Float64("cpu", 0, "cores to reserve")
+	memory := fs.String("memory", "", "memory to reserve, such as 512Mi or 1G")
+	disk := fs.String("disk", "", "disk to reserve, such as 10G")
+	restart := fs.String("restart", "", "restart policy: no, always, unless-stopped or on-failure")
+	health := fs.String("health", "", "HTTP path of the health check")
+	priorityClass := fs.String("priority-class", "", "priority class")
+	var ports, taskLabels listFlag
+	fs.Var(&ports, "port", "container port to publish, such as 80/tcp (repeatable)")
+	fs.Var(&taskLabels, "label", "label in the form key=value (repeatable)")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if *image == "" {
+		return usageError{msg: "--image is required"}
+	}
+
+	t := task.Task{
+		ID:            uuid.New(),
+		Name:          args[0],
+		Namespace:     e.namespace,
+		State:         task.Pending,
+		Image:         *image,
+		Cpu:           *cpu,
+		RestartPolicy: container.RestartPolicyMode(*restart),
+		HealthCheck:   *health,
+		PriorityClass: *priorityClass,
+	}
+	t.Memory, err = parseSize(*memory)
+	if err != nil {
+		return fmt.Errorf("invalid --memory: %v", err)
+	}
+	t.Disk, err = parseSize(*disk)
+	if err != nil {
+		return fmt.Errorf("invalid --disk: %v", err)
+	}
+	if len(ports) > 0 {
+		t.ExposedPort = nat.PortSet{}
+		for _, p := range ports {
+			if !strings.Contains(p, "/") {
+				p += "/tcp"
+			}
+			t.ExposedPort[nat.Port(p)] = struct{}{}
+		}
+	}
+	for _, l := range taskLabels {
+		k, v, ok := strings.Cut(l, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("invalid label %q; use key=value", l)
+		}
+		if t.Labels == nil {
+			t.Labels = map[string]string{}
+		}
+		t.Labels[k] = v
+	}
+
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Scheduled,
+		Timestamp: time.Now(),
+		Task:      t,
+	}
+	created := task.Task{}
+	err = e.client.Send(http.MethodPost, e.namespacePath("/tasks"), te, &created)
+	if err != nil {
+		return err
+	}
+	return e.print(created, &table{header: taskHeader, rows: [][]string{taskRow(&created)}})
+}
+
+// parseSize reads a size in bytes, with an optional K, M or G suffix (or
+// Ki, Mi, Gi) for powers of 1024.
+func parseSize(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	mult := 1
+	num := strings.TrimSuffix(s, "i")
+	switch {
+	case strings.HasSuffix(num, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(num, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(num, "G"):
+		mult = 1 << 30
+	default:
+		num = s
+	}
+	if mult > 1 {
+		num = num[:len(num)-1]
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size", s)
+	}
+	return n * mult, nil
+}
+
+func runLs(e *env, args []string) error {
+	fs := e.flags(true)
+	state := fs.String("state", "", "comma separated task states, such as running,pending")
+	selector := fs.String("l", "", "label selector, such as app=web")
+	_, err := parseArgs(fs, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	q := url.Values{}
+	if *state != "" {
+		q.Set("state", *state)
+	}
+	if *selector != "" {
+		q.Set("selector", *selector)
+	}
+	r, _ := findResource("task")
+	return e.list(r, q)
+}
+
+func runGet(e *env, args []string) error {
+	fs := e.flags(true)
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	r, ok := findResource(args[0])
+	if !ok {
+		return fmt.Errorf("unknown kind %q", args[0])
+	}
+	if len(args) == 1 {
+		return e.list(r, nil)
+	}
+
+	name := args[1]
+	ns := e.namespace
+	if r.path == "/tasks" {
+		t, err := e.findTask(name)
+		if err != nil {
+			return err
+		}
+		name, ns = t.ID.String(), t.Namespace
+	}
+	obj, rows, err := r.list(e.client, r.listPath(ns)+"/"+url.PathEscape(name), true)
+	if err != nil {
+		return err
+	}
+	if r.namespaced {
+		rows[0] = rows[0][1:]
+	}
+	return e.print(obj, &table{header: r.header, rows: rows})
+}
+
+// list prints the objects of a kind in the namespace of the command, or in
+// every namespace with -A, with a NAMESPACE column.
+func (e *env) list(r resource, q url.Values) error {
+	ns := e.namespace
+	if e.allNamespaces {
+		ns = ""
+	}
+	path := r.listPath(ns)
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	objs, rows, err := r.list(e.client, path, false)
+	if err != nil {
+		return err
+	}
+
+	t := &table{header: r.header, rows: rows}
+	if r.namespaced && e.allNamespaces {
+		t.header = append([]string{"NAMESPACE"}, r.header...)
+	} else if r.namespaced {
+		for i := range t.rows {
+			t.rows[i] = t.rows[i][1:]
+		}
+	}
+	return e.print(objs, t)
+}
+
+// findTask looks up a task by ID, or by name in the namespace of the
+// command. Of the tasks with a name, the newest that hasn't finished is
+// picked, or else the newest.
+func (e *env) findTask(ref string) (*task.Task, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		t := task.Task{}
+		err := e.client.Get(e.namespacePath("/tasks/"+id.String()), &t)
+		if err != nil {
+			return nil, err
+		}
+		return &t, nil
+	}
+
+	q := url.Values{"name": {ref}, "sort": {"-submitted"}}
+	var tasks []*task.Task
+	err := e.client.Get(e.namespacePath("/tasks")+"?"+q.Encode(), &tasks)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tasks {
+		if t.State != task.Completed && t.State != task.Failed {
+			return t, nil
+		}
+	}
+	if len(tasks) > 0 {
+		return tasks[0], nil
+	}
+	return nil, fmt.Errorf("no task named %s in namespace %s", ref, e.namespace)
+}
+
+func taskPath(t *task.Task) string {
+	return "/namespaces/" + url.PathEscape(t.Namespace) + "/tasks/" + t.ID.String()
+}
+
+func runStop(e *env, args []string) error {
+	fs := e.flags(false)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	t, err := e.findTask(args[0])
+	if err != nil {
+		return err
+	}
+
+	err = e.client.Send(http.MethodDelete, taskPath(t), nil, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "Stopping task %s (%s)\n", t.Name, t.ID)
+	return nil
+}
+
+func runLogs(e *env, args []string) error {
+	fs := e.flags(false)
+	follow := fs.Bool("f", false, "keep printing new output")
+	tail := fs.Int("tail", -1, "number of lines to print from the end; all of them if negative")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	t, err := e.findTask(args[0])
+	if err != nil {
+		return err
+	}
+
+	q := url.Values{}
+	if *tail >= 0 {
+		q.Set("tail", strconv.Itoa(*tail))
+	}
+	if *follow {
+		q.Set("follow", "true")
+	}
+	resp, err := e.client.Do(http.MethodGet, taskPath(t)+"/logs?"+q.Encode(), nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(e.out, resp.Body)
+	return err
+}
+
+func runExec(e *env, args []string) error {
+	fs := e.flags(false)
+	args, err := parseArgs(fs, args, 2, -1)
+	if err != nil {
+		return err
+	}
+	t, err := e.findTask(args[0])
+	if err != nil {
+		return err
+	}
+
+	result := task.ExecResult{}
+	err = e.client.Send(http.MethodPost, taskPath(t)+"/exec",
+		worker.ExecRequest{Command: args[1:]}, &result)
+	if err != nil {
+		return err
+	}
+	if e.output != Table {
+		return e.print(result, nil)
+	}
+	fmt.Fprint(e.out, result.Output)
+	if result.ExitCode != 0 {
+		return exitError{code: result.ExitCode}
+	}
+	return nil
+}
+
+func runEvents(e *env, args []string) error {
+	fs := e.flags(false)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	t, err := e.findTask(args[0])
+	if err != nil {
+		return err
+	}
+
+	var events []task.TaskEvent
+	err = e.client.Get(taskPath(t)+"/events", &events)
+	if err != nil {
+		return err
+	}
+	tbl := &table{header: []string{"AGE", "TYPE", "STATE", "MESSAGE"}}
+	for _, ev := range events {
+		tbl.add(age(ev.Timestamp), string(ev.Type), ev.Task.State.String(), ev.Message)
+	}
+	return e.print(events, tbl)
+}
+
+func runNodes(e *env, args []string) error {
+	fs := e.flags(false)
+	_, err := parseArgs(fs, args, 0, 0)
+	if err != nil {
+		return err
+	}
+	r, _ := findResource("node")
+	return e.list(r, nil)
+}
+
+func runApply(e *env, args []string) error {
+	fs := e.flags(false)
+	file := fs.String("f", "", "manifest file, or - for standard input (required)")
+	dryRun := fs.Bool("dry-run", false, "only show what would be changed")
+	_, err := parseArgs(fs, args, 0, 0)
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		return usageError{msg: "-f is required"}
+	}
+
+	var data []byte
+	if *file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+
+	path := "/apply"
+	if *dryRun {
+		path += "?dryRun=true"
+	}
+	resp, err := e.client.Do(http.MethodPost, path, bytes.NewReader(data), "application/yaml")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var results []manager.ApplyResult
+	err = json.NewDecoder(resp.Body).Decode(&results)
+	if err != nil {
+		return err
+	}
+
+	tbl := &table{header: []string{"KIND", "NAMESPACE", "NAME", "ACTION", "DETAILS"}}
+	failed := 0
+	for _, r := range results {
+		details := strings.Join(r.Diff, "; ")
+		if r.Action == manager.Failed {
+			failed++
+			details = r.Error
+		}
+		ns := r.Namespace
+		if ns == "" {
+			ns = "-"
+		}
+		tbl.add(r.Kind, ns, r.Name, r.Action, details)
+	}
+	err = e.print(results, tbl)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d manifests failed", failed, len(results))
+	}
+	return nil
+}
+
+func runDrain(e *env, args []string) error {
+	fs := e.flags(false)
+	wait := fs.Bool("wait", false, "wait until every task has been moved")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	path := "/nodes/" + url.PathEscape(args[0]) + "/drain"
+
+	ds := manager.DrainStatus{}
+	err = e.client.Send(http.MethodPost, path, nil, &ds)
+	for err == nil && *wait && !ds.Done {
+		time.Sleep(2 * time.Second)
+		err = e.client.Get(path, &ds)
+	}
+	if err != nil {
+		return err
+	}
+
+	tbl := &table{header: []string{"NODE", "TOTAL", "MOVED", "REMAINING", "DONE"}}
+	tbl.add(ds.Node, strconv.Itoa(ds.Total), strconv.Itoa(ds.Moved), strconv.Itoa(ds.Remaining),
+		strconv.FormatBool(ds.Done))
+	return e.print(ds, tbl)
+}
+
+func runToken(e *env, args []string) error {
+	fs := e.flags(false)
+	ttl := fs.Duration("ttl", 24*time.Hour, "how long the token is valid for")
+	_, err := parseArgs(fs, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	t := manager.BootstrapTokenResponse{}
+	err = e.client.Send(http.MethodPost, "/pki/tokens?ttl="+url.QueryEscape(ttl.String()), nil, &t)
+	if err != nil {
+		return err
+	}
+	tbl := &table{header: []string{"TOKEN", "EXPIRES", "CA HASH"}}
+	tbl.add(t.Token, t.Expires.Local().Format(time.DateTime), t.CAHash)
+	return e.print(t, tbl)
+}
+
+func runRevoke(e *env, args []string) error {
+	fs := e.flags(false)
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c := pki.Certificate{}
+	err = e.client.Send(http.MethodPost, "/pki/certificates/"+url.PathEscape(args[0])+"/revoke", nil, &c)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "Revoked certificate %s of %s\n", c.Serial, c.Name)
+	return nil
+}
+
+func runAPIToken(e *env, args []string) error {
+	fs := e.flags(false)
+	var groups listFlag
+	fs.Var(&groups, "group", "group of the user (repeatable)")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	t := manager.TokenResponse{}
+	err = e.client.Send(http.MethodPost, "/auth/tokens", manager.TokenRequest{User: args[0], Groups: groups}, &t)
+	if err != nil {
+		return err
+	}
+	tbl := &table{header: []string{"TOKEN", "ID", "USER", "GROUPS"}}
+	tbl.add(t.Token, t.ID.String(), t.User, strings.Join(t.Groups, ","))
+	return e.print(t, tbl)
+}
+
+func runBind(e *env, args []string) error {
+	fs := e.flags(false)
+	role := fs.String("role", "", "role to grant: viewer, operator or admin (required)")
+	cluster := fs.Bool("cluster", false, "grant the role in every namespace and on the cluster, not just the namespace")
+	var users, groups listFlag
+	fs.Var(&users, "user", "user to grant the role to (repeatable)")
+	fs.Var(&groups, "group", "group to grant the role to (repeatable)")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if *role == "" {
+		return usageError{msg: "--role is required"}
+	}
+
+	b := auth.RoleBinding{Name: args[0], Role: *role, Users: users, Groups: groups}
+	if !*cluster {
+		b.Namespace = e.namespace
+	}
+	err = e.client.Send(http.MethodPost, "/rolebindings", b, &b)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "Created role binding %s\n", b.Name)
+	return nil
+}
+
+func runWhoAmI(e *env, args []string) error {
+	fs := e.flags(false)
+	_, err := parseArgs(fs, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	who := manager.WhoAmIResponse{}
+	err = e.client.Get("/auth/whoami", &who)
+	if err != nil {
+		return err
+	}
+	tbl := &table{header: []string{"USER", "GROUPS", "ROLES"}}
+	var roles []string
+	for _, b := range who.RoleBindings {
+		roles = append(roles, b.Role+"@"+bindingScope(b))
+	}
+	tbl.add(who.User, strings.Join(who.Groups, ","), strings.Join(roles, ","))
+	return e.print(who, tbl)
+}
+
+// bindingScope returns the namespace of a role binding, or "*" for one
+// that applies to the whole cluster.
+func bindingScope(b *auth.RoleBinding) string {
+	if b.Namespace == "" {
+		return "*"
+	}
+	return b.Namespace
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config tells the client where the manager is and how to authenticate to
+// it. It is read from a YAML file, by default ~/.cube/config, and the
+// CUBE_MANAGER, CUBE_TOKEN, CUBE_NAMESPACE, CUBE_CA, CUBE_CERT and
+// CUBE_KEY environment variables override it.
+type Config struct {
+	// Manager is the address of the manager API, such as
+	// http://localhost:5555.
+	Manager string `yaml:"manager"`
+	// Token is sent as a bearer token with every request.
+	Token string `yaml:"token"`
+	// Namespace is used by commands that aren't given one.
+	Namespace string `yaml:"namespace"`
+	// CA is the PEM certificate the manager's certificate is verified
+	// against over https.
+	CA string `yaml:"ca"`
+	// Cert and Key are a client certificate and its key, which
+	// authenticate the client instead of a token.
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+const defaultManager = "http://localhost:5555"
+
+// configPath returns the path of the config file, set by CUBE_CONFIG.
+func configPath() string {
+	if p := os.Getenv("CUBE_CONFIG"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".cube", "config")
+}
+
+// LoadConfig reads the config file, if there is one, and applies the
+// environment on top of it.
+func LoadConfig() (Config, error) {
+	c := Config{}
+	if p := configPath(); p != "" {
+		data, err := os.ReadFile(p)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return c, err
+		}
+		err = yaml.Unmarshal(data, &c)
+		if err != nil {
+			return c, fmt.Errorf("reading %s: %v", p, err)
+		}
+	}
+
+	if v := os.Getenv("CUBE_MANAGER"); v != "" {
+		c.Manager = v
+	}
+	if v := os.Getenv("CUBE_TOKEN"); v != "" {
+		c.Token = v
+	}
+	if v := os.Getenv("CUBE_NAMESPACE"); v != "" {
+		c.Namespace = v
+	}
+	if v := os.Getenv("CUBE_CA"); v != "" {
+		c.CA = v
+	}
+	if v := os.Getenv("CUBE_CERT"); v != "" {
+		c.Cert = v
+	}
+	if v := os.Getenv("CUBE_KEY"); v != "" {
+		c.Key = v
+	}
+
+	if c.Manager == "" {
+		c.Manager = defaultManager
+	}
+	if !strings.Contains(c.Manager, "://") {
+		c.Manager = "http://" + c.Manager
+	}
+	c.Manager = strings.TrimSuffix(c.Manager, "/")
+	return c, nil
+}
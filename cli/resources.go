@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"cube/auth"
+	"cube/cronjob"
+	"cube/deployment"
+	"cube/ingress"
+	"cube/job"
+	"cube/namespace"
+	"cube/node"
+	"cube/pki"
+	"cube/priority"
+	"cube/secret"
+	"cube/service"
+	"cube/task"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resource describes how the get command lists and shows one kind of
+// object.
+type resource struct {
+	// names are the names the kind can be given by, singular first.
+	names      []string
+	path       string
+	namespaced bool
+	header     []string
+	// list fetches the objects at path, or the one object if one is set,
+	// and returns them with their table rows.
+	list func(c *Client, path string, one bool) (any, [][]string, error)
+}
+
+func newResource[T any](names []string, path string, namespaced bool, header []string,
+	row func(*T) []string) resource {
+	return resource{
+		names:      names,
+		path:       path,
+		namespaced: namespaced,
+		header:     header,
+		list: func(c *Client, path string, one bool) (any, [][]string, error) {
+			rowOf := row
+			if namespaced {
+				rowOf = func(obj *T) []string { return withNamespace(obj, row(obj)) }
+			}
+			if one {
+				obj := new(T)
+				err := c.Get(path, obj)
+				if err != nil {
+					return nil, nil, err
+				}
+				return obj, [][]string{rowOf(obj)}, nil
+			}
+			var objs []*T
+			err := c.Get(path, &objs)
+			if err != nil {
+				return nil, nil, err
+			}
+			rows := make([][]string, 0, len(objs))
+			for _, obj := range objs {
+				rows = append(rows, rowOf(obj))
+			}
+			return objs, rows, nil
+		},
+	}
+}
+
+// withNamespace puts the namespace of an object, if it has one, in front of
+// its row. The caller drops it when it isn't wanted.
+func withNamespace(obj any, row []string) []string {
+	f := reflect.ValueOf(obj).Elem().FieldByName("Namespace")
+	if !f.IsValid() {
+		return row
+	}
+	return append([]string{f.String()}, row...)
+}
+
+var resources = []resource{
+	newResource([]string{"task", "tasks"}, "/tasks", true, taskHeader, taskRow),
+	newResource([]string{"deployment", "deployments", "deploy"}, "/deployments", true,
+		[]string{"NAME", "READY", "REVISION", "AGE"},
+		func(d *deployment.Deployment) []string {
+			return []string{d.Name, fmt.Sprintf("%d/%d", d.Status.AvailableReplicas, d.Replicas),
+				strconv.Itoa(d.Revision), age(d.CreateTime)}
+		}),
+	newResource([]string{"job", "jobs"}, "/jobs", true,
+		[]string{"NAME", "PHASE", "COMPLETIONS", "AGE"},
+		func(j *job.Job) []string {
+			return []string{j.Name, j.Status.Phase, fmt.Sprintf("%d/%d", j.Status.Succeeded, j.Completions),
+				age(j.CreateTime)}
+		}),
+	newResource([]string{"cronjob", "cronjobs"}, "/cronjobs", true,
+		[]string{"NAME", "SCHEDULE", "ACTIVE", "LAST RUN", "AGE"},
+		func(c *cronjob.CronJob) []string {
+			return []string{c.Name, c.Schedule, strconv.Itoa(len(c.Status.Active)),
+				age(c.Status.LastStartTime), age(c.CreateTime)}
+		}),
+	newResource([]string{"service", "services", "svc"}, "/services", true,
+		[]string{"NAME", "PORT", "PROTOCOL", "MODE", "ENDPOINTS", "AGE"},
+		func(s *service.Service) []string {
+			return []string{s.Name, strconv.Itoa(s.Port), s.Protocol, s.Mode,
+				strconv.Itoa(len(s.Status.Endpoints)), age(s.CreateTime)}
+		}),
+	newResource([]string{"ingress", "ingresses", "ing"}, "/ingresses", true,
+		[]string{"NAME", "HOSTS", "AGE"},
+		func(i *ingress.Ingress) []string {
+			var hosts []string
+			for _, r := range i.Rules {
+				if r.Host == "" {
+					hosts = append(hosts, "*")
+				} else {
+					hosts = append(hosts, r.Host)
+				}
+			}
+			return []string{i.Name, strings.Join(hosts, ","), age(i.CreateTime)}
+		}),
+	newResource([]string{"secret", "secrets"}, "/secrets", true,
+		[]string{"NAME", "KEYS", "AGE"},
+		func(s *secret.Secret) []string {
+			return []string{s.Name, strconv.Itoa(len(s.Data)), age(s.CreateTime)}
+		}),
+	newResource([]string{"namespace", "namespaces", "ns"}, "/namespaces", false,
+		[]string{"NAME", "PHASE", "AGE"},
+		func(n *namespace.Namespace) []string {
+			return []string{n.Name, n.Status.Phase, age(n.CreateTime)}
+		}),
+	newResource([]string{"priorityclass", "priorityclasses", "pc"}, "/priorityclasses", false,
+		[]string{"NAME", "VALUE", "DEFAULT", "AGE"},
+		func(p *priority.PriorityClass) []string {
+			return []string{p.Name, strconv.Itoa(p.Value), strconv.FormatBool(p.GlobalDefault),
+				age(p.CreateTime)}
+		}),
+	newResource([]string{"node", "nodes"}, "/nodes", false, nodeHeader, nodeRow),
+	newResource([]string{"certificate", "certificates", "cert", "certs"}, "/pki/certificates", false,
+		[]string{"SERIAL", "NAME", "EXPIRES", "REVOKED"},
+		func(c *pki.Certificate) []string {
+			return []string{c.Serial, c.Name, c.NotAfter.Local().Format(time.DateTime),
+				strconv.FormatBool(c.Revoked)}
+		}),
+	newResource([]string{"rolebinding", "rolebindings", "rb"}, "/rolebindings", false,
+		[]string{"NAME", "ROLE", "NAMESPACE", "USERS", "GROUPS", "AGE"},
+		func(b *auth.RoleBinding) []string {
+			return []string{b.Name, b.Role, bindingScope(b), strings.Join(b.Users, ","),
+				strings.Join(b.Groups, ","), age(b.CreateTime)}
+		}),
+}
+
+// listPath returns the path of the objects of a kind in a namespace, or in
+// every namespace if ns is empty.
+func (r resource) listPath(ns string) string {
+	switch {
+	case !r.namespaced:
+		return r.path
+	case ns != "":
+		return "/namespaces/" + url.PathEscape(ns) + r.path
+	case r.path == "/tasks":
+		// The tasks of every namespace are listed under /task.
+		return "/task"
+	default:
+		return r.path
+	}
+}
+
+func findResource(name string) (resource, bool) {
+	for _, r := range resources {
+		for _, n := range r.names {
+			if strings.EqualFold(n, name) {
+				return r, true
+			}
+		}
+	}
+	return resource{}, false
+}
+
+var taskHeader = []string{"NAME", "ID", "STATE", "IMAGE", "AGE"}
+
+func taskRow(t *task.Task) []string {
+	return []string{t.Name, t.ID.String()[:8], t.State.String(), t.Image, age(t.SubmitTime)}
+}
+
+var nodeHeader = []string{"NAME", "STATUS", "TASKS", "CPU", "MEMORY", "LABELS", "API"}
+
+func nodeRow(n *node.Node) []string {
+	status := n.Status
+	if n.Unschedulable {
+		status += ",SchedulingDisabled"
+	}
+	return []string{n.Name, status, strconv.Itoa(n.TaskCount),
+		fmt.Sprintf("%.1f/%d", n.CpuAllocated, n.Cores),
+		fmt.Sprintf("%dMi/%dMi", n.MemoryAllocated/1024, n.Memory/1024),
+		labels(n.Labels), n.Api}
+}
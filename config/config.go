@@ -0,0 +1,250 @@
+// Package config reads the settings of the manager and worker modes from a
+// YAML file, environment variables and command-line flags, each overriding
+// the one before.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load fills c, a pointer to a config struct holding the defaults, from the
+// config file, then the environment, then the flags in args. The file is
+// named by the -config flag, or else by the environment variable
+// configEnv. Fields are tied to their environment variable and flag by the
+// env and flag struct tags.
+func Load(c any, name, configEnv string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := fs.String("config", os.Getenv(configEnv), "YAML config file (env "+configEnv+")")
+	flags := make(map[string]*rawFlag)
+	for _, f := range fields(reflect.ValueOf(c).Elem()) {
+		if f.flag == "" {
+			continue
+		}
+		r := &rawFlag{value: format(f.value), isBool: f.value.Kind() == reflect.Bool}
+		usage := f.usage
+		if f.env != "" {
+			usage += " (env " + f.env + ")"
+		}
+		fs.Var(r, f.flag, usage)
+		flags[f.flag] = r
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if *file != "" {
+		err := readFile(c, *file)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range fields(reflect.ValueOf(c).Elem()) {
+		if v, ok := os.LookupEnv(f.env); ok && f.env != "" && v != "" {
+			err := set(f.value, v)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %v", f.env, err)
+			}
+		}
+	}
+
+	var ferr error
+	fs.Visit(func(fl *flag.Flag) {
+		r, ok := flags[fl.Name]
+		if !ok || ferr != nil {
+			return
+		}
+		for _, f := range fields(reflect.ValueOf(c).Elem()) {
+			if f.flag == fl.Name {
+				if err := set(f.value, r.value); err != nil {
+					ferr = fmt.Errorf("invalid -%s: %v", fl.Name, err)
+				}
+			}
+		}
+	})
+	return ferr
+}
+
+func readFile(c any, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d := yaml.NewDecoder(f)
+	d.KnownFields(true)
+	err = d.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("reading %s: %v", file, err)
+	}
+	return nil
+}
+
+// rawFlag keeps the text of a flag until the file and environment have
+// been applied.
+type rawFlag struct {
+	value  string
+	isBool bool
+}
+
+func (r *rawFlag) String() string {
+	return r.value
+}
+
+func (r *rawFlag) Set(v string) error {
+	r.value = v
+	return nil
+}
+
+func (r *rawFlag) IsBoolFlag() bool {
+	return r.isBool
+}
+
+type field struct {
+	value reflect.Value
+	env   string
+	flag  string
+	usage string
+}
+
+// fields returns the settable fields of a config struct, including those
+// of nested structs.
+func fields(v reflect.Value) []field {
+	var fs []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Duration(0)) {
+			fs = append(fs, fields(fv)...)
+			continue
+		}
+		fs = append(fs, field{
+			value: fv,
+			env:   sf.Tag.Get("env"),
+			flag:  sf.Tag.Get("flag"),
+			usage: sf.Tag.Get("usage"),
+		})
+	}
+	return fs
+}
+
+// set parses s into a field. Maps are read as key1=value1,key2=value2 and
+// lists as comma separated values.
+func set(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", s)
+		}
+		v.SetBool(b)
+	case reflect.Map:
+		m := make(map[string]string)
+		for _, kv := range splitList(s) {
+			k, val, ok := strings.Cut(kv, "=")
+			if !ok || k == "" {
+				return fmt.Errorf("%q is not key=value", kv)
+			}
+			m[k] = val
+		}
+		v.Set(reflect.ValueOf(m))
+	case reflect.Slice:
+		v.Set(reflect.ValueOf(splitList(s)))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// format writes a field as set reads it, to show defaults in the usage.
+func format(v reflect.Value) string {
+	if v.IsZero() {
+		return ""
+	}
+	switch x := v.Interface().(type) {
+	case map[string]string:
+		var kv []string
+		for k, val := range x {
+			kv = append(kv, k+"="+val)
+		}
+		return strings.Join(kv, ",")
+	case []string:
+		return strings.Join(x, ",")
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+func checkPort(name string, port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("%s must be between 1 and 65535, not %d", name, port)
+	}
+	return nil
+}
+
+func checkInterval(name string, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("interval %s must be positive", name)
+	}
+	return nil
+}
+
+func checkStore(store, dataDir string) error {
+	switch store {
+	case "memory":
+		return nil
+	case "bolt":
+		if dataDir == "" {
+			return errors.New("dataDir is required with the bolt store")
+		}
+		return os.MkdirAll(dataDir, 0700)
+	default:
+		return fmt.Errorf("store must be memory or bolt, not %q", store)
+	}
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Manager is the configuration of the manager mode.
+type Manager struct {
+	Address   string `yaml:"address" env:"CUBE_MANAGER_HOST" flag:"address" usage:"address the API listens on; all interfaces if empty"`
+	Port      int    `yaml:"port" env:"CUBE_MANAGER_PORT" flag:"port" usage:"port of the API"`
+	JoinToken string `yaml:"joinToken" env:"CUBE_JOIN_TOKEN" flag:"join-token" usage:"token workers register with; generated if empty"`
+	Scheduler string `yaml:"scheduler" env:"CUBE_SCHEDULER" flag:"scheduler" usage:"scheduler: roundrobin or epvm"`
+	Store     string `yaml:"store" env:"CUBE_STORE" flag:"store" usage:"store: memory or bolt"`
+	DataDir   string `yaml:"dataDir" env:"CUBE_DATA_DIR" flag:"data-dir" usage:"directory of the bolt store"`
+	// IngressPort and DNSAddress enable the ingress proxy and the DNS
+	// server when set.
+	IngressPort int    `yaml:"ingressPort" env:"CUBE_INGRESS_PORT" flag:"ingress-port" usage:"port of the ingress proxy; disabled if 0"`
+	DNSAddress  string `yaml:"dnsAddress" env:"CUBE_DNS_ADDRESS" flag:"dns-address" usage:"address of the DNS server, such as :53; disabled if empty"`
+	// DNSForward are the networks of the clients whose queries for names
+	// outside the cluster domain are forwarded, so that the DNS server is
+	// not an open resolver.
+	DNSForward []string         `yaml:"dnsForward" env:"CUBE_DNS_FORWARD" flag:"dns-forward" usage:"networks of the clients, besides the nodes, whose DNS queries for other domains are forwarded"`
+	Intervals  ManagerIntervals `yaml:"intervals"`
+	TLS        TLS              `yaml:"tls"`
+	// CADir enables the built-in CA, which keeps its key pair in the
+	// directory. Unless tls names other files, the manager serves the API
+	// with a certificate of the CA, issued for Name and Hosts.
+	CADir        string        `yaml:"caDir" env:"CUBE_CA_DIR" flag:"ca-dir" usage:"directory of the built-in CA; disabled if empty"`
+	CertValidity time.Duration `yaml:"certValidity" env:"CUBE_CERT_VALIDITY" flag:"cert-validity" usage:"how long the certificates issued by the CA are valid for"`
+	Name         string        `yaml:"name" env:"CUBE_MANAGER_NAME" flag:"name" usage:"common name of the manager's certificate"`
+	Hosts        []string      `yaml:"hosts" env:"CUBE_MANAGER_HOSTS" flag:"hosts" usage:"host names and addresses of the manager's certificate; defaults to the host name and localhost"`
+	// Auth makes the API authenticate its callers and authorize them by
+	// their role bindings. AdminToken is a token with every permission.
+	Auth       bool   `yaml:"auth" env:"CUBE_AUTH" flag:"auth" usage:"require API tokens or client certificates and check role bindings"`
+	AdminToken string `yaml:"adminToken" env:"CUBE_ADMIN_TOKEN" flag:"admin-token" usage:"API token of the cluster admin; generated if empty with auth"`
+
+	issueCert  bool
+	dnsForward []*net.IPNet
+}
+
+type ManagerIntervals struct {
+	ProcessTasks time.Duration `yaml:"processTasks" flag:"process-interval" usage:"how often pending tasks are scheduled"`
+	UpdateTasks  time.Duration `yaml:"updateTasks" flag:"update-interval" usage:"how often task states are fetched from the workers"`
+	HealthChecks time.Duration `yaml:"healthChecks" flag:"health-interval" usage:"how often task health checks run"`
+	Reconcile    time.Duration `yaml:"reconcile" flag:"reconcile-interval" usage:"how often the controllers reconcile"`
+	NodeTimeout  time.Duration `yaml:"nodeTimeout" flag:"node-timeout" usage:"how long a node can miss heartbeats before it is NotReady"`
+	Certificates time.Duration `yaml:"certificates" flag:"cert-interval" usage:"how often the manager's certificate is checked for renewal"`
+}
+
+func DefaultManager() Manager {
+	return Manager{
+		Port:         5555,
+		Scheduler:    "roundrobin",
+		Store:        "memory",
+		CertValidity: 30 * 24 * time.Hour,
+		Name:         "cube-manager",
+		// Loopback and private networks, where the containers of the
+		// cluster query from.
+		DNSForward: []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12",
+			"192.168.0.0/16", "fc00::/7"},
+		Intervals: ManagerIntervals{
+			ProcessTasks: 10 * time.Second,
+			UpdateTasks:  15 * time.Second,
+			HealthChecks: 60 * time.Second,
+			Reconcile:    10 * time.Second,
+			NodeTimeout:  45 * time.Second,
+			Certificates: time.Hour,
+		},
+	}
+}
+
+// LoadManager reads the manager configuration from its file, named by
+// -config or CUBE_MANAGER_CONFIG, the environment and the flags in args,
+// and validates it.
+func LoadManager(args []string) (Manager, error) {
+	c := DefaultManager()
+	err := Load(&c, "manager", "CUBE_MANAGER_CONFIG", args)
+	if err != nil {
+		return c, err
+	}
+	return c, c.Validate()
+}
+
+func (c *Manager) Validate() error {
+	err := checkPort("port", c.Port)
+	if err != nil {
+		return err
+	}
+	if c.IngressPort != 0 {
+		err := checkPort("ingressPort", c.IngressPort)
+		if err != nil {
+			return err
+		}
+		if c.IngressPort == c.Port {
+			return fmt.Errorf("ingressPort and port must differ")
+		}
+	}
+	if c.Scheduler != "roundrobin" && c.Scheduler != "epvm" {
+		return fmt.Errorf("scheduler must be roundrobin or epvm, not %q", c.Scheduler)
+	}
+	err = checkStore(c.Store, c.DataDir)
+	if err != nil {
+		return err
+	}
+	err = c.checkCA()
+	if err != nil {
+		return err
+	}
+	err = c.TLS.Validate()
+	if err != nil {
+		return err
+	}
+	c.dnsForward = nil
+	for _, s := range c.DNSForward {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return fmt.Errorf("dnsForward: %v", err)
+		}
+		c.dnsForward = append(c.dnsForward, n)
+	}
+
+	i := c.Intervals
+	for name, d := range map[string]time.Duration{
+		"processTasks": i.ProcessTasks,
+		"updateTasks":  i.UpdateTasks,
+		"healthChecks": i.HealthChecks,
+		"reconcile":    i.Reconcile,
+		"nodeTimeout":  i.NodeTimeout,
+		"certificates": i.Certificates,
+		"certValidity": c.CertValidity,
+	} {
+		if err := checkInterval(name, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCA sets up the files of the built-in CA, if it is enabled, and the
+// names of the manager's certificate.
+func (c *Manager) checkCA() error {
+	c.issueCert = false
+	if c.CADir == "" {
+		return nil
+	}
+	if c.Name == "" {
+		return errors.New("name is required with the built-in CA")
+	}
+	err := os.MkdirAll(c.CADir, 0700)
+	if err != nil {
+		return err
+	}
+	if c.TLS.CA == "" {
+		c.TLS.CA = filepath.Join(c.CADir, "ca.pem")
+	}
+	if c.TLS.Cert == "" && c.TLS.Key == "" {
+		c.TLS.Cert = filepath.Join(c.CADir, "manager.pem")
+		c.TLS.Key = filepath.Join(c.CADir, "manager-key.pem")
+		c.issueCert = true
+	}
+	if len(c.Hosts) == 0 {
+		c.Hosts = []string{"localhost", "127.0.0.1"}
+		if host, err := os.Hostname(); err == nil {
+			c.Hosts = append(c.Hosts, host)
+		}
+		if c.Address != "" && c.Address != "0.0.0.0" && c.Address != "::" {
+			c.Hosts = append(c.Hosts, c.Address)
+		}
+	}
+	return nil
+}
+
+// DNSForwardNets returns the networks of DNSForward, once Validate has
+// parsed them.
+func (c *Manager) DNSForwardNets() []*net.IPNet {
+	return c.dnsForward
+}
+
+// IssuesCert reports whether the manager's certificate is issued by the
+// built-in CA, once Validate has run.
+func (c *Manager) IssuesCert() bool {
+	return c.issueCert
+}
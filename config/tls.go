@@ -0,0 +1,46 @@
+package config
+
+import (
+	"crypto/x509"
+	"cube/pki"
+	"errors"
+)
+
+// TLS names the certificate files of a node. The key pair serves the API
+// and is presented as the client certificate when calling the other
+// nodes, whose certificates are verified against the CA.
+type TLS struct {
+	Cert string `yaml:"cert" env:"CUBE_TLS_CERT" flag:"tls-cert" usage:"PEM certificate of the node; TLS is disabled if empty"`
+	Key  string `yaml:"key" env:"CUBE_TLS_KEY" flag:"tls-key" usage:"PEM private key of the certificate"`
+	CA   string `yaml:"ca" env:"CUBE_TLS_CA" flag:"tls-ca" usage:"PEM certificate of the cluster CA"`
+}
+
+// Enabled reports whether TLS is configured.
+func (t TLS) Enabled() bool {
+	return t.Cert != ""
+}
+
+// Validate checks that either all the files or none of them are set. The
+// files may not exist yet when they are issued by the cluster CA.
+func (t TLS) Validate() error {
+	if t.Cert == "" && t.Key == "" && t.CA == "" {
+		return nil
+	}
+	if t.Cert == "" || t.Key == "" || t.CA == "" {
+		return errors.New("tls needs cert, key and ca")
+	}
+	return nil
+}
+
+// Load reads the key pair and the CA.
+func (t TLS) Load() (*pki.KeyPair, *x509.CertPool, error) {
+	kp, err := pki.LoadKeyPair(t.Cert, t.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	pool, err := pki.LoadPool(t.CA)
+	if err != nil {
+		return nil, nil, err
+	}
+	return kp, pool, nil
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"cube/task"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Worker is the configuration of the worker mode.
+type Worker struct {
+	Name    string `yaml:"name" env:"CUBE_WORKER_NAME" flag:"name" usage:"node name; defaults to the host name"`
+	Address string `yaml:"address" env:"CUBE_WORKER_HOST" flag:"address" usage:"address the API listens on; all interfaces if empty"`
+	Port    int    `yaml:"port" env:"CUBE_WORKER_PORT" flag:"port" usage:"port of the API"`
+	// Advertise is the host:port the manager reaches the worker's API at.
+	Advertise string `yaml:"advertise" env:"CUBE_WORKER_ADVERTISE" flag:"advertise" usage:"host:port the manager reaches the API at; defaults to address:port"`
+	Manager   string `yaml:"manager" env:"CUBE_MANAGER" flag:"manager" usage:"host:port of the manager API"`
+	// ManagerName is the common name of the manager's certificate. Over
+	// TLS, the worker API only accepts requests from it.
+	ManagerName string            `yaml:"managerName" env:"CUBE_MANAGER_NAME" flag:"manager-name" usage:"common name of the manager's certificate"`
+	JoinToken   string            `yaml:"joinToken" env:"CUBE_JOIN_TOKEN" flag:"join-token" usage:"token to register with the manager"`
+	Store       string            `yaml:"store" env:"CUBE_STORE" flag:"store" usage:"store: memory or bolt"`
+	DataDir     string            `yaml:"dataDir" env:"CUBE_DATA_DIR" flag:"data-dir" usage:"directory of the bolt store"`
+	Runtime     string            `yaml:"runtime" env:"CUBE_RUNTIME" flag:"runtime" usage:"container runtime: docker"`
+	Labels      map[string]string `yaml:"labels" env:"CUBE_WORKER_LABELS" flag:"labels" usage:"node labels, as key1=value1,key2=value2"`
+	Taints      []string          `yaml:"taints" env:"CUBE_WORKER_TAINTS" flag:"taints" usage:"node taints, as key=value:Effect,key:Effect"`
+	// Nameserver is the cluster DNS server containers use as their
+	// resolver.
+	Nameserver string `yaml:"nameserver" env:"CUBE_WORKER_DNS" flag:"nameserver" usage:"IP address of the cluster DNS server for containers"`
+	// ServeServices runs the proxies of services served from the workers.
+	ServeServices bool            `yaml:"serveServices" env:"CUBE_SERVE_SERVICES" flag:"serve-services" usage:"run the proxies of services served from the workers"`
+	Intervals     WorkerIntervals `yaml:"intervals"`
+	TLS           TLS             `yaml:"tls"`
+	// BootstrapToken is a one-time join token to get a certificate from
+	// the manager's CA when the tls files don't exist yet. Without tls,
+	// they are kept in dataDir.
+	BootstrapToken string `yaml:"bootstrapToken" env:"CUBE_BOOTSTRAP_TOKEN" flag:"bootstrap-token" usage:"one-time token to get a certificate from the manager's CA"`
+	// CAHash pins the CA certificate fetched from the manager when the ca
+	// file doesn't exist yet.
+	CAHash string `yaml:"caHash" env:"CUBE_CA_HASH" flag:"ca-hash" usage:"sha256:<hex> hash of the manager's CA certificate"`
+
+	taints []task.Taint
+}
+
+type WorkerIntervals struct {
+	RunTasks     time.Duration `yaml:"runTasks" flag:"run-interval" usage:"how often queued tasks are started or stopped"`
+	UpdateTasks  time.Duration `yaml:"updateTasks" flag:"update-interval" usage:"how often container states are checked"`
+	Stats        time.Duration `yaml:"stats" flag:"stats-interval" usage:"how often node stats are collected"`
+	Heartbeat    time.Duration `yaml:"heartbeat" flag:"heartbeat-interval" usage:"how often heartbeats are sent to the manager"`
+	SyncServices time.Duration `yaml:"syncServices" flag:"services-interval" usage:"how often services are fetched from the manager"`
+	Certificates time.Duration `yaml:"certificates" flag:"cert-interval" usage:"how often the certificate is checked for renewal"`
+}
+
+func DefaultWorker() Worker {
+	return Worker{
+		Port:          5556,
+		Manager:       "localhost:5555",
+		ManagerName:   "cube-manager",
+		Store:         "memory",
+		Runtime:       "docker",
+		ServeServices: true,
+		Intervals: WorkerIntervals{
+			RunTasks:     10 * time.Second,
+			UpdateTasks:  15 * time.Second,
+			Stats:        15 * time.Second,
+			Heartbeat:    15 * time.Second,
+			SyncServices: 10 * time.Second,
+			Certificates: time.Hour,
+		},
+	}
+}
+
+// LoadWorker reads the worker configuration from its file, named by
+// -config or CUBE_WORKER_CONFIG, the environment and the flags in args,
+// and validates it.
+func LoadWorker(args []string) (Worker, error) {
+	c := DefaultWorker()
+	err := Load(&c, "worker", "CUBE_WORKER_CONFIG", args)
+	if err != nil {
+		return c, err
+	}
+	return c, c.Validate()
+}
+
+// Validate checks the configuration and fills in the name and advertised
+// address when they are not set.
+func (c *Worker) Validate() error {
+	if c.Name == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return errors.New("name is required")
+		}
+		c.Name = host
+	}
+	err := checkPort("port", c.Port)
+	if err != nil {
+		return err
+	}
+	if c.Advertise == "" {
+		host := c.Address
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host, err = os.Hostname()
+			if err != nil {
+				return errors.New("advertise is required")
+			}
+		}
+		c.Advertise = net.JoinHostPort(host, strconv.Itoa(c.Port))
+	}
+	if _, _, err := net.SplitHostPort(c.Advertise); err != nil {
+		return fmt.Errorf("advertise must be host:port: %v", err)
+	}
+
+	c.Manager = strings.TrimPrefix(c.Manager, "http://")
+	c.Manager = strings.TrimSuffix(strings.TrimPrefix(c.Manager, "https://"), "/")
+	if _, _, err := net.SplitHostPort(c.Manager); err != nil {
+		return fmt.Errorf("manager must be host:port: %v", err)
+	}
+	if c.JoinToken == "" {
+		return errors.New("joinToken is required to register with the manager")
+	}
+	err = checkStore(c.Store, c.DataDir)
+	if err != nil {
+		return err
+	}
+	if c.Runtime != "docker" {
+		return fmt.Errorf("runtime must be docker, not %q", c.Runtime)
+	}
+	if c.BootstrapToken != "" && !c.TLS.Enabled() {
+		if c.DataDir == "" {
+			return errors.New("bootstrapToken needs tls files or a dataDir to keep them in")
+		}
+		err := os.MkdirAll(c.DataDir, 0700)
+		if err != nil {
+			return err
+		}
+		c.TLS = TLS{
+			Cert: filepath.Join(c.DataDir, c.Name+".pem"),
+			Key:  filepath.Join(c.DataDir, c.Name+"-key.pem"),
+			CA:   filepath.Join(c.DataDir, "ca.pem"),
+		}
+	}
+	err = c.TLS.Validate()
+	if err != nil {
+		return err
+	}
+	if c.TLS.Enabled() && c.ManagerName == "" {
+		return errors.New("managerName is required with tls")
+	}
+
+	c.taints = nil
+	for _, s := range c.Taints {
+		t, err := parseTaint(s)
+		if err != nil {
+			return err
+		}
+		c.taints = append(c.taints, t)
+	}
+
+	i := c.Intervals
+	for name, d := range map[string]time.Duration{
+		"runTasks":     i.RunTasks,
+		"updateTasks":  i.UpdateTasks,
+		"stats":        i.Stats,
+		"heartbeat":    i.Heartbeat,
+		"syncServices": i.SyncServices,
+		"certificates": i.Certificates,
+	} {
+		if err := checkInterval(name, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ManagerURL returns the base URL of the manager API.
+func (c *Worker) ManagerURL() string {
+	if c.TLS.Enabled() {
+		return "https://" + c.Manager
+	}
+	return "http://" + c.Manager
+}
+
+// NodeTaints returns the taints of the node, once Validate has parsed them.
+func (c *Worker) NodeTaints() []task.Taint {
+	return c.taints
+}
+
+// parseTaint reads a taint in the form key=value:Effect or key:Effect.
+func parseTaint(s string) (task.Taint, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return task.Taint{}, fmt.Errorf("taint %q has no effect", s)
+	}
+	kv, effect := s[:i], s[i+1:]
+	k, v, hasValue := strings.Cut(kv, "=")
+	if hasValue && v == "" {
+		return task.Taint{}, fmt.Errorf("taint %q has an empty value", s)
+	}
+	t := task.Taint{Key: k, Value: v, Effect: task.TaintEffect(effect)}
+	err := t.Validate()
+	if err != nil {
+		return t, fmt.Errorf("taint %q: %v", s, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"cube/task"
+	"testing"
+)
+
+func TestParseTaint(t *testing.T) {
+	tests := []struct {
+		in   string
+		want task.Taint
+	}{
+		{"gpu=true:NoSchedule", task.Taint{Key: "gpu", Value: "true", Effect: task.NoSchedule}},
+		{"dedicated:NoExecute", task.Taint{Key: "dedicated", Effect: task.NoExecute}},
+		{"cube.io/zone=eu-1:PreferNoSchedule", task.Taint{Key: "cube.io/zone", Value: "eu-1", Effect: task.PreferNoSchedule}},
+	}
+	for _, tt := range tests {
+		got, err := parseTaint(tt.in)
+		if err != nil {
+			t.Errorf("parseTaint(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseTaint(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseTaintRejectsMalformed(t *testing.T) {
+	for _, in := range []string{
+		"gpu",
+		"gpu=true",
+		"gpu=:NoSchedule",
+		"=true:NoSchedule",
+		":NoSchedule",
+		"gpu=true:",
+		"gpu=true:Never",
+		"gpu=a:b:NoSchedule",
+		"gpu=x=y:NoSchedule",
+		"my key=true:NoSchedule",
+		"-gpu:NoSchedule",
+	} {
+		if taint, err := parseTaint(in); err == nil {
+			t.Errorf("parseTaint(%q) = %+v, want an error", in, taint)
+		}
+	}
+}
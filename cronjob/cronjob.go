@@ -0,0 +1,135 @@
+package cronjob
+
+import (
+	"cube/job"
+	"cube/task"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Concurrency policies decide what happens when a run is due while the
+// previous one is still active.
+const (
+	// Allow starts the new run alongside the active ones.
+	Allow = "Allow"
+	// Forbid skips the new run.
+	Forbid = "Forbid"
+	// Replace stops the active runs and starts the new one.
+	Replace = "Replace"
+)
+
+// CronJob starts a task or a job on a cron schedule. Exactly one of
+// TaskTemplate and JobTemplate must be set.
+type CronJob struct {
+	Name      string
+	Namespace string
+	Schedule  string
+	// TimeZone is the IANA time zone the schedule is read in. It defaults
+	// to UTC.
+	TimeZone          string
+	ConcurrencyPolicy string
+	// StartingDeadlineSeconds is how late a run may start, for example
+	// after the manager was down. Later runs are skipped. Zero means runs
+	// are always started.
+	StartingDeadlineSeconds int
+	// SuccessfulHistoryLimit and FailedHistoryLimit are how many finished
+	// runs are kept. They default to 3 and 1.
+	SuccessfulHistoryLimit int
+	FailedHistoryLimit     int
+	TaskTemplate           *task.Task
+	JobTemplate            *job.Job
+	CreateTime             time.Time
+	Status                 Status
+}
+
+type Status struct {
+	// LastScheduleTime is the time of the last run that was due, whether
+	// or not it was started.
+	LastScheduleTime time.Time
+	// LastStartTime is the time the last run was started.
+	LastStartTime time.Time
+	// Active names the tasks or jobs of the runs that haven't finished.
+	Active []string
+	// MissedRuns counts the runs that were skipped.
+	MissedRuns int
+	// AdmissionError is why the last run could not be started, for example
+	// because its task was not admitted over a quota.
+	AdmissionError string
+}
+
+func (c *CronJob) SetDefaults() {
+	if c.ConcurrencyPolicy == "" {
+		c.ConcurrencyPolicy = Allow
+	}
+	if c.TimeZone == "" {
+		c.TimeZone = "UTC"
+	}
+	if c.SuccessfulHistoryLimit == 0 {
+		c.SuccessfulHistoryLimit = 3
+	}
+	if c.FailedHistoryLimit == 0 {
+		c.FailedHistoryLimit = 1
+	}
+}
+
+func (c *CronJob) Validate() error {
+	if c.Name == "" {
+		return errors.New("cron job name must not be empty")
+	}
+	if _, err := ParseSchedule(c.Schedule); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(c.TimeZone); err != nil {
+		return fmt.Errorf("unknown time zone %q", c.TimeZone)
+	}
+	switch c.ConcurrencyPolicy {
+	case "", Allow, Forbid, Replace:
+	default:
+		return fmt.Errorf("unknown concurrency policy %q", c.ConcurrencyPolicy)
+	}
+	if c.StartingDeadlineSeconds < 0 || c.SuccessfulHistoryLimit < 0 || c.FailedHistoryLimit < 0 {
+		return fmt.Errorf("deadline and history limits of cron job %s must not be negative", c.Name)
+	}
+	if (c.TaskTemplate == nil) == (c.JobTemplate == nil) {
+		return fmt.Errorf("cron job %s needs exactly one of a task template and a job template", c.Name)
+	}
+	if c.TaskTemplate != nil {
+		return c.TaskTemplate.Validate()
+	}
+	j := *c.JobTemplate
+	j.Name = c.Name
+	return j.Validate()
+}
+
+// Owner is the value of task.Task.Owner and job.Job.Owner for the runs of
+// the cron job.
+func (c *CronJob) Owner() string {
+	return "cronjob/" + c.Name
+}
+
+// LastMissed returns the most recent time at or before now that the job
+// was due to run, after its last scheduled run or creation, and how many
+// due times it found. It returns the zero time if no run is due.
+func (c *CronJob) LastMissed(now time.Time) (time.Time, int, error) {
+	s, err := ParseSchedule(c.Schedule)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	since := c.Status.LastScheduleTime
+	if since.IsZero() {
+		since = c.CreateTime
+	}
+	var last time.Time
+	count := 0
+	for t := s.Next(since.In(loc)); !t.IsZero() && !t.After(now); t = s.Next(t) {
+		last = t
+		count++
+	}
+	return last, count, nil
+}
@@ -0,0 +1,231 @@
+package deployment
+
+import (
+	"cube/task"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Rollout strategies.
+const (
+	// RollingUpdate replaces tasks gradually, within the MaxSurge and
+	// MaxUnavailable limits.
+	RollingUpdate = "RollingUpdate"
+	// Recreate stops every old task before starting new ones.
+	Recreate = "Recreate"
+)
+
+// RevisionLabel is set on every task created by a deployment to the number
+// of the revision whose template it was built from.
+const RevisionLabel = "cube/revision"
+
+const defaultRevisionHistoryLimit = 10
+
+// Deployment keeps Replicas copies of its Template running. The tasks it
+// owns are the ones whose labels match Selector.
+type Deployment struct {
+	Name      string
+	Namespace string
+	Replicas  int
+	Selector  map[string]string
+	Template  task.Task
+	Strategy  Strategy
+	// RevisionHistoryLimit is how many old revisions are kept for rollback.
+	RevisionHistoryLimit int
+	Revision             int
+	Revisions            []Revision
+	CreateTime           time.Time
+	Status               Status
+}
+
+// Strategy controls how tasks are replaced when the template changes. When
+// both limits are zero, MaxSurge defaults to 1.
+type Strategy struct {
+	Type string
+	// MaxSurge is how many tasks may exist above Replicas during a rollout.
+	MaxSurge int
+	// MaxUnavailable is how many tasks may be unavailable during a rollout.
+	MaxUnavailable int
+}
+
+type Revision struct {
+	Number     int
+	Template   task.Task
+	CreateTime time.Time
+}
+
+type Status struct {
+	// Replicas is the number of tasks that are pending, scheduled or
+	// running.
+	Replicas int
+	// UpdatedReplicas is the number of active tasks of the current revision.
+	UpdatedReplicas int
+	ReadyReplicas   int
+	// AvailableReplicas is the number of running tasks that passed their
+	// health check.
+	AvailableReplicas int
+	FailedTasks       int
+	Revision          int
+	RolloutComplete   bool
+	// AdmissionError is why the last task the deployment tried to create
+	// was not admitted, for example because of a quota. It is cleared once
+	// tasks are admitted again.
+	AdmissionError string
+}
+
+// RolloutStatus describes the progress of the latest rollout.
+type RolloutStatus struct {
+	Deployment        string
+	Revision          int
+	Replicas          int
+	UpdatedReplicas   int
+	AvailableReplicas int
+	OldReplicas       int
+	Complete          bool
+	Message           string
+}
+
+func (d *Deployment) Validate() error {
+	if d.Name == "" {
+		return errors.New("deployment name must not be empty")
+	}
+	if d.Replicas < 0 {
+		return fmt.Errorf("deployment %s has a negative replica count", d.Name)
+	}
+	if len(d.Selector) == 0 {
+		return fmt.Errorf("deployment %s needs a selector", d.Name)
+	}
+	if !d.Matches(d.Template.Labels) {
+		return fmt.Errorf("template labels of deployment %s don't match its selector", d.Name)
+	}
+	switch d.Strategy.Type {
+	case "", RollingUpdate, Recreate:
+	default:
+		return fmt.Errorf("unknown strategy %q for deployment %s", d.Strategy.Type, d.Name)
+	}
+	if d.Strategy.MaxSurge < 0 || d.Strategy.MaxUnavailable < 0 {
+		return fmt.Errorf("strategy limits of deployment %s must not be negative", d.Name)
+	}
+	if d.RevisionHistoryLimit < 0 {
+		return fmt.Errorf("deployment %s has a negative revision history limit", d.Name)
+	}
+	return d.Template.Validate()
+}
+
+// Matches reports whether the labels are selected by the deployment.
+func (d *Deployment) Matches(labels map[string]string) bool {
+	for k, v := range d.Selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Owner is the value of task.Task.Owner for the tasks of the deployment.
+func (d *Deployment) Owner() string {
+	return "deployment/" + d.Name
+}
+
+// Limits returns the surge and unavailability limits of a rolling update.
+func (d *Deployment) Limits() (maxSurge, maxUnavailable int) {
+	if d.Strategy.MaxSurge == 0 && d.Strategy.MaxUnavailable == 0 {
+		return 1, 0
+	}
+	return d.Strategy.MaxSurge, d.Strategy.MaxUnavailable
+}
+
+// SetTemplate makes template the current revision, unless it is the same
+// as the current one. It reports whether a new revision was created.
+func (d *Deployment) SetTemplate(template task.Task, now time.Time) bool {
+	if d.Revision > 0 && sameTemplate(d.Template, template) {
+		return false
+	}
+
+	d.Revision++
+	for _, r := range d.Revisions {
+		if r.Number >= d.Revision {
+			d.Revision = r.Number + 1
+		}
+	}
+	d.Template = template
+	// A template that is rolled back to moves to the top of the history.
+	history := d.Revisions[:0:0]
+	for _, r := range d.Revisions {
+		if !sameTemplate(r.Template, template) {
+			history = append(history, r)
+		}
+	}
+	d.Revisions = append(history, Revision{
+		Number:     d.Revision,
+		Template:   template,
+		CreateTime: now,
+	})
+
+	limit := d.RevisionHistoryLimit
+	if limit == 0 {
+		limit = defaultRevisionHistoryLimit
+	}
+	// Keep the current revision on top of the history limit.
+	if len(d.Revisions) > limit+1 {
+		d.Revisions = d.Revisions[len(d.Revisions)-limit-1:]
+	}
+	return true
+}
+
+// FindRevision returns a revision from the history. Number 0 means the
+// revision before the current one.
+func (d *Deployment) FindRevision(number int) (Revision, error) {
+	if number == 0 {
+		for i := len(d.Revisions) - 1; i >= 0; i-- {
+			if d.Revisions[i].Number < d.Revision {
+				return d.Revisions[i], nil
+			}
+		}
+		return Revision{}, fmt.Errorf("deployment %s has no previous revision", d.Name)
+	}
+	for _, r := range d.Revisions {
+		if r.Number == number {
+			return r, nil
+		}
+	}
+	return Revision{}, fmt.Errorf("deployment %s has no revision %d", d.Name, number)
+}
+
+func (d *Deployment) RolloutStatus() *RolloutStatus {
+	rs := &RolloutStatus{
+		Deployment:        d.Name,
+		Revision:          d.Revision,
+		Replicas:          d.Replicas,
+		UpdatedReplicas:   d.Status.UpdatedReplicas,
+		AvailableReplicas: d.Status.AvailableReplicas,
+		OldReplicas:       d.Status.Replicas - d.Status.UpdatedReplicas,
+		Complete:          d.Status.RolloutComplete && d.Status.Revision == d.Revision,
+	}
+	switch {
+	case rs.Complete:
+		rs.Message = fmt.Sprintf("Revision %d has been rolled out", d.Revision)
+	case rs.UpdatedReplicas < d.Replicas:
+		rs.Message = fmt.Sprintf("%d of %d tasks have been updated", rs.UpdatedReplicas, d.Replicas)
+	case rs.OldReplicas > 0:
+		rs.Message = fmt.Sprintf("%d old tasks are waiting to be stopped", rs.OldReplicas)
+	default:
+		rs.Message = fmt.Sprintf("%d of %d updated tasks are available", rs.AvailableReplicas, d.Replicas)
+	}
+	return rs
+}
+
+// TaskRevision returns the revision a task of the deployment was built from.
+func TaskRevision(t *task.Task) int {
+	n, _ := strconv.Atoi(t.Labels[RevisionLabel])
+	return n
+}
+
+func sameTemplate(a, b task.Task) bool {
+	da, errA := json.Marshal(a)
+	db, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(da) == string(db)
+}
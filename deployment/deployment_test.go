@@ -0,0 +1,101 @@
+package deployment
+
+import (
+	"cube/task"
+	"slices"
+	"testing"
+	"time"
+)
+
+func template(image string) task.Task {
+	return task.Task{Image: image, Labels: map[string]string{"app": "web"}}
+}
+
+func revisionNumbers(d *Deployment) []int {
+	var numbers []int
+	for _, r := range d.Revisions {
+		numbers = append(numbers, r.Number)
+	}
+	return numbers
+}
+
+func TestSetTemplate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		limit     int
+		images    []string
+		revision  int
+		revisions []int
+	}{
+		{"first", 0, []string{"v1"}, 1, []int{1}},
+		{"same template", 0, []string{"v1", "v1"}, 1, []int{1}},
+		{"new templates", 0, []string{"v1", "v2", "v3"}, 3, []int{1, 2, 3}},
+		{"trimmed", 2, []string{"v1", "v2", "v3", "v4", "v5"}, 5, []int{3, 4, 5}},
+		{"default limit", 0, []string{"v1", "v2", "v3", "v4", "v5", "v6", "v7", "v8", "v9", "v10", "v11", "v12"},
+			12, []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}},
+		// A template used before moves to the top under a new number.
+		{"earlier template", 0, []string{"v1", "v2", "v3", "v1"}, 4, []int{2, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Deployment{Name: "web", RevisionHistoryLimit: tt.limit}
+			for i, image := range tt.images {
+				changed := d.SetTemplate(template(image), now)
+				if want := i == 0 || image != tt.images[i-1]; changed != want {
+					t.Errorf("SetTemplate(%s) = %v, want %v", image, changed, want)
+				}
+			}
+			if d.Revision != tt.revision {
+				t.Errorf("revision %d, want %d", d.Revision, tt.revision)
+			}
+			if got := revisionNumbers(d); !slices.Equal(got, tt.revisions) {
+				t.Errorf("revisions %v, want %v", got, tt.revisions)
+			}
+			if last := tt.images[len(tt.images)-1]; d.Template.Image != last {
+				t.Errorf("template image %s, want %s", d.Template.Image, last)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := &Deployment{Name: "web"}
+	for _, image := range []string{"v1", "v2", "v3"} {
+		d.SetTemplate(template(image), now)
+	}
+
+	prev, err := d.FindRevision(0)
+	if err != nil || prev.Number != 2 || prev.Template.Image != "v2" {
+		t.Fatalf("FindRevision(0) = %d %s, %v; want revision 2 with v2", prev.Number, prev.Template.Image, err)
+	}
+	first, err := d.FindRevision(1)
+	if err != nil || first.Template.Image != "v1" {
+		t.Fatalf("FindRevision(1) = %s, %v; want v1", first.Template.Image, err)
+	}
+	if _, err := d.FindRevision(7); err == nil {
+		t.Error("FindRevision found a revision that doesn't exist")
+	}
+
+	// Rolling back to revision 1 makes its template revision 4.
+	if !d.SetTemplate(first.Template, now) {
+		t.Fatal("rollback did not create a revision")
+	}
+	if d.Revision != 4 || d.Template.Image != "v1" {
+		t.Errorf("after rollback: revision %d with %s, want 4 with v1", d.Revision, d.Template.Image)
+	}
+	if got := revisionNumbers(d); !slices.Equal(got, []int{2, 3, 4}) {
+		t.Errorf("revisions after rollback %v, want [2 3 4]", got)
+	}
+	prev, err = d.FindRevision(0)
+	if err != nil || prev.Template.Image != "v3" {
+		t.Errorf("previous revision after rollback is %s, %v; want v3", prev.Template.Image, err)
+	}
+
+	single := &Deployment{Name: "web"}
+	single.SetTemplate(template("v1"), now)
+	if _, err := single.FindRevision(0); err == nil {
+		t.Error("FindRevision(0) found a previous revision of a new deployment")
+	}
+}
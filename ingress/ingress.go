@@ -0,0 +1,127 @@
+package ingress
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Ingress routes HTTP requests that reach the manager's ingress port to
+// tasks, by Host header and path prefix.
+type Ingress struct {
+	Name       string
+	Namespace  string
+	Rules      []Rule
+	CreateTime time.Time
+}
+
+// Rule sends the requests matching Host and PathPrefix to the running and
+// healthy tasks whose labels match Selector.
+type Rule struct {
+	// Host is matched against the Host header. It may start with "*." to
+	// match any subdomain, and matches every host when empty.
+	Host string
+	// PathPrefix defaults to "/".
+	PathPrefix string
+	// RewritePrefix replaces PathPrefix in the path sent to the task.
+	RewritePrefix string
+	Selector      map[string]string
+	// TargetPort is the container port requests are sent to, such as
+	// "80/tcp". It defaults to the first published port of each task.
+	TargetPort string
+	// StickySessions sends the requests of a client to the same task for as
+	// long as it stays available, using a cookie.
+	StickySessions bool
+}
+
+func (i *Ingress) SetDefaults() {
+	for n := range i.Rules {
+		r := &i.Rules[n]
+		r.Host = strings.ToLower(r.Host)
+		if r.PathPrefix == "" {
+			r.PathPrefix = "/"
+		}
+		if r.TargetPort != "" && !strings.Contains(r.TargetPort, "/") {
+			r.TargetPort += "/tcp"
+		}
+	}
+}
+
+func (i *Ingress) Validate() error {
+	if i.Name == "" {
+		return errors.New("ingress name must not be empty")
+	}
+	if len(i.Rules) == 0 {
+		return fmt.Errorf("ingress %s needs at least one rule", i.Name)
+	}
+	for n, r := range i.Rules {
+		if strings.Contains(strings.TrimPrefix(r.Host, "*."), "*") || strings.ContainsAny(r.Host, "/: ") {
+			return fmt.Errorf("rule %d of ingress %s has an invalid host %q", n, i.Name, r.Host)
+		}
+		if !strings.HasPrefix(r.PathPrefix, "/") {
+			return fmt.Errorf("path prefix %q of ingress %s must start with /", r.PathPrefix, i.Name)
+		}
+		if r.RewritePrefix != "" && !strings.HasPrefix(r.RewritePrefix, "/") {
+			return fmt.Errorf("rewrite prefix %q of ingress %s must start with /", r.RewritePrefix, i.Name)
+		}
+		if len(r.Selector) == 0 {
+			return fmt.Errorf("rule %d of ingress %s needs a selector", n, i.Name)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the rule selects the labels.
+func (r *Rule) Matches(labels map[string]string) bool {
+	for k, v := range r.Selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Rule) matchesHost(host string) bool {
+	switch {
+	case r.Host == "":
+		return true
+	case strings.HasPrefix(r.Host, "*."):
+		return strings.HasSuffix(host, r.Host[1:]) && len(host) > len(r.Host)-1
+	default:
+		return host == r.Host
+	}
+}
+
+func (r *Rule) matchesPath(path string) bool {
+	if !strings.HasPrefix(path, r.PathPrefix) {
+		return false
+	}
+	// "/api" matches "/api" and "/api/users" but not "/apis".
+	return strings.HasSuffix(r.PathPrefix, "/") || len(path) == len(r.PathPrefix) ||
+		path[len(r.PathPrefix)] == '/'
+}
+
+// rewrite replaces the rule's path prefix with its rewrite prefix.
+func (r *Rule) rewrite(path string) string {
+	if r.RewritePrefix == "" {
+		return path
+	}
+	rest := strings.TrimPrefix(path, r.PathPrefix)
+	if rest == "" {
+		return r.RewritePrefix
+	}
+	return strings.TrimSuffix(r.RewritePrefix, "/") + "/" + strings.TrimPrefix(rest, "/")
+}
+
+// hostRank orders rules from the most to the least specific host.
+func (r *Rule) hostRank() int {
+	switch {
+	case r.Host == "":
+		return 0
+	case strings.HasPrefix(r.Host, "*."):
+		return 1
+	default:
+		return 2
+	}
+}
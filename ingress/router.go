@@ -0,0 +1,246 @@
+package ingress
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	stickyCookie = "cube-ingress"
+	// An endpoint is ejected for ejectionTime after maxFailures requests to
+	// it failed in a row.
+	maxFailures    = 3
+	ejectionTime   = 30 * time.Second
+	backendTimeout = 5 * time.Second
+)
+
+type targetKey struct{}
+
+// target is where a request is proxied to.
+type target struct {
+	addr string
+	path string
+}
+
+type route struct {
+	ingress   string
+	rule      Rule
+	endpoints []string
+	next      int
+}
+
+type endpointHealth struct {
+	failures     int
+	ejectedUntil time.Time
+}
+
+// Router is an http.Handler that proxies requests according to the rules
+// of a set of ingresses. It ejects endpoints that keep failing for a while.
+type Router struct {
+	mu     sync.Mutex
+	routes []*route
+	health map[string]*endpointHealth
+	proxy  *httputil.ReverseProxy
+}
+
+func NewRouter() *Router {
+	r := &Router{health: make(map[string]*endpointHealth)}
+	r.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			t := pr.In.Context().Value(targetKey{}).(target)
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = t.addr
+			pr.Out.URL.Path = t.path
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = pr.In.Host
+			pr.SetXForwarded()
+		},
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{Timeout: backendTimeout}).DialContext,
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			t := resp.Request.Context().Value(targetKey{}).(target)
+			r.report(t.addr, resp.StatusCode < http.StatusBadGateway ||
+				resp.StatusCode > http.StatusGatewayTimeout)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			t := req.Context().Value(targetKey{}).(target)
+			log.Printf("Ingress request to %s failed: %v\n", t.addr, err)
+			r.report(t.addr, false)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	return r
+}
+
+// Update replaces the routes of the router. endpoints returns the addresses
+// of the tasks a rule sends requests to.
+func (r *Router) Update(ingresses []*Ingress, endpoints func(*Ingress, Rule) []string) {
+	var routes []*route
+	for _, i := range ingresses {
+		for _, rule := range i.Rules {
+			routes = append(routes, &route{
+				ingress:   i.Namespace + "/" + i.Name,
+				rule:      rule,
+				endpoints: endpoints(i, rule),
+			})
+		}
+	}
+	// The most specific host wins, then the longest path prefix.
+	sort.SliceStable(routes, func(a, b int) bool {
+		ra, rb := routes[a].rule, routes[b].rule
+		if ra.hostRank() != rb.hostRank() {
+			return ra.hostRank() > rb.hostRank()
+		}
+		return len(ra.PathPrefix) > len(rb.PathPrefix)
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Keep the round-robin position of routes that didn't change.
+	for _, old := range r.routes {
+		for _, rt := range routes {
+			if rt.ingress == old.ingress && rt.rule.Host == old.rule.Host &&
+				rt.rule.PathPrefix == old.rule.PathPrefix {
+				rt.next = old.next
+			}
+		}
+	}
+	r.routes = routes
+
+	live := make(map[string]bool)
+	for _, rt := range routes {
+		for _, e := range rt.endpoints {
+			live[e] = true
+		}
+	}
+	for addr := range r.health {
+		if !live[addr] {
+			delete(r.health, addr)
+		}
+	}
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := strings.ToLower(req.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	r.mu.Lock()
+	var rt *route
+	for _, candidate := range r.routes {
+		if candidate.rule.matchesHost(host) && candidate.rule.matchesPath(req.URL.Path) {
+			rt = candidate
+			break
+		}
+	}
+	if rt == nil {
+		r.mu.Unlock()
+		http.NotFound(w, req)
+		return
+	}
+
+	addr := ""
+	if rt.rule.StickySessions {
+		if c, err := req.Cookie(stickyCookie); err == nil {
+			addr = r.findEndpoint(rt, c.Value)
+		}
+	}
+	if addr == "" {
+		addr = r.pickEndpoint(rt)
+		if addr != "" && rt.rule.StickySessions {
+			http.SetCookie(w, &http.Cookie{
+				Name:     stickyCookie,
+				Value:    endpointID(addr),
+				Path:     rt.rule.PathPrefix,
+				HttpOnly: true,
+			})
+		}
+	}
+	path := rt.rule.rewrite(req.URL.Path)
+	name := rt.ingress
+	r.mu.Unlock()
+
+	if addr == "" {
+		http.Error(w, fmt.Sprintf("ingress %s has no available endpoints", name), http.StatusServiceUnavailable)
+		return
+	}
+	ctx := context.WithValue(req.Context(), targetKey{}, target{addr: addr, path: path})
+	r.proxy.ServeHTTP(w, req.WithContext(ctx))
+}
+
+// pickEndpoint returns the next endpoint of the route in round-robin order
+// that isn't ejected. If all are ejected, it returns the next one anyway.
+func (r *Router) pickEndpoint(rt *route) string {
+	if len(rt.endpoints) == 0 {
+		return ""
+	}
+	now := time.Now()
+	for i := 0; i < len(rt.endpoints); i++ {
+		rt.next = (rt.next + 1) % len(rt.endpoints)
+		addr := rt.endpoints[rt.next]
+		if !r.ejected(addr, now) {
+			return addr
+		}
+	}
+	rt.next = (rt.next + 1) % len(rt.endpoints)
+	return rt.endpoints[rt.next]
+}
+
+// findEndpoint returns the endpoint of the route with the given sticky
+// session ID, if it is still available.
+func (r *Router) findEndpoint(rt *route, id string) string {
+	for _, addr := range rt.endpoints {
+		if endpointID(addr) == id && !r.ejected(addr, time.Now()) {
+			return addr
+		}
+	}
+	return ""
+}
+
+func (r *Router) ejected(addr string, now time.Time) bool {
+	h, ok := r.health[addr]
+	return ok && now.Before(h.ejectedUntil)
+}
+
+// report records the outcome of a request to an endpoint.
+func (r *Router) report(addr string, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, found := r.health[addr]
+	if !found {
+		h = &endpointHealth{}
+		r.health[addr] = h
+	}
+	if ok {
+		h.failures = 0
+		return
+	}
+	h.failures++
+	if h.failures >= maxFailures {
+		log.Printf("Ejecting ingress endpoint %s for %v after %d failures\n", addr, ejectionTime, h.failures)
+		h.ejectedUntil = time.Now().Add(ejectionTime)
+		h.failures = 0
+	}
+}
+
+// endpointID identifies an endpoint in a sticky session cookie without
+// revealing its address.
+func endpointID(addr string) string {
+	h := fnv.New64a()
+	h.Write([]byte(addr))
+	return fmt.Sprintf("%x", h.Sum64())
+}
@@ -0,0 +1,154 @@
+package ingress
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// backend starts a server that answers with its name and the path it got.
+func backend(t *testing.T, name string) string {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+	}))
+	t.Cleanup(s.Close)
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+func get(t *testing.T, r *Router, host, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "http://"+host+path, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func body(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	b, _ := io.ReadAll(w.Result().Body)
+	return string(b)
+}
+
+func update(r *Router, rules []Rule, endpoints map[string][]string) {
+	r.Update([]*Ingress{{Name: "web", Namespace: "default", Rules: rules}},
+		func(_ *Ingress, rule Rule) []string {
+			return endpoints[rule.Host+rule.PathPrefix]
+		})
+}
+
+func TestRouterPicksTheMostSpecificRule(t *testing.T) {
+	r := NewRouter()
+	catchAll, api, exact, wild := backend(t, "any"), backend(t, "api"), backend(t, "exact"), backend(t, "wild")
+	update(r, []Rule{
+		{PathPrefix: "/"},
+		{PathPrefix: "/api"},
+		{Host: "shop.example.com", PathPrefix: "/"},
+		{Host: "*.example.com", PathPrefix: "/"},
+	}, map[string][]string{
+		"/":                 {catchAll},
+		"/api":              {api},
+		"shop.example.com/": {exact},
+		"*.example.com/":    {wild},
+	})
+
+	tests := []struct {
+		host, path, want string
+	}{
+		{"other.org", "/", "any /"},
+		{"other.org", "/api/users", "api /api/users"},
+		{"shop.example.com:8080", "/api", "exact /api"},
+		{"blog.example.com", "/", "wild /"},
+		{"example.com", "/", "any /"},
+	}
+	for _, tt := range tests {
+		w := get(t, r, tt.host, tt.path)
+		if got := body(t, w); got != tt.want {
+			t.Errorf("%s%s went to %q, want %q", tt.host, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRouterRewritesPrefix(t *testing.T) {
+	r := NewRouter()
+	b := backend(t, "b")
+	update(r, []Rule{{PathPrefix: "/app", RewritePrefix: "/"}}, map[string][]string{"/app": {b}})
+
+	if got := body(t, get(t, r, "x", "/app/index.html")); got != "b /index.html" {
+		t.Errorf("rewritten request reached %q, want %q", got, "b /index.html")
+	}
+	if w := get(t, r, "x", "/other"); w.Code != http.StatusNotFound {
+		t.Errorf("unmatched path got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestRouterRoundRobin(t *testing.T) {
+	r := NewRouter()
+	a, b := backend(t, "a"), backend(t, "b")
+	update(r, []Rule{{PathPrefix: "/"}}, map[string][]string{"/": {a, b}})
+
+	seen := map[string]int{}
+	for range 4 {
+		seen[strings.Fields(body(t, get(t, r, "x", "/")))[0]]++
+	}
+	if seen["a"] != 2 || seen["b"] != 2 {
+		t.Errorf("requests were spread %v, want 2 each", seen)
+	}
+}
+
+func TestRouterStickySessions(t *testing.T) {
+	r := NewRouter()
+	a, b := backend(t, "a"), backend(t, "b")
+	update(r, []Rule{{PathPrefix: "/", StickySessions: true}}, map[string][]string{"/": {a, b}})
+
+	first := get(t, r, "x", "/")
+	cookies := first.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != stickyCookie {
+		t.Fatalf("first response set cookies %v, want %s", cookies, stickyCookie)
+	}
+	want := strings.Fields(body(t, first))[0]
+	for range 3 {
+		if got := strings.Fields(body(t, get(t, r, "x", "/", cookies[0])))[0]; got != want {
+			t.Errorf("sticky request went to %s, want %s", got, want)
+		}
+	}
+}
+
+func TestRouterEjectsFailingEndpoints(t *testing.T) {
+	r := NewRouter()
+	good := backend(t, "good")
+	// Nothing listens on the closed server's address.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	bad := strings.TrimPrefix(closed.URL, "http://")
+	closed.Close()
+	update(r, []Rule{{PathPrefix: "/"}}, map[string][]string{"/": {bad, good}})
+
+	failures := 0
+	for range 2 * maxFailures {
+		if get(t, r, "x", "/").Code == http.StatusBadGateway {
+			failures++
+		}
+	}
+	if failures != maxFailures {
+		t.Fatalf("%d requests failed, want %d before the endpoint is ejected", failures, maxFailures)
+	}
+	for range 4 {
+		if w := get(t, r, "x", "/"); w.Code != http.StatusOK {
+			t.Errorf("request after the ejection got status %d", w.Code)
+		}
+	}
+}
+
+func TestRouterWithoutEndpoints(t *testing.T) {
+	r := NewRouter()
+	update(r, []Rule{{PathPrefix: "/"}}, nil)
+	if w := get(t, r, "x", "/"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("route without endpoints got status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
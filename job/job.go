@@ -0,0 +1,97 @@
+package job
+
+import (
+	"cube/task"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Job phases.
+const (
+	Active   = "Active"
+	Complete = "Complete"
+	Failed   = "Failed"
+)
+
+// Job runs tasks built from its Template until Completions of them have
+// exited successfully.
+type Job struct {
+	Name      string
+	Namespace string
+	// Completions is how many tasks must succeed. It defaults to 1.
+	Completions int
+	// Parallelism is how many tasks may run at once. It defaults to 1.
+	Parallelism int
+	// BackoffLimit is how many failed tasks are retried before the job
+	// fails.
+	BackoffLimit int
+	// ActiveDeadlineSeconds limits how long the job may run. Zero means no
+	// limit.
+	ActiveDeadlineSeconds int
+	Template              task.Task
+	// Parent names the controller that created the job, such as
+	// "cronjob/nightly". It is empty for jobs created directly.
+	Parent     string
+	CreateTime time.Time
+	Status     Status
+}
+
+type Status struct {
+	Phase     string
+	Active    int
+	Succeeded int
+	Failed    int
+	// Reason explains why the job failed.
+	Reason         string
+	StartTime      time.Time
+	CompletionTime time.Time
+	// AdmissionError is why the last task the job tried to create was not
+	// admitted, for example because of a quota.
+	AdmissionError string
+}
+
+func (j *Job) Validate() error {
+	if j.Name == "" {
+		return errors.New("job name must not be empty")
+	}
+	if j.Completions < 0 || j.Parallelism < 0 {
+		return fmt.Errorf("completions and parallelism of job %s must not be negative", j.Name)
+	}
+	if j.BackoffLimit < 0 {
+		return fmt.Errorf("job %s has a negative backoff limit", j.Name)
+	}
+	if j.ActiveDeadlineSeconds < 0 {
+		return fmt.Errorf("job %s has a negative active deadline", j.Name)
+	}
+	return j.Template.Validate()
+}
+
+// SetDefaults fills in the completion count and parallelism when unset.
+func (j *Job) SetDefaults() {
+	if j.Completions == 0 {
+		j.Completions = 1
+	}
+	if j.Parallelism == 0 {
+		j.Parallelism = 1
+	}
+}
+
+// Owner is the value of task.Task.Owner for the tasks of the job.
+func (j *Job) Owner() string {
+	return "job/" + j.Name
+}
+
+// Finished reports whether the job has completed or failed.
+func (j *Job) Finished() bool {
+	return j.Status.Phase == Complete || j.Status.Phase == Failed
+}
+
+// DeadlineExceeded reports whether the job has been running for longer
+// than its active deadline.
+func (j *Job) DeadlineExceeded(now time.Time) bool {
+	if j.ActiveDeadlineSeconds == 0 || j.Status.StartTime.IsZero() {
+		return false
+	}
+	return now.Sub(j.Status.StartTime) > time.Duration(j.ActiveDeadlineSeconds)*time.Second
+}
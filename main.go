@@ -1,55 +1,271 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/tls"
+	"cube/cli"
+	"cube/config"
 	"cube/manager"
+	"cube/pki"
 	"cube/worker"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
 )
 
 func main() {
-	workers := initWorkers()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "manager":
+			c, err := config.LoadManager(os.Args[2:])
+			exitOnError("manager", err)
+			runManager(c)
+		case "worker":
+			c, err := config.LoadWorker(os.Args[2:])
+			exitOnError("worker", err)
+			w := runWorker(c)
+			waitForShutdown()
+			err = w.Deregister(c.ManagerURL(), c.JoinToken)
+			if err != nil {
+				log.Printf("Error deregistering worker %s: %v\n", c.Name, err)
+			}
+		default:
+			// With any other command, cube is a client of the manager API.
+			os.Exit(cli.Run(os.Args[1:]))
+		}
+		return
+	}
 
-	initManager(workers)
+	runLocal()
+}
 
+func exitOnError(mode string, err error) {
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid %s configuration: %v\n", mode, err)
+		os.Exit(2)
+	}
 }
 
-func initWorkers() []string {
-	whost := os.Getenv("CUBE_WORKER_HOST")
-	wport, _ := strconv.Atoi(os.Getenv("CUBE_WORKER_PORT"))
+// runLocal runs a manager and three workers on consecutive ports in one
+// process, configured like the manager and worker modes, for trying cube
+// out on a single host.
+func runLocal() {
+	mc, err := config.LoadManager(nil)
+	exitOnError("manager", err)
+	if mc.JoinToken == "" {
+		mc.JoinToken = savedToken(filepath.Join(mc.DataDir, "join-token"), "cluster join token")
+	}
 
-	fmt.Println("Starting cube worker")
+	for i := range 3 {
+		wc := config.DefaultWorker()
+		wc.Address = "localhost"
+		err := config.Load(&wc, "worker", "CUBE_WORKER_CONFIG", nil)
+		exitOnError("worker", err)
+		wc.Name = fmt.Sprintf("worker-%d", i)
+		wc.Port += i
+		wc.Advertise = ""
+		wc.JoinToken = mc.JoinToken
+		wc.Manager = fmt.Sprintf("localhost:%d", mc.Port)
+		// The workers share a host, so only one of them can listen on the
+		// ports of services served from the workers. It tells the manager,
+		// which only sends clients of those services to nodes that serve
+		// them.
+		wc.ServeServices = wc.ServeServices && i == 0
+		err = wc.Validate()
+		exitOnError("worker", err)
+		runWorker(wc)
+	}
 
-	workers := make([]string, 0)
+	runManager(mc)
+}
 
-	for i := range 3 {
-		w := worker.New(fmt.Sprintf("worker-%d", i), "memory")
+// waitForShutdown blocks until the process is asked to stop.
+func waitForShutdown() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	s := <-sig
+	fmt.Printf("Received %v, shutting down\n", s)
+}
+
+func newJoinToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
 
-		wapi := worker.Api{Address: whost, Port: wport + i, Worker: w}
+// savedToken returns the token kept in file, generating one and writing it
+// there, readable only by the owner, if there is none. Generated tokens
+// are never logged.
+func savedToken(file, what string) string {
+	b, err := os.ReadFile(file)
+	if err == nil && len(strings.TrimSpace(string(b))) > 0 {
+		log.Printf("Using the %s in %s\n", what, file)
+		return strings.TrimSpace(string(b))
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("Error reading the %s: %v\n", what, err)
+	}
+	token := newJoinToken()
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err == nil {
+		err = os.WriteFile(file, []byte(token+"\n"), 0600)
+	}
+	if err != nil {
+		log.Fatalf("Error saving the generated %s: %v\n", what, err)
+	}
+	log.Printf("Generated the %s and saved it to %s\n", what, file)
+	return token
+}
 
-		go w.RunTasks()
-		go w.CollectStats()
-		go w.UpdateTasks()
-		go wapi.Start()
+// runWorker starts a worker and its API in the background and returns the
+// worker.
+func runWorker(c config.Worker) *worker.Worker {
+	fmt.Printf("Starting cube worker %s\n", c.Name)
+	w, err := worker.New(c.Name, c.Store, filepath.Join(c.DataDir, c.Name+".db"))
+	if err != nil {
+		log.Fatalf("Error creating worker %s: %v\n", c.Name, err)
+	}
+	w.Labels = c.Labels
+	w.Taints = c.NodeTaints()
+	w.Nameserver = c.Nameserver
+	w.ServesServices = c.ServeServices
+	w.Intervals = worker.Intervals{
+		RunTasks:     c.Intervals.RunTasks,
+		UpdateTasks:  c.Intervals.UpdateTasks,
+		Stats:        c.Intervals.Stats,
+		Heartbeat:    c.Intervals.Heartbeat,
+		SyncServices: c.Intervals.SyncServices,
+		Certificates: c.Intervals.Certificates,
+	}
 
-		workers = append(workers, fmt.Sprintf("%s:%d", wapi.Address, wapi.Port))
+	wapi := worker.Api{Address: c.Address, Port: c.Port, Worker: w}
+	if c.TLS.Enabled() {
+		err := w.Bootstrap(worker.Bootstrap{
+			Manager:   c.ManagerURL(),
+			Token:     c.BootstrapToken,
+			CAHash:    c.CAHash,
+			Advertise: c.Advertise,
+			CertFile:  c.TLS.Cert,
+			KeyFile:   c.TLS.Key,
+			CAFile:    c.TLS.CA,
+		})
+		if err != nil {
+			log.Fatalf("Error getting a certificate for worker %s: %v\n", c.Name, err)
+		}
+		kp, pool, err := c.TLS.Load()
+		if err != nil {
+			log.Fatalf("Error loading TLS for worker %s: %v\n", c.Name, err)
+		}
+		// Only clients with a certificate of the cluster CA get through
+		// the handshake, and the API checks it is the manager's.
+		wapi.TLS = pki.ServerConfig(kp, pool, tls.RequireAndVerifyClientCert)
+		wapi.ManagerName = c.ManagerName
+		w.Client = pki.NewClient(pki.ClientConfig(kp, pool))
+		go w.RotateCertificates(c.ManagerURL(), kp, c.Advertise)
 	}
 
-	return workers
+	go w.RunTasks()
+	go w.CollectStats()
+	go w.UpdateTasks()
+	go func() {
+		err := wapi.Start()
+		log.Fatalf("Error serving the API of worker %s: %v\n", c.Name, err)
+	}()
+	go w.SendHeartbeats(c.ManagerURL(), c.Advertise, c.JoinToken)
+	if c.ServeServices {
+		go w.SyncServices(c.ManagerURL(), c.JoinToken)
+	}
+	return w
 }
 
-func initManager(workers []string) {
-	mhost := os.Getenv("CUBE_MANAGER_HOST")
-	mport, _ := strconv.Atoi(os.Getenv("CUBE_MANAGER_PORT"))
-
+// runManager starts the manager and serves its API until it fails.
+func runManager(c config.Manager) {
 	fmt.Println("Starting Cube manager")
-	m := manager.New(workers, "roundrobin", "memory")
+	if c.JoinToken == "" {
+		c.JoinToken = savedToken(filepath.Join(c.DataDir, "join-token"), "cluster join token")
+	}
+	m, err := manager.New([]string{}, c.Scheduler, c.Store, filepath.Join(c.DataDir, "manager.db"), c.JoinToken)
+	if err != nil {
+		log.Fatalf("Error creating manager: %v\n", err)
+	}
+	m.Intervals = manager.Intervals{
+		ProcessTasks: c.Intervals.ProcessTasks,
+		UpdateTasks:  c.Intervals.UpdateTasks,
+		HealthChecks: c.Intervals.HealthChecks,
+		Reconcile:    c.Intervals.Reconcile,
+		NodeTimeout:  c.Intervals.NodeTimeout,
+		Certificates: c.Intervals.Certificates,
+	}
 
-	mapi := manager.Api{Address: mhost, Port: mport, Manager: m}
+	if c.Auth {
+		if c.AdminToken == "" {
+			c.AdminToken = savedToken(filepath.Join(c.DataDir, "admin-token"), "admin API token")
+		}
+		if !c.TLS.Enabled() {
+			log.Println("Warning: auth is enabled without TLS; API tokens are sent in the clear")
+		}
+		m.AuthEnabled = true
+		m.AdminToken = c.AdminToken
+	}
+
+	mapi := manager.Api{Address: c.Address, Port: c.Port, Manager: m}
+	if c.CADir != "" {
+		m.CA, err = pki.LoadOrCreateCA(c.CADir)
+		if err != nil {
+			log.Fatalf("Error loading the CA: %v\n", err)
+		}
+		m.CertName = c.Name
+		m.Hosts = c.Hosts
+		m.CertValidity = c.CertValidity
+		fmt.Printf("Cluster CA hash %s\n", m.CA.Hash())
+		if c.IssuesCert() {
+			err := m.IssueOwnCertificate(c.TLS.Cert, c.TLS.Key, c.Hosts)
+			if err != nil {
+				log.Fatalf("Error issuing the manager's certificate: %v\n", err)
+			}
+		}
+	}
+	if c.TLS.Enabled() {
+		kp, pool, err := c.TLS.Load()
+		if err != nil {
+			log.Fatalf("Error loading TLS for the manager: %v\n", err)
+		}
+		// Clients may connect without a certificate, but nodes need one,
+		// and revoked certificates are refused.
+		mapi.TLS = pki.ServerConfig(kp, pool, tls.VerifyClientCertIfGiven)
+		mapi.TLS.VerifyConnection = m.VerifyConnection
+		m.UseTLS(pki.ClientConfig(kp, pool))
+		if c.IssuesCert() {
+			go m.RotateCertificate(kp, c.Hosts)
+		}
+	}
 
 	go m.ProcessTasks()
 	go m.UpdateTasks()
 	go m.DoHealthChecks()
-	mapi.Start()
+	go m.ReconcileDeployments()
+	go m.ReconcileJobs()
+	go m.ReconcileCronJobs()
+	go m.ReconcileNamespaces()
+	go m.SyncServices()
+	if c.IngressPort > 0 {
+		go m.ServeIngress(c.Address + ":" + strconv.Itoa(c.IngressPort))
+	}
+	if c.DNSAddress != "" {
+		m.DNSForward = c.DNSForwardNets()
+		go m.ServeDNS(c.DNSAddress)
+	}
+	err = mapi.Start()
+	log.Fatalf("Error serving the manager API: %v\n", err)
 }
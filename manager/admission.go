@@ -0,0 +1,100 @@
+package manager
+
+import (
+	"cube/namespace"
+	"cube/quota"
+	"cube/task"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// admitTask checks a new task before it is accepted. It puts the task in
+// the default namespace if it has none, names it if it is unnamed, sets its
+// priority and applies the limit range of its namespace. Tasks that would take the
+// namespace over its quota, or whose group size differs from the other
+// members of their group, are rejected.
+func (m *Manager) admitTask(t *task.Task) error {
+	return m.admitReplacement(t, nil)
+}
+
+// admitReplacement checks a task like admitTask. The active task it
+// replaces, if any, is left out of the name check and the quota, as it is
+// stopped once the new one is accepted.
+func (m *Manager) admitReplacement(t *task.Task, replaces *task.Task) error {
+	if t.Namespace == "" {
+		t.Namespace = namespace.Default
+	}
+	err := m.checkNamespace(t.Namespace)
+	if err != nil {
+		return err
+	}
+	if t.Name == "" {
+		t.Name = "task-" + t.ID.String()[:8]
+	}
+	// Only the manager fills in the values of secrets.
+	t.SecretEnv = nil
+
+	for _, other := range m.GetTasks() {
+		if other.ID == t.ID || other.Namespace != t.Namespace || isFinished(other.State) || m.isStopping(other.ID) {
+			continue
+		}
+		if replaces != nil && other.ID == replaces.ID {
+			continue
+		}
+		if other.Name == t.Name {
+			return fmt.Errorf("%w: task %s", ErrAlreadyExists, namespace.Key(t.Namespace, t.Name))
+		}
+		// The members of a group are scheduled by the size of the oldest
+		// one, so they must all agree on it.
+		if t.Group != "" && other.Group == t.Group && other.GroupSize != t.GroupSize {
+			return fmt.Errorf("task group %s has a size of %d, not %d",
+				namespace.Key(t.Namespace, t.Group), other.GroupSize, t.GroupSize)
+		}
+	}
+
+	err = m.setPriority(t)
+	if err != nil {
+		return err
+	}
+	if l, err := m.LimitRangeDb.Get(t.Namespace); err == nil {
+		err := l.Apply(t)
+		if err != nil {
+			return fmt.Errorf("%w: task %s: %v", ErrForbidden, namespace.Key(t.Namespace, t.Name), err)
+		}
+	}
+	if q, err := m.QuotaDb.Get(t.Namespace); err == nil {
+		used := m.namespaceUsage(t.Namespace).Add(quota.Usage(t))
+		if replaces != nil && !isFinished(replaces.State) {
+			used = used.Sub(quota.Usage(replaces))
+		}
+		err := q.Check(used)
+		if err != nil {
+			return fmt.Errorf("%w: task %s: %v", ErrForbidden, namespace.Key(t.Namespace, t.Name), err)
+		}
+	}
+	return nil
+}
+
+// SubmitTask admits a new task and queues it. A task without an ID gets
+// one; an ID that is already taken is refused, so that submissions can't
+// replace existing tasks.
+func (m *Manager) SubmitTask(te *task.TaskEvent) error {
+	// Admit one task at a time so that tasks submitted together can't
+	// overrun a quota.
+	m.admitMu.Lock()
+	defer m.admitMu.Unlock()
+
+	if te.Task.ID == uuid.Nil {
+		te.Task.ID = uuid.New()
+	}
+	if _, err := m.TaskDb.Get(te.Task.ID.String()); err == nil {
+		return fmt.Errorf("%w: task %s", ErrAlreadyExists, te.Task.ID)
+	}
+	err := m.admitTask(&te.Task)
+	if err != nil {
+		return err
+	}
+	m.AddTask(*te)
+	return nil
+}
@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"cube/deployment"
+	"cube/quota"
+	"cube/task"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func submit(m *Manager, name string, cpu float64) (*task.TaskEvent, error) {
+	te := &task.TaskEvent{State: task.Scheduled,
+		Task: task.Task{ID: uuid.New(), Name: name, Image: "nginx", Cpu: cpu}}
+	return te, m.SubmitTask(te)
+}
+
+func TestAdmissionEnforcesQuota(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.SetQuota(&quota.Quota{Hard: quota.Resources{Cpu: 1, Tasks: 2}}); err != nil {
+		t.Fatalf("SetQuota: %v", err)
+	}
+
+	if _, err := submit(m, "a", 0.5); err != nil {
+		t.Fatalf("first task: %v", err)
+	}
+	if _, err := submit(m, "b", 0.75); !errors.Is(err, ErrForbidden) {
+		t.Errorf("task over the cpu quota: got %v, want ErrForbidden", err)
+	}
+	if _, err := submit(m, "c", 0.5); err != nil {
+		t.Fatalf("task within the quota: %v", err)
+	}
+	if _, err := submit(m, "d", 0); !errors.Is(err, ErrForbidden) {
+		t.Errorf("task over the task quota: got %v, want ErrForbidden", err)
+	}
+}
+
+func TestAdmissionAppliesLimitRange(t *testing.T) {
+	m := newTestManager(t)
+	err := m.SetLimitRange(&quota.LimitRange{Default: quota.Limits{Cpu: 0.25}, Max: quota.Limits{Cpu: 1}})
+	if err != nil {
+		t.Fatalf("SetLimitRange: %v", err)
+	}
+
+	te, err := submit(m, "a", 0)
+	if err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+	if te.Task.Cpu != 0.25 {
+		t.Errorf("task got cpu %g, want the default of 0.25", te.Task.Cpu)
+	}
+	if _, err := submit(m, "b", 2); !errors.Is(err, ErrForbidden) {
+		t.Errorf("task above the maximum: got %v, want ErrForbidden", err)
+	}
+}
+
+func TestAdmissionRefusesDuplicateActiveName(t *testing.T) {
+	m := newTestManager(t)
+	first, err := submit(m, "web", 0)
+	if err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+	if _, err := submit(m, "web", 0); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("second task named web: got %v, want ErrAlreadyExists", err)
+	}
+
+	done := first.Task
+	done.State = task.Completed
+	m.TaskDb.Put(done.ID.String(), &done)
+	if _, err := submit(m, "web", 0); err != nil {
+		t.Errorf("name of a finished task was not reusable: %v", err)
+	}
+}
+
+func TestDeploymentShowsAdmissionError(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.SetQuota(&quota.Quota{Hard: quota.Resources{Tasks: 1}}); err != nil {
+		t.Fatalf("SetQuota: %v", err)
+	}
+	d := &deployment.Deployment{
+		Name:     "web",
+		Replicas: 2,
+		Selector: map[string]string{"app": "web"},
+		Template: task.Task{Image: "nginx", Labels: map[string]string{"app": "web"}},
+	}
+	if err := m.CreateDeployment(d); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+
+	m.reconcileDeployments()
+
+	got, err := m.GetDeployment("default", "web")
+	if err != nil {
+		t.Fatalf("GetDeployment: %v", err)
+	}
+	if got.Status.Replicas != 1 || got.Status.AdmissionError == "" {
+		t.Errorf("got %d replicas and admission error %q, want 1 and the quota error",
+			got.Status.Replicas, got.Status.AdmissionError)
+	}
+}
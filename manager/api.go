@@ -1,6 +1,8 @@
 package manager
 
 import (
+	"crypto/tls"
+	"cube/auth"
 	"fmt"
 	"net/http"
 
@@ -12,21 +14,197 @@ type Api struct {
 	Port    int
 	Manager *Manager
 	Router  *chi.Mux
+	// TLS serves the API over TLS when set. Nodes must then present a
+	// client certificate issued to their name.
+	TLS *tls.Config
 }
 
 func (a *Api) initRouter() {
 	a.Router = chi.NewRouter()
+	if a.TLS != nil {
+		a.Router.Use(a.refuseRevoked)
+	}
 
-	a.Router.Route("/task", func(r chi.Router) {
-		r.Post("/", a.StartTaskHandler)
-		r.Get("/", a.GetTasksHandler)
-		r.Route("/{taskID}", func(r chi.Router) {
-			r.Delete("/", a.StopTaskHandler)
+	// Routes outside /namespaces/{namespace} act on the default namespace.
+	a.Router.Route("/task", a.taskRoutes)
+	// Watchers are authorized per change, by its kind and namespace.
+	a.Router.With(a.authenticate).Get("/watch", a.WatchHandler)
+	a.Router.With(a.authenticate).Post("/apply", a.ApplyHandler)
+	a.objectRoutes(a.Router)
+
+	a.Router.Route("/namespaces", func(r chi.Router) {
+		r.With(a.allow(auth.Create, "namespaces")).Post("/", a.CreateNamespaceHandler)
+		r.With(a.allow(auth.List, "namespaces")).Get("/", a.GetNamespacesHandler)
+		r.Route("/{namespace}", func(r chi.Router) {
+			r.With(a.allow(auth.Get, "namespaces")).Get("/", a.GetNamespaceHandler)
+			r.With(a.allow(auth.Delete, "namespaces")).Delete("/", a.DeleteNamespaceHandler)
+			r.Route("/tasks", a.taskRoutes)
+			r.With(a.authenticate).Get("/watch", a.WatchHandler)
+			a.objectRoutes(r)
+		})
+	})
+
+	a.Router.Route("/priorityclasses", func(r chi.Router) {
+		r.With(a.allow(auth.Create, "priorityclasses")).Post("/", a.CreatePriorityClassHandler)
+		r.With(a.allow(auth.List, "priorityclasses")).Get("/", a.GetPriorityClassesHandler)
+		r.Route("/{name}", func(r chi.Router) {
+			r.With(a.allow(auth.Get, "priorityclasses")).Get("/", a.GetPriorityClassHandler)
+			r.With(a.allow(auth.Delete, "priorityclasses")).Delete("/", a.DeletePriorityClassHandler)
+		})
+	})
+
+	// The CA certificate and the certificate requests of nodes are open;
+	// nodes authenticate with their join token or current certificate.
+	a.Router.Route("/pki", func(r chi.Router) {
+		r.Get("/ca", a.GetCAHandler)
+		r.With(a.allow(auth.Create, "bootstraptokens")).Post("/tokens", a.CreateBootstrapTokenHandler)
+		r.Post("/csr", a.SignCertificateHandler)
+		r.Post("/renew", a.RenewCertificateHandler)
+		r.Route("/certificates", func(r chi.Router) {
+			r.With(a.allow(auth.List, "certificates")).Get("/", a.GetCertificatesHandler)
+			r.With(a.allow(auth.Get, "certificates")).Get("/{serial}", a.GetCertificateHandler)
+			r.With(a.allow(auth.Update, "certificates")).Post("/{serial}/revoke", a.RevokeCertificateHandler)
+		})
+	})
+
+	a.Router.Route("/auth", func(r chi.Router) {
+		r.With(a.authenticate).Get("/whoami", a.WhoAmIHandler)
+		r.Route("/tokens", func(r chi.Router) {
+			r.With(a.allow(auth.Create, "apitokens")).Post("/", a.CreateTokenHandler)
+			r.With(a.allow(auth.List, "apitokens")).Get("/", a.GetTokensHandler)
+			r.With(a.allow(auth.Delete, "apitokens")).Delete("/{id}", a.DeleteTokenHandler)
+		})
+	})
+
+	a.Router.Route("/rolebindings", func(r chi.Router) {
+		r.With(a.allow(auth.Create, "rolebindings")).Post("/", a.CreateRoleBindingHandler)
+		r.With(a.allow(auth.List, "rolebindings")).Get("/", a.GetRoleBindingsHandler)
+		r.Route("/{name}", func(r chi.Router) {
+			r.With(a.allow(auth.Get, "rolebindings")).Get("/", a.GetRoleBindingHandler)
+			r.With(a.allow(auth.Delete, "rolebindings")).Delete("/", a.DeleteRoleBindingHandler)
+		})
+	})
+
+	a.Router.Route("/nodes", func(r chi.Router) {
+		r.With(a.allow(auth.List, "nodes")).Get("/", a.GetNodesHandler)
+		r.With(a.requireJoinToken).Post("/", a.RegisterNodeHandler)
+		r.Route("/{name}", func(r chi.Router) {
+			r.With(a.allow(auth.Get, "nodes")).Get("/", a.GetNodeHandler)
+			r.With(a.requireJoinToken, a.requireNodeCert).Delete("/", a.DeregisterNodeHandler)
+			r.With(a.requireJoinToken, a.requireNodeCert).Post("/heartbeat", a.HeartbeatHandler)
+			r.With(a.allow(auth.Update, "nodes")).Post("/cordon", a.CordonNodeHandler)
+			r.With(a.allow(auth.Update, "nodes")).Post("/uncordon", a.UncordonNodeHandler)
+			r.With(a.allow(auth.Update, "nodes")).Post("/drain", a.DrainNodeHandler)
+			r.With(a.allow(auth.Get, "nodes")).Get("/drain", a.GetDrainStatusHandler)
+			r.With(a.allow(auth.Update, "nodes")).Post("/taints", a.AddTaintHandler)
+			r.With(a.allow(auth.Update, "nodes")).Delete("/taints/{key}", a.RemoveTaintHandler)
+		})
+	})
+}
+
+func (a *Api) taskRoutes(r chi.Router) {
+	r.With(a.allow(auth.Create, "tasks")).Post("/", a.StartTaskHandler)
+	r.With(a.allow(auth.List, "tasks")).Get("/", a.GetTasksHandler)
+	r.Route("/{taskID}", func(r chi.Router) {
+		r.With(a.allow(auth.Get, "tasks")).Get("/", a.GetTaskHandler)
+		r.With(a.allow(auth.Get, "tasks")).Get("/events", a.GetTaskEventsHandler)
+		r.With(a.allow(auth.Get, "tasks")).Get("/logs", a.GetTaskLogsHandler)
+		r.With(a.allow(auth.Create, "tasks/exec")).Post("/exec", a.ExecTaskHandler)
+		r.With(a.allow(auth.Delete, "tasks")).Delete("/", a.StopTaskHandler)
+	})
+}
+
+// objectRoutes registers the routes of the objects that live in a
+// namespace.
+func (a *Api) objectRoutes(r chi.Router) {
+	r.Route("/deployments", func(r chi.Router) {
+		r.With(a.allow(auth.Create, "deployments")).Post("/", a.CreateDeploymentHandler)
+		r.With(a.allow(auth.List, "deployments")).Get("/", a.GetDeploymentsHandler)
+		r.Route("/{name}", func(r chi.Router) {
+			r.With(a.allow(auth.Get, "deployments")).Get("/", a.GetDeploymentHandler)
+			r.With(a.allow(auth.Update, "deployments")).Put("/", a.UpdateDeploymentHandler)
+			r.With(a.allow(auth.Delete, "deployments")).Delete("/", a.DeleteDeploymentHandler)
+			r.With(a.allow(auth.Update, "deployments")).Put("/scale", a.ScaleDeploymentHandler)
+			r.With(a.allow(auth.Get, "deployments")).Get("/rollout", a.GetRolloutStatusHandler)
+			r.With(a.allow(auth.Get, "deployments")).Get("/revisions", a.GetRevisionsHandler)
+			r.With(a.allow(auth.Update, "deployments")).Post("/rollback", a.RollbackDeploymentHandler)
+		})
+	})
+
+	r.Route("/jobs", func(r chi.Router) {
+		r.With(a.allow(auth.Create, "jobs")).Post("/", a.CreateJobHandler)
+		r.With(a.allow(auth.List, "jobs")).Get("/", a.GetJobsHandler)
+		r.Route("/{name}", func(r chi.Router) {
+			r.With(a.allow(auth.Get, "jobs")).Get("/", a.GetJobHandler)
+			r.With(a.allow(auth.Delete, "jobs")).Delete("/", a.DeleteJobHandler)
+		})
+	})
+
+	r.Route("/cronjobs", func(r chi.Router) {
+		r.With(a.allow(auth.Create, "cronjobs")).Post("/", a.CreateCronJobHandler)
+		r.With(a.allow(auth.List, "cronjobs")).Get("/", a.GetCronJobsHandler)
+		r.Route("/{name}", func(r chi.Router) {
+			r.With(a.allow(auth.Get, "cronjobs")).Get("/", a.GetCronJobHandler)
+			r.With(a.allow(auth.Update, "cronjobs")).Put("/", a.UpdateCronJobHandler)
+			r.With(a.allow(auth.Delete, "cronjobs")).Delete("/", a.DeleteCronJobHandler)
+		})
+	})
+
+	r.Route("/services", func(r chi.Router) {
+		r.With(a.allow(auth.Create, "services")).Post("/", a.CreateServiceHandler)
+		r.With(a.allow(auth.List, "services")).Get("/", a.GetServicesHandler)
+		r.Route("/{name}", func(r chi.Router) {
+			r.With(a.allow(auth.Get, "services")).Get("/", a.GetServiceHandler)
+			r.With(a.allow(auth.Update, "services")).Put("/", a.UpdateServiceHandler)
+			r.With(a.allow(auth.Delete, "services")).Delete("/", a.DeleteServiceHandler)
+		})
+	})
+
+	r.Route("/ingresses", func(r chi.Router) {
+		r.With(a.allow(auth.Create, "ingresses")).Post("/", a.CreateIngressHandler)
+		r.With(a.allow(auth.List, "ingresses")).Get("/", a.GetIngressesHandler)
+		r.Route("/{name}", func(r chi.Router) {
+			r.With(a.allow(auth.Get, "ingresses")).Get("/", a.GetIngressHandler)
+			r.With(a.allow(auth.Update, "ingresses")).Put("/", a.UpdateIngressHandler)
+			r.With(a.allow(auth.Delete, "ingresses")).Delete("/", a.DeleteIngressHandler)
+		})
+	})
+
+	r.Route("/secrets", func(r chi.Router) {
+		r.With(a.allow(auth.Create, "secrets")).Post("/", a.CreateSecretHandler)
+		r.With(a.allow(auth.List, "secrets")).Get("/", a.GetSecretsHandler)
+		r.Route("/{name}", func(r chi.Router) {
+			r.With(a.allow(auth.Get, "secrets")).Get("/", a.GetSecretHandler)
+			r.With(a.allow(auth.Update, "secrets")).Put("/", a.UpdateSecretHandler)
+			r.With(a.allow(auth.Delete, "secrets")).Delete("/", a.DeleteSecretHandler)
 		})
 	})
+
+	r.Route("/quota", func(r chi.Router) {
+		r.With(a.allow(auth.Update, "quotas")).Put("/", a.SetQuotaHandler)
+		r.With(a.allow(auth.Get, "quotas")).Get("/", a.GetQuotaHandler)
+		r.With(a.allow(auth.Delete, "quotas")).Delete("/", a.DeleteQuotaHandler)
+	})
+
+	r.Route("/limitrange", func(r chi.Router) {
+		r.With(a.allow(auth.Update, "limitranges")).Put("/", a.SetLimitRangeHandler)
+		r.With(a.allow(auth.Get, "limitranges")).Get("/", a.GetLimitRangeHandler)
+		r.With(a.allow(auth.Delete, "limitranges")).Delete("/", a.DeleteLimitRangeHandler)
+	})
 }
 
-func (a *Api) Start() {
+// Handler returns the routes of the API, for serving them on a listener
+// of the caller's.
+func (a *Api) Handler() http.Handler {
 	a.initRouter()
-	http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	return a.Router
+}
+
+func (a *Api) Start() error {
+	addr := fmt.Sprintf("%s:%d", a.Address, a.Port)
+	if a.TLS == nil {
+		return http.ListenAndServe(addr, a.Handler())
+	}
+	s := &http.Server{Addr: addr, Handler: a.Handler(), TLSConfig: a.TLS}
+	return s.ListenAndServeTLS("", "")
 }
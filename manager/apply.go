@@ -0,0 +1,469 @@
+package manager
+
+import (
+	"bytes"
+	"cube/cronjob"
+	"cube/deployment"
+	"cube/ingress"
+	"cube/manifest"
+	"cube/namespace"
+	"cube/priority"
+	"cube/secret"
+	"cube/service"
+	"cube/task"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Apply actions.
+const (
+	Created    = "Created"
+	Configured = "Configured"
+	Unchanged  = "Unchanged"
+	Failed     = "Failed"
+)
+
+// ApplyResult tells what applying a manifest did, or would do in a dry run.
+type ApplyResult struct {
+	Kind      string
+	Namespace string `json:",omitempty"`
+	Name      string
+	Action    string
+	// Diff lists the fields that were changed, as "Path: old -> new".
+	Diff  []string `json:",omitempty"`
+	Error string   `json:",omitempty"`
+}
+
+// applyKind is how objects of one kind are looked up, created and updated
+// by name. update is nil for kinds that can't be changed once created.
+type applyKind struct {
+	name       string
+	namespaced bool
+	// order puts the kinds that others depend on, such as namespaces,
+	// first.
+	order   int
+	managed []string
+	// sensitive are the fields whose values are left out of diffs.
+	sensitive []string
+	newObj    func() any
+	get       func(m *Manager, ns, name string) (any, error)
+	create    func(m *Manager, obj any) error
+	update    func(m *Manager, ns, name string, obj any) error
+}
+
+// objectManaged are the fields of every kind that are set by the manager.
+var objectManaged = []string{"CreateTime", "Status"}
+
+// taskManaged are the fields of a task that are set by the manager.
+var taskManaged = []string{"ID", "ContainerId", "State", "HostPorts", "SubmitTime", "StartTime",
+	"FinishTime", "Healthy", "RestartCount", "ExitCode", "Reason", "Priority", "Owner", "SecretEnv"}
+
+func newKind[T any](name string, namespaced bool, order int,
+	get func(m *Manager, ns, name string) (*T, error),
+	create func(m *Manager, obj *T) error,
+	update func(m *Manager, ns, name string, obj *T) error,
+	managed ...string) applyKind {
+	k := applyKind{
+		name:       name,
+		namespaced: namespaced,
+		order:      order,
+		managed:    managed,
+		newObj:     func() any { return new(T) },
+		get: func(m *Manager, ns, name string) (any, error) {
+			obj, err := get(m, ns, name)
+			if err != nil {
+				return nil, err
+			}
+			return obj, nil
+		},
+		create: func(m *Manager, obj any) error { return create(m, obj.(*T)) },
+	}
+	if update != nil {
+		k.update = func(m *Manager, ns, name string, obj any) error {
+			return update(m, ns, name, obj.(*T))
+		}
+	}
+	return k
+}
+
+// withSensitive marks fields of a kind whose values must not show in the
+// results of an apply.
+func withSensitive(k applyKind, fields ...string) applyKind {
+	k.sensitive = fields
+	return k
+}
+
+var applyKinds = []applyKind{
+	newKind("Namespace", false, 0,
+		func(m *Manager, _, name string) (*namespace.Namespace, error) { return m.GetNamespace(name) },
+		(*Manager).CreateNamespace, nil, objectManaged...),
+	newKind("PriorityClass", false, 1,
+		func(m *Manager, _, name string) (*priority.PriorityClass, error) { return m.GetPriorityClass(name) },
+		(*Manager).CreatePriorityClass, nil, objectManaged...),
+	withSensitive(newKind("Secret", true, 2, (*Manager).GetSecret, (*Manager).CreateSecret,
+		func(m *Manager, ns, name string, s *secret.Secret) error {
+			_, err := m.UpdateSecret(ns, name, s)
+			return err
+		}, objectManaged...), "Data"),
+	newKind("Service", true, 3, (*Manager).GetService, (*Manager).CreateService,
+		func(m *Manager, ns, name string, s *service.Service) error {
+			_, err := m.UpdateService(ns, name, s)
+			return err
+		}, objectManaged...),
+	newKind("Ingress", true, 3, (*Manager).GetIngress, (*Manager).CreateIngress,
+		func(m *Manager, ns, name string, i *ingress.Ingress) error {
+			_, err := m.UpdateIngress(ns, name, i)
+			return err
+		}, objectManaged...),
+	newKind("Deployment", true, 4, (*Manager).GetDeployment, (*Manager).CreateDeployment,
+		func(m *Manager, ns, name string, d *deployment.Deployment) error {
+			_, err := m.UpdateDeployment(ns, name, d)
+			return err
+		}, append([]string{"Revision", "Revisions"}, objectManaged...)...),
+	newKind("Job", true, 4, (*Manager).GetJob, (*Manager).CreateJob, nil,
+		append([]string{"Parent"}, objectManaged...)...),
+	newKind("CronJob", true, 4, (*Manager).GetCronJob, (*Manager).CreateCronJob,
+		func(m *Manager, ns, name string, c *cronjob.CronJob) error {
+			_, err := m.UpdateCronJob(ns, name, c)
+			return err
+		}, objectManaged...),
+	newKind("Task", true, 4, (*Manager).activeTaskByName, (*Manager).applyTask,
+		(*Manager).replaceTask, taskManaged...),
+}
+
+func findKind(name string) (applyKind, bool) {
+	for _, k := range applyKinds {
+		if strings.EqualFold(k.name, name) {
+			return k, true
+		}
+	}
+	return applyKind{}, false
+}
+
+// manifestScope returns the resource and namespace a manifest is applied
+// to, and false if its kind is unknown.
+func manifestScope(mf manifest.Manifest) (string, string, bool) {
+	k, ok := findKind(mf.Kind)
+	if !ok {
+		return "", "", false
+	}
+	ns := mf.Metadata.Namespace
+	if !k.namespaced {
+		ns = ""
+	} else if ns == "" {
+		ns = namespace.Default
+	}
+	return resourceOf(k.name), ns, true
+}
+
+// Apply brings the stored objects in line with the manifests. Objects that
+// don't exist are created, objects whose fields differ from their manifest
+// are updated, and the others are left unchanged. Fields a manifest leaves
+// out keep their current value. With dryRun set, nothing is changed and the
+// results tell what would have been done.
+func (m *Manager) Apply(manifests []manifest.Manifest, dryRun bool) []ApplyResult {
+	sorted := append([]manifest.Manifest{}, manifests...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ki, _ := findKind(sorted[i].Kind)
+		kj, _ := findKind(sorted[j].Kind)
+		return ki.order < kj.order
+	})
+
+	// Objects created by a dry run only exist in the results.
+	planned := make(map[string]bool)
+	results := make([]ApplyResult, 0, len(sorted))
+	for _, mf := range sorted {
+		r := m.applyManifest(mf, dryRun, planned)
+		if r.Action == Created {
+			planned[plannedKey(r.Kind, r.Name)] = true
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func (m *Manager) applyManifest(mf manifest.Manifest, dryRun bool, planned map[string]bool) ApplyResult {
+	r := ApplyResult{Kind: mf.Kind, Name: mf.Metadata.Name}
+	fail := func(err error) ApplyResult {
+		r.Action = Failed
+		r.Error = err.Error()
+		return r
+	}
+
+	k, ok := findKind(mf.Kind)
+	if !ok {
+		return fail(fmt.Errorf("unknown kind %q", mf.Kind))
+	}
+	r.Kind = k.name
+	ns := mf.Metadata.Namespace
+	if k.namespaced && ns == "" {
+		ns = namespace.Default
+	}
+	if !k.namespaced && ns != "" {
+		return fail(fmt.Errorf("%s objects are not namespaced", k.name))
+	}
+	r.Namespace = ns
+
+	current, err := k.get(m, ns, mf.Metadata.Name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fail(err)
+	}
+
+	// The desired object is the current one with the fields of the
+	// manifest, or a new one.
+	desired := k.newObj()
+	if current != nil {
+		err = copyObject(desired, current)
+		if err != nil {
+			return fail(err)
+		}
+	}
+	err = overlay(desired, mf.Spec, k.managed)
+	if err != nil {
+		return fail(err)
+	}
+	err = setIdentity(desired, mf.Metadata.Name, ns)
+	if err != nil {
+		return fail(err)
+	}
+	if d, ok := desired.(interface{ SetDefaults() }); ok {
+		d.SetDefaults()
+	}
+
+	if current == nil {
+		r.Action = Created
+		r.Diff, err = manifest.Diff(k.newObj(), desired, k.sensitive...)
+		if err != nil {
+			return fail(err)
+		}
+		if dryRun {
+			if k.namespaced && !planned[plannedKey("Namespace", ns)] {
+				if err := m.checkNamespace(ns); err != nil {
+					return fail(err)
+				}
+			}
+			if v, ok := desired.(interface{ Validate() error }); ok {
+				if err := v.Validate(); err != nil {
+					return fail(err)
+				}
+			}
+			if err := m.checkAdmission(desired, nil, planned); err != nil {
+				return fail(err)
+			}
+			return r
+		}
+		err = k.create(m, desired)
+		if err != nil {
+			return fail(err)
+		}
+		return r
+	}
+
+	r.Diff, err = manifest.Diff(current, desired, k.sensitive...)
+	if err != nil {
+		return fail(err)
+	}
+	if len(r.Diff) == 0 {
+		r.Action = Unchanged
+		return r
+	}
+	r.Action = Configured
+	if k.update == nil {
+		return fail(fmt.Errorf("%s %s cannot be changed; delete it and apply it again", k.name, mf.Metadata.Name))
+	}
+	if dryRun {
+		if v, ok := desired.(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				return fail(err)
+			}
+		}
+		old, _ := current.(*task.Task)
+		if err := m.checkAdmission(desired, old, planned); err != nil {
+			return fail(err)
+		}
+		return r
+	}
+	err = k.update(m, ns, mf.Metadata.Name, desired)
+	if err != nil {
+		return fail(err)
+	}
+	return r
+}
+
+// copyObject deep copies src into dst, which must have the same type.
+func copyObject(dst, src any) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// overlay sets the fields of obj that spec holds. Each field named in spec
+// is replaced as a whole, so maps and lists are not merged.
+func overlay(obj any, spec json.RawMessage, managed []string) error {
+	if len(spec) == 0 || string(spec) == "null" {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(spec, &fields)
+	if err != nil {
+		return errors.New("spec must be an object")
+	}
+
+	v := reflect.ValueOf(obj).Elem()
+	for key := range fields {
+		f, name := fieldByName(v, key)
+		if !f.IsValid() {
+			return fmt.Errorf("unknown field %q in spec", key)
+		}
+		for _, mf := range managed {
+			if mf == name {
+				return fmt.Errorf("field %s is set by the manager", name)
+			}
+		}
+		f.Set(reflect.Zero(f.Type()))
+	}
+
+	d := json.NewDecoder(bytes.NewReader(spec))
+	d.DisallowUnknownFields()
+	return d.Decode(obj)
+}
+
+func fieldByName(v reflect.Value, key string) (reflect.Value, string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() && strings.EqualFold(t.Field(i).Name, key) {
+			return v.Field(i), t.Field(i).Name
+		}
+	}
+	return reflect.Value{}, ""
+}
+
+// setIdentity sets the name and namespace of an object from its manifest's
+// metadata. The spec may repeat them, but not contradict them.
+func setIdentity(obj any, name, ns string) error {
+	v := reflect.ValueOf(obj).Elem()
+	for field, want := range map[string]string{"Name": name, "Namespace": ns} {
+		f, _ := fieldByName(v, field)
+		if !f.IsValid() || f.Kind() != reflect.String {
+			continue
+		}
+		if got := f.String(); got != "" && got != want {
+			return fmt.Errorf("spec sets %s to %q, but the metadata says %q", field, got, want)
+		}
+		f.SetString(want)
+	}
+	return nil
+}
+
+// activeTaskByName returns the task of a namespace with a name that hasn't
+// finished or been asked to stop.
+func (m *Manager) activeTaskByName(ns, name string) (*task.Task, error) {
+	for _, t := range m.namespaceTasks(ns) {
+		if t.Name == name && !isFinished(t.State) && !m.isStopping(t.ID) {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: task %s", ErrNotFound, namespace.Key(ns, name))
+}
+
+// applyTask submits a task described by a manifest.
+func (m *Manager) applyTask(t *task.Task) error {
+	return m.submitApplied(t, nil)
+}
+
+// replaceTask stops a task and submits a new one with the fields of the
+// manifest, as tasks can't be changed in place. The old task is only
+// stopped once the new one has been admitted.
+func (m *Manager) replaceTask(ns, name string, t *task.Task) error {
+	old, err := m.activeTaskByName(ns, name)
+	if err != nil {
+		return err
+	}
+	fresh, err := freshTask(t)
+	if err != nil {
+		return err
+	}
+	return m.submitApplied(fresh, old)
+}
+
+// submitApplied admits and queues a task from a manifest, and stops the
+// task it replaces, if any, once the new one is admitted.
+func (m *Manager) submitApplied(t *task.Task, replaces *task.Task) error {
+	err := t.Validate()
+	if err != nil {
+		return err
+	}
+	t.ID = uuid.New()
+	t.State = task.Pending
+
+	m.admitMu.Lock()
+	defer m.admitMu.Unlock()
+
+	err = m.admitReplacement(t, replaces)
+	if err != nil {
+		return err
+	}
+	if replaces != nil {
+		m.StopTask(replaces, "Replaced by a new version from a manifest")
+	}
+	m.AddTask(task.TaskEvent{
+		State:   task.Scheduled,
+		Task:    *t,
+		Message: "Applied from a manifest",
+	})
+	return nil
+}
+
+// freshTask copies a task without the fields set by the manager.
+func freshTask(t *task.Task) (*task.Task, error) {
+	fresh := task.Task{}
+	err := copyObject(&fresh, t)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range taskManaged {
+		f, _ := fieldByName(reflect.ValueOf(&fresh).Elem(), field)
+		f.Set(reflect.Zero(f.Type()))
+	}
+	return &fresh, nil
+}
+
+// checkAdmission runs the admission a task from a manifest would go
+// through, replacing the active task current if it is set, without
+// submitting anything. It is how dry runs catch tasks over a quota, with
+// an unknown priority class or a name that is taken. Other kinds are not
+// admitted.
+func (m *Manager) checkAdmission(desired any, current *task.Task, planned map[string]bool) error {
+	t, ok := desired.(*task.Task)
+	if !ok || planned[plannedKey("Namespace", t.Namespace)] {
+		// A namespace that is only planned holds nothing to check against.
+		return nil
+	}
+	fresh, err := freshTask(t)
+	if err != nil {
+		return err
+	}
+	if planned[plannedKey("PriorityClass", fresh.PriorityClass)] {
+		// The class would be created first; check the rest without it.
+		fresh.PriorityClass = ""
+	}
+	fresh.ID = uuid.New()
+
+	m.admitMu.Lock()
+	defer m.admitMu.Unlock()
+
+	return m.admitReplacement(fresh, current)
+}
+
+// plannedKey is the key of an object a dry run would create.
+func plannedKey(kind, name string) string {
+	return kind + "/" + name
+}
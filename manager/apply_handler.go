@@ -0,0 +1,42 @@
+package manager
+
+import (
+	"cube/auth"
+	"cube/manifest"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ApplyHandler applies the YAML or JSON manifests in the request body. With
+// ?dryRun=true it only reports what would change.
+func (a *Api) ApplyHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, fmt.Sprintf("Error reading body: %v", err))
+		return
+	}
+	manifests, err := manifest.Parse(data)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid manifest: %v", err))
+		return
+	}
+
+	// Applying creates or updates objects, so the caller needs both on
+	// every kind in the request.
+	for _, mf := range manifests {
+		resource, ns, ok := manifestScope(mf)
+		if !ok {
+			continue
+		}
+		for _, verb := range []auth.Verb{auth.Create, auth.Update} {
+			if err := a.authorize(r, verb, resource, ns); err != nil {
+				sendObjectError(w, err)
+				return
+			}
+		}
+	}
+
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+	sendJSON(w, http.StatusOK, a.Manager.Apply(manifests, dryRun))
+}
@@ -0,0 +1,109 @@
+package manager
+
+import (
+	"cube/manifest"
+	"cube/quota"
+	"cube/task"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func taskManifest(name string, spec map[string]any) manifest.Manifest {
+	data, _ := json.Marshal(spec)
+	return manifest.Manifest{Kind: "Task", Metadata: manifest.Metadata{Name: name}, Spec: data}
+}
+
+func TestDryRunRunsAdmission(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.SetQuota(&quota.Quota{Hard: quota.Resources{Cpu: 1}}); err != nil {
+		t.Fatalf("SetQuota: %v", err)
+	}
+
+	results := m.Apply([]manifest.Manifest{
+		taskManifest("big", map[string]any{"Image": "nginx", "Cpu": 2}),
+		taskManifest("classy", map[string]any{"Image": "nginx", "PriorityClass": "missing"}),
+		taskManifest("small", map[string]any{"Image": "nginx", "Cpu": 0.5}),
+	}, true)
+
+	got := map[string]string{}
+	for _, r := range results {
+		got[r.Name] = r.Action
+	}
+	want := map[string]string{"big": Failed, "classy": Failed, "small": Created}
+	for name, action := range want {
+		if got[name] != action {
+			t.Errorf("dry run of %s: got %s, want %s", name, got[name], action)
+		}
+	}
+	if tasks := m.GetTasks(); len(tasks) != 0 {
+		t.Errorf("dry run created %d tasks", len(tasks))
+	}
+}
+
+func TestReplaceTaskKeepsOldTaskWhenRefused(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.SetQuota(&quota.Quota{Hard: quota.Resources{Cpu: 1}}); err != nil {
+		t.Fatalf("SetQuota: %v", err)
+	}
+	apply := func(cpu float64) ApplyResult {
+		return m.Apply([]manifest.Manifest{taskManifest("web", map[string]any{"Image": "nginx", "Cpu": cpu})}, false)[0]
+	}
+	if r := apply(0.75); r.Action != Created {
+		t.Fatalf("first apply: %s %s", r.Action, r.Error)
+	}
+	old, _ := m.activeTaskByName("default", "web")
+
+	// The replacement fits once the old task is left out of the quota.
+	if r := apply(0.5); r.Action != Configured {
+		t.Fatalf("replacing within the quota: %s %s", r.Action, r.Error)
+	}
+	if !m.isStopping(old.ID) {
+		t.Error("the replaced task was not stopped")
+	}
+
+	current, _ := m.activeTaskByName("default", "web")
+	if r := apply(4); r.Action != Failed {
+		t.Fatalf("replacing over the quota: got %s, want %s", r.Action, Failed)
+	}
+	if m.isStopping(current.ID) {
+		t.Error("the task was stopped although its replacement was refused")
+	}
+}
+
+func TestReplaceStopsScheduledTask(t *testing.T) {
+	m := newTestManager(t)
+	f, _ := addNode(t, m, "w1")
+	old := &task.Task{Name: "web", Namespace: "default", Image: "nginx"}
+	if err := m.applyTask(old); err != nil {
+		t.Fatalf("applyTask: %v", err)
+	}
+	// The worker hasn't reported the task yet, so it stays scheduled.
+	m.processTasks()
+	if got, _ := m.TaskDb.Get(old.ID.String()); got.State != task.Scheduled {
+		t.Fatalf("task is %v, want %v", got.State, task.Scheduled)
+	}
+
+	r := m.Apply([]manifest.Manifest{taskManifest("web", map[string]any{"Image": "nginx:2"})}, false)[0]
+	if r.Action != Configured {
+		t.Fatalf("apply: %s %s", r.Action, r.Error)
+	}
+	m.processTasks()
+
+	if !slices.Contains(f.stops(), old.ID) {
+		t.Error("the scheduled task that was replaced was not stopped on its worker")
+	}
+}
+
+func TestApplyRedactsSecretData(t *testing.T) {
+	m := newTestManager(t)
+	data, _ := json.Marshal(map[string]any{"Data": map[string]string{"PASSWORD": "hunter2"}})
+	r := m.Apply([]manifest.Manifest{{Kind: "Secret", Metadata: manifest.Metadata{Name: "db"}, Spec: data}}, true)[0]
+	if r.Action != Created {
+		t.Fatalf("apply: %s %s", r.Action, r.Error)
+	}
+	if strings.Contains(strings.Join(r.Diff, "\n"), "hunter2") {
+		t.Errorf("diff shows the secret value: %q", r.Diff)
+	}
+}
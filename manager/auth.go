@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"crypto/subtle"
+	"cube/auth"
+	"cube/pki"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// errUnauthenticated is returned for API requests that carry no valid
+// credentials.
+var errUnauthenticated = errors.New("unauthenticated")
+
+// TokenResponse holds a new API token. The token itself is only ever shown
+// here.
+type TokenResponse struct {
+	Token  string
+	ID     uuid.UUID
+	User   string
+	Groups []string `json:",omitempty"`
+}
+
+// authenticateToken returns the identity of an API token.
+func (m *Manager) authenticateToken(token string) (auth.Identity, error) {
+	if m.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(m.AdminToken)) == 1 {
+		return auth.Identity{User: "admin", Groups: []string{auth.AdminGroup}}, nil
+	}
+	t, err := m.TokenDb.Get(pki.TokenHash(token))
+	if err != nil {
+		return auth.Identity{}, fmt.Errorf("%w: invalid API token", errUnauthenticated)
+	}
+	return auth.Identity{User: t.User, Groups: t.Groups}, nil
+}
+
+// Authorize returns an ErrForbidden error unless the role bindings let id
+// use verb on resource in namespace ns, or in all namespaces if ns is
+// empty.
+func (m *Manager) Authorize(id auth.Identity, verb auth.Verb, resource, ns string) error {
+	bindings, _ := m.RoleBindingDb.List()
+	if auth.Authorize(bindings, id, verb, resource, ns) {
+		return nil
+	}
+	where := "in all namespaces"
+	if ns != "" {
+		where = "in namespace " + ns
+	} else if !auth.Namespaced(resource) {
+		where = "in the cluster"
+	}
+	return fmt.Errorf("%w: %s cannot %s %s %s", ErrForbidden, id.User, verb, resource, where)
+}
+
+// CreateToken creates an API token for user and groups.
+func (m *Manager) CreateToken(user string, groups []string) (*TokenResponse, error) {
+	if user == "" {
+		return nil, errors.New("token user must not be empty")
+	}
+	token, t := auth.NewToken(user, groups)
+	err := m.TokenDb.Put(t.Hash, t)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{Token: token, ID: t.ID, User: t.User, Groups: t.Groups}, nil
+}
+
+// GetTokens returns the API tokens, oldest first.
+func (m *Manager) GetTokens() []*auth.Token {
+	tokens, _ := m.TokenDb.List()
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreateTime.Before(tokens[j].CreateTime)
+	})
+	return tokens
+}
+
+// DeleteToken revokes the API token with the given ID.
+func (m *Manager) DeleteToken(id string) error {
+	for _, t := range m.GetTokens() {
+		if strings.EqualFold(t.ID.String(), id) {
+			return m.TokenDb.Delete(t.Hash)
+		}
+	}
+	return fmt.Errorf("%w: token %s", ErrNotFound, id)
+}
+
+func (m *Manager) CreateRoleBinding(b *auth.RoleBinding) error {
+	err := b.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	if _, err := m.RoleBindingDb.Get(b.Name); err == nil {
+		return fmt.Errorf("%w: role binding %s", ErrAlreadyExists, b.Name)
+	}
+	if b.Namespace != "" {
+		if err := m.checkNamespace(b.Namespace); err != nil {
+			return err
+		}
+	}
+	b.CreateTime = time.Now().UTC()
+	return m.RoleBindingDb.Put(b.Name, b)
+}
+
+func (m *Manager) GetRoleBinding(name string) (*auth.RoleBinding, error) {
+	b, err := m.RoleBindingDb.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: role binding %s", ErrNotFound, name)
+	}
+	return b, nil
+}
+
+func (m *Manager) GetRoleBindings() []*auth.RoleBinding {
+	bindings, _ := m.RoleBindingDb.List()
+	sort.Slice(bindings, func(i, j int) bool {
+		return bindings[i].Name < bindings[j].Name
+	})
+	return bindings
+}
+
+func (m *Manager) DeleteRoleBinding(name string) error {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	if _, err := m.GetRoleBinding(name); err != nil {
+		return err
+	}
+	return m.RoleBindingDb.Delete(name)
+}
@@ -0,0 +1,211 @@
+package manager
+
+import (
+	"crypto/subtle"
+	"cube/auth"
+	"cube/pki"
+	"cube/worker"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TokenRequest asks for an API token for a user and its groups.
+type TokenRequest struct {
+	User   string
+	Groups []string
+}
+
+// WhoAmIResponse tells who the caller is and which role bindings apply to
+// it.
+type WhoAmIResponse struct {
+	auth.Identity
+	RoleBindings []*auth.RoleBinding
+}
+
+// identify returns the identity a request authenticates as: the user of
+// its bearer token, a node for the cluster join token, or the common name
+// and organizations of its client certificate.
+func (a *Api) identify(r *http.Request) (auth.Identity, error) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		token, ok := strings.CutPrefix(h, "Bearer ")
+		if !ok {
+			return auth.Identity{}, fmt.Errorf("%w: only bearer tokens are supported", errUnauthenticated)
+		}
+		return a.Manager.authenticateToken(token)
+	}
+	if token := r.Header.Get(worker.JoinTokenHeader); token != "" {
+		if a.Manager.JoinToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.Manager.JoinToken)) != 1 {
+			return auth.Identity{}, fmt.Errorf("%w: invalid join token", errUnauthenticated)
+		}
+		return auth.Identity{User: "node", Groups: []string{pki.NodeGroup}}, nil
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		id := auth.Identity{User: cert.Subject.CommonName, Groups: cert.Subject.Organization}
+		// Node names are chosen by the nodes, so they can't pass for users.
+		if slices.Contains(id.Groups, pki.NodeGroup) {
+			id.User = "node:" + id.User
+		}
+		return id, nil
+	}
+	return auth.Identity{}, fmt.Errorf("%w: requests need an API token or a client certificate", errUnauthenticated)
+}
+
+// authenticate rejects requests without valid credentials and passes the
+// identity of the others on in their context. It lets everything through
+// when auth is not enabled.
+func (a *Api) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Manager.AuthEnabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, err := a.identify(r)
+		if err != nil {
+			log.Printf("Rejected %s %s from %s: %v\n", r.Method, r.URL.Path, r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cube"`)
+			sendError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+	})
+}
+
+// allow authenticates the callers of a route and checks that their role
+// bindings let them use verb on resource in the namespace of the request.
+func (a *Api) allow(verb auth.Verb, resource string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return a.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := a.authorize(r, verb, resource, requestScope(r, verb, resource))
+			if err != nil {
+				sendObjectError(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// authorize checks that the caller of an authenticated request may use
+// verb on resource in namespace ns.
+func (a *Api) authorize(r *http.Request, verb auth.Verb, resource, ns string) error {
+	if !a.Manager.AuthEnabled {
+		return nil
+	}
+	id, _ := auth.IdentityFrom(r.Context())
+	err := a.Manager.Authorize(id, verb, resource, ns)
+	if err != nil {
+		log.Printf("Denied %s %s from %s: %v\n", r.Method, r.URL.Path, r.RemoteAddr, err)
+	}
+	return err
+}
+
+// requestScope returns the namespace a request acts on, or "" for the
+// lists outside /namespaces/{namespace}, which reach every namespace.
+func requestScope(r *http.Request, verb auth.Verb, resource string) string {
+	if !auth.Namespaced(resource) {
+		return ""
+	}
+	if verb == auth.List && chi.URLParam(r, "namespace") == "" {
+		return ""
+	}
+	return namespaceOf(r)
+}
+
+// resourceOf returns the resource that objects of a kind, such as
+// "Deployment" or "ingress", are authorized as.
+func resourceOf(kind string) string {
+	r := strings.ToLower(kind)
+	if strings.HasSuffix(r, "s") {
+		return r + "es"
+	}
+	return r + "s"
+}
+
+func (a *Api) WhoAmIHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := auth.IdentityFrom(r.Context())
+	if !ok {
+		sendObjectError(w, fmt.Errorf("%w: authentication is not enabled", ErrNotFound))
+		return
+	}
+	resp := WhoAmIResponse{Identity: id, RoleBindings: []*auth.RoleBinding{}}
+	for _, b := range append(slices.Clone(auth.Builtin), a.Manager.GetRoleBindings()...) {
+		if b.Applies(id) {
+			resp.RoleBindings = append(resp.RoleBindings, b)
+		}
+	}
+	sendJSON(w, http.StatusOK, resp)
+}
+
+func (a *Api) CreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	req := TokenRequest{}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	t, err := a.Manager.CreateToken(req.User, req.Groups)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	log.Printf("Created API token %s for %s\n", t.ID, t.User)
+	sendJSON(w, http.StatusCreated, t)
+}
+
+func (a *Api) GetTokensHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, a.Manager.GetTokens())
+}
+
+func (a *Api) DeleteTokenHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	err := a.Manager.DeleteToken(id)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	log.Printf("Deleted API token %s\n", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) CreateRoleBindingHandler(w http.ResponseWriter, r *http.Request) {
+	b := auth.RoleBinding{}
+	if !decodeBody(w, r, &b) {
+		return
+	}
+
+	err := a.Manager.CreateRoleBinding(&b)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+
+	log.Printf("Created role binding %s\n", b.Name)
+	sendJSON(w, http.StatusCreated, b)
+}
+
+func (a *Api) GetRoleBindingsHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, a.Manager.GetRoleBindings())
+}
+
+func (a *Api) GetRoleBindingHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := a.Manager.GetRoleBinding(chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, b)
+}
+
+func (a *Api) DeleteRoleBindingHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.Manager.DeleteRoleBinding(chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,276 @@
+package manager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"cube/pki"
+	"cube/worker"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"time"
+)
+
+// errInvalidToken is returned for certificate requests whose join token is
+// unknown, used up or expired.
+var errInvalidToken = errors.New("invalid or expired join token")
+
+// BootstrapTokenResponse holds a new one-time join token. The token itself
+// is only ever shown here.
+type BootstrapTokenResponse struct {
+	Token   string
+	Expires time.Time
+	// CAHash pins the CA certificate for workers that fetch it.
+	CAHash string
+}
+
+func (m *Manager) checkCA() error {
+	if m.CA == nil {
+		return fmt.Errorf("%w: the built-in CA is not enabled", ErrNotFound)
+	}
+	return nil
+}
+
+// CreateBootstrapToken creates a one-time join token that is valid for
+// ttl.
+func (m *Manager) CreateBootstrapToken(ttl time.Duration) (*BootstrapTokenResponse, error) {
+	if err := m.checkCA(); err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		return nil, errors.New("token ttl must be positive")
+	}
+	token, bt := pki.NewBootstrapToken(ttl)
+	err := m.BootstrapTokenDb.Put(bt.Hash, bt)
+	if err != nil {
+		return nil, err
+	}
+	return &BootstrapTokenResponse{Token: token, Expires: bt.Expires, CAHash: m.CA.Hash()}, nil
+}
+
+// IssueCertificate signs the certificate request of a worker that presents
+// a one-time join token, which is used up. A node can only be issued a
+// certificate while it has no other valid one.
+func (m *Manager) IssueCertificate(token string, req worker.CertRequest) (*worker.CertResponse, error) {
+	if err := m.checkCA(); err != nil {
+		return nil, err
+	}
+	csr, err := pki.ParseCSR([]byte(req.CSR))
+	if err != nil {
+		return nil, err
+	}
+
+	m.certMu.Lock()
+	defer m.certMu.Unlock()
+
+	hash := pki.TokenHash(token)
+	bt, err := m.BootstrapTokenDb.Get(hash)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	m.BootstrapTokenDb.Delete(hash)
+	if time.Now().After(bt.Expires) {
+		return nil, errInvalidToken
+	}
+
+	name := csr.Subject.CommonName
+	for _, c := range m.GetCertificates() {
+		if c.Name == name && !c.Revoked && time.Now().Before(c.NotAfter) {
+			return nil, fmt.Errorf("%w: node %s has certificate %s; revoke it first", ErrAlreadyExists, name, c.Serial)
+		}
+	}
+	return m.signNodeCSR(csr, req.Address)
+}
+
+// RenewCertificate signs a new certificate for the registered node that
+// presents the certificate peer, which must have been issued by the CA and
+// not revoked. The old certificate is revoked, so a node holds one valid
+// certificate at a time.
+func (m *Manager) RenewCertificate(peer *x509.Certificate, req worker.CertRequest) (*worker.CertResponse, error) {
+	if err := m.checkCA(); err != nil {
+		return nil, err
+	}
+	csr, err := pki.ParseCSR([]byte(req.CSR))
+	if err != nil {
+		return nil, err
+	}
+
+	m.certMu.Lock()
+	defer m.certMu.Unlock()
+
+	serial := pki.Serial(peer)
+	old, err := m.CertDb.Get(serial)
+	if err != nil {
+		return nil, fmt.Errorf("%w: certificate %s was not issued by the CA", ErrForbidden, serial)
+	}
+	if old.Revoked {
+		return nil, fmt.Errorf("%w: certificate %s is revoked", ErrForbidden, serial)
+	}
+	name := peer.Subject.CommonName
+	if csr.Subject.CommonName != name {
+		return nil, fmt.Errorf("%w: certificate of %s can't be renewed for %s", ErrForbidden,
+			name, csr.Subject.CommonName)
+	}
+	// A deregistered node needs a new join token to come back.
+	if _, err := m.getNode(name); err != nil {
+		return nil, fmt.Errorf("%w: node %s is not registered", ErrForbidden, name)
+	}
+
+	resp, err := m.signNodeCSR(csr, req.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.revoke(old); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// signNodeCSR issues a node a certificate for the host of the address it
+// advertises, unless the host is one of the manager's or another node's.
+// A registered node must ask for the address it registered with.
+func (m *Manager) signNodeCSR(csr *x509.CertificateRequest, address string) (*worker.CertResponse, error) {
+	name := csr.Subject.CommonName
+	if name == "" {
+		return nil, errors.New("certificate request has no common name")
+	}
+	if name == m.CertName {
+		return nil, fmt.Errorf("%w: %s is the name of the manager", ErrForbidden, name)
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid node address %q: %v", address, err)
+	}
+	if pki.HasHost(m.Hosts, host) {
+		return nil, fmt.Errorf("%w: %s is a host of the manager", ErrForbidden, host)
+	}
+	for _, n := range m.GetNodes() {
+		if n.Name != name && pki.HasHost([]string{n.Host()}, host) {
+			return nil, fmt.Errorf("%w: %s is the address of node %s", ErrForbidden, host, n.Name)
+		}
+		if n.Name == name && !pki.HasHost([]string{n.Host()}, host) {
+			return nil, fmt.Errorf("%w: node %s is registered at %s", ErrForbidden, name, n.Host())
+		}
+	}
+	hosts := []string{host}
+	for _, h := range pki.RequestHosts(csr) {
+		if !pki.HasHost(hosts, h) {
+			return nil, fmt.Errorf("%w: %s is not the address of node %s", ErrForbidden, h, name)
+		}
+	}
+	cert, certPEM, err := m.CA.Sign(csr, pki.NodeGroup, hosts, m.CertValidity)
+	if err != nil {
+		return nil, err
+	}
+	err = m.CertDb.Put(pki.Serial(cert), pki.NewRecord(cert))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Issued certificate %s to node %s, valid until %v\n", pki.Serial(cert), name, cert.NotAfter)
+	return &worker.CertResponse{Certificate: string(certPEM), CA: string(m.CA.CertPEM)}, nil
+}
+
+// GetCertificates returns the certificates issued by the CA, oldest first.
+func (m *Manager) GetCertificates() []*pki.Certificate {
+	certs, _ := m.CertDb.List()
+	sort.Slice(certs, func(i, j int) bool {
+		return certs[i].NotBefore.Before(certs[j].NotBefore)
+	})
+	return certs
+}
+
+func (m *Manager) GetCertificate(serial string) (*pki.Certificate, error) {
+	c, err := m.CertDb.Get(serial)
+	if err != nil {
+		return nil, fmt.Errorf("%w: certificate %s", ErrNotFound, serial)
+	}
+	return c, nil
+}
+
+// RevokeCertificate puts a certificate on the revocation list. The node
+// that holds it can't connect to the manager, or be reached by it, any
+// more.
+func (m *Manager) RevokeCertificate(serial string) (*pki.Certificate, error) {
+	m.certMu.Lock()
+	defer m.certMu.Unlock()
+
+	c, err := m.GetCertificate(serial)
+	if err != nil {
+		return nil, err
+	}
+	if c.Revoked {
+		return c, nil
+	}
+	err = m.revoke(c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// revoke puts the certificate c on the revocation list. certMu must be
+// held.
+func (m *Manager) revoke(c *pki.Certificate) error {
+	now := time.Now().UTC()
+	c.Revoked = true
+	c.RevokeTime = &now
+	err := m.CertDb.Put(c.Serial, c)
+	if err != nil {
+		return err
+	}
+	// Connections to the node that are kept open were verified before.
+	m.Client.CloseIdleConnections()
+	log.Printf("Revoked certificate %s of node %s\n", c.Serial, c.Name)
+	return nil
+}
+
+// VerifyConnection refuses TLS connections whose peer presents a revoked
+// certificate. It is used both by the API and by the client of the
+// worker APIs.
+func (m *Manager) VerifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+	serial := pki.Serial(cs.PeerCertificates[0])
+	if c, err := m.CertDb.Get(serial); err == nil && c.Revoked {
+		return fmt.Errorf("certificate %s of %s is revoked", serial, c.Name)
+	}
+	return nil
+}
+
+// IssueOwnCertificate issues the manager a certificate of the CA for hosts,
+// unless the key pair in certFile and keyFile is still fresh.
+func (m *Manager) IssueOwnCertificate(certFile, keyFile string, hosts []string) error {
+	if err := m.checkCA(); err != nil {
+		return err
+	}
+	if kp, err := pki.LoadKeyPair(certFile, keyFile); err == nil && !kp.NeedsRenewal(time.Now()) {
+		return nil
+	}
+	_, certPEM, keyPEM, err := m.CA.Issue(m.CertName, "", hosts, m.CertValidity)
+	if err != nil {
+		return err
+	}
+	return pki.WriteKeyPair(certFile, keyFile, certPEM, keyPEM)
+}
+
+// RotateCertificate renews the manager's own certificate from the CA
+// before it expires.
+func (m *Manager) RotateCertificate(kp *pki.KeyPair, hosts []string) {
+	for {
+		if kp.NeedsRenewal(time.Now()) {
+			_, certPEM, keyPEM, err := m.CA.Issue(m.CertName, "", hosts, m.CertValidity)
+			if err == nil {
+				err = kp.Update(certPEM, keyPEM)
+			}
+			if err != nil {
+				log.Printf("Error renewing the certificate of the manager: %v\n", err)
+			} else {
+				log.Printf("Renewed the certificate of the manager, valid until %v\n", kp.Leaf().NotAfter)
+			}
+		}
+		time.Sleep(m.Intervals.Certificates)
+	}
+}
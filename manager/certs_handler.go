@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"cube/worker"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultTokenTTL is how long a join token is valid for when no ttl is
+// given.
+const defaultTokenTTL = 24 * time.Hour
+
+// refuseRevoked rejects the requests of connections that were opened with
+// a certificate that has been revoked since.
+func (a *Api) refuseRevoked(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			if err := a.Manager.VerifyConnection(*r.TLS); err != nil {
+				sendError(w, http.StatusForbidden, err.Error())
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Api) GetCAHandler(w http.ResponseWriter, r *http.Request) {
+	if err := a.Manager.checkCA(); err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.WriteHeader(http.StatusOK)
+	w.Write(a.Manager.CA.CertPEM)
+}
+
+func (a *Api) CreateBootstrapTokenHandler(w http.ResponseWriter, r *http.Request) {
+	ttl := defaultTokenTTL
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid ttl %q", v))
+			return
+		}
+		ttl = d
+	}
+
+	t, err := a.Manager.CreateBootstrapToken(ttl)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	log.Printf("Created a join token valid until %v\n", t.Expires)
+	sendJSON(w, http.StatusCreated, t)
+}
+
+func (a *Api) SignCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	req := worker.CertRequest{}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	resp, err := a.Manager.IssueCertificate(r.Header.Get(worker.JoinTokenHeader), req)
+	if errors.Is(err, errInvalidToken) {
+		log.Printf("Rejected certificate request with an invalid join token from %s\n", r.RemoteAddr)
+		sendError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusCreated, resp)
+}
+
+func (a *Api) RenewCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		sendError(w, http.StatusUnauthorized, "renewing a certificate needs the current one")
+		return
+	}
+	req := worker.CertRequest{}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	resp, err := a.Manager.RenewCertificate(r.TLS.VerifiedChains[0][0], req)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusCreated, resp)
+}
+
+func (a *Api) GetCertificatesHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, a.Manager.GetCertificates())
+}
+
+func (a *Api) GetCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := a.Manager.GetCertificate(chi.URLParam(r, "serial"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, c)
+}
+
+func (a *Api) RevokeCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := a.Manager.RevokeCertificate(chi.URLParam(r, "serial"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, c)
+}
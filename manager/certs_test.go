@@ -0,0 +1,187 @@
+package manager
+
+import (
+	"crypto/x509"
+	"cube/pki"
+	"cube/worker"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestCA(t *testing.T) *Manager {
+	t.Helper()
+	m := newTestManager(t)
+	ca, err := pki.LoadOrCreateCA(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA: %v", err)
+	}
+	m.CA = ca
+	m.CertName = "cube-manager"
+	m.CertValidity = time.Hour
+	m.Hosts = []string{"manager.example.com", "10.0.0.1"}
+	return m
+}
+
+// issue requests a certificate for name and hosts with a new join token,
+// for a node that advertises address.
+func issue(t *testing.T, m *Manager, name, address string, hosts ...string) (*worker.CertResponse, error) {
+	t.Helper()
+	bt, err := m.CreateBootstrapToken(time.Minute)
+	if err != nil {
+		t.Fatalf("CreateBootstrapToken: %v", err)
+	}
+	_, csr, err := pki.NewCSR(name, hosts)
+	if err != nil {
+		t.Fatalf("NewCSR: %v", err)
+	}
+	return m.IssueCertificate(bt.Token, worker.CertRequest{CSR: string(csr), Address: address})
+}
+
+func TestIssueCertificateOnlyForAdvertisedHost(t *testing.T) {
+	m := newTestCA(t)
+	if _, err := m.RegisterNode(worker.Registration{Name: "w1", Address: "10.0.0.5:5556"}); err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		hosts   []string
+	}{
+		{"w2", "MANAGER.example.com:5556", []string{"manager.example.com"}},
+		{"w2", "10.0.0.1:5556", []string{"10.0.0.1"}},
+		{"w2", "10.0.0.5:5556", []string{"10.0.0.5"}},
+		{"w2", "10.0.0.6:5556", []string{"10.0.0.6", "10.0.0.1"}},
+		{"w2", "10.0.0.6:5556", []string{"node-2.example.com"}},
+		{"w1", "10.0.0.9:5556", []string{"10.0.0.9"}},
+	}
+	for _, tt := range tests {
+		if _, err := issue(t, m, tt.name, tt.address, tt.hosts...); !errors.Is(err, ErrForbidden) {
+			t.Errorf("issuing %s at %s for %v: got %v, want forbidden", tt.name, tt.address, tt.hosts, err)
+		}
+	}
+
+	if _, err := issue(t, m, "w1", "10.0.0.5:5556", "10.0.0.5"); err != nil {
+		t.Errorf("issuing w1 for its registered address: %v", err)
+	}
+	cr, err := issue(t, m, "w2", "node-2.example.com:5556", "node-2.example.com")
+	if err != nil {
+		t.Fatalf("issuing new node w2: %v", err)
+	}
+	cert, err := pki.ParseCertificate([]byte(cr.Certificate))
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "node-2.example.com" || len(cert.IPAddresses) != 0 {
+		t.Errorf("certificate of w2 is for %v and %v", cert.DNSNames, cert.IPAddresses)
+	}
+}
+
+func TestRenewCertificateKeepsAddress(t *testing.T) {
+	m := newTestCA(t)
+	cr, err := issue(t, m, "w1", "10.0.0.5:5556", "10.0.0.5")
+	if err != nil {
+		t.Fatalf("IssueCertificate: %v", err)
+	}
+	peer, err := pki.ParseCertificate([]byte(cr.Certificate))
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	if _, err := m.RegisterNode(worker.Registration{Name: "w1", Address: "10.0.0.5:5556"}); err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+
+	renew := func(address string, hosts ...string) error {
+		_, csr, err := pki.NewCSR("w1", hosts)
+		if err != nil {
+			t.Fatalf("NewCSR: %v", err)
+		}
+		_, err = m.RenewCertificate(peer, worker.CertRequest{CSR: string(csr), Address: address})
+		return err
+	}
+	if err := renew("10.0.0.5:5556", "10.0.0.5", "evil.example.com"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("renewing for another host: got %v, want forbidden", err)
+	}
+	if err := renew("10.0.0.7:5556", "10.0.0.7"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("renewing for another address: got %v, want forbidden", err)
+	}
+	if err := renew("10.0.0.5:5556", "10.0.0.5"); err != nil {
+		t.Errorf("renewing for the same address: %v", err)
+	}
+}
+
+// renewCert asks for a new certificate of name at address with the certificate
+// peer.
+func renewCert(t *testing.T, m *Manager, peer *x509.Certificate, name, address string) (*x509.Certificate, error) {
+	t.Helper()
+	host, _, _ := net.SplitHostPort(address)
+	_, csr, err := pki.NewCSR(name, []string{host})
+	if err != nil {
+		t.Fatalf("NewCSR: %v", err)
+	}
+	cr, err := m.RenewCertificate(peer, worker.CertRequest{CSR: string(csr), Address: address})
+	if err != nil {
+		return nil, err
+	}
+	cert, err := pki.ParseCertificate([]byte(cr.Certificate))
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return cert, nil
+}
+
+func TestRenewCertificateRevokesOldOne(t *testing.T) {
+	m := newTestCA(t)
+	cr, err := issue(t, m, "w1", "10.0.0.5:5556", "10.0.0.5")
+	if err != nil {
+		t.Fatalf("IssueCertificate: %v", err)
+	}
+	first, err := pki.ParseCertificate([]byte(cr.Certificate))
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	if _, err := m.RegisterNode(worker.Registration{Name: "w1", Address: "10.0.0.5:5556"}); err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+
+	second, err := renewCert(t, m, first, "w1", "10.0.0.5:5556")
+	if err != nil {
+		t.Fatalf("renewing: %v", err)
+	}
+	if c, _ := m.GetCertificate(pki.Serial(first)); !c.Revoked {
+		t.Errorf("certificate %s is still valid after it was renewed", c.Serial)
+	}
+	if _, err := renewCert(t, m, first, "w1", "10.0.0.5:5556"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("renewing a renewed certificate: got %v, want forbidden", err)
+	}
+	if _, err := renewCert(t, m, second, "w1", "10.0.0.5:5556"); err != nil {
+		t.Errorf("renewing the new certificate: %v", err)
+	}
+}
+
+func TestRenewCertificateOfDeregisteredNode(t *testing.T) {
+	m := newTestCA(t)
+	cr, err := issue(t, m, "w1", "10.0.0.5:5556", "10.0.0.5")
+	if err != nil {
+		t.Fatalf("IssueCertificate: %v", err)
+	}
+	peer, err := pki.ParseCertificate([]byte(cr.Certificate))
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	if _, err := m.RegisterNode(worker.Registration{Name: "w1", Address: "10.0.0.5:5556"}); err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+	if err := m.DeregisterNode("w1"); err != nil {
+		t.Fatalf("DeregisterNode: %v", err)
+	}
+
+	if _, err := renewCert(t, m, peer, "w1", "10.0.0.5:5556"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("renewing for a deregistered node: got %v, want forbidden", err)
+	}
+	if c, _ := m.GetCertificate(pki.Serial(peer)); c.Revoked {
+		t.Error("certificate was revoked by a refused renewal")
+	}
+}
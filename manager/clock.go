@@ -0,0 +1,15 @@
+package manager
+
+import "time"
+
+// Clock tells the time to controllers that act on a schedule, so that it
+// can be replaced in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
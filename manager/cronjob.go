@@ -0,0 +1,327 @@
+package manager
+
+import (
+	"cube/cronjob"
+	"cube/job"
+	"cube/namespace"
+	"cube/task"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// cronRun is one run of a cron job: either a task or a job.
+type cronRun struct {
+	name      string
+	start     time.Time
+	active    bool
+	finished  bool
+	succeeded bool
+	task      *task.Task
+	job       *job.Job
+}
+
+func (m *Manager) CreateCronJob(c *cronjob.CronJob) error {
+	if c.Namespace == "" {
+		c.Namespace = namespace.Default
+	}
+	c.SetDefaults()
+	err := c.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	err = m.checkNamespace(c.Namespace)
+	if err != nil {
+		return err
+	}
+	key := namespace.Key(c.Namespace, c.Name)
+	if _, err := m.CronJobDb.Get(key); err == nil {
+		return fmt.Errorf("%w: cron job %s", ErrAlreadyExists, key)
+	}
+	c.CreateTime = m.Clock.Now().UTC()
+	c.Status = cronjob.Status{}
+	return m.CronJobDb.Put(key, c)
+}
+
+// UpdateCronJob replaces the schedule, policies and template of a cron job.
+// Runs that were already started are left alone.
+func (m *Manager) UpdateCronJob(ns, name string, spec *cronjob.CronJob) (*cronjob.CronJob, error) {
+	if spec.Name == "" {
+		spec.Name = name
+	}
+	if spec.Namespace == "" {
+		spec.Namespace = ns
+	}
+	if spec.Name != name || spec.Namespace != ns {
+		return nil, fmt.Errorf("cron job %s cannot be renamed to %s", namespace.Key(ns, name),
+			namespace.Key(spec.Namespace, spec.Name))
+	}
+	spec.SetDefaults()
+	err := spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	c, err := m.GetCronJob(ns, name)
+	if err != nil {
+		return nil, err
+	}
+	updated := *spec
+	updated.CreateTime = c.CreateTime
+	updated.Status = c.Status
+	err = m.CronJobDb.Put(namespace.Key(ns, name), &updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (m *Manager) GetCronJob(ns, name string) (*cronjob.CronJob, error) {
+	key := namespace.Key(ns, name)
+	c, err := m.CronJobDb.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cron job %s", ErrNotFound, key)
+	}
+	return c, nil
+}
+
+// GetCronJobs lists the cron jobs of a namespace, or of all namespaces if
+// ns is empty.
+func (m *Manager) GetCronJobs(ns string) []*cronjob.CronJob {
+	all, _ := m.CronJobDb.List()
+	cronJobs := []*cronjob.CronJob{}
+	for _, c := range all {
+		if ns == "" || c.Namespace == ns {
+			cronJobs = append(cronJobs, c)
+		}
+	}
+	sort.Slice(cronJobs, func(i, j int) bool {
+		return namespace.Key(cronJobs[i].Namespace, cronJobs[i].Name) <
+			namespace.Key(cronJobs[j].Namespace, cronJobs[j].Name)
+	})
+	return cronJobs
+}
+
+// DeleteCronJob removes a cron job and stops its active runs.
+func (m *Manager) DeleteCronJob(ns, name string) error {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	return m.deleteCronJob(ns, name)
+}
+
+func (m *Manager) deleteCronJob(ns, name string) error {
+	c, err := m.GetCronJob(ns, name)
+	if err != nil {
+		return err
+	}
+	err = m.CronJobDb.Delete(namespace.Key(ns, name))
+	if err != nil {
+		return err
+	}
+
+	for _, r := range m.cronRuns(c) {
+		if r.active {
+			m.stopCronRun(c, r, fmt.Sprintf("Cron job %s was deleted", name))
+		}
+	}
+	log.Printf("Deleted cron job %s\n", namespace.Key(ns, name))
+	return nil
+}
+
+func (m *Manager) ReconcileCronJobs() {
+	for {
+		log.Println("Reconciling cron jobs")
+		m.reconcileCronJobs()
+		log.Println("Cron job reconciliation completed")
+		log.Printf("Sleeping for %v\n", m.Intervals.Reconcile)
+		time.Sleep(m.Intervals.Reconcile)
+	}
+}
+
+func (m *Manager) reconcileCronJobs() {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	now := m.Clock.Now().UTC()
+	cronJobs, _ := m.CronJobDb.List()
+	for _, c := range cronJobs {
+		m.reconcileCronJob(c, now)
+	}
+}
+
+// reconcileCronJob starts the latest run of a cron job that is due, subject
+// to its starting deadline and concurrency policy, and removes finished runs
+// beyond the history limits. When several runs were missed, for example
+// while the manager was down, only the latest one is started.
+func (m *Manager) reconcileCronJob(c *cronjob.CronJob, now time.Time) {
+	status := c.Status
+	runs := m.cronRuns(c)
+
+	due, count, err := c.LastMissed(now)
+	if err != nil {
+		log.Printf("Error reading schedule of cron job %s: %v\n", c.Name, err)
+		return
+	}
+	if !due.IsZero() {
+		status.LastScheduleTime = due
+		if count > 1 {
+			log.Printf("Cron job %s missed %d runs, only starting the one due at %v\n", c.Name, count-1, due)
+			status.MissedRuns += count - 1
+		}
+
+		var active []*cronRun
+		for _, r := range runs {
+			if r.active {
+				active = append(active, r)
+			}
+		}
+
+		deadline := time.Duration(c.StartingDeadlineSeconds) * time.Second
+		switch {
+		case deadline > 0 && now.Sub(due) > deadline:
+			log.Printf("Cron job %s missed the starting deadline of the run due at %v\n", c.Name, due)
+			status.MissedRuns++
+		case c.ConcurrencyPolicy == cronjob.Forbid && len(active) > 0:
+			log.Printf("Cron job %s is still running, skipping the run due at %v\n", c.Name, due)
+			status.MissedRuns++
+		default:
+			if c.ConcurrencyPolicy == cronjob.Replace {
+				for _, r := range active {
+					m.stopCronRun(c, r, fmt.Sprintf("Replaced by the run of cron job %s due at %v", c.Name, due))
+				}
+			}
+			err := m.startCronRun(c, due)
+			if err != nil {
+				log.Printf("Error starting cron job %s: %v\n", c.Name, err)
+				status.AdmissionError = err.Error()
+			} else {
+				status.LastStartTime = now
+				status.AdmissionError = ""
+			}
+		}
+		runs = m.cronRuns(c)
+	}
+
+	m.pruneCronRuns(c, runs)
+
+	status.Active = nil
+	for _, r := range runs {
+		if r.active {
+			status.Active = append(status.Active, r.name)
+		}
+	}
+
+	if !reflect.DeepEqual(status, c.Status) {
+		updated := *c
+		updated.Status = status
+		m.CronJobDb.Put(namespace.Key(c.Namespace, c.Name), &updated)
+	}
+}
+
+func (m *Manager) startCronRun(c *cronjob.CronJob, due time.Time) error {
+	if c.TaskTemplate != nil {
+		t, err := m.createTask(c.Namespace, *c.TaskTemplate, c.Name, c.Owner())
+		if err != nil {
+			return err
+		}
+		log.Printf("Cron job %s started task %s\n", c.Name, t.Name)
+		return nil
+	}
+
+	j := *c.JobTemplate
+	j.Name = fmt.Sprintf("%s-%d", c.Name, due.Unix()/60)
+	j.Namespace = c.Namespace
+	j.Parent = c.Owner()
+	err := m.createJob(&j)
+	if err != nil {
+		return err
+	}
+	log.Printf("Cron job %s started job %s\n", c.Name, j.Name)
+	return nil
+}
+
+func (m *Manager) stopCronRun(c *cronjob.CronJob, r *cronRun, reason string) {
+	if r.task != nil {
+		m.StopTask(r.task, reason)
+		return
+	}
+	err := m.deleteJob(c.Namespace, r.name)
+	if err != nil {
+		log.Printf("Error deleting job %s: %v\n", r.name, err)
+	}
+}
+
+// pruneCronRuns removes the oldest finished runs beyond the history limits.
+func (m *Manager) pruneCronRuns(c *cronjob.CronJob, runs []*cronRun) {
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].start.After(runs[j].start)
+	})
+
+	succeeded, failed := 0, 0
+	for _, r := range runs {
+		if !r.finished {
+			continue
+		}
+		if r.succeeded {
+			succeeded++
+			if succeeded <= c.SuccessfulHistoryLimit {
+				continue
+			}
+		} else {
+			failed++
+			if failed <= c.FailedHistoryLimit {
+				continue
+			}
+		}
+
+		if r.task != nil {
+			m.deleteTask(r.task.ID)
+		} else {
+			m.deleteJob(c.Namespace, r.name)
+		}
+		log.Printf("Removed run %s of cron job %s from the history\n", r.name, c.Name)
+	}
+}
+
+// cronRuns returns the tasks or jobs started by a cron job.
+func (m *Manager) cronRuns(c *cronjob.CronJob) []*cronRun {
+	var runs []*cronRun
+	if c.TaskTemplate != nil {
+		for _, t := range m.ownedTasks(c.Namespace, c.Owner(), func(map[string]string) bool { return true }) {
+			runs = append(runs, &cronRun{
+				name:      t.Name,
+				start:     t.SubmitTime,
+				active:    !isFinished(t.State) && !m.isStopping(t.ID),
+				finished:  isFinished(t.State),
+				succeeded: t.State == task.Completed && t.Reason == "",
+				task:      t,
+			})
+		}
+		return runs
+	}
+
+	jobs, _ := m.JobDb.List()
+	for _, j := range jobs {
+		if j.Namespace == c.Namespace && j.Parent == c.Owner() {
+			runs = append(runs, &cronRun{
+				name:      j.Name,
+				start:     j.CreateTime,
+				active:    !j.Finished(),
+				finished:  j.Finished(),
+				succeeded: j.Status.Phase == job.Complete,
+				job:       j,
+			})
+		}
+	}
+	return runs
+}
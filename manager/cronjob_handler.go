@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"cube/cronjob"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (a *Api) CreateCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	c := cronjob.CronJob{}
+	if !decodeBody(w, r, &c) || !inNamespace(w, r, &c.Namespace) {
+		return
+	}
+
+	err := a.Manager.CreateCronJob(&c)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+
+	log.Printf("Created cron job %s\n", c.Name)
+	sendJSON(w, http.StatusCreated, c)
+}
+
+func (a *Api) GetCronJobsHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, a.Manager.GetCronJobs(listNamespace(r)))
+}
+
+func (a *Api) GetCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	c, err := a.Manager.GetCronJob(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, c)
+}
+
+func (a *Api) UpdateCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	spec := cronjob.CronJob{}
+	if !decodeBody(w, r, &spec) {
+		return
+	}
+
+	c, err := a.Manager.UpdateCronJob(namespaceOf(r), chi.URLParam(r, "name"), &spec)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, c)
+}
+
+func (a *Api) DeleteCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.Manager.DeleteCronJob(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,118 @@
+package manager
+
+import (
+	"cube/cronjob"
+	"cube/job"
+	"cube/namespace"
+	"cube/task"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestCronJobRunsOnTheClock(t *testing.T) {
+	m := newTestManager(t)
+	clock := &fakeClock{now: time.Date(2026, 3, 2, 9, 59, 0, 0, time.UTC)}
+	m.Clock = clock
+
+	c := &cronjob.CronJob{
+		Name:         "report",
+		Schedule:     "0 10 * * *",
+		TaskTemplate: &task.Task{Image: "alpine"},
+	}
+	if err := m.CreateCronJob(c); err != nil {
+		t.Fatalf("CreateCronJob: %v", err)
+	}
+
+	m.reconcileCronJobs()
+	if runs := m.cronRuns(c); len(runs) != 0 {
+		t.Fatalf("cron job started %d runs before it was due", len(runs))
+	}
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	m.reconcileCronJobs()
+	runs := m.cronRuns(c)
+	if len(runs) != 1 {
+		t.Fatalf("cron job has %d runs once due, want 1", len(runs))
+	}
+	if !runs[0].task.SubmitTime.Equal(clock.now) {
+		t.Errorf("run was submitted at %v, want the clock's time %v", runs[0].task.SubmitTime, clock.now)
+	}
+	got, _ := m.GetCronJob(namespace.Default, "report")
+	if !got.Status.LastScheduleTime.Equal(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("last schedule time is %v, want 10:00", got.Status.LastScheduleTime)
+	}
+}
+
+func TestPruneCronRunsRemovesEvents(t *testing.T) {
+	m := newTestManager(t)
+	clock := &fakeClock{now: time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)}
+	m.Clock = clock
+
+	c := &cronjob.CronJob{
+		Name:         "report",
+		Schedule:     "* * * * *",
+		TaskTemplate: &task.Task{Image: "alpine"},
+	}
+	if err := m.CreateCronJob(c); err != nil {
+		t.Fatalf("CreateCronJob: %v", err)
+	}
+	// Keep no failed runs.
+	c, _ = m.GetCronJob(namespace.Default, "report")
+	c.FailedHistoryLimit = 0
+
+	clock.now = clock.now.Add(time.Minute)
+	m.reconcileCronJob(c, clock.now)
+	runs := m.cronRuns(c)
+	if len(runs) != 1 {
+		t.Fatalf("cron job has %d runs, want 1", len(runs))
+	}
+	failed := runs[0].task
+	failed.State = task.Failed
+	m.TaskDb.Put(failed.ID.String(), failed)
+	if events, _ := m.GetTaskEvents(failed.ID); len(events) == 0 {
+		t.Fatal("run has no events to prune")
+	}
+
+	m.pruneCronRuns(c, m.cronRuns(c))
+
+	if _, err := m.TaskDb.Get(failed.ID.String()); err == nil {
+		t.Error("failed run beyond the history limit was kept")
+	}
+	if ids, _ := m.EventIndex.Get(failed.ID.String()); len(ids) != 0 {
+		t.Errorf("pruned run still has %d indexed events", len(ids))
+	}
+	if events, _ := m.EventDb.List(); len(events) != 0 {
+		t.Errorf("%d events of the pruned run were kept", len(events))
+	}
+}
+
+func TestJobDeadlineUsesTheClock(t *testing.T) {
+	m := newTestManager(t)
+	clock := &fakeClock{now: time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)}
+	m.Clock = clock
+
+	j := &job.Job{Name: "backup", ActiveDeadlineSeconds: 60, Template: task.Task{Image: "alpine"}}
+	if err := m.CreateJob(j); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	m.reconcileJobs()
+	if j, _ := m.GetJob(namespace.Default, "backup"); j.Status.Phase != job.Active {
+		t.Fatalf("job is %s before its deadline", j.Status.Phase)
+	}
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	m.reconcileJobs()
+	got, _ := m.GetJob(namespace.Default, "backup")
+	if got.Status.Phase != job.Failed || !got.Status.CompletionTime.Equal(clock.now) {
+		t.Errorf("job is %s, completed at %v; want %s at %v", got.Status.Phase, got.Status.CompletionTime, job.Failed, clock.now)
+	}
+}
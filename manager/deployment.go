@@ -0,0 +1,468 @@
+package manager
+
+import (
+	"cube/deployment"
+	"cube/namespace"
+	"cube/task"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound      = errors.New("object not found")
+	ErrAlreadyExists = errors.New("object already exists")
+	ErrForbidden     = errors.New("forbidden")
+)
+
+func (m *Manager) CreateDeployment(d *deployment.Deployment) error {
+	if d.Namespace == "" {
+		d.Namespace = namespace.Default
+	}
+	err := d.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	err = m.checkNamespace(d.Namespace)
+	if err != nil {
+		return err
+	}
+	key := namespace.Key(d.Namespace, d.Name)
+	if _, err := m.DeploymentDb.Get(key); err == nil {
+		return fmt.Errorf("%w: deployment %s", ErrAlreadyExists, key)
+	}
+	d.CreateTime = time.Now().UTC()
+	d.Status = deployment.Status{}
+	d.Revision = 0
+	d.Revisions = nil
+	d.SetTemplate(d.Template, d.CreateTime)
+	return m.DeploymentDb.Put(key, d)
+}
+
+// UpdateDeployment changes the replica count, strategy and template of a
+// deployment. A changed template starts a rollout of a new revision.
+func (m *Manager) UpdateDeployment(ns, name string, spec *deployment.Deployment) (*deployment.Deployment, error) {
+	if spec.Name == "" {
+		spec.Name = name
+	}
+	if spec.Namespace == "" {
+		spec.Namespace = ns
+	}
+	if spec.Name != name || spec.Namespace != ns {
+		return nil, fmt.Errorf("deployment %s cannot be renamed to %s", namespace.Key(ns, name),
+			namespace.Key(spec.Namespace, spec.Name))
+	}
+	err := spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	d, err := m.GetDeployment(ns, name)
+	if err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(d.Selector, spec.Selector) {
+		return nil, fmt.Errorf("selector of deployment %s cannot be changed", name)
+	}
+
+	updated := *d
+	updated.Replicas = spec.Replicas
+	updated.Strategy = spec.Strategy
+	updated.RevisionHistoryLimit = spec.RevisionHistoryLimit
+	if updated.SetTemplate(spec.Template, time.Now().UTC()) {
+		log.Printf("Rolling out revision %d of deployment %s\n", updated.Revision, name)
+	}
+	err = m.DeploymentDb.Put(namespace.Key(ns, name), &updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// RollbackDeployment rolls a deployment out with the template of an earlier
+// revision, which becomes the newest one. Revision 0 means the previous one.
+func (m *Manager) RollbackDeployment(ns, name string, revision int) (*deployment.Deployment, error) {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	d, err := m.GetDeployment(ns, name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := d.FindRevision(revision)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+
+	updated := *d
+	updated.SetTemplate(r.Template, time.Now().UTC())
+	err = m.DeploymentDb.Put(namespace.Key(ns, name), &updated)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Rolled deployment %s back to revision %d as revision %d\n", name, r.Number, updated.Revision)
+	return &updated, nil
+}
+
+// GetRolloutStatus reports the progress of the latest rollout of a
+// deployment.
+func (m *Manager) GetRolloutStatus(ns, name string) (*deployment.RolloutStatus, error) {
+	d, err := m.GetDeployment(ns, name)
+	if err != nil {
+		return nil, err
+	}
+	return d.RolloutStatus(), nil
+}
+
+func (m *Manager) GetDeployment(ns, name string) (*deployment.Deployment, error) {
+	key := namespace.Key(ns, name)
+	d, err := m.DeploymentDb.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: deployment %s", ErrNotFound, key)
+	}
+	return d, nil
+}
+
+// GetDeployments lists the deployments of a namespace, or of all
+// namespaces if ns is empty.
+func (m *Manager) GetDeployments(ns string) []*deployment.Deployment {
+	all, _ := m.DeploymentDb.List()
+	deployments := []*deployment.Deployment{}
+	for _, d := range all {
+		if ns == "" || d.Namespace == ns {
+			deployments = append(deployments, d)
+		}
+	}
+	sort.Slice(deployments, func(i, j int) bool {
+		return namespace.Key(deployments[i].Namespace, deployments[i].Name) <
+			namespace.Key(deployments[j].Namespace, deployments[j].Name)
+	})
+	return deployments
+}
+
+func (m *Manager) ScaleDeployment(ns, name string, replicas int) (*deployment.Deployment, error) {
+	if replicas < 0 {
+		return nil, fmt.Errorf("replica count must not be negative")
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	d, err := m.GetDeployment(ns, name)
+	if err != nil {
+		return nil, err
+	}
+	updated := *d
+	updated.Replicas = replicas
+	err = m.DeploymentDb.Put(namespace.Key(ns, name), &updated)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Scaled deployment %s to %d replicas\n", name, replicas)
+	return &updated, nil
+}
+
+// DeleteDeployment removes a deployment and stops all of its tasks.
+func (m *Manager) DeleteDeployment(ns, name string) error {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	return m.deleteDeployment(ns, name)
+}
+
+func (m *Manager) deleteDeployment(ns, name string) error {
+	d, err := m.GetDeployment(ns, name)
+	if err != nil {
+		return err
+	}
+	err = m.DeploymentDb.Delete(namespace.Key(ns, name))
+	if err != nil {
+		return err
+	}
+
+	for _, t := range m.activeTasks(ns, d.Owner()) {
+		m.StopTask(t, fmt.Sprintf("Deployment %s was deleted", name))
+	}
+	log.Printf("Deleted deployment %s\n", namespace.Key(ns, name))
+	return nil
+}
+
+func (m *Manager) ReconcileDeployments() {
+	for {
+		log.Println("Reconciling deployments")
+		m.reconcileDeployments()
+		log.Println("Deployment reconciliation completed")
+		log.Printf("Sleeping for %v\n", m.Intervals.Reconcile)
+		time.Sleep(m.Intervals.Reconcile)
+	}
+}
+
+func (m *Manager) reconcileDeployments() {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	deployments, _ := m.DeploymentDb.List()
+	for _, d := range deployments {
+		m.reconcileDeployment(d)
+	}
+}
+
+// reconcileDeployment creates or stops tasks until the active tasks of
+// the deployment all belong to its current revision and match its replica
+// count.
+func (m *Manager) reconcileDeployment(d *deployment.Deployment) {
+	owned := m.ownedTasks(d.Namespace, d.Owner(), d.Matches)
+
+	var current, old []*task.Task
+	for _, t := range m.filterActive(owned) {
+		if deployment.TaskRevision(t) == d.Revision {
+			current = append(current, t)
+		} else {
+			old = append(old, t)
+		}
+	}
+	for _, t := range current {
+		if t.State == task.Running && t.HealthCheck != "" && !t.Healthy {
+			m.updateHealth(t)
+		}
+	}
+
+	var err error
+	switch {
+	case len(old) == 0 && !m.hasUnfinished(owned, d.Revision):
+		err = m.scaleDeployment(d, owned, current)
+	case d.Strategy.Type == deployment.Recreate:
+		m.recreateDeployment(d, old)
+	default:
+		err = m.rollDeployment(d, owned, current, old)
+	}
+
+	m.updateDeploymentStatus(d, err)
+}
+
+func (m *Manager) scaleDeployment(d *deployment.Deployment, owned, current []*task.Task) error {
+	if diff := d.Replicas - len(current); diff > 0 {
+		return m.createDeploymentTasks(d, diff)
+	} else if diff < 0 {
+		log.Printf("Deployment %s has %d of %d replicas, stopping %d\n", d.Name, len(current), d.Replicas, -diff)
+		for _, t := range stopOrder(current)[:-diff] {
+			m.StopTask(t, fmt.Sprintf("Deployment %s was scaled down", d.Name))
+		}
+	}
+	return nil
+}
+
+// recreateDeployment stops every task of an old revision. Tasks of the
+// current revision are only created once the old ones have finished.
+func (m *Manager) recreateDeployment(d *deployment.Deployment, old []*task.Task) {
+	for _, t := range old {
+		m.StopTask(t, fmt.Sprintf("Replaced by revision %d of deployment %s", d.Revision, d.Name))
+	}
+	log.Printf("Deployment %s is waiting for old tasks to stop\n", d.Name)
+}
+
+// rollDeployment moves a deployment one step towards its current revision:
+// it creates new tasks as far as MaxSurge allows and stops old ones as far
+// as MaxUnavailable allows. New tasks count as available once they run and
+// pass their health check, so old ones are only stopped after that.
+func (m *Manager) rollDeployment(d *deployment.Deployment, owned, current, old []*task.Task) error {
+	maxSurge, maxUnavailable := d.Limits()
+
+	create := d.Replicas - len(current)
+	if room := d.Replicas + maxSurge - len(current) - len(old); room < create {
+		create = room
+	}
+	var err error
+	if create > 0 {
+		err = m.createDeploymentTasks(d, create)
+	} else if extra := len(current) - d.Replicas; extra > 0 {
+		for _, t := range stopOrder(current)[:extra] {
+			m.StopTask(t, fmt.Sprintf("Deployment %s was scaled down", d.Name))
+		}
+	}
+
+	available := 0
+	for _, t := range append(current, old...) {
+		if isAvailable(t) {
+			available++
+		}
+	}
+	canStop := available - (d.Replicas - maxUnavailable)
+
+	reason := fmt.Sprintf("Replaced by revision %d of deployment %s", d.Revision, d.Name)
+	for _, t := range stopOrder(old) {
+		// Tasks that haven't started don't count towards availability.
+		if t.State != task.Running {
+			m.StopTask(t, reason)
+		} else if canStop > 0 {
+			m.StopTask(t, reason)
+			if isAvailable(t) {
+				canStop--
+			}
+		}
+	}
+	log.Printf("Deployment %s is rolling out revision %d: %d new, %d old, %d available\n",
+		d.Name, d.Revision, len(current), len(old), available)
+	return err
+}
+
+// createDeploymentTasks creates n tasks of the current revision, stopping
+// at the first one that is not admitted.
+func (m *Manager) createDeploymentTasks(d *deployment.Deployment, n int) error {
+	log.Printf("Creating %d tasks of revision %d for deployment %s\n", n, d.Revision, d.Name)
+
+	template := d.Template
+	template.Labels = make(map[string]string, len(d.Template.Labels)+1)
+	for k, v := range d.Template.Labels {
+		template.Labels[k] = v
+	}
+	template.Labels[deployment.RevisionLabel] = strconv.Itoa(d.Revision)
+	for i := 0; i < n; i++ {
+		if _, err := m.createTask(d.Namespace, template, d.Name, d.Owner()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasUnfinished reports whether a task of another revision is still
+// running, including ones that were asked to stop.
+func (m *Manager) hasUnfinished(tasks []*task.Task, revision int) bool {
+	for _, t := range tasks {
+		if !isFinished(t.State) && deployment.TaskRevision(t) != revision {
+			return true
+		}
+	}
+	return false
+}
+
+// updateDeploymentStatus counts the tasks of a deployment. admitErr is the
+// error of the last task that was not admitted in this pass, if any.
+func (m *Manager) updateDeploymentStatus(d *deployment.Deployment, admitErr error) {
+	owned := m.ownedTasks(d.Namespace, d.Owner(), d.Matches)
+	status := deployment.Status{Revision: d.Revision}
+	if admitErr != nil {
+		status.AdmissionError = admitErr.Error()
+	}
+	for _, t := range m.filterActive(owned) {
+		status.Replicas++
+		if deployment.TaskRevision(t) == d.Revision {
+			status.UpdatedReplicas++
+		}
+		if t.State == task.Running {
+			status.ReadyReplicas++
+		}
+		if isAvailable(t) {
+			status.AvailableReplicas++
+		}
+	}
+	for _, t := range owned {
+		if t.State == task.Failed {
+			status.FailedTasks++
+		}
+	}
+	status.RolloutComplete = status.Replicas == d.Replicas &&
+		status.UpdatedReplicas == d.Replicas && status.AvailableReplicas == d.Replicas
+
+	if status != d.Status {
+		updated := *d
+		updated.Status = status
+		m.DeploymentDb.Put(namespace.Key(d.Namespace, d.Name), &updated)
+	}
+}
+
+// isAvailable reports whether a task is running and has passed its health
+// check, if it has one.
+func isAvailable(t *task.Task) bool {
+	return t.State == task.Running && (t.HealthCheck == "" || t.Healthy)
+}
+
+// createTask submits a new task built from a controller's template. It
+// returns the error of the admission if the task was not admitted.
+func (m *Manager) createTask(ns string, template task.Task, prefix, owner string) (*task.Task, error) {
+	t := template
+	t.ID = uuid.New()
+	t.Name = fmt.Sprintf("%s-%s", prefix, t.ID.String()[:8])
+	t.Namespace = ns
+	t.State = task.Scheduled
+	t.Owner = owner
+	t.ContainerId = ""
+	t.HostPorts = nil
+	t.Healthy = false
+	t.ExitCode = 0
+	t.RestartCount = 0
+	t.Labels = make(map[string]string, len(template.Labels))
+	for k, v := range template.Labels {
+		t.Labels[k] = v
+	}
+
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Scheduled,
+		Timestamp: time.Now(),
+		Task:      t,
+		Message:   fmt.Sprintf("Created by %s", owner),
+	}
+	err := m.SubmitTask(&te)
+	if err != nil {
+		log.Printf("Task of %s was not admitted: %v\n", owner, err)
+		return nil, err
+	}
+	t = te.Task
+	return &t, nil
+}
+
+// ownedTasks returns the tasks of a namespace created by owner whose labels
+// are still matched by the controller's selector.
+func (m *Manager) ownedTasks(ns, owner string, matches func(map[string]string) bool) []*task.Task {
+	var tasks []*task.Task
+	for _, t := range m.GetTasks() {
+		if t.Namespace == ns && t.Owner == owner && matches(t.Labels) {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+func (m *Manager) activeTasks(ns, owner string) []*task.Task {
+	return m.filterActive(m.ownedTasks(ns, owner, func(map[string]string) bool { return true }))
+}
+
+// filterActive keeps the tasks that are pending, scheduled or running and
+// have not been asked to stop.
+func (m *Manager) filterActive(tasks []*task.Task) []*task.Task {
+	var active []*task.Task
+	for _, t := range tasks {
+		if !isFinished(t.State) && !m.isStopping(t.ID) {
+			active = append(active, t)
+		}
+	}
+	return active
+}
+
+// stopOrder sorts tasks so that the ones least worth keeping come first:
+// tasks that are not running yet, then the most recently submitted.
+func stopOrder(tasks []*task.Task) []*task.Task {
+	sorted := append([]*task.Task{}, tasks...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := sorted[i].State == task.Running, sorted[j].State == task.Running
+		if ri != rj {
+			return !ri
+		}
+		return sorted[i].SubmitTime.After(sorted[j].SubmitTime)
+	})
+	return sorted
+}
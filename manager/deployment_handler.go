@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"cube/deployment"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ScaleRequest struct {
+	Replicas int
+}
+
+// RollbackRequest names the revision to roll back to. Zero means the
+// previous revision.
+type RollbackRequest struct {
+	Revision int
+}
+
+func (a *Api) CreateDeploymentHandler(w http.ResponseWriter, r *http.Request) {
+	d := deployment.Deployment{}
+	if !decodeBody(w, r, &d) || !inNamespace(w, r, &d.Namespace) {
+		return
+	}
+
+	err := a.Manager.CreateDeployment(&d)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+
+	log.Printf("Created deployment %s\n", d.Name)
+	sendJSON(w, http.StatusCreated, d)
+}
+
+func (a *Api) GetDeploymentsHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, a.Manager.GetDeployments(listNamespace(r)))
+}
+
+func (a *Api) GetDeploymentHandler(w http.ResponseWriter, r *http.Request) {
+	d, err := a.Manager.GetDeployment(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, d)
+}
+
+func (a *Api) ScaleDeploymentHandler(w http.ResponseWriter, r *http.Request) {
+	req := ScaleRequest{}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	d, err := a.Manager.ScaleDeployment(namespaceOf(r), chi.URLParam(r, "name"), req.Replicas)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, d)
+}
+
+func (a *Api) UpdateDeploymentHandler(w http.ResponseWriter, r *http.Request) {
+	spec := deployment.Deployment{}
+	if !decodeBody(w, r, &spec) {
+		return
+	}
+
+	d, err := a.Manager.UpdateDeployment(namespaceOf(r), chi.URLParam(r, "name"), &spec)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, d)
+}
+
+func (a *Api) RollbackDeploymentHandler(w http.ResponseWriter, r *http.Request) {
+	req := RollbackRequest{}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	d, err := a.Manager.RollbackDeployment(namespaceOf(r), chi.URLParam(r, "name"), req.Revision)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, d)
+}
+
+func (a *Api) GetRolloutStatusHandler(w http.ResponseWriter, r *http.Request) {
+	rs, err := a.Manager.GetRolloutStatus(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, rs)
+}
+
+func (a *Api) GetRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	d, err := a.Manager.GetDeployment(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, d.Revisions)
+}
+
+func (a *Api) DeleteDeploymentHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.Manager.DeleteDeployment(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
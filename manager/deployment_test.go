@@ -0,0 +1,280 @@
+package manager
+
+import (
+	"cube/deployment"
+	"cube/task"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestDeployment(t *testing.T, m *Manager, replicas int, strategy deployment.Strategy) *deployment.Deployment {
+	t.Helper()
+	d := &deployment.Deployment{
+		Name:     "web",
+		Replicas: replicas,
+		Selector: map[string]string{"app": "web"},
+		Template: task.Task{Image: "nginx", Labels: map[string]string{"app": "web"}},
+		Strategy: strategy,
+	}
+	if err := m.CreateDeployment(d); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+	return d
+}
+
+// addDeploymentTask stores a task of a revision of the deployment,
+// submitted the given number of minutes after the start of 2026.
+func addDeploymentTask(m *Manager, d *deployment.Deployment, name string, state task.State, minute int) *task.Task {
+	tk := &task.Task{
+		ID:        uuid.New(),
+		Name:      name,
+		Namespace: d.Namespace,
+		Image:     d.Template.Image,
+		State:     state,
+		Owner:     d.Owner(),
+		Labels: map[string]string{"app": "web",
+			deployment.RevisionLabel: strconv.Itoa(d.Revision)},
+		SubmitTime: time.Date(2026, 1, 1, 0, minute, 0, 0, time.UTC),
+	}
+	m.TaskDb.Put(tk.ID.String(), tk)
+	return tk
+}
+
+// reconcile reconciles the stored deployment once.
+func reconcile(t *testing.T, m *Manager, name string) {
+	t.Helper()
+	d, err := m.GetDeployment("default", name)
+	if err != nil {
+		t.Fatalf("GetDeployment: %v", err)
+	}
+	m.reconcileDeployment(d)
+}
+
+// stoppedNames returns the sorted names of the tasks asked to stop.
+func stoppedNames(m *Manager) []string {
+	var names []string
+	for _, tk := range m.GetTasks() {
+		if m.isStopping(tk.ID) {
+			names = append(names, tk.Name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestScaleDeployment(t *testing.T) {
+	tests := []struct {
+		replicas    int
+		wantActive  int
+		wantStopped []string
+	}{
+		{5, 5, nil},
+		{3, 3, nil},
+		// Tasks that don't run yet go first, then the newest.
+		{2, 2, []string{"c"}},
+		{1, 1, []string{"b", "c"}},
+		{0, 0, []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.replicas), func(t *testing.T) {
+			m := newTestManager(t)
+			d := newTestDeployment(t, m, 3, deployment.Strategy{})
+			addDeploymentTask(m, d, "a", task.Running, 1)
+			addDeploymentTask(m, d, "b", task.Running, 2)
+			addDeploymentTask(m, d, "c", task.Pending, 3)
+
+			if _, err := m.ScaleDeployment("default", "web", tt.replicas); err != nil {
+				t.Fatalf("ScaleDeployment: %v", err)
+			}
+			reconcile(t, m, "web")
+
+			if got := len(m.activeTasks("default", d.Owner())); got != tt.wantActive {
+				t.Errorf("deployment has %d active tasks, want %d", got, tt.wantActive)
+			}
+			if got := stoppedNames(m); !slices.Equal(got, tt.wantStopped) {
+				t.Errorf("stopped tasks %v, want %v", got, tt.wantStopped)
+			}
+			got, _ := m.GetDeployment("default", "web")
+			if got.Status.Replicas != tt.wantActive || got.Status.UpdatedReplicas != tt.wantActive {
+				t.Errorf("status has %d replicas, %d updated; want %d", got.Status.Replicas,
+					got.Status.UpdatedReplicas, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestScaleDeploymentKeepsFinishedTasks(t *testing.T) {
+	m := newTestManager(t)
+	d := newTestDeployment(t, m, 2, deployment.Strategy{})
+	addDeploymentTask(m, d, "a", task.Running, 1)
+	addDeploymentTask(m, d, "failed", task.Failed, 2)
+
+	reconcile(t, m, "web")
+
+	if got := len(m.activeTasks("default", d.Owner())); got != 2 {
+		t.Errorf("deployment has %d active tasks, want a replacement for the failed one", got)
+	}
+	if got := stoppedNames(m); len(got) != 0 {
+		t.Errorf("stopped tasks %v, want none", got)
+	}
+}
+
+func TestStopOrder(t *testing.T) {
+	m := newTestManager(t)
+	d := newTestDeployment(t, m, 3, deployment.Strategy{})
+	tasks := []*task.Task{
+		addDeploymentTask(m, d, "old", task.Running, 1),
+		addDeploymentTask(m, d, "scheduled", task.Scheduled, 2),
+		addDeploymentTask(m, d, "new", task.Running, 3),
+		addDeploymentTask(m, d, "pending", task.Pending, 4),
+	}
+
+	var got []string
+	for _, tk := range stopOrder(tasks) {
+		got = append(got, tk.Name)
+	}
+	if want := []string{"pending", "scheduled", "new", "old"}; !slices.Equal(got, want) {
+		t.Errorf("stop order %v, want %v", got, want)
+	}
+}
+
+// settle plays the workers' part between two reconciliations: tasks that
+// were created start running, and tasks that were asked to stop finish.
+func settle(m *Manager) {
+	for _, tk := range m.GetTasks() {
+		switch {
+		case m.isStopping(tk.ID):
+			tk.State = task.Completed
+			m.TaskDb.Put(tk.ID.String(), tk)
+			m.doneStopping(tk.ID)
+		case tk.State == task.Pending || tk.State == task.Scheduled:
+			tk.State = task.Running
+			m.TaskDb.Put(tk.ID.String(), tk)
+		}
+	}
+}
+
+// rolloutStep is the number of active tasks of the new and the old
+// revision after a reconciliation.
+type rolloutStep struct {
+	new, old int
+}
+
+func TestRollDeployment(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy deployment.Strategy
+		steps    []rolloutStep
+	}{
+		{
+			// One new task at a time, and an old one stops only once a
+			// new one is available.
+			name:     "surge",
+			strategy: deployment.Strategy{MaxSurge: 1},
+			steps:    []rolloutStep{{1, 3}, {1, 2}, {2, 2}, {2, 1}, {3, 1}, {3, 0}, {3, 0}},
+		},
+		{
+			// One old task stops before its replacement is created.
+			name:     "unavailable",
+			strategy: deployment.Strategy{MaxUnavailable: 1},
+			steps:    []rolloutStep{{0, 2}, {1, 2}, {1, 1}, {2, 1}, {2, 0}, {3, 0}, {3, 0}},
+		},
+		{
+			name:     "surge and unavailable",
+			strategy: deployment.Strategy{MaxSurge: 1, MaxUnavailable: 1},
+			steps:    []rolloutStep{{1, 2}, {2, 1}, {3, 0}, {3, 0}},
+		},
+		{
+			// Every old task stops before any new one is created.
+			name:     "recreate",
+			strategy: deployment.Strategy{Type: deployment.Recreate},
+			steps:    []rolloutStep{{0, 0}, {3, 0}, {3, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			d := newTestDeployment(t, m, 3, tt.strategy)
+			reconcile(t, m, "web")
+			settle(m)
+
+			spec := *d
+			spec.Template.Image = "nginx:2"
+			d, err := m.UpdateDeployment("default", "web", &spec)
+			if err != nil {
+				t.Fatalf("UpdateDeployment: %v", err)
+			}
+			maxSurge, maxUnavailable := d.Limits()
+
+			for i, want := range tt.steps {
+				reconcile(t, m, "web")
+
+				var got rolloutStep
+				available, total := 0, 0
+				for _, tk := range m.GetTasks() {
+					if isFinished(tk.State) {
+						continue
+					}
+					total++
+					if isAvailable(tk) {
+						available++
+					}
+					if m.isStopping(tk.ID) {
+						continue
+					}
+					if deployment.TaskRevision(tk) == d.Revision {
+						got.new++
+					} else {
+						got.old++
+					}
+				}
+				if got != want {
+					t.Errorf("step %d: %d new and %d old tasks, want %d and %d", i+1, got.new, got.old, want.new, want.old)
+				}
+				if d.Strategy.Type != deployment.Recreate {
+					if total > d.Replicas+maxSurge {
+						t.Errorf("step %d: %d tasks exist, more than %d replicas and a surge of %d",
+							i+1, total, d.Replicas, maxSurge)
+					}
+					if available < d.Replicas-maxUnavailable {
+						t.Errorf("step %d: %d tasks are available, fewer than %d replicas less %d unavailable",
+							i+1, available, d.Replicas, maxUnavailable)
+					}
+				}
+				settle(m)
+			}
+
+			got, _ := m.GetDeployment("default", "web")
+			if !got.RolloutStatus().Complete {
+				t.Errorf("rollout is not complete: %s", got.RolloutStatus().Message)
+			}
+		})
+	}
+}
+
+func TestRollDeploymentWaitsForHealthyTasks(t *testing.T) {
+	m := newTestManager(t)
+	d := newTestDeployment(t, m, 2, deployment.Strategy{MaxSurge: 1})
+	reconcile(t, m, "web")
+	settle(m)
+
+	spec := *d
+	spec.Template.Image = "nginx:2"
+	spec.Template.HealthCheck = "/health"
+	if _, err := m.UpdateDeployment("default", "web", &spec); err != nil {
+		t.Fatalf("UpdateDeployment: %v", err)
+	}
+	reconcile(t, m, "web")
+	settle(m)
+
+	// The new task runs but hasn't passed its health check, so no old
+	// task may stop.
+	reconcile(t, m, "web")
+	if got := stoppedNames(m); len(got) != 0 {
+		t.Errorf("old tasks %v were stopped before the new one was healthy", got)
+	}
+}
@@ -0,0 +1,281 @@
+package manager
+
+import (
+	"cube/node"
+	"cube/service"
+	"cube/task"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	dnsTTL = 5
+	// nodeZone holds the names of the nodes, such as worker-0.node.cube.
+	nodeZone = "node"
+)
+
+// dnsTarget is an address a name resolves to.
+type dnsTarget struct {
+	name string
+	ip   net.IP
+	port int
+}
+
+// ServeDNS answers A and SRV queries for <task-or-service>.<namespace>.cube
+// and <node>.node.cube over UDP and TCP, and forwards other queries to the
+// resolvers of the manager's host.
+func (m *Manager) ServeDNS(address string) {
+	upstream := upstreamResolvers()
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m.handleDNS(w, r, upstream)
+	})
+
+	go func() {
+		err := (&dns.Server{Addr: address, Net: "tcp", Handler: handler}).ListenAndServe()
+		if err != nil {
+			log.Printf("Error serving DNS over TCP on %s: %v\n", address, err)
+		}
+	}()
+	log.Printf("Serving DNS on %s\n", address)
+	err := (&dns.Server{Addr: address, Net: "udp", Handler: handler}).ListenAndServe()
+	if err != nil {
+		log.Printf("Error serving DNS over UDP on %s: %v\n", address, err)
+	}
+}
+
+func (m *Manager) handleDNS(w dns.ResponseWriter, r *dns.Msg, upstream []string) {
+	if len(r.Question) != 1 {
+		msg := new(dns.Msg)
+		msg.SetRcode(r, dns.RcodeFormatError)
+		w.WriteMsg(msg)
+		return
+	}
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+	if !dns.IsSubDomain(task.DNSDomain+".", name) {
+		if !m.forwardsFor(w.RemoteAddr()) {
+			msg := new(dns.Msg)
+			msg.SetRcode(r, dns.RcodeRefused)
+			w.WriteMsg(msg)
+			return
+		}
+		w.WriteMsg(forwardDNS(r, upstream))
+		return
+	}
+
+	msg := new(dns.Msg)
+	msg.SetReply(r)
+	msg.Authoritative = true
+
+	targets, found := m.resolveName(name, localIP(w))
+	if !found {
+		msg.Rcode = dns.RcodeNameError
+		w.WriteMsg(msg)
+		return
+	}
+
+	hdr := func(name string, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: dnsTTL}
+	}
+	seen := make(map[string]bool)
+	for _, t := range targets {
+		switch q.Qtype {
+		case dns.TypeA, dns.TypeANY:
+			if !seen[t.ip.String()] {
+				seen[t.ip.String()] = true
+				msg.Answer = append(msg.Answer, &dns.A{Hdr: hdr(q.Name, dns.TypeA), A: t.ip})
+			}
+		case dns.TypeSRV:
+			msg.Answer = append(msg.Answer, &dns.SRV{
+				Hdr:      hdr(q.Name, dns.TypeSRV),
+				Priority: 0,
+				Weight:   10,
+				Port:     uint16(t.port),
+				Target:   t.name,
+			})
+			if !seen[t.name] {
+				seen[t.name] = true
+				msg.Extra = append(msg.Extra, &dns.A{Hdr: hdr(t.name, dns.TypeA), A: t.ip})
+			}
+		}
+	}
+	w.WriteMsg(msg)
+}
+
+// resolveName returns the addresses of the service, task or node a name
+// under the cluster domain refers to. Leading labels starting with an
+// underscore, as in _http._tcp.web.default.cube, are ignored. managerIP is
+// the address services served from the manager resolve to.
+func (m *Manager) resolveName(name string, managerIP net.IP) ([]dnsTarget, bool) {
+	labels := dns.SplitDomainName(name)
+	for len(labels) > 0 && strings.HasPrefix(labels[0], "_") {
+		labels = labels[1:]
+	}
+	if len(labels) != 3 {
+		return nil, false
+	}
+	object, ns := labels[0], labels[1]
+	fqdn := dns.Fqdn(strings.Join(labels, "."))
+
+	if ns == nodeZone {
+		n, err := m.GetNode(object)
+		if err != nil {
+			return nil, false
+		}
+		ip := nodeIP(n)
+		if ip == nil {
+			return nil, true
+		}
+		return []dnsTarget{{name: fqdn, ip: ip}}, true
+	}
+	if _, err := m.GetNamespace(ns); err != nil {
+		return nil, false
+	}
+
+	for _, s := range m.GetServices(ns) {
+		if strings.ToLower(s.Name) != object {
+			continue
+		}
+		if s.Mode == service.OnManager {
+			if managerIP == nil {
+				return nil, true
+			}
+			return []dnsTarget{{name: fqdn, ip: managerIP, port: s.Port}}, true
+		}
+		var targets []dnsTarget
+		for _, n := range m.GetNodes() {
+			if n.Status != node.Ready || !n.ServesServices {
+				continue
+			}
+			if ip := nodeIP(n); ip != nil {
+				targets = append(targets, dnsTarget{
+					name: dns.Fqdn(fmt.Sprintf("%s.%s.%s", strings.ToLower(n.Name), nodeZone, task.DNSDomain)),
+					ip:   ip,
+					port: s.Port,
+				})
+			}
+		}
+		return targets, true
+	}
+
+	var targets []dnsTarget
+	found := false
+	for _, t := range m.GetTasks() {
+		if t.Namespace != ns || strings.ToLower(t.Name) != object {
+			continue
+		}
+		found = true
+		n, ok := m.taskNode(t.ID)
+		if !ok || t.State != task.Running {
+			continue
+		}
+		ip := nodeIP(n)
+		port, _ := strconv.Atoi(publishedPort(t, ""))
+		if ip != nil {
+			targets = append(targets, dnsTarget{name: fqdn, ip: ip, port: port})
+		}
+	}
+	return targets, found
+}
+
+// nodeIP returns the IPv4 address of a node, looking up its host name if
+// needed.
+func nodeIP(n *node.Node) net.IP {
+	host := n.Host()
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.To4()
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		log.Printf("Error looking up address of node %s: %v\n", n.Name, err)
+		return nil
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4
+		}
+	}
+	return nil
+}
+
+// localIP returns the address a DNS query was received on, which is where
+// services served from the manager can be reached by the client. When the
+// server listens on all addresses, it is the address used to reach the
+// client.
+func localIP(w dns.ResponseWriter) net.IP {
+	host, _, err := net.SplitHostPort(w.LocalAddr().String())
+	if err != nil {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+		return ip.To4()
+	}
+
+	remote, _, err := net.SplitHostPort(w.RemoteAddr().String())
+	if err != nil {
+		return nil
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(remote, "53"))
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.To4()
+}
+
+// forwardsFor reports whether queries for other domains from a client are
+// forwarded: the client must be a node or in one of the DNSForward
+// networks.
+func (m *Manager) forwardsFor(addr net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range m.DNSForward {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	for _, n := range m.GetNodes() {
+		if nip := net.ParseIP(n.Host()); nip != nil && nip.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func upstreamResolvers() []string {
+	config, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil || len(config.Servers) == 0 {
+		log.Printf("No resolvers found in /etc/resolv.conf, forwarding DNS queries to 8.8.8.8\n")
+		return []string{"8.8.8.8:53"}
+	}
+	var servers []string
+	for _, s := range config.Servers {
+		servers = append(servers, net.JoinHostPort(s, config.Port))
+	}
+	return servers
+}
+
+func forwardDNS(r *dns.Msg, upstream []string) *dns.Msg {
+	c := new(dns.Client)
+	for _, server := range upstream {
+		resp, _, err := c.Exchange(r, server)
+		if err == nil {
+			return resp
+		}
+		log.Printf("Error forwarding DNS query to %s: %v\n", server, err)
+	}
+	msg := new(dns.Msg)
+	msg.SetRcode(r, dns.RcodeServerFailure)
+	return msg
+}
@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"cube/service"
+	"cube/worker"
+	"net"
+	"testing"
+)
+
+func TestResolveServiceOnlyToServingNodes(t *testing.T) {
+	m := newTestManager(t)
+	for _, r := range []worker.Registration{
+		{Name: "w1", Address: "10.0.0.5:5556", Services: true},
+		{Name: "w2", Address: "10.0.0.6:5556"},
+	} {
+		if _, err := m.RegisterNode(r); err != nil {
+			t.Fatalf("RegisterNode %s: %v", r.Name, err)
+		}
+	}
+	err := m.CreateService(&service.Service{
+		Name:     "web",
+		Selector: map[string]string{"app": "web"},
+		Port:     8080,
+		Mode:     service.OnWorkers,
+	})
+	if err != nil {
+		t.Fatalf("CreateService: %v", err)
+	}
+
+	targets, found := m.resolveName("web.default.cube.", nil)
+	if !found {
+		t.Fatal("service was not found")
+	}
+	if len(targets) != 1 || !targets[0].ip.Equal(net.ParseIP("10.0.0.5")) {
+		t.Errorf("got targets %v, want only 10.0.0.5", targets)
+	}
+}
+
+func TestForwardsFor(t *testing.T) {
+	m := newTestManager(t)
+	_, private, _ := net.ParseCIDR("192.168.0.0/16")
+	m.DNSForward = []*net.IPNet{private}
+	if _, err := m.RegisterNode(worker.Registration{Name: "w1", Address: "203.0.113.7:5556"}); err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"192.168.1.20:5353", true},
+		{"203.0.113.7:5353", true},
+		{"198.51.100.1:5353", false},
+	}
+	for _, tt := range tests {
+		addr, _ := net.ResolveUDPAddr("udp", tt.addr)
+		if got := m.forwardsFor(addr); got != tt.want {
+			t.Errorf("forwardsFor(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package manager
+
+import (
+	"cube/store"
+	"cube/task"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DrainStatus struct {
+	Node       string
+	StartTime  time.Time
+	FinishTime time.Time
+	Total      int
+	Moved      int
+	Remaining  int
+	Done       bool
+
+	// moving holds the running tasks that were sent to other nodes and
+	// whether their copy on the drained node was asked to stop.
+	moving map[uuid.UUID]bool
+}
+
+func (m *Manager) Cordon(name string) error {
+	return m.setUnschedulable(name, true)
+}
+
+func (m *Manager) Uncordon(name string) error {
+	return m.setUnschedulable(name, false)
+}
+
+func (m *Manager) setUnschedulable(name string, unschedulable bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.findNode(name)
+	if n == nil {
+		return ErrNodeNotFound
+	}
+	n.Unschedulable = unschedulable
+	m.publishNode(store.Modified, n)
+	log.Printf("Node %s unschedulable: %v\n", name, unschedulable)
+	return nil
+}
+
+// Drain cordons a node and moves every task on it to other nodes. The
+// drain runs in the background; its progress is available through
+// GetDrainStatus.
+func (m *Manager) Drain(name string) (DrainStatus, error) {
+	err := m.Cordon(name)
+	if err != nil {
+		return DrainStatus{}, err
+	}
+	active := m.activeTaskCount(name)
+
+	m.mu.Lock()
+	ds, ok := m.drains[name]
+	if ok && !ds.Done {
+		status := *ds
+		m.mu.Unlock()
+		return status, nil
+	}
+	ds = &DrainStatus{
+		Node:      name,
+		StartTime: time.Now(),
+		Total:     active,
+		Remaining: active,
+		moving:    make(map[uuid.UUID]bool),
+	}
+	m.drains[name] = ds
+	status := *ds
+	m.mu.Unlock()
+
+	go m.drain(name)
+
+	return status, nil
+}
+
+// activeTaskCount counts the tasks on a node that haven't finished; the
+// finished ones are only dropped from the node, not moved.
+func (m *Manager) activeTaskCount(name string) int {
+	m.mu.Lock()
+	ids := append([]uuid.UUID{}, m.WorkerTaskMap[name]...)
+	m.mu.Unlock()
+
+	count := 0
+	for _, id := range ids {
+		t, err := m.TaskDb.Get(id.String())
+		if err == nil && !isFinished(t.State) {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *Manager) GetDrainStatus(name string) (DrainStatus, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ds, ok := m.drains[name]
+	if !ok {
+		return DrainStatus{}, false
+	}
+	return *ds, true
+}
+
+// drain moves the tasks off a node. Running tasks keep running there until
+// they run on another node, so that draining doesn't take away capacity
+// before it is replaced; tasks that haven't started yet are evicted right
+// away.
+func (m *Manager) drain(name string) {
+	log.Printf("Draining node %s\n", name)
+	m.moveTasks(name)
+	for !m.updateDrainStatus(name) {
+		time.Sleep(5 * time.Second)
+		m.finishMoves(name)
+	}
+	log.Printf("Node %s has been drained\n", name)
+}
+
+// moveTasks sends every task on a draining node back through the pending
+// queue.
+func (m *Manager) moveTasks(name string) {
+	m.mu.Lock()
+	ids := append([]uuid.UUID{}, m.WorkerTaskMap[name]...)
+	m.mu.Unlock()
+
+	reason := fmt.Sprintf("node %s is being drained", name)
+	for _, id := range ids {
+		t, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			m.unassignTask(id)
+			continue
+		}
+
+		switch t.State {
+		case task.Running:
+			log.Printf("Moving task %s off node %s\n", t.ID, name)
+			m.recordTaskEvent(*t, task.EventEvicted, fmt.Sprintf("Moving off node %s: %s", name, reason))
+			m.mu.Lock()
+			m.drains[name].moving[id] = false
+			m.mu.Unlock()
+			m.unassignTask(id)
+			m.requeueTask(t, reason)
+		case task.Scheduled:
+			log.Printf("Moving task %s off node %s\n", t.ID, name)
+			m.evictTask(t, reason)
+			m.mu.Lock()
+			m.drains[name].Moved++
+			m.mu.Unlock()
+		default:
+			m.unassignTask(id)
+		}
+		m.updateDrainStatus(name)
+	}
+}
+
+// finishMoves stops the copies left on a draining node of the tasks that
+// run elsewhere now, or that no longer need to run, and counts a task as
+// moved once its copy has stopped.
+func (m *Manager) finishMoves(name string) {
+	m.mu.Lock()
+	moving := make(map[uuid.UUID]bool, len(m.drains[name].moving))
+	for id, stopping := range m.drains[name].moving {
+		moving[id] = stopping
+	}
+	m.mu.Unlock()
+	if len(moving) == 0 {
+		return
+	}
+
+	n, err := m.getNode(name)
+	if err != nil {
+		// The node is gone, and the copies with it.
+		m.mu.Lock()
+		m.drains[name].Moved += len(moving)
+		clear(m.drains[name].moving)
+		m.mu.Unlock()
+		return
+	}
+	left, err := m.workerTasks(n)
+	if err != nil {
+		log.Printf("Error getting the tasks of draining node %s: %v\n", name, err)
+		return
+	}
+	running := make(map[uuid.UUID]bool)
+	for _, t := range left {
+		if !isFinished(t.State) {
+			running[t.ID] = true
+		}
+	}
+
+	for id, stopping := range moving {
+		if !running[id] {
+			m.mu.Lock()
+			delete(m.drains[name].moving, id)
+			m.drains[name].Moved++
+			m.mu.Unlock()
+			continue
+		}
+		if stopping || !m.movedAway(id, name) {
+			continue
+		}
+		log.Printf("Task %s runs elsewhere, stopping it on node %s\n", id, name)
+		if m.stopTask(name, id.String()) == nil {
+			m.mu.Lock()
+			m.drains[name].moving[id] = true
+			m.mu.Unlock()
+		}
+	}
+}
+
+// movedAway reports whether a task that is moving off a node no longer
+// needs its copy there: it runs on another node, or it finished or was
+// deleted.
+func (m *Manager) movedAway(id uuid.UUID, name string) bool {
+	t, err := m.TaskDb.Get(id.String())
+	if err != nil || isFinished(t.State) || m.isStopping(id) {
+		return true
+	}
+	w, ok := m.taskWorker(id)
+	return ok && w != name && t.State == task.Running
+}
+
+// isMoving reports whether a task is moving off a draining node, so that
+// the node's reports of it are not taken for the task's own.
+func (m *Manager) isMoving(name string, id uuid.UUID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ds, ok := m.drains[name]
+	if !ok {
+		return false
+	}
+	_, moving := ds.moving[id]
+	return moving
+}
+
+// updateDrainStatus records how many tasks are left on a draining node and
+// reports whether the drain has finished.
+func (m *Manager) updateDrainStatus(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ds := m.drains[name]
+	ds.Remaining = len(m.WorkerTaskMap[name]) + len(ds.moving)
+	if ds.Remaining == 0 && !ds.Done {
+		ds.Done = true
+		ds.FinishTime = time.Now()
+	}
+	return ds.Done
+}
@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"cube/task"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDrainKeepsTasksUntilTheyRunElsewhere(t *testing.T) {
+	m := newTestManager(t)
+	f1, n1 := addNode(t, m, "w1")
+	_, n2 := addNode(t, m, "w2")
+
+	tk := &task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx"}
+	runTaskOn(m, n1, tk)
+	f1.setTask(*tk)
+
+	m.Cordon("w1")
+	m.drains["w1"] = &DrainStatus{Node: "w1", StartTime: time.Now(), Total: 1, moving: make(map[uuid.UUID]bool)}
+	m.moveTasks("w1")
+
+	if m.updateDrainStatus("w1") {
+		t.Fatal("drain finished while the task still ran only on the drained node")
+	}
+	m.finishMoves("w1")
+	if stops := f1.stops(); len(stops) != 0 {
+		t.Fatalf("task was stopped on the drained node before it ran elsewhere: %v", stops)
+	}
+
+	// The task is placed on the other node and starts there.
+	moved, _ := m.TaskDb.Get(tk.ID.String())
+	if moved.State != task.Pending {
+		t.Fatalf("moved task is %v, want %v", moved.State, task.Pending)
+	}
+	runTaskOn(m, n2, moved)
+
+	m.finishMoves("w1")
+	if stops := f1.stops(); len(stops) != 1 || stops[0] != tk.ID {
+		t.Fatalf("stops on the drained node = %v, want [%s]", stops, tk.ID)
+	}
+	if m.updateDrainStatus("w1") {
+		t.Fatal("drain finished before the task stopped on the drained node")
+	}
+
+	left := *tk
+	left.State = task.Completed
+	f1.setTask(left)
+	m.finishMoves("w1")
+	if !m.updateDrainStatus("w1") {
+		t.Fatal("drain did not finish once the task stopped on the drained node")
+	}
+	ds, _ := m.GetDrainStatus("w1")
+	if ds.Moved != 1 || ds.Remaining != 0 {
+		t.Errorf("drain status moved %d, remaining %d; want 1, 0", ds.Moved, ds.Remaining)
+	}
+}
+
+func TestDrainCountsOnlyActiveTasks(t *testing.T) {
+	m := newTestManager(t)
+	_, n := addNode(t, m, "w1")
+
+	running := &task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx"}
+	runTaskOn(m, n, running)
+	done := &task.Task{ID: uuid.New(), Name: "batch", Namespace: "default", Image: "busybox"}
+	runTaskOn(m, n, done)
+	done.State = task.Completed
+	m.TaskDb.Put(done.ID.String(), done)
+
+	if got := m.activeTaskCount("w1"); got != 1 {
+		t.Errorf("active tasks on the node = %d, want 1", got)
+	}
+}
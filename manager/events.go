@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"cube/task"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxTaskEvents is the number of events kept for each task. Older events
+// are dropped as new ones are recorded.
+const maxTaskEvents = 100
+
+// recordEvent saves an event and indexes it by the ID of its task, dropping
+// the task's oldest events beyond maxTaskEvents.
+func (m *Manager) recordEvent(te *task.TaskEvent) {
+	err := m.EventDb.Put(te.ID.String(), te)
+	if err != nil {
+		log.Printf("Error saving event %v: %v\n", te.ID, err)
+		return
+	}
+	err = m.EventIndex.Add(te.Task.ID.String(), te.ID.String())
+	if err != nil {
+		log.Printf("Error indexing event %v: %v\n", te.ID, err)
+		return
+	}
+
+	dropped, err := m.EventIndex.Trim(te.Task.ID.String(), maxTaskEvents)
+	if err != nil {
+		log.Printf("Error trimming the events of task %v: %v\n", te.Task.ID, err)
+	}
+	for _, eID := range dropped {
+		m.EventDb.Delete(eID)
+	}
+}
+
+// deleteTask removes a finished task and the events recorded for it.
+func (m *Manager) deleteTask(id uuid.UUID) {
+	m.unassignTask(id)
+	m.TaskDb.Delete(id.String())
+
+	ids, _ := m.EventIndex.Get(id.String())
+	for _, eID := range ids {
+		m.EventDb.Delete(eID)
+	}
+	err := m.EventIndex.Delete(id.String())
+	if err != nil {
+		log.Printf("Error removing events of task %v from the index: %v\n", id, err)
+	}
+}
+
+func (m *Manager) recordTaskEvent(t task.Task, eventType task.EventType, msg string) {
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     t.State,
+		Timestamp: time.Now().UTC(),
+		Task:      t,
+		Type:      eventType,
+		Message:   msg,
+	}
+	m.recordEvent(&te)
+}
+
+// GetTaskEvents returns the events recorded for a task, oldest first.
+func (m *Manager) GetTaskEvents(id uuid.UUID) ([]*task.TaskEvent, error) {
+	ids, err := m.EventIndex.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*task.TaskEvent, 0, len(ids))
+	for _, eID := range ids {
+		te, err := m.EventDb.Get(eID)
+		if err != nil {
+			log.Printf("Event %s indexed for task %v is missing\n", eID, id)
+			continue
+		}
+		events = append(events, te)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	return events, nil
+}
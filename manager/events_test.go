@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"cube/task"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestEventIDsAreAssignedByTheManager(t *testing.T) {
+	m := newTestManager(t)
+	eventID := uuid.New()
+	first := task.TaskEvent{ID: eventID, State: task.Scheduled,
+		Task: task.Task{ID: uuid.New(), Name: "a", Image: "nginx"}}
+	second := task.TaskEvent{ID: eventID, State: task.Scheduled,
+		Task: task.Task{ID: uuid.New(), Name: "b", Image: "nginx"}}
+
+	for _, te := range []*task.TaskEvent{&first, &second} {
+		if err := m.SubmitTask(te); err != nil {
+			t.Fatalf("SubmitTask: %v", err)
+		}
+	}
+
+	if _, err := m.EventDb.Get(eventID.String()); err == nil {
+		t.Error("the event ID sent by the client was used as a key")
+	}
+	for _, id := range []uuid.UUID{first.Task.ID, second.Task.ID} {
+		events, err := m.GetTaskEvents(id)
+		if err != nil || len(events) != 1 {
+			t.Errorf("task %s has events %v (%v), want 1", id, events, err)
+		}
+	}
+}
+
+func TestSubmitTaskRefusesExistingID(t *testing.T) {
+	m := newTestManager(t)
+	te := task.TaskEvent{State: task.Scheduled, Task: task.Task{ID: uuid.New(), Name: "a", Image: "nginx"}}
+	if err := m.SubmitTask(&te); err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+
+	again := te
+	again.Task.Name = "b"
+	err := m.SubmitTask(&again)
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("resubmitting task %s: got %v, want %v", te.Task.ID, err, ErrAlreadyExists)
+	}
+}
+
+func TestTaskEventsAreCapped(t *testing.T) {
+	m := newTestManager(t)
+	tk := task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx", State: task.Running}
+	var first uuid.UUID
+	for i := 0; i < maxTaskEvents+5; i++ {
+		te := task.TaskEvent{ID: uuid.New(), State: tk.State, Task: tk, Type: task.EventRestarted}
+		if i == 0 {
+			first = te.ID
+		}
+		m.recordEvent(&te)
+	}
+
+	events, err := m.GetTaskEvents(tk.ID)
+	if err != nil || len(events) != maxTaskEvents {
+		t.Fatalf("task has %d events (%v), want %d", len(events), err, maxTaskEvents)
+	}
+	if _, err := m.EventDb.Get(first.String()); err == nil {
+		t.Error("the oldest event is still stored")
+	}
+	if n, _ := m.EventDb.Count(); n != maxTaskEvents {
+		t.Errorf("event store holds %d events, want %d", n, maxTaskEvents)
+	}
+}
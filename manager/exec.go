@@ -0,0 +1,85 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"cube/task"
+	"cube/worker"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// TaskLogs streams the output of a task's container from the worker it is
+// on. tail limits the output to the last lines, and with follow set the
+// stream stays open until ctx is done.
+func (m *Manager) TaskLogs(ctx context.Context, t *task.Task, tail string, follow bool) (io.ReadCloser, error) {
+	n, ok := m.taskNode(t.ID)
+	if !ok {
+		return nil, fmt.Errorf("task %s is not on a node", t.ID)
+	}
+
+	q := url.Values{}
+	if tail != "" {
+		q.Set("tail", tail)
+	}
+	if follow {
+		q.Set("follow", "true")
+	}
+	u := fmt.Sprintf("%s/task/%s/logs?%s", n.Api, t.ID, q.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", n.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, workerError(resp)
+	}
+	return resp.Body, nil
+}
+
+// ExecTask runs a command in a task's container on the worker it is on.
+func (m *Manager) ExecTask(t *task.Task, cmd []string) (*task.ExecResult, error) {
+	n, ok := m.taskNode(t.ID)
+	if !ok {
+		return nil, fmt.Errorf("task %s is not on a node", t.ID)
+	}
+
+	data, err := json.Marshal(worker.ExecRequest{Command: cmd})
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/task/%s/exec", n.Api, t.ID)
+	resp, err := m.Client.Post(u, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", n.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, workerError(resp)
+	}
+
+	result := task.ExecResult{}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// workerError reads the error of a failed worker response.
+func workerError(resp *http.Response) error {
+	e := worker.ErrorResponse{}
+	err := json.NewDecoder(resp.Body).Decode(&e)
+	if err != nil {
+		return fmt.Errorf("worker responded with %s", resp.Status)
+	}
+	return errors.New(e.Message)
+}
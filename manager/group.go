@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"cube/namespace"
+	"cube/scheduler"
+	"cube/task"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+func groupKey(t task.Task) string {
+	return namespace.Key(t.Namespace, t.Group)
+}
+
+// holdForGroup keeps a pending member of a task group aside until the
+// whole group can be scheduled by scheduleGroups.
+func (m *Manager) holdForGroup(te *task.TaskEvent) {
+	key := groupKey(te.Task)
+	if m.groups[key] == nil {
+		m.groups[key] = make(map[uuid.UUID]*task.TaskEvent)
+	}
+	m.groups[key][te.Task.ID] = te
+}
+
+// scheduleGroups places the pending members of each task group, all of
+// them or none. A group is placed once its pending members and the ones
+// already placed add up to its size, and every pending member fits on the
+// nodes at the same time. Until then its members stay pending without
+// holding any capacity.
+func (m *Manager) scheduleGroups() {
+	for key, members := range m.groups {
+		var pending []task.Task
+		for id, te := range members {
+			persisted, err := m.TaskDb.Get(id.String())
+			if err != nil || persisted.State != task.Pending || m.isStopping(id) {
+				delete(members, id)
+				continue
+			}
+			if _, ok := m.taskWorker(id); ok {
+				delete(members, id)
+				continue
+			}
+			pending = append(pending, te.Task)
+		}
+		if len(pending) == 0 {
+			delete(m.groups, key)
+			continue
+		}
+		sort.Slice(pending, func(i, j int) bool {
+			return pending[i].SubmitTime.Before(pending[j].SubmitTime)
+		})
+
+		size := pending[0].GroupSize
+		placed := m.placedGroupMembers(pending[0])
+		if missing := size - placed - len(pending); missing > 0 {
+			m.holdGroup(members, fmt.Sprintf("waiting for %d more members of task group %s", missing, key))
+			continue
+		}
+
+		placement, err := scheduler.PlaceGroup(m.Scheduler, pending, m.schedulableNodes())
+		if err != nil {
+			m.holdGroup(members, err.Error())
+			continue
+		}
+		log.Printf("Scheduling the %d pending members of task group %s\n", len(pending), key)
+		var sent []uuid.UUID
+		for id, name := range placement {
+			w, err := m.getNode(name)
+			if err == nil {
+				err = m.startOn(members[id], w)
+			}
+			if err != nil {
+				log.Printf("Task group %s could not be placed: %v\n", key, err)
+				m.unplaceGroup(members, sent)
+				m.holdGroup(members, fmt.Sprintf("member %s of task group %s could not be placed: %v",
+					members[id].Task.Name, key, err))
+				sent = nil
+				break
+			}
+			sent = append(sent, id)
+		}
+		for _, id := range sent {
+			delete(members, id)
+		}
+	}
+}
+
+// unplaceGroup takes back the members of a group that were sent to their
+// nodes when another member could not be, so that the group stays pending
+// as a whole. A member whose worker can't be asked to stop it stays on its
+// node, where it may run, and is no longer pending.
+func (m *Manager) unplaceGroup(members map[uuid.UUID]*task.TaskEvent, sent []uuid.UUID) {
+	for _, id := range sent {
+		w, ok := m.taskWorker(id)
+		if !ok {
+			continue
+		}
+		err := m.stopTask(w, id.String())
+		if err != nil && !errors.Is(err, ErrNodeNotFound) && !errors.Is(err, errUnknownTask) {
+			log.Printf("Task %v stays on node %s: %v\n", id, w, err)
+			delete(members, id)
+			continue
+		}
+		m.unassignTask(id)
+	}
+}
+
+// placedGroupMembers counts the members of a task's group that are already
+// on a node and haven't finished or been asked to stop.
+func (m *Manager) placedGroupMembers(t task.Task) int {
+	placed := 0
+	for _, other := range m.namespaceTasks(t.Namespace) {
+		if other.Group != t.Group || isFinished(other.State) || m.isStopping(other.ID) {
+			continue
+		}
+		if _, ok := m.taskWorker(other.ID); ok {
+			placed++
+		}
+	}
+	return placed
+}
+
+// holdGroup keeps the pending members of a group pending for a reason.
+func (m *Manager) holdGroup(members map[uuid.UUID]*task.TaskEvent, reason string) {
+	for _, te := range members {
+		if te.Task.Reason != reason {
+			m.recordTaskEvent(te.Task, task.EventUnschedulable, reason)
+		}
+		te.Task.State = task.Pending
+		te.Task.Reason = reason
+		m.updateTask(te.Task.ID, func(t *task.Task) error {
+			t.State = task.Pending
+			t.Reason = reason
+			return nil
+		})
+	}
+}
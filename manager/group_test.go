@@ -0,0 +1,129 @@
+package manager
+
+import (
+	"cube/task"
+	"cube/worker"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func groupMember(name string, size int) *task.TaskEvent {
+	return &task.TaskEvent{State: task.Scheduled, Task: task.Task{ID: uuid.New(), Name: name,
+		Image: "nginx", Group: "train", GroupSize: size}}
+}
+
+func TestGroupMembersMustShareTheirSize(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.SubmitTask(groupMember("a", 2)); err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+	if err := m.SubmitTask(groupMember("b", 3)); err == nil {
+		t.Error("a member with another group size was admitted")
+	}
+	if err := m.SubmitTask(groupMember("c", 2)); err != nil {
+		t.Errorf("a member with the same group size was refused: %v", err)
+	}
+}
+
+func TestGroupIsPlacedOnceComplete(t *testing.T) {
+	m := newTestManager(t)
+	f, _ := addNode(t, m, "w1")
+	first := groupMember("a", 2)
+	if err := m.SubmitTask(first); err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+
+	m.processTasks()
+	if len(f.starts()) != 0 {
+		t.Fatal("a member was placed before the group was complete")
+	}
+
+	second := groupMember("b", 2)
+	if err := m.SubmitTask(second); err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+	m.processTasks()
+	for _, id := range []uuid.UUID{first.Task.ID, second.Task.ID} {
+		if !slices.Contains(f.starts(), id) {
+			t.Errorf("member %s was not placed with its group", id)
+		}
+	}
+}
+
+func TestRefusedTaskIsUnassignedAndRetried(t *testing.T) {
+	m := newTestManager(t)
+	refusing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(refusing.Close)
+	_, err := m.RegisterNode(worker.Registration{Name: "w1", Address: strings.TrimPrefix(refusing.URL, "http://"),
+		Cores: 4, Memory: 1 << 30, Disk: 1 << 30})
+	if err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+
+	te := task.TaskEvent{State: task.Scheduled, Task: task.Task{ID: uuid.New(), Name: "web", Image: "nginx"}}
+	if err := m.SubmitTask(&te); err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+	m.processTasks()
+
+	if _, ok := m.taskWorker(te.Task.ID); ok {
+		t.Error("task refused by its worker is still assigned to it")
+	}
+	got, _ := m.TaskDb.Get(te.Task.ID.String())
+	if got.State != task.Pending || m.Pending.Length() != 1 {
+		t.Errorf("task is %v with %d pending events, want it pending and queued", got.State, m.Pending.Length())
+	}
+}
+
+func TestGroupIsRolledBackWhenAMemberFails(t *testing.T) {
+	m := newTestManager(t)
+	f1, n1 := addNode(t, m, "w1")
+	f2, n2 := addNode(t, m, "w2")
+	f2.refuseStarts(http.StatusInternalServerError)
+
+	// The members don't fit on one node together.
+	var members []*task.TaskEvent
+	for _, name := range []string{"a", "b"} {
+		te := groupMember(name, 2)
+		te.Task.Cpu = 3
+		if err := m.SubmitTask(te); err != nil {
+			t.Fatalf("SubmitTask: %v", err)
+		}
+		members = append(members, te)
+	}
+	m.processTasks()
+
+	for _, te := range members {
+		got, _ := m.TaskDb.Get(te.Task.ID.String())
+		if got.State != task.Pending || !strings.Contains(got.Reason, "could not be placed") {
+			t.Errorf("member %s is %v with reason %q, want pending for the group", got.Name, got.State, got.Reason)
+		}
+		if w, ok := m.taskWorker(te.Task.ID); ok {
+			t.Errorf("member %s is still assigned to %s", got.Name, w)
+		}
+	}
+	// A member sent before the other failed is stopped again.
+	if starts, stops := f1.starts(), f1.stops(); !slices.Equal(starts, stops) {
+		t.Errorf("w1 started %v and stopped %v, want every start stopped", starts, stops)
+	}
+	if n1.CpuAllocated != 0 || n2.CpuAllocated != 0 {
+		t.Errorf("nodes hold %v and %v cpus for the group, want none", n1.CpuAllocated, n2.CpuAllocated)
+	}
+
+	// The group is placed as a whole once the node takes tasks again.
+	f2.refuseStarts(0)
+	m.processTasks()
+	for _, te := range members {
+		got, _ := m.TaskDb.Get(te.Task.ID.String())
+		if got.State != task.Scheduled {
+			t.Errorf("member %s is %v after the node recovered, want %v", got.Name, got.State, task.Scheduled)
+		}
+	}
+}
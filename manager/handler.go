@@ -1,12 +1,15 @@
 package manager
 
 import (
+	"cube/namespace"
 	"cube/task"
+	"cube/utils"
+	"cube/worker"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -17,6 +20,88 @@ type ErrorResponse struct {
 	Message        string
 }
 
+func sendError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	e := ErrorResponse{
+		HttpStatusCode: status,
+		Message:        msg,
+	}
+	json.NewEncoder(w).Encode(e)
+}
+
+func sendJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// decodeBody decodes a JSON request body into v, answering with a 400 and
+// returning false when it can't.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	err := d.Decode(v)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
+		log.Print(msg)
+		sendError(w, http.StatusBadRequest, msg)
+		return false
+	}
+	return true
+}
+
+// sendObjectError maps errors from object operations to HTTP responses.
+func sendObjectError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		sendError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrAlreadyExists):
+		sendError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrForbidden):
+		sendError(w, http.StatusForbidden, err.Error())
+	default:
+		sendError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+// namespaceOf returns the namespace of a request. Requests outside the
+// /namespaces/{namespace} routes act on the default namespace.
+func namespaceOf(r *http.Request) string {
+	if ns := chi.URLParam(r, "namespace"); ns != "" {
+		return ns
+	}
+	return namespace.Default
+}
+
+// listNamespace returns the namespace to list objects from. Lists outside
+// the /namespaces/{namespace} routes cover all namespaces.
+func listNamespace(r *http.Request) string {
+	return chi.URLParam(r, "namespace")
+}
+
+// inNamespace puts an object from a request body in the namespace of the
+// request, answering with a 400 and returning false if the body names
+// another one.
+func inNamespace(w http.ResponseWriter, r *http.Request, ns *string) bool {
+	want := namespaceOf(r)
+	if *ns != "" && *ns != want {
+		sendError(w, http.StatusBadRequest,
+			fmt.Sprintf("object is in namespace %s, not %s", *ns, want))
+		return false
+	}
+	*ns = want
+	return true
+}
+
+// taskVisible reports whether a task can be looked up through a request:
+// it must be in the namespace of the request, so the /task routes only
+// reach the tasks of the default namespace.
+func taskVisible(r *http.Request, t *task.Task) bool {
+	return t.Namespace == namespaceOf(r)
+}
+
 func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 	d := json.NewDecoder(r.Body)
 	d.DisallowUnknownFields()
@@ -36,7 +121,22 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a.Manager.AddTask(te)
+	err = te.Task.Validate()
+	if err != nil {
+		msg := fmt.Sprintf("Invalid task %v: %v\n", te.Task.ID, err)
+		log.Print(msg)
+		sendError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if !inNamespace(w, r, &te.Task.Namespace) {
+		return
+	}
+
+	err = a.Manager.SubmitTask(&te)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
 	log.Printf("Added task %v\n", te.Task.ID)
 	w.WriteHeader(201)
 
@@ -44,9 +144,72 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *Api) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := ParseTaskQuery(r.URL.Query())
+	if err != nil {
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if ns := listNamespace(r); ns != "" {
+		q.Namespace = ns
+	}
+
+	tasks, next, err := a.Manager.QueryTasks(q)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	json.NewEncoder(w).Encode(a.Manager.GetTasks())
+	json.NewEncoder(w).Encode(tasks)
+}
+
+func (a *Api) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid task id %s", taskID))
+		return
+	}
+
+	t, err := a.Manager.TaskDb.Get(tID.String())
+	if err != nil || !taskVisible(r, t) {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("No task with ID %v found", tID))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(t)
+}
+
+func (a *Api) GetTaskEventsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid task id %s", taskID))
+		return
+	}
+
+	if t, err := a.Manager.TaskDb.Get(tID.String()); err != nil || !taskVisible(r, t) {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("No task with ID %v found", tID))
+		return
+	}
+
+	events, err := a.Manager.GetTaskEvents(tID)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(events)
 }
 
 func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -57,27 +220,82 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tID, _ := uuid.Parse(taskID)
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid task id %s", taskID))
+		return
+	}
 
 	taskToStop, err := a.Manager.TaskDb.Get(tID.String())
+	if err != nil || !taskVisible(r, taskToStop) {
+		msg := fmt.Sprintf("No task with ID %v found", tID)
+		log.Print(msg)
+		sendError(w, http.StatusNotFound, msg)
+		return
+	}
+
+	a.Manager.StopTask(taskToStop, "Stop requested through the API")
+
+	log.Printf("Added task event to stop task %v\n", taskToStop.ID)
+	w.WriteHeader(204)
+}
+
+// requestTask looks up the task of a request, answering with an error and
+// returning false if there is none.
+func (a *Api) requestTask(w http.ResponseWriter, r *http.Request) (*task.Task, bool) {
+	taskID := chi.URLParam(r, "taskID")
+	tID, err := uuid.Parse(taskID)
 	if err != nil {
-		log.Printf("No task with ID %v found", tID)
-		w.WriteHeader(http.StatusBadRequest)
+		sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid task id %s", taskID))
+		return nil, false
+	}
+
+	t, err := a.Manager.TaskDb.Get(tID.String())
+	if err != nil || !taskVisible(r, t) {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("No task with ID %v found", tID))
+		return nil, false
+	}
+	return t, true
+}
+
+func (a *Api) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.requestTask(w, r)
+	if !ok {
 		return
 	}
 
-	te := task.TaskEvent{
-		ID:        tID,
-		State:     task.Completed,
-		Timestamp: time.Now(),
+	logs, err := a.Manager.TaskLogs(r.Context(), t, r.URL.Query().Get("tail"),
+		r.URL.Query().Get("follow") == "true")
+	if err != nil {
+		sendObjectError(w, err)
+		return
 	}
+	defer logs.Close()
 
-	taskCopy := *taskToStop
-	taskCopy.State = task.Completed
-	te.Task = taskCopy
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	utils.StreamCopy(w, logs)
+}
 
-	a.Manager.AddTask(te)
+func (a *Api) ExecTaskHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.requestTask(w, r)
+	if !ok {
+		return
+	}
+	req := worker.ExecRequest{}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if len(req.Command) == 0 {
+		sendError(w, http.StatusBadRequest, "Command must not be empty")
+		return
+	}
 
-	log.Printf("Added task event %v to stop task %v\n", te.ID, taskToStop.ID)
-	w.WriteHeader(204)
+	result, err := a.Manager.ExecTask(t, req.Command)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	log.Printf("Ran %v in task %v\n", req.Command, t.ID)
+	sendJSON(w, http.StatusOK, result)
 }
@@ -0,0 +1,143 @@
+package manager
+
+import (
+	"cube/ingress"
+	"cube/namespace"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+func (m *Manager) CreateIngress(i *ingress.Ingress) error {
+	if i.Namespace == "" {
+		i.Namespace = namespace.Default
+	}
+	i.SetDefaults()
+	err := i.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	err = m.checkNamespace(i.Namespace)
+	if err != nil {
+		return err
+	}
+	key := namespace.Key(i.Namespace, i.Name)
+	if _, err := m.IngressDb.Get(key); err == nil {
+		return fmt.Errorf("%w: ingress %s", ErrAlreadyExists, key)
+	}
+	i.CreateTime = time.Now().UTC()
+	return m.IngressDb.Put(key, i)
+}
+
+// UpdateIngress replaces the rules of an ingress.
+func (m *Manager) UpdateIngress(ns, name string, spec *ingress.Ingress) (*ingress.Ingress, error) {
+	if spec.Name == "" {
+		spec.Name = name
+	}
+	if spec.Namespace == "" {
+		spec.Namespace = ns
+	}
+	if spec.Name != name || spec.Namespace != ns {
+		return nil, fmt.Errorf("ingress %s cannot be renamed to %s", namespace.Key(ns, name),
+			namespace.Key(spec.Namespace, spec.Name))
+	}
+	spec.SetDefaults()
+	err := spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	i, err := m.GetIngress(ns, name)
+	if err != nil {
+		return nil, err
+	}
+	updated := *i
+	updated.Rules = spec.Rules
+	err = m.IngressDb.Put(namespace.Key(ns, name), &updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (m *Manager) GetIngress(ns, name string) (*ingress.Ingress, error) {
+	key := namespace.Key(ns, name)
+	i, err := m.IngressDb.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: ingress %s", ErrNotFound, key)
+	}
+	return i, nil
+}
+
+// GetIngresses lists the ingresses of a namespace, or of all namespaces if
+// ns is empty.
+func (m *Manager) GetIngresses(ns string) []*ingress.Ingress {
+	all, _ := m.IngressDb.List()
+	ingresses := []*ingress.Ingress{}
+	for _, i := range all {
+		if ns == "" || i.Namespace == ns {
+			ingresses = append(ingresses, i)
+		}
+	}
+	sort.Slice(ingresses, func(i, j int) bool {
+		return namespace.Key(ingresses[i].Namespace, ingresses[i].Name) <
+			namespace.Key(ingresses[j].Namespace, ingresses[j].Name)
+	})
+	return ingresses
+}
+
+func (m *Manager) DeleteIngress(ns, name string) error {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	return m.deleteIngress(ns, name)
+}
+
+func (m *Manager) deleteIngress(ns, name string) error {
+	if _, err := m.GetIngress(ns, name); err != nil {
+		return err
+	}
+	return m.IngressDb.Delete(namespace.Key(ns, name))
+}
+
+// ServeIngress serves the ingress rules on an address, and keeps the
+// endpoints of the rules up to date whenever something changes, and at
+// least every 10 seconds.
+func (m *Manager) ServeIngress(address string) {
+	go func() {
+		for {
+			_, changed, _ := m.Feed.Since(m.Feed.Revision())
+			m.syncIngresses()
+			select {
+			case <-changed:
+			case <-time.After(10 * time.Second):
+			}
+		}
+	}()
+
+	log.Printf("Serving ingress on %s\n", address)
+	err := http.ListenAndServe(address, m.ingressRouter)
+	if err != nil {
+		log.Printf("Error serving ingress on %s: %v\n", address, err)
+	}
+}
+
+func (m *Manager) syncIngresses() {
+	ingresses, _ := m.IngressDb.List()
+	m.ingressRouter.Update(ingresses, func(i *ingress.Ingress, r ingress.Rule) []string {
+		var addrs []string
+		for _, e := range m.taskEndpoints(i.Namespace, r.Matches, r.TargetPort) {
+			addrs = append(addrs, e.Address)
+		}
+		return addrs
+	})
+}
@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"cube/ingress"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (a *Api) CreateIngressHandler(w http.ResponseWriter, r *http.Request) {
+	i := ingress.Ingress{}
+	if !decodeBody(w, r, &i) || !inNamespace(w, r, &i.Namespace) {
+		return
+	}
+
+	err := a.Manager.CreateIngress(&i)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+
+	log.Printf("Created ingress %s\n", i.Name)
+	sendJSON(w, http.StatusCreated, i)
+}
+
+func (a *Api) GetIngressesHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, a.Manager.GetIngresses(listNamespace(r)))
+}
+
+func (a *Api) GetIngressHandler(w http.ResponseWriter, r *http.Request) {
+	i, err := a.Manager.GetIngress(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, i)
+}
+
+func (a *Api) DeleteIngressHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.Manager.DeleteIngress(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) UpdateIngressHandler(w http.ResponseWriter, r *http.Request) {
+	spec := ingress.Ingress{}
+	if !decodeBody(w, r, &spec) {
+		return
+	}
+
+	i, err := a.Manager.UpdateIngress(namespaceOf(r), chi.URLParam(r, "name"), &spec)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, i)
+}
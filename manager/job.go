@@ -0,0 +1,182 @@
+package manager
+
+import (
+	"cube/job"
+	"cube/namespace"
+	"cube/task"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+func (m *Manager) CreateJob(j *job.Job) error {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	return m.createJob(j)
+}
+
+func (m *Manager) createJob(j *job.Job) error {
+	if j.Namespace == "" {
+		j.Namespace = namespace.Default
+	}
+	j.SetDefaults()
+	err := j.Validate()
+	if err != nil {
+		return err
+	}
+	err = m.checkNamespace(j.Namespace)
+	if err != nil {
+		return err
+	}
+	key := namespace.Key(j.Namespace, j.Name)
+	if _, err := m.JobDb.Get(key); err == nil {
+		return fmt.Errorf("%w: job %s", ErrAlreadyExists, key)
+	}
+	j.CreateTime = m.Clock.Now().UTC()
+	j.Status = job.Status{Phase: job.Active, StartTime: j.CreateTime}
+	return m.JobDb.Put(key, j)
+}
+
+func (m *Manager) GetJob(ns, name string) (*job.Job, error) {
+	key := namespace.Key(ns, name)
+	j, err := m.JobDb.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: job %s", ErrNotFound, key)
+	}
+	return j, nil
+}
+
+// GetJobs lists the jobs of a namespace, or of all namespaces if ns is
+// empty.
+func (m *Manager) GetJobs(ns string) []*job.Job {
+	all, _ := m.JobDb.List()
+	jobs := []*job.Job{}
+	for _, j := range all {
+		if ns == "" || j.Namespace == ns {
+			jobs = append(jobs, j)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return namespace.Key(jobs[i].Namespace, jobs[i].Name) < namespace.Key(jobs[j].Namespace, jobs[j].Name)
+	})
+	return jobs
+}
+
+// DeleteJob removes a job and stops the tasks it is still running.
+func (m *Manager) DeleteJob(ns, name string) error {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	return m.deleteJob(ns, name)
+}
+
+func (m *Manager) deleteJob(ns, name string) error {
+	j, err := m.GetJob(ns, name)
+	if err != nil {
+		return err
+	}
+	err = m.JobDb.Delete(namespace.Key(ns, name))
+	if err != nil {
+		return err
+	}
+
+	for _, t := range m.activeTasks(ns, j.Owner()) {
+		m.StopTask(t, fmt.Sprintf("Job %s was deleted", name))
+	}
+	log.Printf("Deleted job %s\n", namespace.Key(ns, name))
+	return nil
+}
+
+func (m *Manager) ReconcileJobs() {
+	for {
+		log.Println("Reconciling jobs")
+		m.reconcileJobs()
+		log.Println("Job reconciliation completed")
+		log.Printf("Sleeping for %v\n", m.Intervals.Reconcile)
+		time.Sleep(m.Intervals.Reconcile)
+	}
+}
+
+func (m *Manager) reconcileJobs() {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	jobs, _ := m.JobDb.List()
+	for _, j := range jobs {
+		if !j.Finished() {
+			m.reconcileJob(j)
+		}
+	}
+}
+
+// reconcileJob counts the successful and failed tasks of a job, finishes
+// the job once enough have succeeded or too many have failed, and otherwise
+// keeps up to Parallelism tasks running.
+func (m *Manager) reconcileJob(j *job.Job) {
+	owned := m.ownedTasks(j.Namespace, j.Owner(), func(map[string]string) bool { return true })
+	active := m.filterActive(owned)
+
+	status := j.Status
+	status.Active = len(active)
+	status.Succeeded, status.Failed = 0, 0
+	for _, t := range owned {
+		switch t.State {
+		case task.Completed:
+			// Tasks stopped through the manager carry the reason they
+			// were stopped and don't count as successes.
+			if t.Reason == "" {
+				status.Succeeded++
+			}
+		case task.Failed:
+			status.Failed++
+		}
+	}
+
+	now := m.Clock.Now().UTC()
+	switch {
+	case status.Succeeded >= j.Completions:
+		status.Phase = job.Complete
+	case status.Failed > j.BackoffLimit:
+		status.Phase = job.Failed
+		status.Reason = fmt.Sprintf("%d tasks failed, more than the backoff limit of %d", status.Failed, j.BackoffLimit)
+	case j.DeadlineExceeded(now):
+		status.Phase = job.Failed
+		status.Reason = fmt.Sprintf("Job was active for longer than %d seconds", j.ActiveDeadlineSeconds)
+	}
+
+	if status.Phase != job.Active {
+		status.CompletionTime = now
+		for _, t := range active {
+			m.StopTask(t, fmt.Sprintf("Job %s has finished", j.Name))
+		}
+		status.Active = 0
+		log.Printf("Job %s is %s\n", j.Name, status.Phase)
+	} else {
+		want := j.Parallelism
+		if remaining := j.Completions - status.Succeeded; remaining < want {
+			want = remaining
+		}
+		if diff := want - len(active); diff > 0 {
+			log.Printf("Job %s has %d active tasks, creating %d\n", j.Name, len(active), diff)
+			template := j.Template
+			// Failed tasks are retried by the job, not by Docker.
+			template.RestartPolicy = ""
+			status.AdmissionError = ""
+			for i := 0; i < diff; i++ {
+				if _, err := m.createTask(j.Namespace, template, j.Name, j.Owner()); err != nil {
+					status.AdmissionError = err.Error()
+					break
+				}
+				status.Active++
+			}
+		}
+	}
+
+	if status != j.Status {
+		updated := *j
+		updated.Status = status
+		m.JobDb.Put(namespace.Key(j.Namespace, j.Name), &updated)
+	}
+}
@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"cube/job"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (a *Api) CreateJobHandler(w http.ResponseWriter, r *http.Request) {
+	j := job.Job{}
+	if !decodeBody(w, r, &j) || !inNamespace(w, r, &j.Namespace) {
+		return
+	}
+
+	err := a.Manager.CreateJob(&j)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+
+	log.Printf("Created job %s\n", j.Name)
+	sendJSON(w, http.StatusCreated, j)
+}
+
+func (a *Api) GetJobsHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, a.Manager.GetJobs(listNamespace(r)))
+}
+
+func (a *Api) GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	j, err := a.Manager.GetJob(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, j)
+}
+
+func (a *Api) DeleteJobHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.Manager.DeleteJob(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,132 @@
+package manager
+
+import (
+	"cube/job"
+	"cube/namespace"
+	"cube/task"
+	"testing"
+	"time"
+)
+
+// jobStep finishes some of a job's active tasks, moves the clock on and
+// reconciles the job once.
+type jobStep struct {
+	succeed int
+	fail    int
+	// stop finishes tasks as completed with a reason, as tasks stopped
+	// through the manager are.
+	stop    int
+	advance time.Duration
+
+	phase     string
+	active    int
+	succeeded int
+	failed    int
+}
+
+// finishJobTasks finishes n of the job's active tasks in the given state.
+func finishJobTasks(t *testing.T, m *Manager, j *job.Job, n int, state task.State, reason string) {
+	t.Helper()
+	active := m.activeTasks(j.Namespace, j.Owner())
+	if len(active) < n {
+		t.Fatalf("job has %d active tasks, cannot finish %d", len(active), n)
+	}
+	for _, tk := range active[:n] {
+		tk.State = state
+		tk.Reason = reason
+		m.TaskDb.Put(tk.ID.String(), tk)
+	}
+}
+
+func TestReconcileJob(t *testing.T) {
+	tests := []struct {
+		name  string
+		job   job.Job
+		steps []jobStep
+	}{
+		{
+			name: "completions and parallelism",
+			job:  job.Job{Completions: 5, Parallelism: 2},
+			steps: []jobStep{
+				{phase: job.Active, active: 2},
+				{succeed: 2, phase: job.Active, active: 2, succeeded: 2},
+				{succeed: 1, phase: job.Active, active: 2, succeeded: 3},
+				// Only one more task is needed.
+				{succeed: 1, phase: job.Active, active: 1, succeeded: 4},
+				{succeed: 1, phase: job.Complete, active: 0, succeeded: 5},
+			},
+		},
+		{
+			name: "last completion",
+			job:  job.Job{Completions: 3, Parallelism: 3},
+			steps: []jobStep{
+				{phase: job.Active, active: 3},
+				{succeed: 2, phase: job.Active, active: 1, succeeded: 2},
+				{succeed: 1, phase: job.Complete, active: 0, succeeded: 3},
+			},
+		},
+		{
+			name: "backoff limit",
+			job:  job.Job{Completions: 1, BackoffLimit: 1},
+			steps: []jobStep{
+				{phase: job.Active, active: 1},
+				{fail: 1, phase: job.Active, active: 1, failed: 1},
+				{fail: 1, phase: job.Failed, active: 0, failed: 2},
+			},
+		},
+		{
+			name: "active deadline",
+			job:  job.Job{Completions: 4, Parallelism: 2, ActiveDeadlineSeconds: 60},
+			steps: []jobStep{
+				{phase: job.Active, active: 2},
+				{succeed: 1, advance: 30 * time.Second, phase: job.Active, active: 2, succeeded: 1},
+				{advance: time.Minute, phase: job.Failed, active: 0, succeeded: 1},
+			},
+		},
+		{
+			// A task stopped through the manager neither succeeded nor
+			// failed, so it is replaced.
+			name: "stopped task",
+			job:  job.Job{Completions: 1},
+			steps: []jobStep{
+				{phase: job.Active, active: 1},
+				{stop: 1, phase: job.Active, active: 1},
+				{succeed: 1, phase: job.Complete, active: 0, succeeded: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			clock := &fakeClock{now: time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)}
+			m.Clock = clock
+			j := tt.job
+			j.Name = "batch"
+			j.Template = task.Task{Image: "alpine"}
+			if err := m.CreateJob(&j); err != nil {
+				t.Fatalf("CreateJob: %v", err)
+			}
+
+			for i, step := range tt.steps {
+				finishJobTasks(t, m, &j, step.succeed, task.Completed, "")
+				finishJobTasks(t, m, &j, step.fail, task.Failed, "")
+				finishJobTasks(t, m, &j, step.stop, task.Completed, "Node w1 was drained")
+				clock.now = clock.now.Add(step.advance)
+				m.reconcileJobs()
+
+				got, _ := m.GetJob(namespace.Default, "batch")
+				s := got.Status
+				if s.Phase != step.phase || s.Active != step.active || s.Succeeded != step.succeeded || s.Failed != step.failed {
+					t.Fatalf("step %d: job is %s with %d active, %d succeeded, %d failed; want %s with %d, %d, %d",
+						i+1, s.Phase, s.Active, s.Succeeded, s.Failed, step.phase, step.active, step.succeeded, step.failed)
+				}
+				if active := len(m.activeTasks(j.Namespace, j.Owner())); active != step.active {
+					t.Errorf("step %d: %d tasks are active, status says %d", i+1, active, step.active)
+				}
+				if got.Finished() && (!s.CompletionTime.Equal(clock.now) || (s.Phase == job.Failed) == (s.Reason == "")) {
+					t.Errorf("step %d: finished at %v with reason %q", i+1, s.CompletionTime, s.Reason)
+				}
+			}
+		})
+	}
+}
@@ -2,9 +2,22 @@ package manager
 
 import (
 	"bytes"
+	"crypto/tls"
+	"cube/auth"
+	"cube/cronjob"
+	"cube/deployment"
+	"cube/ingress"
+	"cube/job"
+	"cube/namespace"
 	"cube/node"
+	"cube/pki"
+	"cube/priority"
+	"cube/proxy"
 	"cube/queue"
+	"cube/quota"
 	"cube/scheduler"
+	"cube/secret"
+	"cube/service"
 	"cube/store"
 	"cube/task"
 	"cube/worker"
@@ -12,8 +25,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"strings"
+	"net/url"
+	"reflect"
+	"sync"
 	"time"
 
 	"github.com/docker/go-connections/nat"
@@ -21,18 +37,111 @@ import (
 )
 
 type Manager struct {
-	Pending       *queue.Queue[*task.TaskEvent]
+	Pending       *queue.PriorityQueue[*task.TaskEvent]
 	TaskDb        store.Store[*task.Task]
 	EventDb       store.Store[*task.TaskEvent]
+	EventIndex    store.Index
 	Workers       []string
 	WorkerTaskMap map[string][]uuid.UUID
 	TaskWorkerMap map[uuid.UUID]string
 	LastWorkerIdx int
 	WorkerNodes   []*node.Node
 	Scheduler     scheduler.Scheduler
+	JoinToken     string
+	drains        map[string]*DrainStatus
+	stopping      map[uuid.UUID]bool
+	// stopRetries holds the stops that the worker could not be asked for,
+	// until they are tried again.
+	stopRetries map[uuid.UUID]stopRetry
+	// groups holds the pending members of task groups, by group key, until
+	// the whole group can be placed. It is only used by ProcessTasks.
+	groups map[string]map[uuid.UUID]*task.TaskEvent
+	// deferred holds the events queued during a pass over the pending
+	// queue, while passing is set, until the pass is over.
+	deferred      []*task.TaskEvent
+	passing       bool
+	Feed          *store.Feed
+	NamespaceDb   store.Store[*namespace.Namespace]
+	DeploymentDb  store.Store[*deployment.Deployment]
+	JobDb         store.Store[*job.Job]
+	CronJobDb     store.Store[*cronjob.CronJob]
+	ServiceDb     store.Store[*service.Service]
+	proxies       map[string]*proxy.Proxy
+	IngressDb     store.Store[*ingress.Ingress]
+	ingressRouter *ingress.Router
+	// DNSForward are the networks of the clients whose DNS queries for
+	// other domains are forwarded. Queries from nodes are always forwarded.
+	DNSForward      []*net.IPNet
+	SecretDb        store.Store[*secret.Secret]
+	QuotaDb         store.Store[*quota.Quota]
+	LimitRangeDb    store.Store[*quota.LimitRange]
+	PriorityClassDb store.Store[*priority.PriorityClass]
+	Clock           Clock
+	Intervals       Intervals
+	// Client makes the requests to the worker APIs, over TLS once UseTLS
+	// has been called.
+	Client *http.Client
+	scheme string
+	// CA issues the certificates of the workers when it is set. CertName
+	// is the common name of the manager's own certificate and Hosts are
+	// its host names and addresses, which no node is issued a certificate
+	// for.
+	CA               *pki.CA
+	CertName         string
+	Hosts            []string
+	CertValidity     time.Duration
+	CertDb           store.Store[*pki.Certificate]
+	BootstrapTokenDb store.Store[*pki.BootstrapToken]
+	// AuthEnabled makes the API authenticate its callers and check their
+	// role bindings. AdminToken is a token of the cube:admins group.
+	AuthEnabled   bool
+	AdminToken    string
+	TokenDb       store.Store[*auth.Token]
+	RoleBindingDb store.Store[*auth.RoleBinding]
+	// certMu serialises the use of join tokens and the issuing and
+	// revoking of certificates.
+	certMu sync.Mutex
+	mu     sync.Mutex
+	// taskMu serialises the read-modify-writes of stored tasks, so that
+	// the loops and the API don't overwrite each other's changes.
+	taskMu sync.Mutex
+	// admitMu serialises the admission of new tasks.
+	admitMu sync.Mutex
+	// controllerMu serialises changes to controller objects such as
+	// namespaces, deployments, jobs, cron jobs, services and ingresses
+	// between the API and the reconcile loops.
+	controllerMu sync.Mutex
 }
 
-func New(workers []string, schedulerType, dbType string) *Manager {
+// Intervals are how often the loops of the manager run.
+type Intervals struct {
+	ProcessTasks time.Duration
+	UpdateTasks  time.Duration
+	HealthChecks time.Duration
+	// Reconcile is the interval of the deployment, job, cron job and
+	// namespace controllers.
+	Reconcile time.Duration
+	// NodeTimeout is how long a node can go without a heartbeat before it
+	// is marked NotReady.
+	NodeTimeout time.Duration
+	// Certificates is how often the manager's certificate is checked for
+	// renewal.
+	Certificates time.Duration
+}
+
+var DefaultIntervals = Intervals{
+	ProcessTasks: 10 * time.Second,
+	UpdateTasks:  15 * time.Second,
+	HealthChecks: 60 * time.Second,
+	Reconcile:    10 * time.Second,
+	NodeTimeout:  45 * time.Second,
+	Certificates: time.Hour,
+}
+
+// New creates a manager with its stores of the given type, "memory" or
+// "bolt". Bolt stores are kept in dbFile, and the tasks that were pending
+// when the manager last stopped are queued again.
+func New(workers []string, schedulerType, dbType, dbFile, joinToken string) (*Manager, error) {
 	var nodes []*node.Node
 	workerTaskMap := make(map[string][]uuid.UUID)
 	for worker := range workers {
@@ -53,119 +162,343 @@ func New(workers []string, schedulerType, dbType string) *Manager {
 		s = &scheduler.RoundRobin{Name: "roundrobin"}
 	}
 
-	var ts store.Store[*task.Task]
-	var es store.Store[*task.TaskEvent]
+	b, err := store.NewBackend(dbType, dbFile)
+	if err != nil {
+		return nil, err
+	}
+	ts := store.Open[*task.Task](b, "tasks")
+	es := store.Open[*task.TaskEvent](b, "events")
+	ei := store.OpenIndex(b, "task_events")
+	ds := store.Open[*deployment.Deployment](b, "deployments")
+	js := store.Open[*job.Job](b, "jobs")
+	cs := store.Open[*cronjob.CronJob](b, "cronjobs")
+	ss := store.Open[*service.Service](b, "services")
+	is := store.Open[*ingress.Ingress](b, "ingresses")
+	ns := store.Open[*namespace.Namespace](b, "namespaces")
+	sec := store.Open[*secret.Secret](b, "secrets")
+	qs := store.Open[*quota.Quota](b, "quotas")
+	ls := store.Open[*quota.LimitRange](b, "limitranges")
+	ps := store.Open[*priority.PriorityClass](b, "priorityclasses")
+	certs := store.Open[*pki.Certificate](b, "certificates")
+	tokens := store.Open[*pki.BootstrapToken](b, "bootstraptokens")
+	apiTokens := store.Open[*auth.Token](b, "apitokens")
+	bindings := store.Open[*auth.RoleBinding](b, "rolebindings")
+	if b.Err() != nil {
+		return nil, b.Err()
+	}
+
+	feed := store.NewFeed(changeFeedSize)
+
+	m := &Manager{
+		Pending:          queue.NewPriority(pendingOrder),
+		TaskDb:           store.NewWatchedStore(ts, feed, "task"),
+		EventDb:          es,
+		EventIndex:       ei,
+		Workers:          workers,
+		WorkerTaskMap:    workerTaskMap,
+		TaskWorkerMap:    make(map[uuid.UUID]string),
+		WorkerNodes:      nodes,
+		Scheduler:        s,
+		JoinToken:        joinToken,
+		drains:           make(map[string]*DrainStatus),
+		stopping:         make(map[uuid.UUID]bool),
+		stopRetries:      make(map[uuid.UUID]stopRetry),
+		groups:           make(map[string]map[uuid.UUID]*task.TaskEvent),
+		Feed:             feed,
+		NamespaceDb:      store.NewWatchedStore(ns, feed, "namespace"),
+		DeploymentDb:     store.NewWatchedStore(ds, feed, "deployment"),
+		JobDb:            store.NewWatchedStore(js, feed, "job"),
+		CronJobDb:        store.NewWatchedStore(cs, feed, "cronjob"),
+		ServiceDb:        store.NewWatchedStore(ss, feed, "service"),
+		proxies:          make(map[string]*proxy.Proxy),
+		IngressDb:        store.NewWatchedStore(is, feed, "ingress"),
+		ingressRouter:    ingress.NewRouter(),
+		SecretDb:         store.NewWatchedStore(sec, feed, "secret"),
+		QuotaDb:          store.NewWatchedStore(qs, feed, "quota"),
+		LimitRangeDb:     store.NewWatchedStore(ls, feed, "limitrange"),
+		PriorityClassDb:  store.NewWatchedStore(ps, feed, "priorityclass"),
+		Clock:            realClock{},
+		Intervals:        DefaultIntervals,
+		Client:           http.DefaultClient,
+		scheme:           "http",
+		CertDb:           certs,
+		BootstrapTokenDb: tokens,
+		TokenDb:          apiTokens,
+		RoleBindingDb:    bindings,
+	}
+	if _, err := m.NamespaceDb.Get(namespace.Default); err != nil {
+		m.NamespaceDb.Put(namespace.Default, &namespace.Namespace{
+			Name:       namespace.Default,
+			CreateTime: time.Now().UTC(),
+			Status:     namespace.Status{Phase: namespace.Active},
+		})
+	}
+	m.requeuePending()
+	return m, nil
+}
 
-	switch dbType {
-	case "memory":
-		ts = store.NewInMemoryStore[*task.Task]()
-		es = store.NewInMemoryStore[*task.TaskEvent]()
+// UseTLS makes the manager reach the worker APIs over TLS with the client
+// configuration c, which holds the certificate the manager presents to
+// the workers. Workers with revoked certificates are not trusted.
+func (m *Manager) UseTLS(c *tls.Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.VerifyConnection = m.VerifyConnection
+	m.Client = pki.NewClient(c)
+	m.scheme = "https"
+	for _, n := range m.WorkerNodes {
+		if u, err := url.Parse(n.Api); err == nil {
+			n.Api = m.nodeApi(u.Host)
+		}
+		n.Client = m.Client
 	}
+}
+
+// nodeApi returns the base URL of the API of a worker at address.
+func (m *Manager) nodeApi(address string) string {
+	return fmt.Sprintf("%s://%s", m.scheme, address)
+}
 
-	return &Manager{
-		Pending:       queue.New[*task.TaskEvent](),
-		TaskDb:        ts,
-		EventDb:       es,
-		Workers:       workers,
-		WorkerTaskMap: workerTaskMap,
-		TaskWorkerMap: make(map[uuid.UUID]string),
-		WorkerNodes:   nodes,
-		Scheduler:     s,
+// requeuePending queues the pending tasks found in the store, which were
+// waiting to be scheduled when the manager stopped.
+func (m *Manager) requeuePending() {
+	for _, t := range m.GetTasks() {
+		if t.State != task.Pending {
+			continue
+		}
+		m.Pending.Enqueue(&task.TaskEvent{
+			ID:        uuid.New(),
+			State:     task.Scheduled,
+			Timestamp: time.Now().UTC(),
+			Task:      *t,
+		})
 	}
 }
 
 func (m *Manager) SelectWorker(t task.Task) (*node.Node, error) {
-	candidates := m.Scheduler.SelectCandidateNodes(t, m.WorkerNodes)
+	nodes := m.schedulableNodes()
+	candidates := m.Scheduler.SelectCandidateNodes(t, nodes)
 
 	if candidates == nil {
-		msg := fmt.Sprintf("No available candidates match resource request for task %v", t.ID)
+		msg := fmt.Sprintf("task %v is unschedulable: %s", t.ID, scheduler.Explain(t, nodes))
+		if unavailable := len(m.nodes()) - len(nodes); unavailable > 0 {
+			msg += fmt.Sprintf(" (%d node(s) not ready or cordoned)", unavailable)
+		}
 		err := errors.New(msg)
 		return nil, err
 	}
 
 	scores := m.Scheduler.Score(t, candidates)
 	selectedNode := m.Scheduler.Pick(scores, candidates)
-	return selectedNode, nil
+	return m.getNode(selectedNode.Name)
 }
 
-func (m *Manager) AddTask(te task.TaskEvent) {
-	m.Pending.Enqueue(&te)
-}
+// errTaskChanged is returned by updates that no longer apply because the
+// stored task changed since the caller read it.
+var errTaskChanged = errors.New("task changed since it was read")
 
-func (m *Manager) updateTasks() {
-	for _, worker := range m.Workers {
-		log.Printf("Checking worker %v for task update", worker)
-		url := fmt.Sprintf("http://%s/task", worker)
+// updateTask applies change to the stored task with the given ID and
+// stores the result. The task is read again under taskMu, so changes made
+// since the caller read it are kept. Nothing is stored if change fails.
+func (m *Manager) updateTask(id uuid.UUID, change func(t *task.Task) error) (*task.Task, error) {
+	m.taskMu.Lock()
+	defer m.taskMu.Unlock()
 
-		resp, err := http.Get(url)
-		if err != nil {
-			log.Printf("Error connecting to %v:%v\n", worker, err)
-			continue
-		}
+	stored, err := m.TaskDb.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	t := *stored
+	if err := change(&t); err != nil {
+		return nil, err
+	}
+	if err := m.TaskDb.Put(id.String(), &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
 
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("Error sending request to worker :%v\n", worker)
-			continue
+// AddTask queues a task event. Tasks seen for the first time are recorded
+// as pending so they can be looked up before they are scheduled.
+func (m *Manager) AddTask(te task.TaskEvent) {
+	if te.Task.Namespace == "" {
+		te.Task.Namespace = namespace.Default
+	}
+	m.taskMu.Lock()
+	if _, err := m.TaskDb.Get(te.Task.ID.String()); err != nil {
+		te.Task.SubmitTime = m.Clock.Now().UTC()
+		t := te.Task
+		t.State = task.Pending
+		m.TaskDb.Put(t.ID.String(), &t)
+	}
+	m.taskMu.Unlock()
+
+	// Event IDs key the event store, so they are never taken from callers.
+	te.ID = uuid.New()
+	te.Timestamp = time.Now().UTC()
+	if te.Type == "" {
+		te.Type = task.EventSubmitted
+		if te.State == task.Completed {
+			te.Type = task.EventStopRequested
 		}
+	}
+	ev := te
+	m.recordEvent(&ev)
 
-		d := json.NewDecoder(resp.Body)
-		var tasks []*task.Task
+	m.enqueue(&te)
+}
 
-		err = d.Decode(&tasks)
+// pendingOrder puts the events of higher priority tasks first.
+func pendingOrder(a, b *task.TaskEvent) bool {
+	return a.Task.Priority > b.Task.Priority
+}
 
+func (m *Manager) updateTasks() {
+	for _, n := range m.nodes() {
+		log.Printf("Checking worker %v for task update", n.Name)
+		tasks, err := m.workerTasks(n)
 		if err != nil {
-			log.Printf("Error decoding tasks :%v\n", err)
+			log.Printf("Error getting the tasks of worker %v: %v\n", n.Name, err)
 			continue
 		}
 
 		for _, t := range tasks {
 			log.Printf("Attempting to update task: %v", t.ID)
 
-			task, err := m.TaskDb.Get(t.ID.String())
+			if w, ok := m.taskWorker(t.ID); !ok || w != n.Name {
+				if ok || !m.adoptTask(n, t.ID) {
+					log.Printf("Task %s is no longer assigned to %s, ignoring update\n", t.ID, n.Name)
+					continue
+				}
+			}
+
+			persisted, err := m.TaskDb.Get(t.ID.String())
 
 			if err != nil {
 				log.Printf("Task with ID %s not found\n", t.ID)
 				continue
 			}
-			if task.State != t.State {
-				task.State = t.State
+			if persisted.State == t.State && persisted.StartTime.Equal(t.StartTime) &&
+				persisted.FinishTime.Equal(t.FinishTime) && persisted.ContainerId == t.ContainerId &&
+				persisted.ExitCode == t.ExitCode && reflect.DeepEqual(persisted.HostPorts, t.HostPorts) {
+				continue
 			}
-			task.StartTime = t.StartTime
-			task.FinishTime = t.FinishTime
-			task.ContainerId = t.ContainerId
-			task.HostPorts = t.HostPorts
 
-			m.TaskDb.Put(task.ID.String(), task)
+			var oldState task.State
+			persisted, err = m.updateTask(t.ID, func(p *task.Task) error {
+				oldState = p.State
+				p.State = t.State
+				p.StartTime = t.StartTime
+				p.FinishTime = t.FinishTime
+				p.ContainerId = t.ContainerId
+				p.HostPorts = t.HostPorts
+				p.ExitCode = t.ExitCode
+				if t.State != task.Running {
+					p.Healthy = false
+				}
+				return nil
+			})
+			if err != nil {
+				log.Printf("Error updating task %s: %v\n", t.ID, err)
+				continue
+			}
+
+			if oldState != t.State {
+				m.recordTaskEvent(*persisted, task.EventStateChanged,
+					fmt.Sprintf("State changed from %v to %v", oldState, t.State))
+				if isFinished(t.State) {
+					m.releaseTask(n, t.ID)
+				}
+			}
 		}
 	}
 }
 
+// workerTasks returns the tasks a worker knows about.
+func (m *Manager) workerTasks(n *node.Node) ([]*task.Task, error) {
+	resp, err := m.Client.Get(fmt.Sprintf("%s/task", n.Api))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("worker responded with status %d", resp.StatusCode)
+	}
+
+	var tasks []*task.Task
+	err = json.NewDecoder(resp.Body).Decode(&tasks)
+	if err != nil {
+		return nil, fmt.Errorf("decoding tasks: %w", err)
+	}
+	return tasks, nil
+}
+
 func (m *Manager) UpdateTasks() {
 	for {
 		log.Println("Checking for task updates from workers")
 		m.updateTasks()
+		m.checkNodes()
 		log.Println("Task updates completed")
-		log.Println("Sleeping for 15 seconds")
-		time.Sleep(15 * time.Second)
+		log.Printf("Sleeping for %v\n", m.Intervals.UpdateTasks)
+		time.Sleep(m.Intervals.UpdateTasks)
 	}
 }
 
+// ProcessTasks works through the pending queue every ProcessTasks interval. Tasks that
+// can't be scheduled are queued again and retried on the next pass.
 func (m *Manager) ProcessTasks() {
 	for {
 		log.Println("Processing any tasks in the queue")
+		m.processTasks()
+		log.Printf("Sleeping for %v\n", m.Intervals.ProcessTasks)
+		time.Sleep(m.Intervals.ProcessTasks)
+	}
+}
+
+// processTasks makes one pass over the pending queue. Events queued during
+// the pass, such as tasks that could not be placed or were preempted, are
+// only queued once it is over, so that each is tried once per pass and a
+// task that doesn't fit can't hold up the lower priority ones behind it.
+func (m *Manager) processTasks() {
+	m.mu.Lock()
+	m.passing = true
+	m.mu.Unlock()
+
+	for m.Pending.Length() > 0 {
 		m.SendWork()
-		log.Println("Sleeping for 10 seconds")
-		time.Sleep(10 * time.Second)
+	}
+	m.scheduleGroups()
+
+	m.mu.Lock()
+	deferred := m.deferred
+	m.deferred, m.passing = nil, false
+	m.mu.Unlock()
+	for _, te := range deferred {
+		m.Pending.Enqueue(te)
 	}
 }
 
+// enqueue adds an event to the pending queue, or holds it back until the
+// end of the current pass.
+func (m *Manager) enqueue(te *task.TaskEvent) {
+	m.mu.Lock()
+	if m.passing {
+		m.deferred = append(m.deferred, te)
+		m.mu.Unlock()
+		return
+	}
+	m.mu.Unlock()
+	m.Pending.Enqueue(te)
+}
+
 func (m *Manager) DoHealthChecks() {
 	for {
 		log.Println("Performing task health check")
 		m.doHealthChecks()
 		log.Println("Task health checks completed")
-		log.Println("Sleeping for 60 seconds")
-		time.Sleep(60 * time.Second)
+		log.Printf("Sleeping for %v\n", m.Intervals.HealthChecks)
+		time.Sleep(m.Intervals.HealthChecks)
 	}
 }
 
@@ -177,11 +510,10 @@ func (m *Manager) SendWork() {
 
 	te := m.Pending.Dequeue()
 	t := te.Task
-	m.EventDb.Put(te.ID.String(), te)
 
 	log.Printf("Pulled %v from the pending queue\n", t)
 
-	taskWorker, ok := m.TaskWorkerMap[t.ID]
+	taskWorker, ok := m.taskWorker(t.ID)
 	if ok {
 		persistedTask, err := m.TaskDb.Get(t.ID.String())
 
@@ -190,63 +522,255 @@ func (m *Manager) SendWork() {
 			return
 		}
 
-		if te.State == task.Completed && task.IsValidStateTransition(persistedTask.State, te.State) {
+		// A task that is scheduled may already be starting on its worker,
+		// so it is stopped there like a running one.
+		active := persistedTask.State == task.Scheduled || persistedTask.State == task.Running
+		if te.State == task.Completed && active {
+			if !m.stopDue(t.ID) {
+				m.enqueue(te)
+				return
+			}
 			log.Printf("Stopping the task %v from worker %v", t, taskWorker)
-			m.stopTask(taskWorker, t.ID.String())
+			err := m.stopTask(taskWorker, t.ID.String())
+			// A scheduled task may still be queued on its worker, which
+			// only knows it once it starts.
+			gone := errors.Is(err, ErrNodeNotFound) ||
+				errors.Is(err, errUnknownTask) && persistedTask.State == task.Running
+			if gone {
+				// The node is gone, or has lost the task: it runs nowhere.
+				m.unassignTask(t.ID)
+				m.finishStop(persistedTask)
+			} else if err != nil {
+				m.retryStop(t.ID)
+				m.enqueue(te)
+			}
 			return
 		}
 
-		log.Printf("invalid request: existing task %s is in state %v and cannot transition to the completed state\n",
-			persistedTask.ID.String(), persistedTask.State)
+		log.Printf("invalid request: existing task %s is in state %v and cannot transition to the %v state\n",
+			persistedTask.ID.String(), persistedTask.State, te.State)
+		m.doneStopping(t.ID)
 		return
 	}
 
-	w, err := m.SelectWorker(t)
+	if te.State == task.Completed || m.isStopping(t.ID) {
+		log.Printf("Task %v was stopped before it was scheduled\n", t.ID)
+		m.finishStop(&t)
+		return
+	}
+
+	if persistedTask, err := m.TaskDb.Get(t.ID.String()); err == nil && persistedTask.State == task.Completed {
+		log.Printf("Task %v has already been stopped, not scheduling it\n", t.ID)
+		return
+	}
 
+	if t.Group != "" {
+		m.holdForGroup(te)
+		return
+	}
+
+	w, err := m.SelectWorker(t)
 	if err != nil {
-		log.Printf("Failed to select a worker for task %v\n", t)
+		log.Printf("Failed to select a worker for task %v: %v\n", t.ID, err)
+		reason := err.Error()
+		if n := m.preempt(t); n != "" {
+			reason = fmt.Sprintf("Waiting for the tasks preempted on node %s to stop", n)
+		}
+		m.keepPending(te, reason)
 		return
 	}
+	m.placeTask(te, w)
+}
+
+// keepPending leaves a task that can't be placed pending, with the reason,
+// and queues it again so it is tried on the next pass.
+func (m *Manager) keepPending(te *task.TaskEvent, reason string) {
+	if te.Task.Reason != reason {
+		m.recordTaskEvent(te.Task, task.EventUnschedulable, reason)
+	}
+	te.Task.State = task.Pending
+	te.Task.Reason = reason
+	m.updateTask(te.Task.ID, func(t *task.Task) error {
+		t.State = task.Pending
+		t.Reason = reason
+		return nil
+	})
+	m.enqueue(te)
+}
+
+// placeTask assigns a task to a node and sends it to the node's worker.
+// A task that can't be sent goes back to the pending queue, free to be
+// placed on another node.
+func (m *Manager) placeTask(te *task.TaskEvent, w *node.Node) {
+	err := m.startOn(te, w)
+	if err != nil {
+		m.keepPending(te, err.Error())
+	}
+}
 
-	m.WorkerTaskMap[w.Name] = append(m.WorkerTaskMap[w.Name], t.ID)
-	m.TaskWorkerMap[t.ID] = w.Name
+// startOn assigns a task to a node and sends it to the node's worker. A
+// task whose secrets are missing is not assigned, and one the worker
+// doesn't take is unassigned again; the error says why.
+func (m *Manager) startOn(te *task.TaskEvent, w *node.Node) error {
+	t := te.Task
+	env, err := m.secretEnv(&t)
+	if err != nil {
+		log.Printf("Not placing task %v: %v\n", t.ID, err)
+		return err
+	}
+	m.assignTask(w, t)
 
 	t.State = task.Scheduled
-	m.TaskDb.Put(t.ID.String(), &t)
+	t.Reason = ""
+	m.updateTask(t.ID, func(stored *task.Task) error {
+		stored.State = task.Scheduled
+		stored.Reason = ""
+		return nil
+	})
+	te.Task = t
+	m.recordTaskEvent(t, task.EventScheduled, fmt.Sprintf("Assigned to node %s", w.Name))
 
-	data, err := json.Marshal(te)
+	sent := *te
+	sent.Task.SecretEnv = env
+	err = m.sendTask(w, sent)
 	if err != nil {
-		log.Printf("Unable to marshal task object: %v\n", err)
-		return
+		log.Printf("Error sending task %v to %v: %v\n", t.ID, w.Name, err)
+		m.unassignTask(t.ID)
+		return fmt.Errorf("Node %s did not take the task: %v", w.Name, err)
 	}
+	return nil
+}
 
-	url := fmt.Sprintf("http://%s/task", w.Name)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+// sendTask asks a node's worker to run a task. The worker must answer with
+// 201 Created.
+func (m *Manager) sendTask(w *node.Node, te task.TaskEvent) error {
+	data, err := json.Marshal(te)
+	if err != nil {
+		return err
+	}
 
+	url := fmt.Sprintf("%s/task", w.Api)
+	resp, err := m.Client.Post(url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
-		log.Printf("Error connecting to %v: %v\n", w, err)
-		m.Pending.Enqueue(te)
-		return
+		return err
 	}
+	defer resp.Body.Close()
 
 	d := json.NewDecoder(resp.Body)
 	if resp.StatusCode != http.StatusCreated {
 		e := worker.ErrorResponse{}
-		err := d.Decode(&e)
-		if err != nil {
-			fmt.Printf("Error decoding response: %s\n", err.Error())
-			return
+		if d.Decode(&e) != nil || e.Message == "" {
+			return fmt.Errorf("worker responded with status %d", resp.StatusCode)
 		}
-		log.Printf("Response error (%d): %s", e.HttpStatusCode, e.Message)
-		return
+		return fmt.Errorf("worker responded with status %d: %s", resp.StatusCode, e.Message)
 	}
-	t = task.Task{}
+	t := task.Task{}
 	err = d.Decode(&t)
 	if err != nil {
-		fmt.Printf("Error decoding response: %s\n", err.Error())
-		return
+		log.Printf("Error decoding response: %v\n", err)
+		return nil
 	}
 	log.Printf("%#v\n", t)
+	return nil
+}
+
+// StopTask queues a request to stop a task.
+func (m *Manager) StopTask(t *task.Task, reason string) {
+	t.Reason = reason
+	stored, err := m.updateTask(t.ID, func(s *task.Task) error {
+		s.Reason = reason
+		return nil
+	})
+	if err == nil {
+		*t = *stored
+	}
+
+	taskCopy := *t
+	taskCopy.State = task.Completed
+
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Completed,
+		Timestamp: time.Now(),
+		Task:      taskCopy,
+		Message:   reason,
+	}
+
+	m.mu.Lock()
+	m.stopping[t.ID] = true
+	m.mu.Unlock()
+
+	m.AddTask(te)
+}
+
+// finishStop marks a task that was asked to stop and runs nowhere as
+// completed.
+func (m *Manager) finishStop(t *task.Task) {
+	t.State = task.Completed
+	t.FinishTime = time.Now().UTC()
+	m.updateTask(t.ID, func(s *task.Task) error {
+		s.State = t.State
+		s.FinishTime = t.FinishTime
+		return nil
+	})
+	m.doneStopping(t.ID)
+}
+
+// doneStopping forgets that a task was asked to stop, once it has stopped
+// or the request was refused.
+func (m *Manager) doneStopping(id uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.stopping, id)
+	delete(m.stopRetries, id)
+}
+
+// maxStopBackoff is the longest wait between two attempts to ask a worker
+// to stop a task.
+const maxStopBackoff = 5 * time.Minute
+
+// stopRetry records how often a worker could not be asked to stop a task,
+// and when to ask again.
+type stopRetry struct {
+	failures int
+	next     time.Time
+}
+
+// retryStop backs off the next attempt to stop a task, doubling the wait
+// from one pass over the pending queue up to maxStopBackoff.
+func (m *Manager) retryStop(id uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := m.stopRetries[id]
+	wait := m.Intervals.ProcessTasks << min(r.failures, 16)
+	if wait <= 0 || wait > maxStopBackoff {
+		wait = maxStopBackoff
+	}
+	r.failures++
+	r.next = m.Clock.Now().Add(wait)
+	m.stopRetries[id] = r
+	log.Printf("Stopping task %v failed %d time(s), trying again in %v\n", id, r.failures, wait)
+}
+
+// stopDue reports whether a stop that failed before is due to be tried
+// again.
+func (m *Manager) stopDue(id uuid.UUID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.stopRetries[id]
+	return !ok || !m.Clock.Now().Before(r.next)
+}
+
+// isStopping reports whether a stop was requested for a task that has not
+// finished yet.
+func (m *Manager) isStopping(id uuid.UUID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stopping[id]
 }
 
 func (m *Manager) GetTasks() []*task.Task {
@@ -257,19 +781,22 @@ func (m *Manager) GetTasks() []*task.Task {
 func (m *Manager) checkTaskHealth(t task.Task) error {
 	log.Printf("Calling health check for task %s: %s\n", t.ID, t.HealthCheck)
 
-	w := m.TaskWorkerMap[t.ID]
+	w, ok := m.taskNode(t.ID)
+	if !ok {
+		msg := fmt.Sprintf("No worker found for task %s", t.ID)
+		log.Println(msg)
+		return errors.New(msg)
+	}
 
 	hostPort := getHostPort(t.HostPorts)
 
-	worker := strings.Split(w, ":")
-
 	if hostPort == nil {
 		msg := fmt.Sprintf("Host port is nil for task %s", t.ID)
 		log.Println(msg)
 		return nil
 	}
 
-	url := fmt.Sprintf("http://%s:%s%s", worker[0], *hostPort, t.HealthCheck)
+	url := fmt.Sprintf("http://%s:%s%s", w.Host(), *hostPort, t.HealthCheck)
 
 	log.Printf("Calling health check for task %s: %s\n", t.ID, url)
 
@@ -301,23 +828,76 @@ func getHostPort(ports nat.PortMap) *string {
 func (m *Manager) doHealthChecks() {
 	for _, t := range m.GetTasks() {
 		if t.State == task.Running && t.RestartCount < 3 {
-			err := m.checkTaskHealth(*t)
+			err := m.updateHealth(t)
 			if err != nil {
+				m.recordTaskEvent(*t, task.EventHealthCheckFailed, err.Error())
 				if t.RestartCount < 3 {
 					m.restartTask(t)
 				}
 			}
-		} else if t.State == task.Failed && t.RestartCount < 3 {
+		} else if t.State == task.Failed && t.RestartCount < 3 && t.Owner == "" {
+			// Failed tasks owned by a controller are replaced by it instead.
 			m.restartTask(t)
 		}
 	}
 }
 
+// updateHealth runs the task's health check and records the result on
+// the task.
+func (m *Manager) updateHealth(t *task.Task) error {
+	err := m.checkTaskHealth(*t)
+	if healthy := err == nil; t.Healthy != healthy {
+		t.Healthy = healthy
+		m.updateTask(t.ID, func(s *task.Task) error {
+			s.Healthy = healthy
+			return nil
+		})
+	}
+	return err
+}
+
 func (m *Manager) restartTask(t *task.Task) {
-	w := m.TaskWorkerMap[t.ID]
+	// The task may have been stopped or restarted since it was read.
+	restarted, err := m.updateTask(t.ID, func(s *task.Task) error {
+		if s.State != t.State || m.isStopping(t.ID) {
+			return errTaskChanged
+		}
+		s.RestartCount++
+		return nil
+	})
+	if err != nil {
+		log.Printf("Not restarting task %s: %v\n", t.ID, err)
+		return
+	}
+	*t = *restarted
+
+	w, ok := m.taskNode(t.ID)
+	if !ok {
+		// Like any other task that needs a node, it waits in the pending
+		// queue until one has room for it.
+		log.Printf("No worker found for task %s, scheduling it again\n", t.ID)
+		m.requeueTask(t, "Restarted without a node")
+		return
+	}
+	env, err := m.secretEnv(t)
+	if err != nil {
+		// It waits in the pending queue for its secrets.
+		m.unassignTask(t.ID)
+		m.requeueTask(t, err.Error())
+		return
+	}
 	t.State = task.Scheduled
-	t.RestartCount++
-	m.TaskDb.Put(t.ID.String(), t)
+	t.Healthy = false
+	t.ExitCode = 0
+	m.updateTask(t.ID, func(s *task.Task) error {
+		s.State = t.State
+		s.Healthy = false
+		s.ExitCode = 0
+		return nil
+	})
+	m.activateTask(w, *t)
+	m.recordTaskEvent(*t, task.EventRestarted,
+		fmt.Sprintf("Restart %d on node %s", t.RestartCount, w.Name))
 
 	te := task.TaskEvent{
 		ID:        uuid.New(),
@@ -325,59 +905,47 @@ func (m *Manager) restartTask(t *task.Task) {
 		Timestamp: time.Now(),
 		Task:      *t,
 	}
-	data, err := json.Marshal(te)
+	te.Task.SecretEnv = env
+	err = m.sendTask(w, te)
 	if err != nil {
-		log.Printf("Unable to marshal task object: %v.", t)
-		return
+		log.Printf("Error sending task %v to %v: %v\n", t.ID, w.Name, err)
+		m.unassignTask(t.ID)
+		m.requeueTask(t, fmt.Sprintf("Node %s did not take the task: %v", w.Name, err))
 	}
-	url := fmt.Sprintf("http://%s/task", w)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		log.Printf("Error connecting to %v: %v", w, err)
-		m.Pending.Enqueue(&te)
-		return
-	}
-	d := json.NewDecoder(resp.Body)
-	if resp.StatusCode != http.StatusCreated {
-		e := worker.ErrorResponse{}
-		err := d.Decode(&e)
-		if err != nil {
-			fmt.Printf("Error decoding response: %s\n", err.Error())
-			return
-		}
-		log.Printf("Response error (%d): %s", e.HttpStatusCode, e.Message)
-		return
-	}
-	newTask := task.Task{}
-	err = d.Decode(&newTask)
-	if err != nil {
-		fmt.Printf("Error decoding response: %s\n", err.Error())
-		return
-	}
-	log.Printf("%#v\n", t)
 }
 
-func (m *Manager) stopTask(worker string, taskId string) {
-	url := fmt.Sprintf("http://%s/task/%s", worker, taskId)
-
-	client := &http.Client{}
+// stopTask asks a worker to stop a task and reports whether the worker
+// accepted the request.
+func (m *Manager) stopTask(worker string, taskId string) error {
+	n, err := m.getNode(worker)
+	if err != nil {
+		log.Printf("Unable to stop task %s: %v\n", taskId, err)
+		return err
+	}
+	url := fmt.Sprintf("%s/task/%s", n.Api, taskId)
 
 	req, err := http.NewRequest(http.MethodDelete, url, nil)
 
 	if err != nil {
 		log.Printf("Error creating request to delete task %s: %v\n", taskId, err)
-		return
+		return err
 	}
 
-	resp, err := client.Do(req)
+	resp, err := m.Client.Do(req)
 
 	if err != nil {
 		log.Printf("error connecting to worker at %s: %v\n", url, err)
-		return
+		return err
 	}
-	if resp.StatusCode != 204 {
-		log.Printf("Error sending request: %v\n", err)
-		return
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		log.Printf("Worker %s doesn't know task %s\n", worker, taskId)
+		return fmt.Errorf("%w: %s on worker %s", errUnknownTask, taskId, worker)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		log.Printf("Worker %s refused to stop task %s with status %d\n", worker, taskId, resp.StatusCode)
+		return fmt.Errorf("worker %s refused to stop task %s with status %d", worker, taskId, resp.StatusCode)
 	}
 	log.Printf("task %s has been scheduled to be stopped", taskId)
+	return nil
 }
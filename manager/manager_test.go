@@ -0,0 +1,204 @@
+package manager
+
+import (
+	"cube/node"
+	"cube/task"
+	"cube/worker"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// newTestManager returns a manager with in-memory stores and no nodes.
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := New([]string{}, "roundrobin", "memory", "", "token")
+	if err != nil {
+		t.Fatalf("creating manager: %v", err)
+	}
+	return m
+}
+
+// fakeWorker is a worker API that reports a fixed set of tasks and records
+// the tasks it is asked to start and stop.
+type fakeWorker struct {
+	mu      sync.Mutex
+	tasks   map[uuid.UUID]*task.Task
+	started []task.Task
+	stopped []uuid.UUID
+	// startStatus and stopStatus are the statuses the worker answers
+	// starts and stops with, if not 201 and 204.
+	startStatus int
+	stopStatus  int
+	server      *httptest.Server
+}
+
+func newFakeWorker(t *testing.T) *fakeWorker {
+	t.Helper()
+	f := &fakeWorker{tasks: make(map[uuid.UUID]*task.Task)}
+	r := chi.NewRouter()
+	r.Get("/task", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		tasks := []*task.Task{}
+		for _, t := range f.tasks {
+			tasks = append(tasks, t)
+		}
+		json.NewEncoder(w).Encode(tasks)
+	})
+	r.Post("/task", func(w http.ResponseWriter, r *http.Request) {
+		te := task.TaskEvent{}
+		json.NewDecoder(r.Body).Decode(&te)
+		f.mu.Lock()
+		status := f.startStatus
+		if status == 0 {
+			f.started = append(f.started, te.Task)
+			status = http.StatusCreated
+		}
+		f.mu.Unlock()
+		w.WriteHeader(status)
+	})
+	r.Delete("/task/{id}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.stopped = append(f.stopped, uuid.MustParse(chi.URLParam(r, "id")))
+		status := f.stopStatus
+		f.mu.Unlock()
+		if status == 0 {
+			status = http.StatusNoContent
+		}
+		w.WriteHeader(status)
+	})
+	f.server = httptest.NewServer(r)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// address returns the host and port the worker registers with.
+func (f *fakeWorker) address() string {
+	return strings.TrimPrefix(f.server.URL, "http://")
+}
+
+func (f *fakeWorker) setTask(t task.Task) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tasks[t.ID] = &t
+}
+
+// refuseStarts makes the worker answer starts with a status other than
+// 201, without starting the tasks.
+func (f *fakeWorker) refuseStarts(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.startStatus = status
+}
+
+// answerStops makes the worker answer stops with a status other than 204.
+func (f *fakeWorker) answerStops(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopStatus = status
+}
+
+func (f *fakeWorker) stops() []uuid.UUID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]uuid.UUID{}, f.stopped...)
+}
+
+func (f *fakeWorker) starts() []uuid.UUID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []uuid.UUID
+	for _, t := range f.started {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+// startedTasks returns the tasks the worker was asked to start, as sent.
+func (f *fakeWorker) startedTasks() []task.Task {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]task.Task{}, f.started...)
+}
+
+// addNode registers a fake worker with the manager.
+func addNode(t *testing.T, m *Manager, name string) (*fakeWorker, *node.Node) {
+	t.Helper()
+	f := newFakeWorker(t)
+	n, err := m.RegisterNode(worker.Registration{Name: name, Address: f.address(), Cores: 4, Memory: 1 << 30, Disk: 1 << 30})
+	if err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+	return f, n
+}
+
+// runTaskOn records a task as running on a node.
+func runTaskOn(m *Manager, n *node.Node, t *task.Task) {
+	t.State = task.Running
+	m.TaskDb.Put(t.ID.String(), t)
+	m.assignTask(n, *t)
+}
+
+func TestUnschedulableTaskStaysPending(t *testing.T) {
+	m := newTestManager(t)
+	tk := task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx", State: task.Scheduled}
+	m.TaskDb.Put(tk.ID.String(), &tk)
+	m.AddTask(task.TaskEvent{ID: uuid.New(), State: task.Scheduled, Task: tk})
+
+	m.SendWork()
+
+	got, _ := m.TaskDb.Get(tk.ID.String())
+	if got.State != task.Pending || got.Reason == "" {
+		t.Errorf("task without a node is %v with reason %q, want %v with a reason", got.State, got.Reason, task.Pending)
+	}
+	if m.Pending.Length() != 1 {
+		t.Errorf("pending queue has %d events, want the task queued again", m.Pending.Length())
+	}
+}
+
+func TestRestartWithoutNodeRequeues(t *testing.T) {
+	m := newTestManager(t)
+	tk := &task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx", State: task.Failed}
+	m.TaskDb.Put(tk.ID.String(), tk)
+
+	m.restartTask(tk)
+
+	got, _ := m.TaskDb.Get(tk.ID.String())
+	if got.State != task.Pending || got.RestartCount != 1 {
+		t.Errorf("restarted task is %v after %d restarts, want %v after 1", got.State, got.RestartCount, task.Pending)
+	}
+	if m.Pending.Length() != 1 {
+		t.Errorf("pending queue has %d events, want 1", m.Pending.Length())
+	}
+}
+
+func TestRestartOfChangedTaskIsSkipped(t *testing.T) {
+	m := newTestManager(t)
+	f, n := addNode(t, m, "w1")
+	tk := &task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx", State: task.Failed}
+	m.TaskDb.Put(tk.ID.String(), tk)
+	m.assignTask(n, *tk)
+	read := *tk
+
+	// The task is stopped after the health checks read it.
+	m.updateTask(tk.ID, func(s *task.Task) error {
+		s.State = task.Completed
+		return nil
+	})
+	m.restartTask(&read)
+
+	got, _ := m.TaskDb.Get(tk.ID.String())
+	if got.State != task.Completed || got.RestartCount != 0 {
+		t.Errorf("task is %v after %d restarts, want %v after 0", got.State, got.RestartCount, task.Completed)
+	}
+	if starts := f.starts(); len(starts) != 0 {
+		t.Errorf("worker was asked to start a stopped task: %v", starts)
+	}
+}
@@ -0,0 +1,176 @@
+package manager
+
+import (
+	"cube/namespace"
+	"cube/task"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+func (m *Manager) CreateNamespace(n *namespace.Namespace) error {
+	err := n.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	if _, err := m.NamespaceDb.Get(n.Name); err == nil {
+		return fmt.Errorf("%w: namespace %s", ErrAlreadyExists, n.Name)
+	}
+	n.CreateTime = time.Now().UTC()
+	n.Status = namespace.Status{Phase: namespace.Active}
+	return m.NamespaceDb.Put(n.Name, n)
+}
+
+func (m *Manager) GetNamespace(name string) (*namespace.Namespace, error) {
+	n, err := m.NamespaceDb.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: namespace %s", ErrNotFound, name)
+	}
+	return n, nil
+}
+
+func (m *Manager) GetNamespaces() []*namespace.Namespace {
+	namespaces, _ := m.NamespaceDb.List()
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name < namespaces[j].Name
+	})
+	return namespaces
+}
+
+// checkNamespace returns an error unless objects can be created in the
+// namespace.
+func (m *Manager) checkNamespace(name string) error {
+	n, err := m.GetNamespace(name)
+	if err != nil {
+		return err
+	}
+	if n.Status.Phase == namespace.Terminating {
+		return fmt.Errorf("namespace %s is being deleted", name)
+	}
+	return nil
+}
+
+// DeleteNamespace marks a namespace as terminating, deletes the objects in
+// it and stops its tasks. The namespace itself is removed by
+// ReconcileNamespaces once all of its tasks have finished.
+func (m *Manager) DeleteNamespace(name string) (*namespace.Namespace, error) {
+	if name == namespace.Default {
+		return nil, errors.New("the default namespace cannot be deleted")
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	n, err := m.GetNamespace(name)
+	if err != nil {
+		return nil, err
+	}
+	if n.Status.Phase != namespace.Terminating {
+		updated := *n
+		updated.Status.Phase = namespace.Terminating
+		err = m.NamespaceDb.Put(name, &updated)
+		if err != nil {
+			return nil, err
+		}
+		n = &updated
+		log.Printf("Deleting namespace %s\n", name)
+	}
+
+	m.cleanNamespace(name)
+	return n, nil
+}
+
+// cleanNamespace deletes every object in a namespace and stops its tasks.
+func (m *Manager) cleanNamespace(ns string) {
+	for _, c := range m.GetCronJobs(ns) {
+		m.deleteCronJob(ns, c.Name)
+	}
+	for _, j := range m.GetJobs(ns) {
+		m.deleteJob(ns, j.Name)
+	}
+	for _, d := range m.GetDeployments(ns) {
+		m.deleteDeployment(ns, d.Name)
+	}
+	for _, s := range m.GetServices(ns) {
+		m.deleteService(ns, s.Name)
+	}
+	for _, i := range m.GetIngresses(ns) {
+		m.deleteIngress(ns, i.Name)
+	}
+	for _, s := range m.GetSecrets(ns) {
+		m.deleteSecret(ns, s.Name)
+	}
+	for _, b := range m.GetRoleBindings() {
+		if b.Namespace == ns {
+			m.RoleBindingDb.Delete(b.Name)
+		}
+	}
+
+	for _, t := range m.namespaceTasks(ns) {
+		if !isFinished(t.State) && !m.isStopping(t.ID) {
+			m.StopTask(t, fmt.Sprintf("Namespace %s was deleted", ns))
+		}
+	}
+}
+
+func (m *Manager) ReconcileNamespaces() {
+	for {
+		log.Println("Reconciling namespaces")
+		m.reconcileNamespaces()
+		log.Println("Namespace reconciliation completed")
+		log.Printf("Sleeping for %v\n", m.Intervals.Reconcile)
+		time.Sleep(m.Intervals.Reconcile)
+	}
+}
+
+// reconcileNamespaces finishes deleting terminating namespaces. Objects
+// created while the namespace was being cleaned are deleted again, and the
+// namespace is removed with its finished tasks once none are left running.
+func (m *Manager) reconcileNamespaces() {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	namespaces, _ := m.NamespaceDb.List()
+	for _, n := range namespaces {
+		if n.Status.Phase != namespace.Terminating {
+			continue
+		}
+		m.cleanNamespace(n.Name)
+
+		tasks := m.namespaceTasks(n.Name)
+		running := false
+		for _, t := range tasks {
+			if !isFinished(t.State) {
+				running = true
+				break
+			}
+		}
+		if running {
+			continue
+		}
+
+		for _, t := range tasks {
+			m.deleteTask(t.ID)
+		}
+		m.QuotaDb.Delete(n.Name)
+		m.LimitRangeDb.Delete(n.Name)
+		m.NamespaceDb.Delete(n.Name)
+		log.Printf("Deleted namespace %s\n", n.Name)
+	}
+}
+
+func (m *Manager) namespaceTasks(ns string) []*task.Task {
+	var tasks []*task.Task
+	for _, t := range m.GetTasks() {
+		if t.Namespace == ns {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
@@ -0,0 +1,49 @@
+package manager
+
+import (
+	"cube/namespace"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (a *Api) CreateNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	n := namespace.Namespace{}
+	if !decodeBody(w, r, &n) {
+		return
+	}
+
+	err := a.Manager.CreateNamespace(&n)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+
+	log.Printf("Created namespace %s\n", n.Name)
+	sendJSON(w, http.StatusCreated, n)
+}
+
+func (a *Api) GetNamespacesHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, a.Manager.GetNamespaces())
+}
+
+func (a *Api) GetNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := a.Manager.GetNamespace(chi.URLParam(r, "namespace"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, n)
+}
+
+// DeleteNamespaceHandler starts deleting a namespace and answers with 202,
+// as the namespace is only removed once its tasks have stopped.
+func (a *Api) DeleteNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := a.Manager.DeleteNamespace(chi.URLParam(r, "namespace"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusAccepted, n)
+}
@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"cube/namespace"
+	"cube/task"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDeletedNamespaceRemovesTaskEvents(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CreateNamespace(&namespace.Namespace{Name: "team-a"}); err != nil {
+		t.Fatalf("CreateNamespace: %v", err)
+	}
+	te := task.TaskEvent{State: task.Scheduled, Task: task.Task{ID: uuid.New(), Name: "web", Namespace: "team-a", Image: "nginx"}}
+	if err := m.SubmitTask(&te); err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+	id := te.Task.ID
+
+	if _, err := m.DeleteNamespace("team-a"); err != nil {
+		t.Fatalf("DeleteNamespace: %v", err)
+	}
+	// The task was never placed, so the stop finishes it in the queue.
+	m.processTasks()
+	m.reconcileNamespaces()
+
+	if _, err := m.GetNamespace("team-a"); err == nil {
+		t.Error("namespace was not removed")
+	}
+	if _, err := m.TaskDb.Get(id.String()); err == nil {
+		t.Error("task was not removed")
+	}
+	if events, err := m.GetTaskEvents(id); err == nil && len(events) > 0 {
+		t.Errorf("task still has %d events", len(events))
+	}
+	events, _ := m.EventDb.List()
+	for _, e := range events {
+		if e.Task.ID == id {
+			t.Errorf("event %s of the task was left behind", e.ID)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package manager
+
+import (
+	"crypto/subtle"
+	"cube/pki"
+	"cube/task"
+	"cube/worker"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// requireJoinToken rejects requests that don't carry the cluster join token.
+func (a *Api) requireJoinToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(worker.JoinTokenHeader)
+		if a.Manager.JoinToken == "" {
+			sendError(w, http.StatusForbidden, "node registration is disabled")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.Manager.JoinToken)) != 1 {
+			log.Printf("Rejected node request with invalid join token from %s\n", r.RemoteAddr)
+			sendError(w, http.StatusUnauthorized, "invalid join token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireNodeCert rejects node requests over TLS whose client certificate
+// wasn't issued to the node named in the path.
+func (a *Api) requireNodeCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := a.checkNodeCert(r, chi.URLParam(r, "name"))
+		if err != nil {
+			sendError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkNodeCert makes sure a request comes from the node name, by the
+// common name of its client certificate, when the API is served over TLS.
+func (a *Api) checkNodeCert(r *http.Request, name string) error {
+	if a.TLS == nil {
+		return nil
+	}
+	cn, err := pki.PeerName(r)
+	if err != nil {
+		log.Printf("Rejected node request without a certificate from %s\n", r.RemoteAddr)
+		return errors.New("node requests need a client certificate")
+	}
+	if cn != name {
+		log.Printf("Rejected request for node %s with the certificate of %s from %s\n", name, cn, r.RemoteAddr)
+		return fmt.Errorf("certificate of %s is not valid for node %s", cn, name)
+	}
+	return nil
+}
+
+func (a *Api) GetNodesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(a.Manager.GetNodes())
+}
+
+func (a *Api) GetNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	n, err := a.Manager.GetNode(name)
+	if err != nil {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("No node with name %s found", name))
+		return
+	}
+	sendJSON(w, http.StatusOK, n)
+}
+
+func (a *Api) RegisterNodeHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	reg := worker.Registration{}
+	err := d.Decode(&reg)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
+		log.Print(msg)
+		sendError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	err = a.checkNodeCert(r, reg.Name)
+	if err != nil {
+		sendError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	n, err := a.Manager.RegisterNode(reg)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(n)
+}
+
+func (a *Api) DeregisterNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	err := a.Manager.DeregisterNode(name)
+	if errors.Is(err, ErrNodeNotFound) {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("No node with name %s found", name))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) HeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	err := a.Manager.Heartbeat(name)
+	if errors.Is(err, ErrNodeNotFound) {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("No node with name %s found", name))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) CordonNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	err := a.Manager.Cordon(name)
+	if errors.Is(err, ErrNodeNotFound) {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("No node with name %s found", name))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) UncordonNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	err := a.Manager.Uncordon(name)
+	if errors.Is(err, ErrNodeNotFound) {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("No node with name %s found", name))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) DrainNodeHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	ds, err := a.Manager.Drain(name)
+	if errors.Is(err, ErrNodeNotFound) {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("No node with name %s found", name))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ds)
+}
+
+func (a *Api) GetDrainStatusHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	ds, ok := a.Manager.GetDrainStatus(name)
+	if !ok {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("Node %s is not being drained", name))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ds)
+}
+
+func (a *Api) AddTaintHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	taint := task.Taint{}
+	err := d.Decode(&taint)
+	if err != nil {
+		msg := fmt.Sprintf("Error unmarshalling body: %v\n", err)
+		log.Print(msg)
+		sendError(w, http.StatusBadRequest, msg)
+		return
+	}
+	err = taint.Validate()
+	if err != nil {
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = a.Manager.AddTaint(name, taint)
+	if errors.Is(err, ErrNodeNotFound) {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("No node with name %s found", name))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) RemoveTaintHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	key := chi.URLParam(r, "key")
+
+	err := a.Manager.RemoveTaint(name, key)
+	if errors.Is(err, ErrNodeNotFound) {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("No node with name %s found", name))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,359 @@
+package manager
+
+import (
+	"cube/node"
+	"cube/store"
+	"cube/task"
+	"cube/worker"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrNodeNotFound = errors.New("node not found")
+
+// errUnknownTask is returned when a worker doesn't know a task it is asked
+// to stop.
+var errUnknownTask = errors.New("unknown task")
+
+func (m *Manager) RegisterNode(r worker.Registration) (*node.Node, error) {
+	if r.Name == "" || r.Address == "" {
+		return nil, errors.New("node name and address are required")
+	}
+	for _, t := range r.Taints {
+		if err := t.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.findNode(r.Name)
+	if n == nil {
+		n = node.NewNode(r.Name, m.nodeApi(r.Address), "worker")
+		n.Client = m.Client
+		m.WorkerNodes = append(m.WorkerNodes, n)
+		m.Workers = append(m.Workers, r.Name)
+		defer m.publishNode(store.Added, n)
+		log.Printf("Registered new node %s at %s\n", r.Name, r.Address)
+	} else {
+		defer m.publishNode(store.Modified, n)
+		n.Api = m.nodeApi(r.Address)
+		log.Printf("Node %s registered again at %s\n", r.Name, r.Address)
+	}
+	if _, ok := m.WorkerTaskMap[r.Name]; !ok {
+		m.WorkerTaskMap[r.Name] = []uuid.UUID{}
+	}
+
+	n.Cores = r.Cores
+	n.Memory = r.Memory
+	n.Disk = r.Disk
+	if r.Labels != nil {
+		n.Labels = r.Labels
+	}
+	if r.Taints != nil {
+		n.Taints = r.Taints
+	}
+	n.ServesServices = r.Services
+	n.Status = node.Ready
+	n.LastHeartbeat = time.Now()
+
+	for _, t := range n.Taints {
+		if t.Effect == task.NoExecute {
+			go m.evictIntolerantTasks(n.Name)
+			break
+		}
+	}
+
+	return n, nil
+}
+
+// DeregisterNode removes a node from the cluster. Tasks that were still
+// active on it are sent back to the pending queue to be scheduled elsewhere.
+func (m *Manager) DeregisterNode(name string) error {
+	m.mu.Lock()
+	idx := -1
+	for i, n := range m.WorkerNodes {
+		if n.Name == name {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		m.mu.Unlock()
+		return ErrNodeNotFound
+	}
+
+	m.publishNode(store.Deleted, m.WorkerNodes[idx])
+	m.WorkerNodes = append(m.WorkerNodes[:idx:idx], m.WorkerNodes[idx+1:]...)
+	workers := make([]string, 0, len(m.Workers))
+	for _, w := range m.Workers {
+		if w != name {
+			workers = append(workers, w)
+		}
+	}
+	m.Workers = workers
+
+	taskIDs := m.WorkerTaskMap[name]
+	delete(m.WorkerTaskMap, name)
+	for _, id := range taskIDs {
+		delete(m.TaskWorkerMap, id)
+	}
+	m.mu.Unlock()
+
+	log.Printf("Deregistered node %s\n", name)
+
+	for _, id := range taskIDs {
+		t, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			continue
+		}
+		if t.State == task.Scheduled || t.State == task.Running {
+			log.Printf("Rescheduling task %s from deregistered node %s\n", t.ID, name)
+			m.requeueTask(t, fmt.Sprintf("Node %s was deregistered", name))
+		}
+	}
+	return nil
+}
+
+func (m *Manager) Heartbeat(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.findNode(name)
+	if n == nil {
+		return ErrNodeNotFound
+	}
+	n.LastHeartbeat = time.Now()
+	if n.Status != node.Ready {
+		log.Printf("Node %s is ready again\n", name)
+		n.Status = node.Ready
+		m.publishNode(store.Modified, n)
+	}
+	return nil
+}
+
+// GetNodes returns copies of the nodes, taken under the manager's lock so
+// that callers can read them while heartbeats keep updating the nodes.
+func (m *Manager) GetNodes() []*node.Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodes := make([]*node.Node, len(m.WorkerNodes))
+	for i, n := range m.WorkerNodes {
+		nodes[i] = n.Clone()
+	}
+	return nodes
+}
+
+// GetNode returns a copy of the node with the given name.
+func (m *Manager) GetNode(name string) (*node.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.findNode(name)
+	if n == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, name)
+	}
+	return n.Clone(), nil
+}
+
+// checkNodes marks registered nodes that stopped sending heartbeats as
+// NotReady. Nodes passed to New never heartbeat and are left alone.
+func (m *Manager) checkNodes() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, n := range m.WorkerNodes {
+		if n.LastHeartbeat.IsZero() || n.Status != node.Ready {
+			continue
+		}
+		if time.Since(n.LastHeartbeat) > m.Intervals.NodeTimeout {
+			log.Printf("Node %s missed its heartbeats, marking it %s\n", n.Name, node.NotReady)
+			n.Status = node.NotReady
+			m.publishNode(store.Modified, n)
+		}
+	}
+}
+
+// publishNode records a node change on the change feed. It must be called
+// with m.mu held.
+func (m *Manager) publishNode(changeType store.ChangeType, n *node.Node) {
+	m.Feed.Publish("node", changeType, n.Name, n.Clone())
+}
+
+func (m *Manager) findNode(name string) *node.Node {
+	for _, n := range m.WorkerNodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+func (m *Manager) getNode(name string) (*node.Node, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.findNode(name)
+	if n == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, name)
+	}
+	return n, nil
+}
+
+func (m *Manager) nodes() []*node.Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodes := make([]*node.Node, len(m.WorkerNodes))
+	copy(nodes, m.WorkerNodes)
+	return nodes
+}
+
+// schedulableNodes returns copies of the nodes that can take new tasks, so
+// that schedulers can inspect them while the manager keeps updating them.
+func (m *Manager) schedulableNodes() []*node.Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var nodes []*node.Node
+	for _, n := range m.WorkerNodes {
+		if n.Status == node.Ready && !n.Unschedulable {
+			nodes = append(nodes, n.Clone())
+		}
+	}
+	return nodes
+}
+
+func (m *Manager) taskWorker(id uuid.UUID) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.TaskWorkerMap[id]
+	return w, ok
+}
+
+func (m *Manager) taskNode(id uuid.UUID) (*node.Node, bool) {
+	w, ok := m.taskWorker(id)
+	if !ok {
+		return nil, false
+	}
+	n, err := m.getNode(w)
+	if err != nil {
+		return nil, false
+	}
+	return n, true
+}
+
+func (m *Manager) assignTask(n *node.Node, t task.Task) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.WorkerTaskMap[n.Name] = append(m.WorkerTaskMap[n.Name], t.ID)
+	m.TaskWorkerMap[t.ID] = n.Name
+	n.AddTask(t)
+}
+
+// activateTask marks a task that is started again on its node as active.
+func (m *Manager) activateTask(n *node.Node, t task.Task) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n.AddTask(t)
+}
+
+// releaseTask marks a task that stopped running as no longer active on
+// its node.
+func (m *Manager) releaseTask(n *node.Node, id uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n.RemoveTask(id)
+	delete(m.stopping, id)
+	delete(m.stopRetries, id)
+}
+
+func (m *Manager) unassignTask(id uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.TaskWorkerMap[id]
+	if !ok {
+		return
+	}
+	delete(m.TaskWorkerMap, id)
+	if n := m.findNode(w); n != nil {
+		n.RemoveTask(id)
+	}
+
+	ids := m.WorkerTaskMap[w]
+	for i, tID := range ids {
+		if tID == id {
+			m.WorkerTaskMap[w] = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+}
+
+// evictTask stops a task on its current node and sends it back through the
+// pending queue so that it is scheduled on another node.
+func (m *Manager) evictTask(t *task.Task, reason string) {
+	w, ok := m.taskWorker(t.ID)
+	if ok {
+		m.recordTaskEvent(*t, task.EventEvicted, fmt.Sprintf("Evicted from node %s: %s", w, reason))
+		m.stopTask(w, t.ID.String())
+		m.unassignTask(t.ID)
+	}
+	m.requeueTask(t, reason)
+}
+
+// adoptTask assigns a task that a node reports to it, if the task is
+// scheduled or running and assigned to no node. This happens when the
+// manager restarts with a persistent store, as assignments are kept in
+// memory.
+func (m *Manager) adoptTask(n *node.Node, id uuid.UUID) bool {
+	t, err := m.TaskDb.Get(id.String())
+	if err != nil || (t.State != task.Scheduled && t.State != task.Running) || m.isMoving(n.Name, id) {
+		return false
+	}
+	m.assignTask(n, *t)
+	log.Printf("Adopted task %s running on %s\n", id, n.Name)
+	return true
+}
+
+func isFinished(s task.State) bool {
+	return s == task.Completed || s == task.Failed
+}
+
+// requeueTask puts a task back on the pending queue so it is scheduled
+// again from scratch.
+func (m *Manager) requeueTask(t *task.Task, reason string) {
+	t.State = task.Pending
+	t.ContainerId = ""
+	t.HostPorts = nil
+	t.Healthy = false
+	t.ExitCode = 0
+	m.updateTask(t.ID, func(s *task.Task) error {
+		s.State = t.State
+		s.ContainerId = ""
+		s.HostPorts = nil
+		s.Healthy = false
+		s.ExitCode = 0
+		return nil
+	})
+
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Scheduled,
+		Timestamp: time.Now(),
+		Task:      *t,
+		Type:      task.EventRescheduled,
+		Message:   reason,
+	}
+	m.AddTask(te)
+}
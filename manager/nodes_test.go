@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"cube/worker"
+	"sync"
+	"testing"
+)
+
+func TestGetNodesReturnsCopies(t *testing.T) {
+	m := newTestManager(t)
+	_, err := m.RegisterNode(worker.Registration{Name: "w1", Address: "localhost:5556"})
+	if err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+
+	nodes := m.GetNodes()
+	if len(nodes) != 1 {
+		t.Fatalf("got %d nodes, want 1", len(nodes))
+	}
+	nodes[0].Unschedulable = true
+	n, err := m.GetNode("w1")
+	if err != nil {
+		t.Fatalf("GetNode: %v", err)
+	}
+	if n.Unschedulable {
+		t.Error("changing a node returned by GetNodes changed the manager's node")
+	}
+}
+
+// TestNodeReadsDuringHeartbeats is meant to run with -race.
+func TestNodeReadsDuringHeartbeats(t *testing.T) {
+	m := newTestManager(t)
+	_, err := m.RegisterNode(worker.Registration{Name: "w1", Address: "localhost:5556"})
+	if err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			m.Heartbeat("w1")
+			m.checkNodes()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			m.schedulableNodes()
+			for _, n := range m.GetNodes() {
+				_ = n.Status
+				_ = n.LastHeartbeat
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,38 @@
+package manager
+
+import (
+	"cube/scheduler"
+	"cube/task"
+	"fmt"
+	"log"
+)
+
+// preempt makes room for a task that fits on no node by evicting tasks of
+// a lower priority, and returns the name of the node it freed up, or "" if
+// none can be. The victims are stopped within their grace period and
+// queued again. The task itself is placed on a later pass, by which time
+// their resources have been released.
+func (m *Manager) preempt(t task.Task) string {
+	running := make(map[string][]*task.Task)
+	for _, r := range m.GetTasks() {
+		if isFinished(r.State) || m.isStopping(r.ID) {
+			continue
+		}
+		if w, ok := m.taskWorker(r.ID); ok {
+			running[w] = append(running[w], r)
+		}
+	}
+
+	p := scheduler.FindPreemption(t, m.schedulableNodes(), running)
+	if p == nil {
+		return ""
+	}
+
+	for _, v := range p.Victims {
+		msg := fmt.Sprintf("Preempted by task %s with priority %d", t.ID, t.Priority)
+		log.Printf("Task %s on node %s: %s\n", v.ID, p.Node.Name, msg)
+		m.recordTaskEvent(*v, task.EventPreempted, msg)
+		m.evictTask(v, msg)
+	}
+	return p.Node.Name
+}
@@ -0,0 +1,71 @@
+package manager
+
+import (
+	"cube/priority"
+	"cube/task"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPreemptedNodeIsUsedOnTheNextPass(t *testing.T) {
+	m := newTestManager(t)
+	f, n := addNode(t, m, "w1")
+	if err := m.CreatePriorityClass(&priority.PriorityClass{Name: "high", Value: 10}); err != nil {
+		t.Fatalf("CreatePriorityClass: %v", err)
+	}
+	victim := &task.Task{ID: uuid.New(), Name: "batch", Namespace: "default", Image: "nginx", Cpu: 3}
+	runTaskOn(m, n, victim)
+
+	te := task.TaskEvent{State: task.Scheduled,
+		Task: task.Task{ID: uuid.New(), Name: "web", Image: "nginx", Cpu: 2, PriorityClass: "high"}}
+	if err := m.SubmitTask(&te); err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+
+	m.processTasks()
+	if !slices.Contains(f.stops(), victim.ID) {
+		t.Fatal("the lower priority task was not stopped")
+	}
+	if slices.Contains(f.starts(), te.Task.ID) {
+		t.Fatal("the task was placed in the pass that preempted for it")
+	}
+	got, _ := m.TaskDb.Get(te.Task.ID.String())
+	if got.State != task.Pending {
+		t.Errorf("task is %v after preempting, want %v", got.State, task.Pending)
+	}
+
+	m.processTasks()
+	if !slices.Contains(f.starts(), te.Task.ID) {
+		t.Error("the task was not placed on the next pass")
+	}
+	if slices.Contains(f.starts(), victim.ID) {
+		t.Error("the preempted task was placed back on the node")
+	}
+}
+
+func TestUnschedulableTaskDoesNotBlockThePass(t *testing.T) {
+	m := newTestManager(t)
+	f, _ := addNode(t, m, "w1")
+	if err := m.CreatePriorityClass(&priority.PriorityClass{Name: "high", Value: 10}); err != nil {
+		t.Fatalf("CreatePriorityClass: %v", err)
+	}
+	big := task.TaskEvent{State: task.Scheduled,
+		Task: task.Task{ID: uuid.New(), Name: "big", Image: "nginx", Cpu: 64, PriorityClass: "high"}}
+	small := task.TaskEvent{State: task.Scheduled,
+		Task: task.Task{ID: uuid.New(), Name: "small", Image: "nginx", Cpu: 1}}
+	for _, te := range []*task.TaskEvent{&big, &small} {
+		if err := m.SubmitTask(te); err != nil {
+			t.Fatalf("SubmitTask: %v", err)
+		}
+	}
+
+	m.processTasks()
+	if !slices.Contains(f.starts(), small.Task.ID) {
+		t.Error("the task behind an unschedulable one was not placed")
+	}
+	if m.Pending.Length() != 1 {
+		t.Errorf("pending queue has %d events after the pass, want the unschedulable task", m.Pending.Length())
+	}
+}
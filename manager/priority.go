@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"cube/priority"
+	"cube/task"
+	"fmt"
+	"sort"
+	"time"
+)
+
+func (m *Manager) CreatePriorityClass(p *priority.PriorityClass) error {
+	err := p.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	if _, err := m.PriorityClassDb.Get(p.Name); err == nil {
+		return fmt.Errorf("%w: priority class %s", ErrAlreadyExists, p.Name)
+	}
+	if p.GlobalDefault {
+		if d := m.defaultPriorityClass(); d != nil {
+			return fmt.Errorf("priority class %s is already the global default", d.Name)
+		}
+	}
+	p.CreateTime = time.Now().UTC()
+	return m.PriorityClassDb.Put(p.Name, p)
+}
+
+func (m *Manager) GetPriorityClass(name string) (*priority.PriorityClass, error) {
+	p, err := m.PriorityClassDb.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: priority class %s", ErrNotFound, name)
+	}
+	return p, nil
+}
+
+func (m *Manager) GetPriorityClasses() []*priority.PriorityClass {
+	classes, _ := m.PriorityClassDb.List()
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i].Name < classes[j].Name
+	})
+	return classes
+}
+
+// DeletePriorityClass removes a priority class. Tasks that were admitted
+// with it keep their priority.
+func (m *Manager) DeletePriorityClass(name string) error {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	if _, err := m.GetPriorityClass(name); err != nil {
+		return err
+	}
+	return m.PriorityClassDb.Delete(name)
+}
+
+func (m *Manager) defaultPriorityClass() *priority.PriorityClass {
+	classes, _ := m.PriorityClassDb.List()
+	for _, p := range classes {
+		if p.GlobalDefault {
+			return p
+		}
+	}
+	return nil
+}
+
+// setPriority sets the priority of a task from its priority class, or from
+// the global default class if it names none.
+func (m *Manager) setPriority(t *task.Task) error {
+	if t.PriorityClass == "" {
+		t.Priority = 0
+		if d := m.defaultPriorityClass(); d != nil {
+			t.PriorityClass = d.Name
+			t.Priority = d.Value
+		}
+		return nil
+	}
+	p, err := m.GetPriorityClass(t.PriorityClass)
+	if err != nil {
+		return err
+	}
+	t.Priority = p.Value
+	return nil
+}
@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"cube/priority"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (a *Api) CreatePriorityClassHandler(w http.ResponseWriter, r *http.Request) {
+	p := priority.PriorityClass{}
+	if !decodeBody(w, r, &p) {
+		return
+	}
+
+	err := a.Manager.CreatePriorityClass(&p)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+
+	log.Printf("Created priority class %s\n", p.Name)
+	sendJSON(w, http.StatusCreated, p)
+}
+
+func (a *Api) GetPriorityClassesHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, a.Manager.GetPriorityClasses())
+}
+
+func (a *Api) GetPriorityClassHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := a.Manager.GetPriorityClass(chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, p)
+}
+
+func (a *Api) DeletePriorityClassHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.Manager.DeletePriorityClass(chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
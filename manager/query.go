@@ -0,0 +1,208 @@
+package manager
+
+import (
+	"cube/task"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxTaskQueryLimit = 1000
+
+// TaskQuery selects, orders and pages the tasks returned by QueryTasks.
+type TaskQuery struct {
+	States    []task.State
+	Namespace string
+	Name      string
+	Node      string
+	Selector  task.Selector
+	// Since and Until bound the time a task was submitted.
+	Since time.Time
+	Until time.Time
+	// SortBy is one of submitted, started, finished, name or state.
+	SortBy     string
+	Descending bool
+	Limit      int
+	Cursor     string
+}
+
+// cursor marks the last task of a page, by its sort key and ID.
+type cursor struct {
+	Key string
+	ID  string
+}
+
+var taskSortKeys = map[string]func(t *task.Task) string{
+	"submitted": func(t *task.Task) string { return timeKey(t.SubmitTime) },
+	"started":   func(t *task.Task) string { return timeKey(t.StartTime) },
+	"finished":  func(t *task.Task) string { return timeKey(t.FinishTime) },
+	"name":      func(t *task.Task) string { return t.Name },
+	"state":     func(t *task.Task) string { return fmt.Sprintf("%02d", t.State) },
+}
+
+func timeKey(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
+
+// ParseTaskQuery reads a TaskQuery from the query parameters of a request:
+// state, namespace, name, node, selector, since, until (RFC 3339), sort (prefix with
+// "-" for descending order), limit and cursor.
+func ParseTaskQuery(v url.Values) (TaskQuery, error) {
+	q := TaskQuery{
+		Namespace: v.Get("namespace"),
+		Name:      v.Get("name"),
+		Node:      v.Get("node"),
+		SortBy:    "submitted",
+		Cursor:    v.Get("cursor"),
+	}
+
+	for _, s := range v["state"] {
+		for _, name := range strings.Split(s, ",") {
+			state, err := task.ParseState(name)
+			if err != nil {
+				return q, err
+			}
+			q.States = append(q.States, state)
+		}
+	}
+
+	selector, err := task.ParseSelector(v.Get("selector"))
+	if err != nil {
+		return q, fmt.Errorf("invalid selector: %v", err)
+	}
+	q.Selector = selector
+
+	if s := v.Get("since"); s != "" {
+		q.Since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return q, fmt.Errorf("invalid since time: %v", err)
+		}
+	}
+	if s := v.Get("until"); s != "" {
+		q.Until, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return q, fmt.Errorf("invalid until time: %v", err)
+		}
+	}
+
+	if s := v.Get("sort"); s != "" {
+		q.SortBy, q.Descending = strings.CutPrefix(s, "-")
+		if _, ok := taskSortKeys[q.SortBy]; !ok {
+			return q, fmt.Errorf("cannot sort tasks by %q", q.SortBy)
+		}
+	}
+
+	if s := v.Get("limit"); s != "" {
+		q.Limit, err = strconv.Atoi(s)
+		if err != nil || q.Limit < 1 || q.Limit > maxTaskQueryLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxTaskQueryLimit)
+		}
+	}
+
+	return q, nil
+}
+
+func (q TaskQuery) matches(t *task.Task, node string) bool {
+	if len(q.States) > 0 && !task.Contains(q.States, t.State) {
+		return false
+	}
+	if q.Namespace != "" && t.Namespace != q.Namespace {
+		return false
+	}
+	if q.Name != "" && t.Name != q.Name {
+		return false
+	}
+	if q.Node != "" && node != q.Node {
+		return false
+	}
+	if !q.Selector.Matches(t.Labels) {
+		return false
+	}
+	if !q.Since.IsZero() && t.SubmitTime.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !t.SubmitTime.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// QueryTasks returns one page of the tasks matching the query along with
+// the cursor of the next page, which is empty on the last page.
+func (m *Manager) QueryTasks(q TaskQuery) ([]*task.Task, string, error) {
+	sortKey, ok := taskSortKeys[q.SortBy]
+	if !ok {
+		return nil, "", fmt.Errorf("cannot sort tasks by %q", q.SortBy)
+	}
+
+	var after *cursor
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &c
+	}
+
+	var tasks []*task.Task
+	for _, t := range m.GetTasks() {
+		node, _ := m.taskWorker(t.ID)
+		if q.matches(t, node) {
+			tasks = append(tasks, t)
+		}
+	}
+
+	less := func(a, b cursor) bool {
+		if a.Key != b.Key {
+			return (a.Key < b.Key) != q.Descending
+		}
+		return a.ID < b.ID
+	}
+	keyOf := func(t *task.Task) cursor {
+		return cursor{Key: sortKey(t), ID: t.ID.String()}
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return less(keyOf(tasks[i]), keyOf(tasks[j]))
+	})
+
+	if after != nil {
+		start := sort.Search(len(tasks), func(i int) bool {
+			return less(*after, keyOf(tasks[i]))
+		})
+		tasks = tasks[start:]
+	}
+
+	next := ""
+	if q.Limit > 0 && len(tasks) > q.Limit {
+		tasks = tasks[:q.Limit]
+		next = encodeCursor(keyOf(tasks[len(tasks)-1]))
+	}
+
+	if tasks == nil {
+		tasks = []*task.Task{}
+	}
+	return tasks, next, nil
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor %q", s)
+	}
+	return c, nil
+}
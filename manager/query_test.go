@@ -0,0 +1,173 @@
+package manager
+
+import (
+	"cube/task"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseTaskQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr bool
+		check   func(q TaskQuery) bool
+	}{
+		{"", false, func(q TaskQuery) bool { return q.SortBy == "submitted" && !q.Descending && q.Limit == 0 }},
+		{"state=running,failed&state=pending", false, func(q TaskQuery) bool {
+			return len(q.States) == 3 && q.States[0] == task.Running && q.States[1] == task.Failed && q.States[2] == task.Pending
+		}},
+		{"sort=-name&limit=10", false, func(q TaskQuery) bool { return q.SortBy == "name" && q.Descending && q.Limit == 10 }},
+		{"selector=app=web,tier!=db", false, func(q TaskQuery) bool { return len(q.Selector) == 2 }},
+		{"since=2026-01-02T15:04:05Z", false, func(q TaskQuery) bool { return q.Since.Equal(time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)) }},
+		{"state=sleeping", true, nil},
+		{"sort=image", true, nil},
+		{"limit=0", true, nil},
+		{"limit=1001", true, nil},
+		{"limit=ten", true, nil},
+		{"until=yesterday", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			v, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := ParseTaskQuery(v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTaskQuery error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && !tt.check(q) {
+				t.Errorf("ParseTaskQuery(%q) = %+v", tt.query, q)
+			}
+		})
+	}
+}
+
+// addQueryTask stores a task submitted the given number of minutes after
+// the start of 2026.
+func addQueryTask(m *Manager, name, namespace string, state task.State, minute int, labels map[string]string) *task.Task {
+	tk := &task.Task{
+		ID:         uuid.New(),
+		Name:       name,
+		Namespace:  namespace,
+		Image:      "nginx",
+		State:      state,
+		Labels:     labels,
+		SubmitTime: time.Date(2026, 1, 1, 0, minute, 0, 0, time.UTC),
+	}
+	m.TaskDb.Put(tk.ID.String(), tk)
+	return tk
+}
+
+func names(tasks []*task.Task) []string {
+	var n []string
+	for _, t := range tasks {
+		n = append(n, t.Name)
+	}
+	return n
+}
+
+func TestQueryTasksFilters(t *testing.T) {
+	m := newTestManager(t)
+	_, n := addNode(t, m, "w1")
+	web := addQueryTask(m, "web", "default", task.Running, 1, map[string]string{"app": "web"})
+	m.assignTask(n, *web)
+	addQueryTask(m, "db", "default", task.Running, 2, map[string]string{"app": "db"})
+	addQueryTask(m, "batch", "default", task.Completed, 3, nil)
+	addQueryTask(m, "api", "team-a", task.Pending, 4, map[string]string{"app": "web"})
+
+	tests := []struct {
+		name  string
+		query TaskQuery
+		want  []string
+	}{
+		{"all", TaskQuery{}, []string{"web", "db", "batch", "api"}},
+		{"state", TaskQuery{States: []task.State{task.Running, task.Pending}}, []string{"web", "db", "api"}},
+		{"namespace", TaskQuery{Namespace: "team-a"}, []string{"api"}},
+		{"name", TaskQuery{Name: "db"}, []string{"db"}},
+		{"node", TaskQuery{Node: "w1"}, []string{"web"}},
+		{"selector", TaskQuery{Selector: task.Selector{{Key: "app", Operator: task.In, Values: []string{"web"}}}}, []string{"web", "api"}},
+		{"since", TaskQuery{Since: time.Date(2026, 1, 1, 0, 2, 0, 0, time.UTC)}, []string{"db", "batch", "api"}},
+		{"until", TaskQuery{Until: time.Date(2026, 1, 1, 0, 2, 0, 0, time.UTC)}, []string{"web"}},
+		{"descending", TaskQuery{Descending: true}, []string{"api", "batch", "db", "web"}},
+		{"by name", TaskQuery{SortBy: "name"}, []string{"api", "batch", "db", "web"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.query.SortBy == "" {
+				tt.query.SortBy = "submitted"
+			}
+			tasks, next, err := m.QueryTasks(tt.query)
+			if err != nil {
+				t.Fatalf("QueryTasks: %v", err)
+			}
+			if got := names(tasks); !slices.Equal(got, tt.want) {
+				t.Errorf("tasks = %v, want %v", got, tt.want)
+			}
+			if next != "" {
+				t.Errorf("next cursor = %q on the only page", next)
+			}
+		})
+	}
+}
+
+func TestQueryTasksPages(t *testing.T) {
+	m := newTestManager(t)
+	// Tasks sharing a name tie on the sort key and are ordered by ID.
+	want := map[string]int{"a": 3, "b": 4, "c": 2}
+	for name, count := range want {
+		for i := 0; i < count; i++ {
+			addQueryTask(m, name, "default", task.Running, i, nil)
+		}
+	}
+
+	for _, descending := range []bool{false, true} {
+		seen := make(map[uuid.UUID]bool)
+		var order []string
+		q := TaskQuery{SortBy: "name", Descending: descending, Limit: 2}
+		for pages := 0; ; pages++ {
+			if pages > 10 {
+				t.Fatal("paging did not end")
+			}
+			tasks, next, err := m.QueryTasks(q)
+			if err != nil {
+				t.Fatalf("QueryTasks: %v", err)
+			}
+			if len(tasks) > q.Limit {
+				t.Fatalf("page has %d tasks, limit is %d", len(tasks), q.Limit)
+			}
+			for _, tk := range tasks {
+				if seen[tk.ID] {
+					t.Errorf("task %s %s was returned twice", tk.Name, tk.ID)
+				}
+				seen[tk.ID] = true
+				order = append(order, tk.Name)
+			}
+			if next == "" {
+				break
+			}
+			q.Cursor = next
+		}
+
+		if len(seen) != 9 {
+			t.Errorf("descending %v: paged through %d tasks, want 9", descending, len(seen))
+		}
+		for i := 1; i < len(order); i++ {
+			if (order[i-1] > order[i]) != descending && order[i-1] != order[i] {
+				t.Errorf("descending %v: tasks out of order: %v", descending, order)
+				break
+			}
+		}
+	}
+}
+
+func TestQueryTasksRejectsBadCursor(t *testing.T) {
+	m := newTestManager(t)
+	if _, _, err := m.QueryTasks(TaskQuery{SortBy: "submitted", Cursor: "not-a-cursor"}); err == nil {
+		t.Error("QueryTasks accepted an invalid cursor")
+	}
+}
@@ -0,0 +1,109 @@
+package manager
+
+import (
+	"cube/namespace"
+	"cube/quota"
+	"fmt"
+	"time"
+)
+
+// SetQuota creates or replaces the quota of a namespace. Tasks that are
+// already running are not affected by a lower quota.
+func (m *Manager) SetQuota(q *quota.Quota) error {
+	if q.Namespace == "" {
+		q.Namespace = namespace.Default
+	}
+	err := q.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	err = m.checkNamespace(q.Namespace)
+	if err != nil {
+		return err
+	}
+	q.CreateTime = time.Now().UTC()
+	if old, err := m.QuotaDb.Get(q.Namespace); err == nil {
+		q.CreateTime = old.CreateTime
+	}
+	q.Status = quota.Status{Used: m.namespaceUsage(q.Namespace)}
+	return m.QuotaDb.Put(q.Namespace, q)
+}
+
+// GetQuota returns the quota of a namespace with its current usage.
+func (m *Manager) GetQuota(ns string) (*quota.Quota, error) {
+	q, err := m.QuotaDb.Get(ns)
+	if err != nil {
+		return nil, fmt.Errorf("%w: quota of namespace %s", ErrNotFound, ns)
+	}
+	withUsage := *q
+	withUsage.Status.Used = m.namespaceUsage(ns)
+	return &withUsage, nil
+}
+
+func (m *Manager) DeleteQuota(ns string) error {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	if _, err := m.GetQuota(ns); err != nil {
+		return err
+	}
+	return m.QuotaDb.Delete(ns)
+}
+
+// SetLimitRange creates or replaces the limit range of a namespace.
+func (m *Manager) SetLimitRange(l *quota.LimitRange) error {
+	if l.Namespace == "" {
+		l.Namespace = namespace.Default
+	}
+	err := l.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	err = m.checkNamespace(l.Namespace)
+	if err != nil {
+		return err
+	}
+	l.CreateTime = time.Now().UTC()
+	if old, err := m.LimitRangeDb.Get(l.Namespace); err == nil {
+		l.CreateTime = old.CreateTime
+	}
+	return m.LimitRangeDb.Put(l.Namespace, l)
+}
+
+func (m *Manager) GetLimitRange(ns string) (*quota.LimitRange, error) {
+	l, err := m.LimitRangeDb.Get(ns)
+	if err != nil {
+		return nil, fmt.Errorf("%w: limit range of namespace %s", ErrNotFound, ns)
+	}
+	return l, nil
+}
+
+func (m *Manager) DeleteLimitRange(ns string) error {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	if _, err := m.GetLimitRange(ns); err != nil {
+		return err
+	}
+	return m.LimitRangeDb.Delete(ns)
+}
+
+// namespaceUsage adds up the resources requested by the tasks of a
+// namespace that have not finished.
+func (m *Manager) namespaceUsage(ns string) quota.Resources {
+	var used quota.Resources
+	for _, t := range m.namespaceTasks(ns) {
+		if !isFinished(t.State) {
+			used = used.Add(quota.Usage(t))
+		}
+	}
+	return used
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"cube/quota"
+	"net/http"
+)
+
+func (a *Api) SetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	q := quota.Quota{}
+	if !decodeBody(w, r, &q) || !inNamespace(w, r, &q.Namespace) {
+		return
+	}
+
+	err := a.Manager.SetQuota(&q)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, q)
+}
+
+func (a *Api) GetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := a.Manager.GetQuota(namespaceOf(r))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, q)
+}
+
+func (a *Api) DeleteQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.Manager.DeleteQuota(namespaceOf(r))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Api) SetLimitRangeHandler(w http.ResponseWriter, r *http.Request) {
+	l := quota.LimitRange{}
+	if !decodeBody(w, r, &l) || !inNamespace(w, r, &l.Namespace) {
+		return
+	}
+
+	err := a.Manager.SetLimitRange(&l)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, l)
+}
+
+func (a *Api) GetLimitRangeHandler(w http.ResponseWriter, r *http.Request) {
+	l, err := a.Manager.GetLimitRange(namespaceOf(r))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, l)
+}
+
+func (a *Api) DeleteLimitRangeHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.Manager.DeleteLimitRange(namespaceOf(r))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
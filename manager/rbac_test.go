@@ -0,0 +1,127 @@
+package manager
+
+import (
+	"context"
+	"cube/auth"
+	"cube/namespace"
+	"cube/task"
+	"cube/worker"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newAuthServer serves the API of a manager with auth enabled and returns
+// a token of alice, a viewer of namespace team-a.
+func newAuthServer(t *testing.T) (*Manager, *httptest.Server, string) {
+	t.Helper()
+	m := newTestManager(t)
+	m.AuthEnabled = true
+	m.AdminToken = "admin-token"
+	for _, ns := range []string{"team-a", "team-b"} {
+		if err := m.CreateNamespace(&namespace.Namespace{Name: ns}); err != nil {
+			t.Fatalf("CreateNamespace %s: %v", ns, err)
+		}
+	}
+	err := m.CreateRoleBinding(&auth.RoleBinding{Name: "team-a-viewers", Namespace: "team-a",
+		Role: auth.Viewer, Users: []string{"alice"}})
+	if err != nil {
+		t.Fatalf("CreateRoleBinding: %v", err)
+	}
+	tr, err := m.CreateToken("alice", nil)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	srv := httptest.NewServer((&Api{Manager: m}).Handler())
+	t.Cleanup(srv.Close)
+	return m, srv, tr.Token
+}
+
+func request(t *testing.T, ctx context.Context, method, url, token string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	// Watches are read until ctx ends them.
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestNamespaceBindingLimitsRequests(t *testing.T) {
+	_, srv, token := newAuthServer(t)
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{http.MethodGet, "/namespaces/team-a/tasks", "", http.StatusUnauthorized},
+		{http.MethodGet, "/namespaces/team-a/tasks", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/namespaces/team-a/tasks", token, http.StatusOK},
+		{http.MethodGet, "/namespaces/team-a/deployments", token, http.StatusOK},
+		{http.MethodGet, "/namespaces/team-a/secrets", token, http.StatusForbidden},
+		{http.MethodGet, "/namespaces/team-b/tasks", token, http.StatusForbidden},
+		{http.MethodGet, "/task", token, http.StatusForbidden},
+		{http.MethodDelete, "/namespaces/team-a", token, http.StatusForbidden},
+		{http.MethodGet, "/task", "admin-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, body := request(t, context.Background(), tt.method, srv.URL+tt.path, tt.token)
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s: got %d (%s), want %d", tt.method, tt.path, resp.StatusCode, body, tt.want)
+		}
+	}
+}
+
+func TestWatchShowsOnlyBoundNamespaces(t *testing.T) {
+	m, srv, token := newAuthServer(t)
+	if _, err := m.RegisterNode(worker.Registration{Name: "w1", Address: "10.0.0.5:5556"}); err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+	ids := map[string]uuid.UUID{}
+	for _, ns := range []string{"team-a", "team-b"} {
+		te := task.TaskEvent{State: task.Scheduled,
+			Task: task.Task{ID: uuid.New(), Name: "web", Namespace: ns, Image: "nginx"}}
+		if err := m.SubmitTask(&te); err != nil {
+			t.Fatalf("SubmitTask: %v", err)
+		}
+		ids[ns] = te.Task.ID
+	}
+
+	for _, path := range []string{"/watch?resume=0", "/namespaces/team-a/watch?resume=0"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		resp, body := request(t, ctx, http.MethodGet, srv.URL+path, token)
+		cancel()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: got %d (%s)", path, resp.StatusCode, body)
+		}
+		if !strings.Contains(body, ids["team-a"].String()) {
+			t.Errorf("GET %s: task of team-a is missing from %s", path, body)
+		}
+		if strings.Contains(body, ids["team-b"].String()) || strings.Contains(body, "event: node") {
+			t.Errorf("GET %s: got changes alice may not list: %s", path, body)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, body := request(t, ctx, http.MethodGet, srv.URL+"/namespaces/team-b/watch?resume=0", "admin-token")
+	if strings.Contains(body, ids["team-a"].String()) || !strings.Contains(body, ids["team-b"].String()) {
+		t.Errorf("watch of team-b: got %s", body)
+	}
+}
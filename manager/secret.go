@@ -0,0 +1,128 @@
+package manager
+
+import (
+	"cube/namespace"
+	"cube/secret"
+	"cube/task"
+	"fmt"
+	"sort"
+	"time"
+)
+
+func (m *Manager) CreateSecret(s *secret.Secret) error {
+	if s.Namespace == "" {
+		s.Namespace = namespace.Default
+	}
+	err := s.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	err = m.checkNamespace(s.Namespace)
+	if err != nil {
+		return err
+	}
+	key := namespace.Key(s.Namespace, s.Name)
+	if _, err := m.SecretDb.Get(key); err == nil {
+		return fmt.Errorf("%w: secret %s", ErrAlreadyExists, key)
+	}
+	s.CreateTime = time.Now().UTC()
+	return m.SecretDb.Put(key, s)
+}
+
+// UpdateSecret replaces the data of a secret.
+func (m *Manager) UpdateSecret(ns, name string, spec *secret.Secret) (*secret.Secret, error) {
+	if spec.Name == "" {
+		spec.Name = name
+	}
+	if spec.Namespace == "" {
+		spec.Namespace = ns
+	}
+	if spec.Name != name || spec.Namespace != ns {
+		return nil, fmt.Errorf("secret %s cannot be renamed to %s", namespace.Key(ns, name),
+			namespace.Key(spec.Namespace, spec.Name))
+	}
+	err := spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	s, err := m.GetSecret(ns, name)
+	if err != nil {
+		return nil, err
+	}
+	updated := *s
+	updated.Data = spec.Data
+	err = m.SecretDb.Put(namespace.Key(ns, name), &updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (m *Manager) GetSecret(ns, name string) (*secret.Secret, error) {
+	key := namespace.Key(ns, name)
+	s, err := m.SecretDb.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: secret %s", ErrNotFound, key)
+	}
+	return s, nil
+}
+
+// GetSecrets lists the secrets of a namespace, or of all namespaces if ns
+// is empty.
+func (m *Manager) GetSecrets(ns string) []*secret.Secret {
+	all, _ := m.SecretDb.List()
+	secrets := []*secret.Secret{}
+	for _, s := range all {
+		if ns == "" || s.Namespace == ns {
+			secrets = append(secrets, s)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return namespace.Key(secrets[i].Namespace, secrets[i].Name) <
+			namespace.Key(secrets[j].Namespace, secrets[j].Name)
+	})
+	return secrets
+}
+
+func (m *Manager) DeleteSecret(ns, name string) error {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	return m.deleteSecret(ns, name)
+}
+
+func (m *Manager) deleteSecret(ns, name string) error {
+	if _, err := m.GetSecret(ns, name); err != nil {
+		return err
+	}
+	return m.SecretDb.Delete(namespace.Key(ns, name))
+}
+
+// secretEnv returns the data of the secrets a task names as KEY=value
+// environment variables, ordered by secret and key.
+func (m *Manager) secretEnv(t *task.Task) ([]string, error) {
+	var env []string
+	for _, name := range t.Secrets {
+		s, err := m.GetSecret(t.Namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(s.Data))
+		for k := range s.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			env = append(env, k+"="+s.Data[k])
+		}
+	}
+	return env, nil
+}
@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"cube/secret"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (a *Api) CreateSecretHandler(w http.ResponseWriter, r *http.Request) {
+	s := secret.Secret{}
+	if !decodeBody(w, r, &s) || !inNamespace(w, r, &s.Namespace) {
+		return
+	}
+
+	err := a.Manager.CreateSecret(&s)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+
+	log.Printf("Created secret %s\n", s.Name)
+	sendJSON(w, http.StatusCreated, s)
+}
+
+func (a *Api) GetSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, a.Manager.GetSecrets(listNamespace(r)))
+}
+
+func (a *Api) GetSecretHandler(w http.ResponseWriter, r *http.Request) {
+	s, err := a.Manager.GetSecret(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, s)
+}
+
+func (a *Api) UpdateSecretHandler(w http.ResponseWriter, r *http.Request) {
+	spec := secret.Secret{}
+	if !decodeBody(w, r, &spec) {
+		return
+	}
+
+	s, err := a.Manager.UpdateSecret(namespaceOf(r), chi.URLParam(r, "name"), &spec)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, s)
+}
+
+func (a *Api) DeleteSecretHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.Manager.DeleteSecret(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
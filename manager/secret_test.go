@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"cube/secret"
+	"cube/task"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPlaceTaskSendsSecretsToWorkerOnly(t *testing.T) {
+	m := newTestManager(t)
+	f, _ := addNode(t, m, "w1")
+	err := m.CreateSecret(&secret.Secret{Name: "db", Data: map[string]string{"USER": "app", "PASSWORD": "s3cret"}})
+	if err != nil {
+		t.Fatalf("CreateSecret: %v", err)
+	}
+
+	tk := task.Task{ID: uuid.New(), Name: "web", Image: "nginx", Secrets: []string{"db"}}
+	if err := m.SubmitTask(&task.TaskEvent{State: task.Scheduled, Task: tk}); err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+	m.SendWork()
+
+	started := f.startedTasks()
+	if len(started) != 1 {
+		t.Fatalf("worker started %d tasks, want 1", len(started))
+	}
+	want := []string{"PASSWORD=s3cret", "USER=app"}
+	if !slices.Equal(started[0].SecretEnv, want) {
+		t.Errorf("worker got env %v, want %v", started[0].SecretEnv, want)
+	}
+	stored, _ := m.TaskDb.Get(tk.ID.String())
+	if stored.SecretEnv != nil {
+		t.Errorf("stored task has secret values %v", stored.SecretEnv)
+	}
+}
+
+func TestTaskWaitsForMissingSecret(t *testing.T) {
+	m := newTestManager(t)
+	f, _ := addNode(t, m, "w1")
+
+	tk := task.Task{ID: uuid.New(), Name: "web", Image: "nginx", Secrets: []string{"db"}}
+	if err := m.SubmitTask(&task.TaskEvent{State: task.Scheduled, Task: tk}); err != nil {
+		t.Fatalf("SubmitTask: %v", err)
+	}
+	m.SendWork()
+
+	if len(f.starts()) != 0 {
+		t.Error("task was started without its secret")
+	}
+	got, _ := m.TaskDb.Get(tk.ID.String())
+	if got.State != task.Pending || m.Pending.Length() != 1 {
+		t.Errorf("task is %v with %d pending events, want it pending and queued", got.State, m.Pending.Length())
+	}
+	if _, ok := m.taskWorker(tk.ID); ok {
+		t.Error("task is still assigned to a node")
+	}
+}
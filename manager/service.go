@@ -0,0 +1,258 @@
+package manager
+
+import (
+	"cube/namespace"
+	"cube/proxy"
+	"cube/service"
+	"cube/task"
+	"fmt"
+	"log"
+	"net"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+)
+
+func (m *Manager) CreateService(s *service.Service) error {
+	if s.Namespace == "" {
+		s.Namespace = namespace.Default
+	}
+	s.SetDefaults()
+	err := s.Validate()
+	if err != nil {
+		return err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	err = m.checkNamespace(s.Namespace)
+	if err != nil {
+		return err
+	}
+	key := namespace.Key(s.Namespace, s.Name)
+	services, _ := m.ServiceDb.List()
+	for _, other := range services {
+		if other.Namespace == s.Namespace && other.Name == s.Name {
+			return fmt.Errorf("%w: service %s", ErrAlreadyExists, key)
+		}
+		// Ports are shared by all namespaces.
+		if other.Port == s.Port {
+			return fmt.Errorf("port %d is already used by service %s", s.Port,
+				namespace.Key(other.Namespace, other.Name))
+		}
+	}
+	s.CreateTime = time.Now().UTC()
+	s.Status = service.Status{Endpoints: m.serviceEndpoints(s)}
+	return m.ServiceDb.Put(key, s)
+}
+
+// UpdateService replaces the selector, ports, protocol and mode of a
+// service.
+func (m *Manager) UpdateService(ns, name string, spec *service.Service) (*service.Service, error) {
+	if spec.Name == "" {
+		spec.Name = name
+	}
+	if spec.Namespace == "" {
+		spec.Namespace = ns
+	}
+	if spec.Name != name || spec.Namespace != ns {
+		return nil, fmt.Errorf("service %s cannot be renamed to %s", namespace.Key(ns, name),
+			namespace.Key(spec.Namespace, spec.Name))
+	}
+	spec.SetDefaults()
+	err := spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	s, err := m.GetService(ns, name)
+	if err != nil {
+		return nil, err
+	}
+	services, _ := m.ServiceDb.List()
+	for _, other := range services {
+		if other.Port == spec.Port && (other.Namespace != ns || other.Name != name) {
+			return nil, fmt.Errorf("port %d is already used by service %s", spec.Port,
+				namespace.Key(other.Namespace, other.Name))
+		}
+	}
+	updated := *spec
+	updated.CreateTime = s.CreateTime
+	updated.Status = service.Status{Endpoints: m.serviceEndpoints(&updated)}
+	err = m.ServiceDb.Put(namespace.Key(ns, name), &updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (m *Manager) GetService(ns, name string) (*service.Service, error) {
+	key := namespace.Key(ns, name)
+	s, err := m.ServiceDb.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: service %s", ErrNotFound, key)
+	}
+	return s, nil
+}
+
+// GetServices lists the services of a namespace, or of all namespaces if
+// ns is empty.
+func (m *Manager) GetServices(ns string) []*service.Service {
+	all, _ := m.ServiceDb.List()
+	services := []*service.Service{}
+	for _, s := range all {
+		if ns == "" || s.Namespace == ns {
+			services = append(services, s)
+		}
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return namespace.Key(services[i].Namespace, services[i].Name) <
+			namespace.Key(services[j].Namespace, services[j].Name)
+	})
+	return services
+}
+
+func (m *Manager) DeleteService(ns, name string) error {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	return m.deleteService(ns, name)
+}
+
+func (m *Manager) deleteService(ns, name string) error {
+	key := namespace.Key(ns, name)
+	if _, err := m.GetService(ns, name); err != nil {
+		return err
+	}
+	err := m.ServiceDb.Delete(key)
+	if err != nil {
+		return err
+	}
+	m.stopProxy(key)
+	log.Printf("Deleted service %s\n", key)
+	return nil
+}
+
+// SyncServices keeps the endpoints of every service up to date and runs a
+// proxy in the manager for the services served from it. It syncs whenever
+// something changes, and at least every 10 seconds.
+func (m *Manager) SyncServices() {
+	for {
+		_, changed, _ := m.Feed.Since(m.Feed.Revision())
+		m.syncServices()
+		select {
+		case <-changed:
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+func (m *Manager) syncServices() {
+	m.controllerMu.Lock()
+	defer m.controllerMu.Unlock()
+
+	services, _ := m.ServiceDb.List()
+	served := make(map[string]bool)
+	for _, s := range services {
+		key := namespace.Key(s.Namespace, s.Name)
+		endpoints := m.serviceEndpoints(s)
+		if !reflect.DeepEqual(endpoints, s.Status.Endpoints) {
+			log.Printf("Service %s now has %d endpoints\n", key, len(endpoints))
+			updated := *s
+			updated.Status.Endpoints = endpoints
+			m.ServiceDb.Put(key, &updated)
+			s = &updated
+		}
+
+		if s.Mode != service.OnManager {
+			continue
+		}
+		p, ok := m.proxies[key]
+		if ok && (p.Port != s.Port || p.Protocol != s.Protocol) {
+			m.stopProxy(key)
+			ok = false
+		}
+		if !ok {
+			p = proxy.New(key, s.Protocol, s.Port)
+			err := p.Start()
+			if err != nil {
+				log.Printf("Error starting proxy for service %s: %v\n", key, err)
+				continue
+			}
+			m.proxies[key] = p
+		}
+		p.SetEndpoints(s.Addresses())
+		served[key] = true
+	}
+
+	for name := range m.proxies {
+		if !served[name] {
+			m.stopProxy(name)
+		}
+	}
+}
+
+func (m *Manager) stopProxy(name string) {
+	p, ok := m.proxies[name]
+	if !ok {
+		return
+	}
+	err := p.Stop()
+	if err != nil {
+		log.Printf("Error stopping proxy for service %s: %v\n", name, err)
+	}
+	delete(m.proxies, name)
+}
+
+func (m *Manager) serviceEndpoints(s *service.Service) []service.Endpoint {
+	return m.taskEndpoints(s.Namespace, s.Matches, s.TargetPort)
+}
+
+// taskEndpoints returns the addresses of the available tasks of a namespace
+// whose labels match, sorted by task ID.
+func (m *Manager) taskEndpoints(ns string, matches func(map[string]string) bool, targetPort string) []service.Endpoint {
+	endpoints := []service.Endpoint{}
+	for _, t := range m.GetTasks() {
+		if t.Namespace != ns || !matches(t.Labels) || !isAvailable(t) || m.isStopping(t.ID) {
+			continue
+		}
+		n, ok := m.taskNode(t.ID)
+		if !ok {
+			continue
+		}
+		port := publishedPort(t, targetPort)
+		if port == "" {
+			continue
+		}
+		endpoints = append(endpoints, service.Endpoint{
+			Task:    t.ID.String(),
+			Address: net.JoinHostPort(n.Host(), port),
+		})
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Task < endpoints[j].Task
+	})
+	return endpoints
+}
+
+// publishedPort returns the host port the target port of a task is
+// published on, or the first published port if target is empty.
+func publishedPort(t *task.Task, target string) string {
+	if target != "" {
+		for _, b := range t.HostPorts[nat.Port(target)] {
+			return b.HostPort
+		}
+		return ""
+	}
+	hostPort := getHostPort(t.HostPorts)
+	if hostPort == nil {
+		return ""
+	}
+	return *hostPort
+}
@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"cube/service"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (a *Api) CreateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	s := service.Service{}
+	if !decodeBody(w, r, &s) || !inNamespace(w, r, &s.Namespace) {
+		return
+	}
+
+	err := a.Manager.CreateService(&s)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+
+	log.Printf("Created service %s\n", s.Name)
+	sendJSON(w, http.StatusCreated, s)
+}
+
+func (a *Api) GetServicesHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, a.Manager.GetServices(listNamespace(r)))
+}
+
+func (a *Api) GetServiceHandler(w http.ResponseWriter, r *http.Request) {
+	s, err := a.Manager.GetService(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, s)
+}
+
+func (a *Api) UpdateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	spec := service.Service{}
+	if !decodeBody(w, r, &spec) {
+		return
+	}
+
+	s, err := a.Manager.UpdateService(namespaceOf(r), chi.URLParam(r, "name"), &spec)
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	sendJSON(w, http.StatusOK, s)
+}
+
+func (a *Api) DeleteServiceHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.Manager.DeleteService(namespaceOf(r), chi.URLParam(r, "name"))
+	if err != nil {
+		sendObjectError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
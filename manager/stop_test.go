@@ -0,0 +1,186 @@
+package manager
+
+import (
+	"cube/task"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestStopScheduledTaskReachesWorker(t *testing.T) {
+	m := newTestManager(t)
+	f, n := addNode(t, m, "w1")
+	tk := &task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx", State: task.Scheduled}
+	m.TaskDb.Put(tk.ID.String(), tk)
+	m.assignTask(n, *tk)
+
+	m.StopTask(tk, "scaled down")
+	m.SendWork()
+
+	if stops := f.stops(); len(stops) != 1 || stops[0] != tk.ID {
+		t.Fatalf("worker stops = %v, want [%s]", stops, tk.ID)
+	}
+	if !m.isStopping(tk.ID) {
+		t.Error("task is no longer stopping before the worker reported it stopped")
+	}
+}
+
+func TestRefusedStopIsForgotten(t *testing.T) {
+	m := newTestManager(t)
+	f, n := addNode(t, m, "w1")
+	tk := &task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx", State: task.Failed}
+	m.TaskDb.Put(tk.ID.String(), tk)
+	m.assignTask(n, *tk)
+
+	m.StopTask(tk, "scaled down")
+	m.SendWork()
+
+	if stops := f.stops(); len(stops) != 0 {
+		t.Errorf("worker was asked to stop a finished task: %v", stops)
+	}
+	if m.isStopping(tk.ID) {
+		t.Error("task is still stopping after its stop was refused")
+	}
+}
+
+func TestStopOnUnreachableWorkerIsRetried(t *testing.T) {
+	m := newTestManager(t)
+	f, n := addNode(t, m, "w1")
+	f.server.Close()
+	tk := &task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx", State: task.Running}
+	m.TaskDb.Put(tk.ID.String(), tk)
+	m.assignTask(n, *tk)
+
+	m.StopTask(tk, "scaled down")
+	m.SendWork()
+
+	if m.Pending.Length() != 1 {
+		t.Errorf("pending queue has %d events, want the stop queued again", m.Pending.Length())
+	}
+	if !m.isStopping(tk.ID) {
+		t.Error("task is no longer stopping after the worker could not be reached")
+	}
+}
+
+func TestStopOnDeregisteredNodeCompletesTask(t *testing.T) {
+	m := newTestManager(t)
+	_, n := addNode(t, m, "w1")
+	tk := &task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx", State: task.Running}
+	m.TaskDb.Put(tk.ID.String(), tk)
+	m.assignTask(n, *tk)
+	m.mu.Lock()
+	m.WorkerNodes = nil
+	m.mu.Unlock()
+
+	m.StopTask(tk, "scaled down")
+	m.SendWork()
+
+	got, _ := m.TaskDb.Get(tk.ID.String())
+	if got.State != task.Completed || m.isStopping(tk.ID) {
+		t.Errorf("task is %v and stopping %v, want %v and not stopping", got.State, m.isStopping(tk.ID), task.Completed)
+	}
+}
+
+func TestStopOfTaskUnknownToWorkerCompletesIt(t *testing.T) {
+	tests := []struct {
+		state    task.State
+		finished bool
+	}{
+		{task.Running, true},
+		// A scheduled task may not have reached the worker's store yet.
+		{task.Scheduled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.state.String(), func(t *testing.T) {
+			m := newTestManager(t)
+			f, n := addNode(t, m, "w1")
+			f.answerStops(http.StatusNotFound)
+			tk := &task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx", State: tt.state}
+			m.TaskDb.Put(tk.ID.String(), tk)
+			m.assignTask(n, *tk)
+
+			m.StopTask(tk, "scaled down")
+			m.SendWork()
+
+			got, _ := m.TaskDb.Get(tk.ID.String())
+			_, assigned := m.taskWorker(tk.ID)
+			if finished := got.State == task.Completed && !assigned && !m.isStopping(tk.ID); finished != tt.finished {
+				t.Errorf("task is %v, assigned %v, stopping %v; want finished %v",
+					got.State, assigned, m.isStopping(tk.ID), tt.finished)
+			}
+		})
+	}
+}
+
+func TestFailedStopsBackOff(t *testing.T) {
+	m := newTestManager(t)
+	clock := &fakeClock{now: time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)}
+	m.Clock = clock
+	f, n := addNode(t, m, "w1")
+	f.answerStops(http.StatusInternalServerError)
+	tk := &task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx", State: task.Running}
+	m.TaskDb.Put(tk.ID.String(), tk)
+	m.assignTask(n, *tk)
+	m.StopTask(tk, "scaled down")
+
+	// The waits double from one pass up to maxStopBackoff.
+	var waits []time.Duration
+	for i := 0; i < 8; i++ {
+		m.SendWork()
+		attempts := len(f.stops())
+		m.SendWork()
+		if len(f.stops()) != attempts {
+			t.Fatalf("stop was tried again before its wait was over")
+		}
+		m.mu.Lock()
+		wait := m.stopRetries[tk.ID].next.Sub(clock.now)
+		m.mu.Unlock()
+		waits = append(waits, wait)
+		clock.now = clock.now.Add(wait)
+	}
+
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second,
+		160 * time.Second, maxStopBackoff, maxStopBackoff, maxStopBackoff}
+	for i := range want {
+		if waits[i] != want[i] {
+			t.Fatalf("waits between stops = %v, want %v", waits, want)
+		}
+	}
+	if m.Pending.Length() != 1 || !m.isStopping(tk.ID) {
+		t.Errorf("pending queue has %d events and stopping is %v, want the stop still queued", m.Pending.Length(), m.isStopping(tk.ID))
+	}
+
+	// Once the worker takes the stop, it is no longer queued.
+	f.answerStops(0)
+	attempts := len(f.stops())
+	m.SendWork()
+	if len(f.stops()) != attempts+1 || m.Pending.Length() != 0 {
+		t.Errorf("worker got %d more stops and %d events are pending, want 1 and 0",
+			len(f.stops())-attempts, m.Pending.Length())
+	}
+}
+
+func TestStopKeepsStateReportedSinceRead(t *testing.T) {
+	m := newTestManager(t)
+	_, n := addNode(t, m, "w1")
+	tk := &task.Task{ID: uuid.New(), Name: "web", Namespace: "default", Image: "nginx", State: task.Scheduled}
+	m.TaskDb.Put(tk.ID.String(), tk)
+	m.assignTask(n, *tk)
+	read := *tk
+
+	// The worker reports the task running after the caller read it.
+	m.updateTask(tk.ID, func(s *task.Task) error {
+		s.State = task.Running
+		s.ContainerId = "c1"
+		return nil
+	})
+	m.StopTask(&read, "scaled down")
+
+	got, _ := m.TaskDb.Get(tk.ID.String())
+	if got.State != task.Running || got.ContainerId != "c1" || got.Reason != "scaled down" {
+		t.Errorf("stored task is %v in container %q with reason %q, want %v in c1 with the stop reason",
+			got.State, got.ContainerId, got.Reason, task.Running)
+	}
+}
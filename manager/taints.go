@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"cube/store"
+	"cube/task"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// AddTaint adds a taint to a node, replacing any taint with the same key and
+// effect. Tasks that don't tolerate a NoExecute taint are evicted.
+func (m *Manager) AddTaint(name string, taint task.Taint) error {
+	m.mu.Lock()
+	n := m.findNode(name)
+	if n == nil {
+		m.mu.Unlock()
+		return ErrNodeNotFound
+	}
+
+	taints := []task.Taint{taint}
+	for _, t := range n.Taints {
+		if t.Key != taint.Key || t.Effect != taint.Effect {
+			taints = append(taints, t)
+		}
+	}
+	n.Taints = taints
+	m.publishNode(store.Modified, n)
+	m.mu.Unlock()
+
+	log.Printf("Added taint %s=%s:%s to node %s\n", taint.Key, taint.Value, taint.Effect, name)
+
+	// Evictions stop tasks on the node, which may take a while, so they
+	// run in the background.
+	if taint.Effect == task.NoExecute {
+		go m.evictIntolerantTasks(name)
+	}
+	return nil
+}
+
+// RemoveTaint removes every taint with the given key from a node.
+func (m *Manager) RemoveTaint(name, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.findNode(name)
+	if n == nil {
+		return ErrNodeNotFound
+	}
+
+	var taints []task.Taint
+	for _, t := range n.Taints {
+		if t.Key != key {
+			taints = append(taints, t)
+		}
+	}
+	n.Taints = taints
+	m.publishNode(store.Modified, n)
+
+	log.Printf("Removed taint %s from node %s\n", key, name)
+	return nil
+}
+
+// evictIntolerantTasks moves the active tasks on a node that don't tolerate
+// its NoExecute taints to other nodes.
+func (m *Manager) evictIntolerantTasks(name string) {
+	m.mu.Lock()
+	n := m.findNode(name)
+	if n == nil {
+		m.mu.Unlock()
+		return
+	}
+	var noExecute []task.Taint
+	for _, t := range n.Taints {
+		if t.Effect == task.NoExecute {
+			noExecute = append(noExecute, t)
+		}
+	}
+	ids := append([]uuid.UUID{}, m.WorkerTaskMap[name]...)
+	m.mu.Unlock()
+
+	for _, id := range ids {
+		t, err := m.TaskDb.Get(id.String())
+		if err != nil || isFinished(t.State) {
+			continue
+		}
+		for _, taint := range noExecute {
+			if !taint.ToleratedBy(t.Tolerations) {
+				log.Printf("Evicting task %s from node %s: taint %s:%s is not tolerated\n",
+					t.ID, name, taint.Key, taint.Effect)
+				m.evictTask(t, fmt.Sprintf("taint %s:%s is not tolerated", taint.Key, taint.Effect))
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package manager
+
+import (
+	"cube/auth"
+	"cube/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of changes kept on the feed for watchers to resume from.
+const changeFeedSize = 10000
+
+// WatchHandler streams task and node changes as Server-Sent Events. Each
+// event carries its revision as the event ID; clients resume after a
+// disconnect by sending it back in the Last-Event-ID header or the resume
+// query parameter. The kind parameter limits the stream to "task" or "node"
+// changes. Under /namespaces/{namespace}, only the changes to objects of
+// that namespace are streamed.
+func (a *Api) WatchHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	kinds := make(map[string]bool)
+	for _, k := range strings.Split(r.URL.Query().Get("kind"), ",") {
+		if k != "" {
+			kinds[k] = true
+		}
+	}
+
+	revision := a.Manager.Feed.Revision()
+	resume := r.Header.Get("Last-Event-ID")
+	if q := r.URL.Query().Get("resume"); q != "" {
+		resume = q
+	}
+	if resume != "" {
+		rev, err := strconv.ParseUint(resume, 10, 64)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid resume token %s", resume))
+			return
+		}
+		revision = rev
+	}
+
+	// Check the resume token before committing to a streaming response.
+	changes, notify, err := a.Manager.Feed.Since(revision)
+	if errors.Is(err, store.ErrCompacted) {
+		sendError(w, http.StatusGone, fmt.Sprintf("Changes after revision %d are no longer available", revision))
+		return
+	}
+	if err != nil {
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	// visible caches which kinds of changes the caller may see in which
+	// namespaces.
+	visible := make(map[string]bool)
+	only := listNamespace(r)
+
+	for {
+		for _, c := range changes {
+			revision = c.Revision
+			if len(kinds) > 0 && !kinds[c.Kind] {
+				continue
+			}
+			ns := changeNamespace(c)
+			if only != "" && ns != only {
+				continue
+			}
+			key := c.Kind + "/" + ns
+			if _, ok := visible[key]; !ok {
+				visible[key] = a.canWatch(r, c.Kind, ns)
+			}
+			if !visible[key] {
+				continue
+			}
+			data, err := json.Marshal(c)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", c.Revision, c.Kind, data)
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-notify:
+		}
+
+		changes, notify, err = a.Manager.Feed.Since(revision)
+		if err != nil {
+			// The client fell too far behind; it has to list again.
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+// canWatch reports whether the caller of a watch may list the objects of a
+// kind in namespace ns, or the objects of a kind outside namespaces when ns
+// is empty. Changes to the others are left out of its stream.
+func (a *Api) canWatch(r *http.Request, kind, ns string) bool {
+	if !a.Manager.AuthEnabled {
+		return true
+	}
+	id, _ := auth.IdentityFrom(r.Context())
+	return a.Manager.Authorize(id, auth.List, resourceOf(kind), ns) == nil
+}
+
+// changeNamespace returns the namespace of the object a change is to, or ""
+// for objects outside namespaces.
+func changeNamespace(c store.Change) string {
+	if !auth.Namespaced(resourceOf(c.Kind)) {
+		return ""
+	}
+	var obj struct{ Namespace string }
+	json.Unmarshal(c.Object, &obj)
+	return obj.Namespace
+}
@@ -0,0 +1,212 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"cube/store"
+	"cube/task"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type sseEvent struct {
+	ID    uint64
+	Event string
+	Key   string
+}
+
+// watch opens a watch on the path and sends the events it reads on the
+// returned channel until the test ends.
+func watch(t *testing.T, srv *httptest.Server, path string, header http.Header) <-chan sseEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		t.Fatalf("GET %s: got %d", path, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("GET %s: content type %q", path, ct)
+	}
+
+	events := make(chan sseEvent, 100)
+	go func() {
+		defer resp.Body.Close()
+		var ev sseEvent
+		s := bufio.NewScanner(resp.Body)
+		for s.Scan() {
+			line := s.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				ev.ID, _ = strconv.ParseUint(strings.TrimPrefix(line, "id: "), 10, 64)
+			case strings.HasPrefix(line, "event: "):
+				ev.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				var c store.Change
+				if json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &c) == nil {
+					ev.Key = c.Key
+				}
+			case line == "" && ev.Event != "":
+				events <- ev
+				ev = sseEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+// nextEvent returns the next event of a watch, or fails the test if none comes.
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event on the watch")
+		return sseEvent{}
+	}
+}
+
+// noEvent fails the test if the watch sends an event soon.
+func noEvent(t *testing.T, events <-chan sseEvent) {
+	t.Helper()
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func newWatchServer(t *testing.T) (*Manager, *httptest.Server) {
+	m := newTestManager(t)
+	srv := httptest.NewServer((&Api{Manager: m}).Handler())
+	t.Cleanup(srv.Close)
+	return m, srv
+}
+
+func publishTask(m *Manager, name, namespace string) string {
+	tk := &task.Task{ID: uuid.New(), Name: name, Namespace: namespace, Image: "nginx"}
+	m.TaskDb.Put(tk.ID.String(), tk)
+	return tk.ID.String()
+}
+
+func TestWatchStreamsChanges(t *testing.T) {
+	m, srv := newWatchServer(t)
+	publishTask(m, "before", "default")
+
+	events := watch(t, srv, "/watch", nil)
+	// Without a resume token the watch starts at the current revision.
+	noEvent(t, events)
+
+	id := publishTask(m, "web", "default")
+	ev := nextEvent(t, events)
+	if ev.Event != "task" || ev.Key != id || ev.ID != m.Feed.Revision() {
+		t.Errorf("got event %+v, want task %s at revision %d", ev, id, m.Feed.Revision())
+	}
+}
+
+func TestWatchResumes(t *testing.T) {
+	m, srv := newWatchServer(t)
+	publishTask(m, "a", "default")
+	from := m.Feed.Revision()
+	b := publishTask(m, "b", "default")
+	c := publishTask(m, "c", "default")
+
+	for _, resume := range []struct {
+		path   string
+		header http.Header
+	}{
+		{fmt.Sprintf("/watch?resume=%d", from), nil},
+		{"/watch", http.Header{"Last-Event-ID": {strconv.FormatUint(from, 10)}}},
+	} {
+		events := watch(t, srv, resume.path, resume.header)
+		if ev := nextEvent(t, events); ev.Key != b || ev.ID != from+1 {
+			t.Errorf("%s: first event %+v, want task %s at revision %d", resume.path, ev, b, from+1)
+		}
+		if ev := nextEvent(t, events); ev.Key != c || ev.ID != from+2 {
+			t.Errorf("%s: second event %+v, want task %s at revision %d", resume.path, ev, c, from+2)
+		}
+		noEvent(t, events)
+	}
+}
+
+func TestWatchRefusesBadResume(t *testing.T) {
+	m, srv := newWatchServer(t)
+	m.Feed = store.NewFeed(2)
+	for i := 0; i < 5; i++ {
+		m.Feed.Publish("task", store.Added, uuid.NewString(), nil)
+	}
+
+	tests := []struct {
+		resume string
+		want   int
+	}{
+		{"abc", http.StatusBadRequest},
+		{"99", http.StatusBadRequest},
+		{"1", http.StatusGone},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(srv.URL + "/watch?resume=" + tt.resume)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("resume %s: got %d, want %d", tt.resume, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestWatchFilters(t *testing.T) {
+	m, srv := newWatchServer(t)
+	from := m.Feed.Revision()
+	def := publishTask(m, "web", "default")
+	other := publishTask(m, "web", "team-a")
+	addNode(t, m, "w1")
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/watch?kind=task", []string{"task " + def, "task " + other}},
+		{"/watch?kind=node", []string{"node w1"}},
+		{"/watch?kind=task,node", []string{"task " + def, "task " + other, "node w1"}},
+		{"/namespaces/team-a/watch", []string{"task " + other}},
+		{"/namespaces/team-a/watch?kind=node", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			sep := "?"
+			if strings.Contains(tt.path, "?") {
+				sep = "&"
+			}
+			events := watch(t, srv, fmt.Sprintf("%s%sresume=%d", tt.path, sep, from), nil)
+			for _, want := range tt.want {
+				ev := nextEvent(t, events)
+				if got := ev.Event + " " + ev.Key; got != want {
+					t.Errorf("got %s, want %s", got, want)
+				}
+			}
+			noEvent(t, events)
+		})
+	}
+}
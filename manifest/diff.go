@@ -0,0 +1,115 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Diff lists the fields that differ between two objects of the same type,
+// one "Path: old -> new" line per field, using their JSON form. The values
+// of the fields under a sensitive path, such as the Data of a secret, are
+// shown as <redacted>.
+func Diff(old, new any, sensitive ...string) ([]string, error) {
+	a, err := flatten(old)
+	if err != nil {
+		return nil, err
+	}
+	b, err := flatten(new)
+	if err != nil {
+		return nil, err
+	}
+
+	show := func(path, v string) string {
+		if v != "" && isSensitive(path, sensitive) {
+			return "<redacted>"
+		}
+		return orNone(v)
+	}
+	var diff []string
+	for path, v := range b {
+		if a[path] != v {
+			diff = append(diff, fmt.Sprintf("%s: %s -> %s", path, show(path, a[path]), show(path, v)))
+		}
+	}
+	for path, v := range a {
+		if _, ok := b[path]; !ok {
+			diff = append(diff, fmt.Sprintf("%s: %s -> <none>", path, show(path, v)))
+		}
+	}
+	sort.Strings(diff)
+	return diff, nil
+}
+
+// isSensitive reports whether a path is one of the sensitive ones or lies
+// under one of them.
+func isSensitive(path string, sensitive []string) bool {
+	for _, s := range sensitive {
+		if path == s || strings.HasPrefix(path, s+".") || strings.HasPrefix(path, s+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+func orNone(v string) string {
+	if v == "" {
+		return "<none>"
+	}
+	return v
+}
+
+// flatten maps the path of every leaf value of an object to its JSON
+// encoding. Zero values are left out so that unset and empty fields
+// compare equal.
+func flatten(v any) (map[string]string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var tree any
+	err = json.Unmarshal(data, &tree)
+	if err != nil {
+		return nil, err
+	}
+	leaves := make(map[string]string)
+	walk("", tree, leaves)
+	return leaves, nil
+}
+
+func walk(path string, v any, leaves map[string]string) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			walk(join(k), child, leaves)
+		}
+	case []any:
+		for i, child := range v {
+			walk(fmt.Sprintf("%s[%d]", path, i), child, leaves)
+		}
+	default:
+		if isZero(v) {
+			return
+		}
+		data, _ := json.Marshal(v)
+		leaves[path] = string(data)
+	}
+}
+
+func isZero(v any) bool {
+	switch v {
+	case nil, false, "", float64(0), zeroTime:
+		return true
+	}
+	return false
+}
+
+// zeroTime is how an unset time.Time is encoded.
+const zeroTime = "0001-01-01T00:00:00Z"
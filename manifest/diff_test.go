@@ -0,0 +1,45 @@
+package manifest
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+type object struct {
+	Name string
+	Data map[string]string
+}
+
+func TestDiff(t *testing.T) {
+	old := object{Name: "a", Data: map[string]string{"k": "1"}}
+	new := object{Name: "b", Data: map[string]string{"k": "1", "j": "2"}}
+
+	diff, err := Diff(old, new)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	want := []string{`Data.j: <none> -> "2"`, `Name: "a" -> "b"`}
+	if !slices.Equal(diff, want) {
+		t.Errorf("got %q, want %q", diff, want)
+	}
+}
+
+func TestDiffRedactsSensitiveFields(t *testing.T) {
+	old := object{Name: "db", Data: map[string]string{"PASSWORD": "old-secret"}}
+	new := object{Name: "db", Data: map[string]string{"PASSWORD": "new-secret", "USER": "app"}}
+
+	diff, err := Diff(old, new, "Data")
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	want := []string{"Data.PASSWORD: <redacted> -> <redacted>", "Data.USER: <none> -> <redacted>"}
+	if !slices.Equal(diff, want) {
+		t.Errorf("got %q, want %q", diff, want)
+	}
+	for _, line := range diff {
+		if strings.Contains(line, "secret") {
+			t.Errorf("diff shows a secret value: %s", line)
+		}
+	}
+}
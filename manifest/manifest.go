@@ -0,0 +1,81 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest describes one object by name. Spec holds the fields of the
+// object, with the same names as in the API, and is decoded once the kind
+// is known.
+type Manifest struct {
+	Kind     string          `json:"kind"`
+	Metadata Metadata        `json:"metadata"`
+	Spec     json.RawMessage `json:"spec"`
+}
+
+type Metadata struct {
+	Name string `json:"name"`
+	// Namespace defaults to the default namespace for namespaced kinds.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Parse reads the manifests in a YAML or JSON document. YAML input can hold
+// several manifests separated by "---", and JSON input can be a single
+// manifest or an array of them.
+func Parse(data []byte) ([]Manifest, error) {
+	var manifests []Manifest
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	for i := 1; ; i++ {
+		var doc any
+		err := d.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", i, err)
+		}
+		if doc == nil {
+			continue
+		}
+
+		// Go through JSON so that specs decode into the API types.
+		js, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", i, err)
+		}
+		if _, ok := doc.([]any); ok {
+			var list []Manifest
+			err = strictDecode(js, &list)
+			manifests = append(manifests, list...)
+		} else {
+			var m Manifest
+			err = strictDecode(js, &m)
+			manifests = append(manifests, m)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", i, err)
+		}
+	}
+
+	for _, m := range manifests {
+		if m.Kind == "" {
+			return nil, errors.New("manifest has no kind")
+		}
+		if m.Metadata.Name == "" {
+			return nil, fmt.Errorf("%s manifest has no name", m.Kind)
+		}
+	}
+	return manifests, nil
+}
+
+func strictDecode(data []byte, v any) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
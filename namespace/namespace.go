@@ -0,0 +1,48 @@
+package namespace
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Default is the namespace of objects created without one.
+const Default = "default"
+
+// Namespace phases.
+const (
+	Active = "Active"
+	// Terminating namespaces are being cleaned up and accept no new objects.
+	Terminating = "Terminating"
+)
+
+var nameRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// Namespace groups tasks and the objects that manage them. Names of objects
+// only have to be unique within their namespace.
+type Namespace struct {
+	Name       string
+	CreateTime time.Time
+	Status     Status
+}
+
+type Status struct {
+	Phase string
+}
+
+func (n *Namespace) Validate() error {
+	return ValidateName(n.Name)
+}
+
+// ValidateName checks that a namespace name can be used as a DNS label.
+func ValidateName(name string) error {
+	if !nameRe.MatchString(name) {
+		return fmt.Errorf("invalid namespace name %q: it must be a lowercase DNS label", name)
+	}
+	return nil
+}
+
+// Key returns the key an object with the given name is stored under.
+func Key(namespace, name string) string {
+	return namespace + "/" + name
+}
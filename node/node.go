@@ -1,6 +1,7 @@
 package node
 
 import (
+	"cube/task"
 	"cube/utils"
 	"cube/worker"
 	"encoding/json"
@@ -9,6 +10,15 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	Ready    = "Ready"
+	NotReady = "NotReady"
 )
 
 type Node struct {
@@ -16,6 +26,7 @@ type Node struct {
 	IP              string
 	Api             string
 	Cores           int
+	CpuAllocated    float64
 	Memory          int
 	MemoryAllocated int
 	Disk            int
@@ -23,19 +34,141 @@ type Node struct {
 	Stats           worker.Stats
 	Role            string
 	TaskCount       int
+	Labels          map[string]string
+	Status          string
+	LastHeartbeat   time.Time
+	Unschedulable   bool
+	// ServesServices tells whether the node runs the proxies of services
+	// served from the workers.
+	ServesServices bool
+	// TaskLabels holds the labels of the active tasks on the node, keyed by
+	// task ID. It is used for inter-task affinity.
+	TaskLabels map[string]map[string]string
+	// TaskNamespaces holds the namespace of the active tasks on the node,
+	// keyed by task ID, so that affinity only matches tasks in the same
+	// namespace.
+	TaskNamespaces map[string]string
+	Taints         []task.Taint
+	// Reservations holds the resources requested by the active tasks on
+	// the node, keyed by task ID.
+	Reservations map[string]Reservation
+	// Client makes the requests to the node's API.
+	Client *http.Client `json:"-"`
+}
+
+// Reservation is the share of a node's capacity held by one task. Memory is
+// in kilobytes and disk in bytes, like the node's capacity.
+type Reservation struct {
+	Cpu    float64
+	Memory int
+	Disk   int
 }
 
 func NewNode(name, api, role string) *Node {
 	return &Node{
-		Name: name,
-		Api:  api,
-		Role: role,
+		Name:           name,
+		Api:            api,
+		Role:           role,
+		Labels:         make(map[string]string),
+		Status:         Ready,
+		TaskLabels:     make(map[string]map[string]string),
+		TaskNamespaces: make(map[string]string),
+		Reservations:   make(map[string]Reservation),
+		Client:         http.DefaultClient,
+	}
+}
+
+// AddTask records a task as active on the node and reserves the resources
+// it requested.
+func (n *Node) AddTask(t task.Task) {
+	if n.TaskLabels == nil {
+		n.TaskLabels = make(map[string]map[string]string)
+	}
+	if n.TaskNamespaces == nil {
+		n.TaskNamespaces = make(map[string]string)
+	}
+	if n.Reservations == nil {
+		n.Reservations = make(map[string]Reservation)
+	}
+	n.TaskLabels[t.ID.String()] = t.Labels
+	n.TaskNamespaces[t.ID.String()] = t.Namespace
+	n.Reservations[t.ID.String()] = Reservation{
+		Cpu:    t.Cpu,
+		Memory: task.MemoryKb(t),
+		Disk:   t.Disk,
+	}
+	n.updateAllocated()
+}
+
+// RemoveTask forgets a task that is no longer active on the node and
+// releases its reservation.
+func (n *Node) RemoveTask(id uuid.UUID) {
+	delete(n.TaskLabels, id.String())
+	delete(n.TaskNamespaces, id.String())
+	delete(n.Reservations, id.String())
+	n.updateAllocated()
+}
+
+func (n *Node) updateAllocated() {
+	n.CpuAllocated = 0
+	n.MemoryAllocated = 0
+	n.DiskAllocated = 0
+	for _, r := range n.Reservations {
+		n.CpuAllocated += r.Cpu
+		n.MemoryAllocated += r.Memory
+		n.DiskAllocated += r.Disk
+	}
+	n.TaskCount = len(n.Reservations)
+}
+
+func (n *Node) AllocatableCpu() float64 {
+	return float64(n.Cores) - n.CpuAllocated
+}
+
+func (n *Node) AllocatableMemory() int {
+	return n.Memory - n.MemoryAllocated
+}
+
+func (n *Node) AllocatableDisk() int {
+	return n.Disk - n.DiskAllocated
+}
+
+// Clone returns a copy of the node that can be handed to a scheduler
+// without sharing its maps.
+func (n *Node) Clone() *Node {
+	c := *n
+	c.Labels = make(map[string]string, len(n.Labels))
+	for k, v := range n.Labels {
+		c.Labels[k] = v
+	}
+	c.Taints = append([]task.Taint{}, n.Taints...)
+	c.TaskLabels = make(map[string]map[string]string, len(n.TaskLabels))
+	for k, v := range n.TaskLabels {
+		c.TaskLabels[k] = v
+	}
+	c.TaskNamespaces = make(map[string]string, len(n.TaskNamespaces))
+	for k, v := range n.TaskNamespaces {
+		c.TaskNamespaces[k] = v
+	}
+	c.Reservations = make(map[string]Reservation, len(n.Reservations))
+	for k, v := range n.Reservations {
+		c.Reservations[k] = v
+	}
+	return &c
+}
+
+// Host returns the host part of the node's API address.
+func (n *Node) Host() string {
+	u, err := url.Parse(n.Api)
+	if err != nil {
+		return n.Name
 	}
+	return u.Hostname()
 }
 
 func (n *Node) GetStats() (*worker.Stats, error) {
 	url := fmt.Sprintf("%s/stats", n.Api)
-	resp, err := utils.HTTPWithRetry(http.Get, url)
+	resp, err := utils.HTTPWithRetry(n.Client.Get, url)
 	if err != nil {
 		msg := fmt.Sprintf("Unable to connect to %v. Permanent failure.\n", n.Api)
 		log.Println(msg)
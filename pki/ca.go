@@ -0,0 +1,279 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// NodeGroup is the organization of the certificates issued to nodes.
+const NodeGroup = "cube:nodes"
+
+// caValidity is how long the CA certificate is valid for.
+const caValidity = 10 * 365 * 24 * time.Hour
+
+// CA is the cluster certificate authority, which signs the certificates of
+// the manager and the workers.
+type CA struct {
+	Cert    *x509.Certificate
+	CertPEM []byte
+	key     crypto.Signer
+}
+
+// LoadOrCreateCA reads the CA from ca.pem and ca-key.pem in dir, and
+// creates them if they don't exist yet.
+func LoadOrCreateCA(dir string) (*CA, error) {
+	certFile := filepath.Join(dir, "ca.pem")
+	keyFile := filepath.Join(dir, "ca-key.pem")
+
+	certPEM, err := os.ReadFile(certFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return createCA(certFile, keyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", keyFile, err)
+	}
+	return &CA{Cert: cert, CertPEM: certPEM, key: key}, nil
+}
+
+func createCA(certFile, keyFile string) (*CA, error) {
+	key, keyPEM, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          newSerial(),
+		Subject:               pkix.Name{CommonName: "cube-ca"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(caValidity),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	err = WriteKeyPair(certFile, keyFile, certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Cert: cert, CertPEM: certPEM, key: key}, nil
+}
+
+// Hash returns the hash of the CA certificate that workers can pin when
+// they fetch it from the manager.
+func (ca *CA) Hash() string {
+	return CertHash(ca.Cert)
+}
+
+// CertHash returns the SHA-256 hash of a certificate, as sha256:<hex>.
+func CertHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Sign issues a certificate for the key and names of a certificate
+// request, which must all be among hosts. The certificate serves APIs and
+// authenticates clients, and is valid for validity.
+func (ca *CA) Sign(csr *x509.CertificateRequest, org string, hosts []string, validity time.Duration) (*x509.Certificate, []byte, error) {
+	err := csr.CheckSignature()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate request: %v", err)
+	}
+	for _, h := range RequestHosts(csr) {
+		if !HasHost(hosts, h) {
+			return nil, nil, fmt.Errorf("certificate request for %s names host %s, which it may not", csr.Subject.CommonName, h)
+		}
+	}
+	// The certificate is valid a little before it is issued, for nodes
+	// whose clocks are behind.
+	now := time.Now()
+	notBefore := now.Add(-min(time.Minute, validity/10))
+	notAfter := now.Add(validity)
+	if notAfter.After(ca.Cert.NotAfter) {
+		notAfter = ca.Cert.NotAfter
+	}
+	subject := pkix.Name{CommonName: csr.Subject.CommonName}
+	if org != "" {
+		subject.Organization = []string{org}
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: newSerial(),
+		Subject:      subject,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     csr.DNSNames,
+		IPAddresses:  csr.IPAddresses,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// Issue creates a key and a certificate for name and hosts, for the
+// manager's own key pair.
+func (ca *CA) Issue(name, org string, hosts []string, validity time.Duration) (*x509.Certificate, []byte, []byte, error) {
+	keyPEM, csrPEM, err := NewCSR(name, hosts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	csr, err := ParseCSR(csrPEM)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cert, certPEM, err := ca.Sign(csr, org, hosts, validity)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cert, certPEM, keyPEM, nil
+}
+
+// NewCSR creates a key and a certificate request for name, valid for the
+// host names and addresses in hosts.
+func NewCSR(name string, hosts []string) ([]byte, []byte, error) {
+	key, keyPEM, err := newKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.CertificateRequest{Subject: pkix.Name{CommonName: name}}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keyPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// RequestHosts returns the host names and addresses a certificate request
+// is for.
+func RequestHosts(csr *x509.CertificateRequest) []string {
+	hosts := append([]string{}, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	return hosts
+}
+
+// HasHost reports whether host is in hosts. Names are compared without
+// regard to case, and addresses by value, so that ::ffff:10.0.0.1 is
+// 10.0.0.1.
+func HasHost(hosts []string, host string) bool {
+	ip := net.ParseIP(host)
+	for _, h := range hosts {
+		if ip != nil {
+			if hip := net.ParseIP(h); hip != nil && hip.Equal(ip) {
+				return true
+			}
+		} else if strings.EqualFold(strings.TrimSuffix(h, "."), strings.TrimSuffix(host, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCSR reads a PEM certificate request.
+func ParseCSR(data []byte) (*x509.CertificateRequest, error) {
+	b, _ := pem.Decode(data)
+	if b == nil || b.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("no PEM certificate request found")
+	}
+	return x509.ParseCertificateRequest(b.Bytes)
+}
+
+// ParseCertificate reads the first certificate of PEM data.
+func ParseCertificate(data []byte) (*x509.Certificate, error) {
+	b, _ := pem.Decode(data)
+	if b == nil || b.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate found")
+	}
+	return x509.ParseCertificate(b.Bytes)
+}
+
+// Serial formats the serial number of a certificate as it is listed.
+func Serial(cert *x509.Certificate) string {
+	return cert.SerialNumber.Text(16)
+}
+
+func newKey() (crypto.Signer, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func parseKey(data []byte) (crypto.Signer, error) {
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil, errors.New("no PEM key found")
+	}
+	if key, err := x509.ParseECPrivateKey(b.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(b.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+	return signer, nil
+}
+
+func newSerial() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return n
+}
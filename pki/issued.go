@@ -0,0 +1,54 @@
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+)
+
+// Certificate is the record the manager keeps of a certificate issued by
+// the CA. Revoked certificates are refused until they expire.
+type Certificate struct {
+	Serial     string
+	Name       string
+	NotBefore  time.Time
+	NotAfter   time.Time
+	Revoked    bool
+	RevokeTime *time.Time `json:",omitempty"`
+}
+
+// NewRecord returns the record of an issued certificate.
+func NewRecord(cert *x509.Certificate) *Certificate {
+	return &Certificate{
+		Serial:    Serial(cert),
+		Name:      cert.Subject.CommonName,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+}
+
+// BootstrapToken is a one-time join token that lets a worker get its first
+// certificate from the CA. It can be used once, before it expires, and
+// only its hash is stored.
+type BootstrapToken struct {
+	Hash       string
+	CreateTime time.Time
+	Expires    time.Time
+}
+
+// NewBootstrapToken returns a random token and its record.
+func NewBootstrapToken(ttl time.Duration) (string, *BootstrapToken) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	now := time.Now().UTC()
+	return token, &BootstrapToken{Hash: TokenHash(token), CreateTime: now, Expires: now.Add(ttl)}
+}
+
+// TokenHash returns the hash a token is stored by.
+func TokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,106 @@
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// KeyPair is the certificate and key of a node, kept in two files. It can
+// be replaced while it is in use, so that a certificate is rotated without
+// restarting the servers and clients that present it.
+type KeyPair struct {
+	CertFile string
+	KeyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+}
+
+// LoadKeyPair reads a key pair from its files.
+func LoadKeyPair(certFile, keyFile string) (*KeyPair, error) {
+	kp := &KeyPair{CertFile: certFile, KeyFile: keyFile}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading certificate %s: %v", certFile, err)
+	}
+	kp.cert = &cert
+	return kp, nil
+}
+
+// Update writes a new certificate and key to the files of the key pair and
+// starts presenting them.
+func (kp *KeyPair) Update(certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	err = WriteKeyPair(kp.CertFile, kp.KeyFile, certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	kp.mu.Lock()
+	kp.cert = &cert
+	kp.mu.Unlock()
+	return nil
+}
+
+// Leaf returns the certificate of the key pair.
+func (kp *KeyPair) Leaf() *x509.Certificate {
+	kp.mu.RLock()
+	defer kp.mu.RUnlock()
+	return kp.cert.Leaf
+}
+
+// NeedsRenewal reports whether two thirds of the certificate's lifetime
+// have passed, when it is time to get a new one.
+func (kp *KeyPair) NeedsRenewal(now time.Time) bool {
+	return NeedsRenewal(kp.Leaf(), now)
+}
+
+// NeedsRenewal reports whether two thirds of the lifetime of cert have
+// passed.
+func NeedsRenewal(cert *x509.Certificate, now time.Time) bool {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return now.After(cert.NotAfter.Add(-lifetime / 3))
+}
+
+func (kp *KeyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	kp.mu.RLock()
+	defer kp.mu.RUnlock()
+	return kp.cert, nil
+}
+
+func (kp *KeyPair) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	kp.mu.RLock()
+	defer kp.mu.RUnlock()
+	return kp.cert, nil
+}
+
+// WriteKeyPair writes a PEM certificate and key to their files. The key is
+// only readable by its owner.
+func WriteKeyPair(certFile, keyFile string, certPEM, keyPEM []byte) error {
+	err := WriteFile(keyFile, keyPEM, 0600)
+	if err != nil {
+		return err
+	}
+	return WriteFile(certFile, certPEM, 0644)
+}
+
+// WriteFile replaces a file through a temporary file, so that it is never
+// seen half written.
+func WriteFile(name string, data []byte, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(name), 0700)
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	err = os.WriteFile(tmp, data, perm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
@@ -0,0 +1,67 @@
+// Package pki builds the TLS configurations the manager, the workers and
+// the client use to talk to each other, and runs the cluster CA that
+// issues the certificates of the nodes.
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// ServerConfig returns the TLS configuration of an API served with the key
+// pair kp. Client certificates are verified against the CAs in pool, as
+// clientAuth asks.
+func ServerConfig(kp *KeyPair, pool *x509.CertPool, clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		GetCertificate: kp.GetCertificate,
+		ClientCAs:      pool,
+		ClientAuth:     clientAuth,
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// ClientConfig returns the TLS configuration of a client that verifies
+// servers against the CAs in pool, or the system roots if it is nil. The
+// key pair kp, if given, is presented to servers that ask for a
+// certificate.
+func ClientConfig(kp *KeyPair, pool *x509.CertPool) *tls.Config {
+	c := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	if kp != nil {
+		c.GetClientCertificate = kp.GetClientCertificate
+	}
+	return c
+}
+
+// NewClient returns an HTTP client that connects with the TLS
+// configuration c.
+func NewClient(c *tls.Config) *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = c
+	return &http.Client{Transport: t}
+}
+
+// LoadPool reads the PEM certificates of caFile into a pool.
+func LoadPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// PeerName returns the common name of the verified client certificate of
+// a request, or an error if the request didn't present one.
+func PeerName(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", errors.New("no verified client certificate")
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName, nil
+}
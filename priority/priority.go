@@ -0,0 +1,25 @@
+package priority
+
+import (
+	"errors"
+	"time"
+)
+
+// PriorityClass maps a name tasks can refer to onto a priority. Tasks with
+// a higher Value are scheduled first and can preempt tasks with a lower one.
+type PriorityClass struct {
+	Name  string
+	Value int
+	// GlobalDefault makes the class apply to tasks that don't name one.
+	// At most one class can be the global default.
+	GlobalDefault bool
+	Description   string
+	CreateTime    time.Time
+}
+
+func (p *PriorityClass) Validate() error {
+	if p.Name == "" {
+		return errors.New("priority class name must not be empty")
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+)
+
+const dialTimeout = 5 * time.Second
+
+type endpointKey struct{}
+
+// Proxy listens on a port and balances TCP connections or HTTP requests
+// across a set of endpoints in round-robin order.
+type Proxy struct {
+	Name     string
+	Protocol string
+	Port     int
+
+	mu        sync.Mutex
+	endpoints []string
+	next      int
+	listener  net.Listener
+	server    *http.Server
+	reverse   *httputil.ReverseProxy
+}
+
+func New(name, protocol string, port int) *Proxy {
+	return &Proxy{Name: name, Protocol: protocol, Port: port}
+}
+
+// Start listens on the proxy's port and serves connections in the
+// background until Stop is called.
+func (p *Proxy) Start() error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", p.Port))
+	if err != nil {
+		return fmt.Errorf("proxy %s cannot listen on port %d: %v", p.Name, p.Port, err)
+	}
+
+	p.mu.Lock()
+	p.listener = l
+	if p.Protocol == "HTTP" {
+		p.server = &http.Server{Handler: p}
+	}
+	p.mu.Unlock()
+
+	if p.server != nil {
+		go p.server.Serve(l)
+	} else {
+		go p.serveTCP(l)
+	}
+	log.Printf("Proxy %s listening on port %d\n", p.Name, p.Port)
+	return nil
+}
+
+func (p *Proxy) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.server != nil {
+		return p.server.Close()
+	}
+	if p.listener != nil {
+		return p.listener.Close()
+	}
+	return nil
+}
+
+// SetEndpoints replaces the addresses the proxy balances across.
+func (p *Proxy) SetEndpoints(addrs []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.endpoints = append([]string{}, addrs...)
+}
+
+// pick returns the endpoint whose turn it is.
+func (p *Proxy) pick() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.endpoints) == 0 {
+		return "", false
+	}
+	p.next = (p.next + 1) % len(p.endpoints)
+	return p.endpoints[p.next], true
+}
+
+func (p *Proxy) Endpoints() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.endpoints...)
+}
+
+func (p *Proxy) serveTCP(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Proxy %s failed to accept a connection: %v\n", p.Name, err)
+			continue
+		}
+		go p.handleTCP(conn)
+	}
+}
+
+func (p *Proxy) handleTCP(conn net.Conn) {
+	defer conn.Close()
+
+	addr, ok := p.pick()
+	if !ok {
+		log.Printf("Proxy %s has no endpoints\n", p.Name)
+		return
+	}
+	backend, err := p.dial(context.Background(), "tcp", addr)
+	if err != nil {
+		log.Printf("Proxy %s: %v\n", p.Name, err)
+		return
+	}
+	defer backend.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(backend, conn)
+		if c, ok := backend.(*net.TCPConn); ok {
+			c.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, backend)
+		if c, ok := conn.(*net.TCPConn); ok {
+			c.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// dial connects to addr, falling back to up to two other endpoints if it
+// cannot be reached.
+func (p *Proxy) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	addrs := []string{addr}
+	for _, other := range p.Endpoints() {
+		if other != addr && len(addrs) < 3 {
+			addrs = append(addrs, other)
+		}
+	}
+
+	for _, a := range addrs {
+		conn, err := d.DialContext(ctx, network, a)
+		if err == nil {
+			return conn, nil
+		}
+		log.Printf("Proxy %s cannot reach %s: %v\n", p.Name, a, err)
+	}
+	return nil, fmt.Errorf("no reachable endpoint for %s", p.Name)
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	addr, ok := p.pick()
+	if !ok {
+		http.Error(w, fmt.Sprintf("service %s has no available endpoints", p.Name), http.StatusServiceUnavailable)
+		return
+	}
+	ctx := context.WithValue(r.Context(), endpointKey{}, addr)
+	p.reverseProxy().ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (p *Proxy) reverseProxy() *httputil.ReverseProxy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.reverse == nil {
+		p.reverse = &httputil.ReverseProxy{
+			Rewrite: func(r *httputil.ProxyRequest) {
+				r.Out.URL.Scheme = "http"
+				r.Out.URL.Host = r.In.Context().Value(endpointKey{}).(string)
+				r.Out.Host = r.In.Host
+				r.SetXForwarded()
+			},
+			Transport: &http.Transport{DialContext: p.dial},
+		}
+	}
+	return p.reverse
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// deadAddress returns an address that refuses connections.
+func deadAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+// startProxy starts a proxy on a free port and returns its loopback
+// address.
+func startProxy(t *testing.T, protocol string, endpoints []string) string {
+	t.Helper()
+	p := New("web", protocol, 0)
+	p.SetEndpoints(endpoints)
+	if err := p.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { p.Stop() })
+	port := p.listener.Addr().(*net.TCPAddr).Port
+	return fmt.Sprintf("127.0.0.1:%d", port)
+}
+
+func TestPickIsRoundRobin(t *testing.T) {
+	p := New("web", "TCP", 0)
+	if _, ok := p.pick(); ok {
+		t.Error("picked an endpoint of a proxy without endpoints")
+	}
+
+	p.SetEndpoints([]string{"a", "b", "c"})
+	var picks []string
+	for i := 0; i < 6; i++ {
+		addr, _ := p.pick()
+		picks = append(picks, addr)
+	}
+	if got := strings.Join(picks, ""); got != "bcabca" {
+		t.Errorf("picks %s, want bcabca", got)
+	}
+
+	// A shorter endpoint list doesn't leave the turn out of range.
+	p.SetEndpoints([]string{"a"})
+	if addr, ok := p.pick(); !ok || addr != "a" {
+		t.Errorf("pick after the endpoints changed = %q, %v", addr, ok)
+	}
+}
+
+func TestHTTPProxy(t *testing.T) {
+	var backends []string
+	for _, name := range []string{"b1", "b2"} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s %s", name, r.URL.Path, r.Header.Get("X-Forwarded-For"))
+		}))
+		t.Cleanup(srv.Close)
+		backends = append(backends, strings.TrimPrefix(srv.URL, "http://"))
+	}
+	// Requests whose turn is the dead endpoint go to another one.
+	addr := startProxy(t, "HTTP", append([]string{deadAddress(t)}, backends...))
+
+	served := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		resp, err := http.Get("http://" + addr + "/hello")
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET: got %d (%s)", resp.StatusCode, body)
+		}
+		fields := strings.Fields(string(body))
+		if len(fields) != 3 || fields[1] != "/hello" || fields[2] != "127.0.0.1" {
+			t.Errorf("backend got %q, want the path and the client address", body)
+		}
+		served[fields[0]]++
+	}
+	if served["b1"] == 0 || served["b2"] == 0 || served["b1"]+served["b2"] != 6 {
+		t.Errorf("requests served by backend: %v", served)
+	}
+}
+
+func TestTCPProxy(t *testing.T) {
+	// The backend answers once the client has closed its side.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				data, _ := io.ReadAll(conn)
+				fmt.Fprintf(conn, "got %s", data)
+			}()
+		}
+	}()
+	addr := startProxy(t, "TCP", []string{deadAddress(t), l.Addr().String()})
+
+	for i := 0; i < 4; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		fmt.Fprintf(conn, "request %d", i)
+		conn.(*net.TCPConn).CloseWrite()
+		reply, err := io.ReadAll(conn)
+		conn.Close()
+		if err != nil || string(reply) != fmt.Sprintf("got request %d", i) {
+			t.Errorf("reply %q, %v; want the request echoed after the half-close", reply, err)
+		}
+	}
+}
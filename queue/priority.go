@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// PriorityQueue returns the value that comes first according to less,
+// and values that are equal in the order they were enqueued. It is safe
+// for concurrent use.
+type PriorityQueue[T any] struct {
+	mu    sync.Mutex
+	items items[T]
+	seq   uint64
+}
+
+type item[T any] struct {
+	val T
+	seq uint64
+}
+
+type items[T any] struct {
+	list []item[T]
+	less func(a, b T) bool
+}
+
+func (h items[T]) Len() int { return len(h.list) }
+
+func (h items[T]) Less(i, j int) bool {
+	a, b := h.list[i], h.list[j]
+	if h.less(a.val, b.val) {
+		return true
+	}
+	if h.less(b.val, a.val) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+func (h items[T]) Swap(i, j int) { h.list[i], h.list[j] = h.list[j], h.list[i] }
+
+func (h *items[T]) Push(x any) { h.list = append(h.list, x.(item[T])) }
+
+func (h *items[T]) Pop() any {
+	last := h.list[len(h.list)-1]
+	h.list = h.list[:len(h.list)-1]
+	return last
+}
+
+func NewPriority[T any](less func(a, b T) bool) *PriorityQueue[T] {
+	return &PriorityQueue[T]{items: items[T]{less: less}}
+}
+
+func (q *PriorityQueue[T]) Enqueue(val T) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	heap.Push(&q.items, item[T]{val: val, seq: q.seq})
+}
+
+func (q *PriorityQueue[T]) Dequeue() T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items.list) == 0 {
+		var zeroValue T
+		return zeroValue
+	}
+	return heap.Pop(&q.items).(item[T]).val
+}
+
+func (q *PriorityQueue[T]) Peek() T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items.list) == 0 {
+		var zeroValue T
+		return zeroValue
+	}
+	return q.items.list[0].val
+}
+
+func (q *PriorityQueue[T]) Length() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items.list)
+}
@@ -0,0 +1,60 @@
+package quota
+
+import (
+	"cube/task"
+	"fmt"
+	"time"
+)
+
+// Limits are the resources requested by a single task. A zero value means
+// no default or no maximum.
+type Limits struct {
+	Cpu    float64
+	Memory int
+	Disk   int
+}
+
+// LimitRange sets the default and maximum requests of the tasks of a
+// namespace. A namespace has at most one limit range.
+type LimitRange struct {
+	Namespace  string
+	Default    Limits
+	Max        Limits
+	CreateTime time.Time
+}
+
+func (l *LimitRange) Validate() error {
+	d, m := l.Default, l.Max
+	if d.Cpu < 0 || d.Memory < 0 || d.Disk < 0 || m.Cpu < 0 || m.Memory < 0 || m.Disk < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if (m.Cpu > 0 && d.Cpu > m.Cpu) || (m.Memory > 0 && d.Memory > m.Memory) ||
+		(m.Disk > 0 && d.Disk > m.Disk) {
+		return fmt.Errorf("default limits must not be above the maximum")
+	}
+	return nil
+}
+
+// Apply fills in the requests a task was submitted without from the
+// defaults, and returns an error if a request is above the maximum.
+func (l *LimitRange) Apply(t *task.Task) error {
+	if t.Cpu == 0 {
+		t.Cpu = l.Default.Cpu
+	}
+	if t.Memory == 0 {
+		t.Memory = l.Default.Memory
+	}
+	if t.Disk == 0 {
+		t.Disk = l.Default.Disk
+	}
+
+	switch {
+	case l.Max.Cpu > 0 && t.Cpu > l.Max.Cpu:
+		return fmt.Errorf("cpu %g is above the maximum of %g", t.Cpu, l.Max.Cpu)
+	case l.Max.Memory > 0 && t.Memory > l.Max.Memory:
+		return fmt.Errorf("memory %d is above the maximum of %d", t.Memory, l.Max.Memory)
+	case l.Max.Disk > 0 && t.Disk > l.Max.Disk:
+		return fmt.Errorf("disk %d is above the maximum of %d", t.Disk, l.Max.Disk)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package quota
+
+import (
+	"cube/task"
+	"fmt"
+	"time"
+)
+
+// Resources is an amount of each resource a quota caps. A zero value in a
+// limit means the resource is not limited; there is no way to cap it at
+// zero.
+type Resources struct {
+	Cpu float64
+	// Memory and Disk are in bytes, like the requests of a task.
+	Memory int
+	Disk   int
+	// Tasks counts the tasks that have not finished.
+	Tasks int
+	// HostPorts counts the ports published by those tasks.
+	HostPorts int
+}
+
+// Quota caps the resources requested by the active tasks of a namespace.
+// A namespace has at most one quota.
+type Quota struct {
+	Namespace  string
+	Hard       Resources
+	CreateTime time.Time
+	Status     Status
+}
+
+type Status struct {
+	Used Resources
+}
+
+// Usage returns the resources a task counts against a quota.
+func Usage(t *task.Task) Resources {
+	return Resources{
+		Cpu:       t.Cpu,
+		Memory:    t.Memory,
+		Disk:      t.Disk,
+		Tasks:     1,
+		HostPorts: len(t.ExposedPort),
+	}
+}
+
+func (r Resources) Add(o Resources) Resources {
+	return Resources{
+		Cpu:       r.Cpu + o.Cpu,
+		Memory:    r.Memory + o.Memory,
+		Disk:      r.Disk + o.Disk,
+		Tasks:     r.Tasks + o.Tasks,
+		HostPorts: r.HostPorts + o.HostPorts,
+	}
+}
+
+func (r Resources) Sub(o Resources) Resources {
+	return Resources{
+		Cpu:       r.Cpu - o.Cpu,
+		Memory:    r.Memory - o.Memory,
+		Disk:      r.Disk - o.Disk,
+		Tasks:     r.Tasks - o.Tasks,
+		HostPorts: r.HostPorts - o.HostPorts,
+	}
+}
+
+func (r Resources) validate() error {
+	if r.Cpu < 0 || r.Memory < 0 || r.Disk < 0 || r.Tasks < 0 || r.HostPorts < 0 {
+		return fmt.Errorf("resource amounts must not be negative")
+	}
+	return nil
+}
+
+func (q *Quota) Validate() error {
+	return q.Hard.validate()
+}
+
+// Check returns an error naming the first resource of which used is over
+// the quota.
+func (q *Quota) Check(used Resources) error {
+	h := q.Hard
+	switch {
+	case h.Cpu > 0 && used.Cpu > h.Cpu:
+		return fmt.Errorf("cpu %g exceeds quota %g", used.Cpu, h.Cpu)
+	case h.Memory > 0 && used.Memory > h.Memory:
+		return fmt.Errorf("memory %d exceeds quota %d", used.Memory, h.Memory)
+	case h.Disk > 0 && used.Disk > h.Disk:
+		return fmt.Errorf("disk %d exceeds quota %d", used.Disk, h.Disk)
+	case h.Tasks > 0 && used.Tasks > h.Tasks:
+		return fmt.Errorf("%d tasks exceed quota %d", used.Tasks, h.Tasks)
+	case h.HostPorts > 0 && used.HostPorts > h.HostPorts:
+		return fmt.Errorf("%d host ports exceed quota %d", used.HostPorts, h.HostPorts)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+)
+
+func matchesNodeSelector(t task.Task, n *node.Node) bool {
+	for k, v := range t.NodeSelector {
+		if n.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesNodeAffinity(t task.Task, n *node.Node) bool {
+	if t.Affinity == nil || t.Affinity.NodeAffinity == nil {
+		return true
+	}
+	return t.Affinity.NodeAffinity.Required.Matches(n.Labels)
+}
+
+func matchesTaskAffinity(t task.Task, n *node.Node, nodes []*node.Node) bool {
+	if t.Affinity == nil || t.Affinity.TaskAffinity == nil {
+		return true
+	}
+	for _, s := range t.Affinity.TaskAffinity.Required {
+		if runsMatchingTask(t, n, s) {
+			continue
+		}
+		// The first task of a group that is attracted to itself has nowhere
+		// to go unless it is allowed to start anywhere.
+		if s.Matches(t.Labels) && !anyRunsMatchingTask(t, nodes, s) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func matchesTaskAntiAffinity(t task.Task, n *node.Node) bool {
+	if t.Affinity == nil || t.Affinity.TaskAntiAffinity == nil {
+		return true
+	}
+	for _, s := range t.Affinity.TaskAntiAffinity.Required {
+		if runsMatchingTask(t, n, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// runsMatchingTask reports whether the node runs another task of the same
+// namespace that the selector matches.
+func runsMatchingTask(t task.Task, n *node.Node, s task.Selector) bool {
+	for id, labels := range n.TaskLabels {
+		if id == t.ID.String() || n.TaskNamespaces[id] != t.Namespace {
+			continue
+		}
+		if s.Matches(labels) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyRunsMatchingTask(t task.Task, nodes []*node.Node, s task.Selector) bool {
+	for _, n := range nodes {
+		if runsMatchingTask(t, n, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// preferenceScore rates how well a node satisfies the task's preferred
+// affinity rules, from -1 (only disliked) to 1 (only preferred).
+func preferenceScore(t task.Task, n *node.Node) float64 {
+	if t.Affinity == nil {
+		return 0
+	}
+	score, total := 0, 0
+	if na := t.Affinity.NodeAffinity; na != nil {
+		for _, p := range na.Preferred {
+			total += p.Weight
+			if p.Selector.Matches(n.Labels) {
+				score += p.Weight
+			}
+		}
+	}
+	if ta := t.Affinity.TaskAffinity; ta != nil {
+		for _, p := range ta.Preferred {
+			total += p.Weight
+			if runsMatchingTask(t, n, p.Selector) {
+				score += p.Weight
+			}
+		}
+	}
+	if ta := t.Affinity.TaskAntiAffinity; ta != nil {
+		for _, p := range ta.Preferred {
+			total += p.Weight
+			if runsMatchingTask(t, n, p.Selector) {
+				score -= p.Weight
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(score) / float64(total)
+}
+
+// toleratesTaints reports whether the task tolerates every NoSchedule and
+// NoExecute taint on the node.
+func toleratesTaints(t task.Task, n *node.Node) bool {
+	for _, taint := range n.Taints {
+		if taint.Effect == task.PreferNoSchedule {
+			continue
+		}
+		if !taint.ToleratedBy(t.Tolerations) {
+			return false
+		}
+	}
+	return true
+}
+
+// taintPenalty counts the PreferNoSchedule taints on the node that the task
+// doesn't tolerate.
+func taintPenalty(t task.Task, n *node.Node) float64 {
+	penalty := 0.0
+	for _, taint := range n.Taints {
+		if taint.Effect == task.PreferNoSchedule && !taint.ToleratedBy(t.Tolerations) {
+			penalty++
+		}
+	}
+	return penalty
+}
@@ -0,0 +1,36 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTaskAffinityStaysInNamespace(t *testing.T) {
+	n := node.NewNode("w1", "http://w1:5556", "worker")
+	n.AddTask(task.Task{ID: uuid.New(), Namespace: "team-a", Labels: map[string]string{"app": "db"}})
+
+	db := task.Selector{{Key: "app", Operator: task.In, Values: []string{"db"}}}
+	tests := []struct {
+		name      string
+		namespace string
+		affinity  *task.Affinity
+		want      bool
+	}{
+		{"affinity in the same namespace", "team-a", &task.Affinity{TaskAffinity: &task.TaskAffinity{Required: []task.Selector{db}}}, true},
+		{"affinity in another namespace", "team-b", &task.Affinity{TaskAffinity: &task.TaskAffinity{Required: []task.Selector{db}}}, false},
+		{"anti-affinity in the same namespace", "team-a", &task.Affinity{TaskAntiAffinity: &task.TaskAffinity{Required: []task.Selector{db}}}, false},
+		{"anti-affinity in another namespace", "team-b", &task.Affinity{TaskAntiAffinity: &task.TaskAffinity{Required: []task.Selector{db}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tk := task.Task{ID: uuid.New(), Namespace: tt.namespace, Labels: map[string]string{"app": "web"}, Affinity: tt.affinity}
+			got := matchesTaskAffinity(tk, n, []*node.Node{n}) && matchesTaskAntiAffinity(tk, n)
+			if got != tt.want {
+				t.Errorf("task fits the node = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
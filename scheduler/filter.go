@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A predicate is a condition a node must meet to run a task. Reason
+// describes the nodes that fail it.
+type predicate struct {
+	reason string
+	fits   func(t task.Task, n *node.Node, nodes []*node.Node) bool
+}
+
+var predicates = []predicate{
+	{"had untolerated taints", func(t task.Task, n *node.Node, _ []*node.Node) bool {
+		return toleratesTaints(t, n)
+	}},
+	{"didn't match the node selector", func(t task.Task, n *node.Node, _ []*node.Node) bool {
+		return matchesNodeSelector(t, n)
+	}},
+	{"didn't match node affinity", func(t task.Task, n *node.Node, _ []*node.Node) bool {
+		return matchesNodeAffinity(t, n)
+	}},
+	{"didn't match task affinity", matchesTaskAffinity},
+	{"didn't match task anti-affinity", func(t task.Task, n *node.Node, _ []*node.Node) bool {
+		return matchesTaskAntiAffinity(t, n)
+	}},
+	{"had insufficient cpu", func(t task.Task, n *node.Node, _ []*node.Node) bool {
+		return checkCpu(t, n)
+	}},
+	{"had insufficient memory", func(t task.Task, n *node.Node, _ []*node.Node) bool {
+		return checkMemory(t, n)
+	}},
+	{"had insufficient disk", func(t task.Task, n *node.Node, _ []*node.Node) bool {
+		return checkDisk(t, n)
+	}},
+}
+
+// filterNodes returns the nodes that meet every predicate for the task.
+func filterNodes(t task.Task, nodes []*node.Node) []*node.Node {
+	var candidates []*node.Node
+	for _, n := range nodes {
+		if failedPredicate(t, n, nodes) == nil {
+			candidates = append(candidates, n)
+		}
+	}
+	return candidates
+}
+
+func failedPredicate(t task.Task, n *node.Node, nodes []*node.Node) *predicate {
+	for i := range predicates {
+		if !predicates[i].fits(t, n, nodes) {
+			return &predicates[i]
+		}
+	}
+	return nil
+}
+
+// Explain describes why none of the nodes can run the task, for example
+// "0/3 nodes are available: 2 node(s) had insufficient memory, 1 node(s)
+// had untolerated taints".
+func Explain(t task.Task, nodes []*node.Node) string {
+	counts := make(map[string]int)
+	for _, n := range nodes {
+		if p := failedPredicate(t, n, nodes); p != nil {
+			counts[p.reason]++
+		}
+	}
+
+	reasons := make([]string, 0, len(counts))
+	for reason, count := range counts {
+		reasons = append(reasons, fmt.Sprintf("%d node(s) %s", count, reason))
+	}
+	sort.Strings(reasons)
+
+	msg := fmt.Sprintf("0/%d nodes are available", len(nodes))
+	if len(reasons) > 0 {
+		msg += ": " + strings.Join(reasons, ", ")
+	}
+	return msg
+}
+
+func checkCpu(t task.Task, n *node.Node) bool {
+	return n.Cores == 0 || t.Cpu <= n.AllocatableCpu()
+}
+
+func checkMemory(t task.Task, n *node.Node) bool {
+	return n.Memory == 0 || task.MemoryKb(t) <= n.AllocatableMemory()
+}
+
+func checkDisk(t task.Task, n *node.Node) bool {
+	return n.Disk == 0 || t.Disk <= n.AllocatableDisk()
+}
@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// PlaceGroup finds a node for every task of a group at once. It places the
+// tasks one after the other on the nodes, reserving their resources as it
+// goes, so the nodes must be copies the caller doesn't mind changing. It
+// returns the name of the node picked for each task, or an error if one of
+// them doesn't fit.
+func PlaceGroup(s Scheduler, tasks []task.Task, nodes []*node.Node) (map[uuid.UUID]string, error) {
+	// The largest tasks are the hardest to fit, so place them first.
+	sorted := append([]task.Task{}, tasks...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Cpu != sorted[j].Cpu {
+			return sorted[i].Cpu > sorted[j].Cpu
+		}
+		return sorted[i].Memory > sorted[j].Memory
+	})
+
+	placement := make(map[uuid.UUID]string, len(sorted))
+	for _, t := range sorted {
+		candidates := s.SelectCandidateNodes(t, nodes)
+		if candidates == nil {
+			return nil, fmt.Errorf("task %s of group %s doesn't fit with the rest of the group: %s",
+				t.Name, t.Group, Explain(t, nodes))
+		}
+		picked := s.Pick(s.Score(t, candidates), candidates)
+		picked.AddTask(t)
+		placement[t.ID] = picked.Name
+	}
+	return placement, nil
+}
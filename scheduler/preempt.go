@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"sort"
+)
+
+// Preemption is a node a task fits on once Victims have been evicted.
+type Preemption struct {
+	Node    *node.Node
+	Victims []*task.Task
+}
+
+// Fits reports whether a node meets every predicate for the task.
+func Fits(t task.Task, n *node.Node, nodes []*node.Node) bool {
+	return failedPredicate(t, n, nodes) == nil
+}
+
+// FindPreemption looks for the node where evicting tasks of a lower
+// priority than t makes room for it. running holds the active tasks of
+// each node, by node name. Of the nodes that work, it picks the one whose
+// most important victim has the lowest priority, then the one with the
+// fewest victims. It returns nil if no eviction makes room.
+func FindPreemption(t task.Task, nodes []*node.Node, running map[string][]*task.Task) *Preemption {
+	var best *Preemption
+	for _, n := range nodes {
+		victims := preemptionVictims(t, n, nodes, running[n.Name])
+		if victims == nil {
+			continue
+		}
+		p := &Preemption{Node: n, Victims: victims}
+		if best == nil || betterPreemption(p, best) {
+			best = p
+		}
+	}
+	return best
+}
+
+// preemptionVictims returns the fewest tasks of a lower priority to evict
+// from the node for t to fit, trying to keep the most important ones.
+func preemptionVictims(t task.Task, n *node.Node, nodes []*node.Node, running []*task.Task) []*task.Task {
+	var candidates []*task.Task
+	for _, r := range running {
+		if r.Priority < t.Priority {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	// Most important first: highest priority, then longest running.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Priority != candidates[j].Priority {
+			return candidates[i].Priority > candidates[j].Priority
+		}
+		return candidates[i].StartTime.Before(candidates[j].StartTime)
+	})
+
+	c := n.Clone()
+	for _, v := range candidates {
+		c.RemoveTask(v.ID)
+	}
+	if !Fits(t, c, nodes) {
+		return nil
+	}
+
+	// Give back every task the node can keep while t still fits.
+	var victims []*task.Task
+	for _, v := range candidates {
+		c.AddTask(*v)
+		if !Fits(t, c, nodes) {
+			c.RemoveTask(v.ID)
+			victims = append(victims, v)
+		}
+	}
+	if len(victims) == 0 {
+		return nil
+	}
+	return victims
+}
+
+func betterPreemption(a, b *Preemption) bool {
+	pa, pb := maxPriority(a.Victims), maxPriority(b.Victims)
+	if pa != pb {
+		return pa < pb
+	}
+	return len(a.Victims) < len(b.Victims)
+}
+
+func maxPriority(tasks []*task.Task) int {
+	max := tasks[0].Priority
+	for _, t := range tasks[1:] {
+		if t.Priority > max {
+			max = t.Priority
+		}
+	}
+	return max
+}
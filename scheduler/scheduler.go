@@ -26,7 +26,7 @@ type RoundRobin struct {
 }
 
 func (r *RoundRobin) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
-	return nodes
+	return filterNodes(t, nodes)
 }
 
 func (r *RoundRobin) Score(t task.Task, nodes []*node.Node) map[string]float64 {
@@ -46,6 +46,7 @@ func (r *RoundRobin) Score(t task.Task, nodes []*node.Node) map[string]float64 {
 		} else {
 			nodeScores[node.Name] = 1.0
 		}
+		nodeScores[node.Name] += taintPenalty(t, node) - preferenceScore(t, node)
 	}
 	return nodeScores
 }
@@ -72,49 +73,52 @@ type Epvm struct {
 }
 
 func (e *Epvm) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
-	var candidates []*node.Node
-
-	for _, node := range nodes {
-		if checkDisk(t, node.DiskAllocated) {
-			candidates = append(candidates, node)
-		}
-	}
-
-	return candidates
-}
-
-func checkDisk(t task.Task, diskAvailable int) bool {
-	return t.Disk <= diskAvailable
+	return filterNodes(t, nodes)
 }
 
+// Score rates the cost of adding the task to each node. A node whose
+// stats can't be read scores an infinite cost, so it is only picked when no
+// other node can be.
 func (e *Epvm) Score(t task.Task, nodes []*node.Node) map[string]float64 {
 	nodeScores := make(map[string]float64)
-	maxJobs := 4.0
 	for _, node := range nodes {
 		cpuUsage, err := calculateCpuUsage(node)
 		if err != nil {
-			log.Printf("Failed to get cpu usage for node: %v", node.Api)
+			log.Printf("Failed to get cpu usage for node: %v\n", node.Api)
+			nodeScores[node.Name] = math.Inf(1)
 			continue
 		}
-		cpuLoad := calculateLoad(cpuUsage, math.Pow(2, 0.8))
-		memoryAllocated := float64(node.Stats.MemUsedKb()) +
-			float64(node.MemoryAllocated)
-		memoryPercentAllocated := memoryAllocated / float64(node.Memory)
-		newMemPercent := (calculateLoad(memoryAllocated+
-			float64(t.Memory/1000), float64(node.Memory)))
-		memCost := math.Pow(LIEB, newMemPercent) + math.Pow(LIEB,
-			(float64(node.TaskCount+1))/maxJobs) -
-			math.Pow(LIEB, memoryPercentAllocated) -
-			math.Pow(LIEB, float64(node.TaskCount)/float64(maxJobs))
-		cpuCost := math.Pow(LIEB, cpuLoad) +
-			math.Pow(LIEB, (float64(node.TaskCount+1))/maxJobs) -
-			math.Pow(LIEB, cpuLoad) -
-			math.Pow(LIEB, float64(node.TaskCount)/float64(maxJobs))
-		nodeScores[node.Name] = memCost + cpuCost
+		nodeScores[node.Name] = epvmCost(t, node, cpuUsage) +
+			taintPenalty(t, node) - preferenceScore(t, node)
 	}
 	return nodeScores
 }
 
+// epvmCost is the increase in cpu and memory cost of adding the task to the
+// node. A node that reports no memory can't be rated and costs infinitely
+// much.
+func epvmCost(t task.Task, node *node.Node, cpuUsage float64) float64 {
+	if node.Memory <= 0 {
+		return math.Inf(1)
+	}
+	maxJobs := 4.0
+	cpuLoad := calculateLoad(cpuUsage, math.Pow(2, 0.8))
+	memoryAllocated := float64(node.Stats.MemUsedKb()) +
+		float64(node.MemoryAllocated)
+	memoryPercentAllocated := memoryAllocated / float64(node.Memory)
+	newMemPercent := (calculateLoad(memoryAllocated+
+		float64(t.Memory/1000), float64(node.Memory)))
+	memCost := math.Pow(LIEB, newMemPercent) + math.Pow(LIEB,
+		(float64(node.TaskCount+1))/maxJobs) -
+		math.Pow(LIEB, memoryPercentAllocated) -
+		math.Pow(LIEB, float64(node.TaskCount)/float64(maxJobs))
+	cpuCost := math.Pow(LIEB, cpuLoad) +
+		math.Pow(LIEB, (float64(node.TaskCount+1))/maxJobs) -
+		math.Pow(LIEB, cpuLoad) -
+		math.Pow(LIEB, float64(node.TaskCount)/float64(maxJobs))
+	return memCost + cpuCost
+}
+
 func calculateCpuUsage(node *node.Node) (float64, error) {
 	stat1, err := node.GetStats()
 	if err != nil {
@@ -151,17 +155,18 @@ func calculateLoad(usage float64, capacity float64) float64 {
 	return usage / capacity
 }
 
+// Pick returns the candidate with the lowest cost. Candidates without a
+// score cost infinitely much.
 func (e *Epvm) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
-	minCost := 0.00
+	minCost := math.Inf(1)
 	var bestNode *node.Node
 	for idx, node := range candidates {
-		if idx == 0 {
-			minCost = scores[node.Name]
-			bestNode = node
-			continue
+		cost, ok := scores[node.Name]
+		if !ok || math.IsNaN(cost) {
+			cost = math.Inf(1)
 		}
-		if scores[node.Name] < minCost {
-			minCost = scores[node.Name]
+		if idx == 0 || cost < minCost {
+			minCost = cost
 			bestNode = node
 		}
 	}
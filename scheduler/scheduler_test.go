@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"math"
+	"testing"
+
+	"github.com/c9s/goprocinfo/linux"
+)
+
+func TestEpvmPickSkipsNodesWithoutScore(t *testing.T) {
+	w1 := node.NewNode("w1", "http://w1:5556", "worker")
+	w2 := node.NewNode("w2", "http://w2:5556", "worker")
+	w3 := node.NewNode("w3", "http://w3:5556", "worker")
+	candidates := []*node.Node{w1, w2, w3}
+
+	tests := []struct {
+		name   string
+		scores map[string]float64
+		want   string
+	}{
+		{"lowest cost", map[string]float64{"w1": 0.5, "w2": 0.2, "w3": 0.3}, "w2"},
+		{"failed stats", map[string]float64{"w1": math.Inf(1), "w2": 0.4, "w3": 0.3}, "w3"},
+		{"no score", map[string]float64{"w2": 0.4, "w3": 0.3}, "w3"},
+		{"not a number", map[string]float64{"w1": math.NaN(), "w2": 0.4, "w3": 0.3}, "w3"},
+		{"all failed", map[string]float64{"w1": math.Inf(1), "w2": math.Inf(1), "w3": math.Inf(1)}, "w1"},
+	}
+	e := &Epvm{Name: "epvm"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.Pick(tt.scores, candidates); got.Name != tt.want {
+				t.Errorf("picked %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestEpvmCostWithoutMemory(t *testing.T) {
+	n := node.NewNode("w1", "http://w1:5556", "worker")
+	n.Stats.MemStats = &linux.MemInfo{}
+	tk := task.Task{Memory: 64 * 1024 * 1024}
+	if cost := epvmCost(tk, n, 0.5); !math.IsInf(cost, 1) {
+		t.Errorf("cost on a node without memory = %v, want +Inf", cost)
+	}
+
+	n.Memory = 8 * 1024 * 1024
+	n.Stats.MemStats = &linux.MemInfo{MemTotal: 8 * 1024 * 1024, MemAvailable: 4 * 1024 * 1024}
+	if cost := epvmCost(tk, n, 0.5); math.IsNaN(cost) || math.IsInf(cost, 0) {
+		t.Errorf("cost on a node with memory = %v, want a finite cost", cost)
+	}
+}
@@ -0,0 +1,27 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Secret holds sensitive key/value data for the tasks of a namespace.
+type Secret struct {
+	Namespace  string
+	Name       string
+	Data       map[string]string
+	CreateTime time.Time
+}
+
+func (s *Secret) Validate() error {
+	if s.Name == "" {
+		return errors.New("secret name must not be empty")
+	}
+	for k := range s.Data {
+		if k == "" {
+			return fmt.Errorf("secret %s has an empty key", s.Name)
+		}
+	}
+	return nil
+}
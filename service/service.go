@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Protocols a service can proxy.
+const (
+	TCP  = "TCP"
+	HTTP = "HTTP"
+)
+
+// Places a service can listen on.
+const (
+	// OnManager serves the service from the manager.
+	OnManager = "Manager"
+	// OnWorkers serves the service from every worker.
+	OnWorkers = "Workers"
+)
+
+// Service exposes the tasks whose labels match Selector on a stable Port,
+// balancing connections across the ones that are running and healthy.
+type Service struct {
+	Name      string
+	Namespace string
+	Selector  map[string]string
+	Port      int
+	// TargetPort is the container port traffic is sent to, such as
+	// "80/tcp". It defaults to the first published port of each task.
+	TargetPort string
+	Protocol   string
+	Mode       string
+	CreateTime time.Time
+	Status     Status
+}
+
+type Status struct {
+	Endpoints []Endpoint
+}
+
+// Endpoint is the address a task's target port is published on.
+type Endpoint struct {
+	Task    string
+	Address string
+}
+
+func (s *Service) SetDefaults() {
+	if s.Protocol == "" {
+		s.Protocol = TCP
+	}
+	if s.Mode == "" {
+		s.Mode = OnManager
+	}
+	if s.TargetPort != "" && !strings.Contains(s.TargetPort, "/") {
+		s.TargetPort += "/tcp"
+	}
+}
+
+func (s *Service) Validate() error {
+	if s.Name == "" {
+		return errors.New("service name must not be empty")
+	}
+	if len(s.Selector) == 0 {
+		return fmt.Errorf("service %s needs a selector", s.Name)
+	}
+	if s.Port < 1 || s.Port > 65535 {
+		return fmt.Errorf("port %d of service %s is out of range", s.Port, s.Name)
+	}
+	switch s.Protocol {
+	case TCP, HTTP:
+	default:
+		return fmt.Errorf("unknown protocol %q for service %s", s.Protocol, s.Name)
+	}
+	switch s.Mode {
+	case OnManager, OnWorkers:
+	default:
+		return fmt.Errorf("unknown mode %q for service %s", s.Mode, s.Name)
+	}
+	return nil
+}
+
+// Matches reports whether the labels are selected by the service.
+func (s *Service) Matches(labels map[string]string) bool {
+	for k, v := range s.Selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Addresses returns the addresses of the service's endpoints.
+func (s *Service) Addresses() []string {
+	addrs := make([]string, 0, len(s.Status.Endpoints))
+	for _, e := range s.Status.Endpoints {
+		addrs = append(addrs, e.Address)
+	}
+	return addrs
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type ChangeType string
+
+const (
+	Added    ChangeType = "Added"
+	Modified ChangeType = "Modified"
+	Deleted  ChangeType = "Deleted"
+)
+
+// Change describes one write to a watched object. Object holds the JSON
+// encoding of the object as it was written.
+type Change struct {
+	Revision  uint64
+	Kind      string
+	Type      ChangeType
+	Key       string
+	Timestamp time.Time
+	Object    json.RawMessage
+}
+
+// ErrCompacted is returned when the changes after a revision are no longer
+// retained by the feed.
+var ErrCompacted = errors.New("revision has been compacted")
+
+// Feed keeps the most recent changes in the order they were made, each
+// with an increasing revision that clients can resume from.
+type Feed struct {
+	mu       sync.Mutex
+	changes  []Change
+	size     int
+	revision uint64
+	notify   chan struct{}
+}
+
+func NewFeed(size int) *Feed {
+	return &Feed{
+		size:   size,
+		notify: make(chan struct{}),
+	}
+}
+
+func (f *Feed) Publish(kind string, changeType ChangeType, key string, object any) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		data = nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.revision++
+	f.changes = append(f.changes, Change{
+		Revision:  f.revision,
+		Kind:      kind,
+		Type:      changeType,
+		Key:       key,
+		Timestamp: time.Now().UTC(),
+		Object:    data,
+	})
+	if len(f.changes) > f.size {
+		f.changes = f.changes[len(f.changes)-f.size:]
+	}
+
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
+
+// Revision returns the revision of the latest change.
+func (f *Feed) Revision() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.revision
+}
+
+// Since returns the changes made after the given revision, and a channel
+// that is closed when the next change is published.
+func (f *Feed) Since(revision uint64) ([]Change, <-chan struct{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if revision > f.revision {
+		return nil, nil, fmt.Errorf("revision %d is in the future", revision)
+	}
+	if len(f.changes) > 0 && revision+1 < f.changes[0].Revision {
+		return nil, nil, ErrCompacted
+	}
+
+	start := len(f.changes)
+	for i, c := range f.changes {
+		if c.Revision > revision {
+			start = i
+			break
+		}
+	}
+	changes := append([]Change{}, f.changes[start:]...)
+	return changes, f.notify, nil
+}
+
+// WatchedStore publishes every write to the wrapped store on a feed.
+// Writes are serialized, so each change is published as Added or Modified
+// correctly and in the order the writes were made.
+type WatchedStore[T any] struct {
+	Store[T]
+	Feed *Feed
+	Kind string
+
+	mu sync.Mutex
+}
+
+func NewWatchedStore[T any](s Store[T], feed *Feed, kind string) *WatchedStore[T] {
+	return &WatchedStore[T]{Store: s, Feed: feed, Kind: kind}
+}
+
+func (w *WatchedStore[T]) Put(key string, value T) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	changeType := Modified
+	if _, err := w.Store.Get(key); err != nil {
+		changeType = Added
+	}
+
+	err := w.Store.Put(key, value)
+	if err != nil {
+		return err
+	}
+	w.Feed.Publish(w.Kind, changeType, key, value)
+	return nil
+}
+
+func (w *WatchedStore[T]) Delete(key string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	value, err := w.Store.Get(key)
+	if err != nil {
+		return err
+	}
+
+	err = w.Store.Delete(key)
+	if err != nil {
+		return err
+	}
+	w.Feed.Publish(w.Kind, Deleted, key, value)
+	return nil
+}
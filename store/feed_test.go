@@ -0,0 +1,67 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestWatchedStoreConcurrentPuts(t *testing.T) {
+	b, err := NewBackend("memory", "")
+	if err != nil {
+		t.Fatalf("NewBackend: %v", err)
+	}
+	feed := NewFeed(1000)
+	s := NewWatchedStore(Open[*string](b, "things"), feed, "thing")
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 20 {
+				v := fmt.Sprintf("%d-%d", i, j)
+				s.Put(fmt.Sprintf("key-%d", j), &v)
+			}
+		}()
+	}
+	wg.Wait()
+
+	changes, _, err := feed.Since(0)
+	if err != nil {
+		t.Fatalf("Since: %v", err)
+	}
+	added := map[string]int{}
+	for _, c := range changes {
+		if c.Type == Added {
+			added[c.Key]++
+		}
+	}
+	for j := range 20 {
+		key := fmt.Sprintf("key-%d", j)
+		if added[key] != 1 {
+			t.Errorf("%s was published as added %d times, want 1", key, added[key])
+		}
+	}
+}
+
+func TestFeedSince(t *testing.T) {
+	feed := NewFeed(2)
+	for i := range 3 {
+		feed.Publish("thing", Added, fmt.Sprint(i), i)
+	}
+
+	changes, _, err := feed.Since(1)
+	if err != nil {
+		t.Fatalf("Since(1): %v", err)
+	}
+	if len(changes) != 2 || changes[0].Revision != 2 || changes[1].Revision != 3 {
+		t.Errorf("Since(1) = %+v, want revisions 2 and 3", changes)
+	}
+	if _, _, err := feed.Since(0); err != ErrCompacted {
+		t.Errorf("Since(0) after compaction: got %v, want %v", err, ErrCompacted)
+	}
+	if _, _, err := feed.Since(4); err == nil {
+		t.Error("Since a future revision: want an error")
+	}
+}
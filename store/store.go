@@ -2,22 +2,122 @@ package store
 
 import (
 	"cube/task"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 
-	"github.com/boltdb/bolt"
+	bolt "go.etcd.io/bbolt"
 )
 
+// ErrNotFound is returned for keys that aren't in a store.
+var ErrNotFound = errors.New("does not exist")
+
+// notFound returns the error for a key missing from a store of T, naming
+// the kind of value, such as "cron job with key default/backup does not
+// exist".
+func notFound[T any](key string) error {
+	return fmt.Errorf("%s with key %s %w", kindOf[T](), key, ErrNotFound)
+}
+
+// kindOf returns the name of the type of values in lower case words.
+func kindOf[T any]() string {
+	typ := reflect.TypeFor[T]()
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Name() == "" {
+		return "entry"
+	}
+	var b strings.Builder
+	for i, r := range typ.Name() {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 type Store[T any] interface {
 	Put(key string, value T) error
 	Get(key string) (T, error)
 	List() ([]T, error)
 	Count() (int, error)
+	Delete(key string) error
+}
+
+// Index maps a key to an ordered list of IDs, such as a task ID to the IDs
+// of the events recorded for it.
+type Index interface {
+	Add(key string, id string) error
+	Get(key string) ([]string, error)
+	Delete(key string) error
+	// Trim keeps only the last max IDs of a key and returns the ones it
+	// dropped, oldest first.
+	Trim(key string, max int) ([]string, error)
+}
+
+type InMemoryIndex struct {
+	Db map[string][]string
+	mu sync.RWMutex
+}
+
+var _ Index = (*InMemoryIndex)(nil)
+
+func NewInMemoryIndex() *InMemoryIndex {
+	return &InMemoryIndex{
+		Db: make(map[string][]string),
+	}
+}
+
+func (i *InMemoryIndex) Add(key string, id string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.Db[key] = append(i.Db[key], id)
+	return nil
+}
+
+func (i *InMemoryIndex) Get(key string) ([]string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return append([]string{}, i.Db[key]...), nil
+}
+
+func (i *InMemoryIndex) Delete(key string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.Db, key)
+	return nil
+}
+
+func (i *InMemoryIndex) Trim(key string, max int) ([]string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	ids := i.Db[key]
+	if len(ids) <= max {
+		return nil, nil
+	}
+	dropped := append([]string{}, ids[:len(ids)-max]...)
+	i.Db[key] = append([]string{}, ids[len(ids)-max:]...)
+	return dropped, nil
 }
 
 type InMemoryTaskStore[T any] struct {
 	Db map[string]T
+	mu sync.RWMutex
 }
 
 // Ensure InMemoryTaskStore implements the Store interface
@@ -31,21 +131,30 @@ func NewInMemoryStore[T any]() *InMemoryTaskStore[T] {
 }
 
 func (i *InMemoryTaskStore[T]) Put(key string, value T) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
 	i.Db[key] = value
 	return nil
 }
 
 func (i *InMemoryTaskStore[T]) Get(key string) (T, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
 	var zeroVal T
 
 	t, ok := i.Db[key]
 	if !ok {
-		return zeroVal, fmt.Errorf("task with key %s does not exist", key)
+		return zeroVal, notFound[T](key)
 	}
 	return t, nil
 }
 
 func (i *InMemoryTaskStore[T]) List() ([]T, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
 	data := make([]T, 0, len(i.Db))
 
 	for _, v := range i.Db {
@@ -55,38 +164,252 @@ func (i *InMemoryTaskStore[T]) List() ([]T, error) {
 	return data, nil
 }
 func (i *InMemoryTaskStore[T]) Count() (int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
 	return len(i.Db), nil
 }
 
-type TaskStore struct {
-	Db       *bolt.DB
-	DbFile   string
-	FileMode os.FileMode
-	Bucket   string
+func (i *InMemoryTaskStore[T]) Delete(key string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, ok := i.Db[key]; !ok {
+		return notFound[T](key)
+	}
+	delete(i.Db, key)
+	return nil
+}
+
+// TaskStore keeps values as JSON in a bucket of a bolt database, so that
+// they survive restarts.
+type TaskStore[T any] struct {
+	Db     *bolt.DB
+	Bucket string
 }
 
-func NewTaskStore(file string, mode os.FileMode, bucket string) (*TaskStore, error) {
-	db, err := bolt.Open(file, mode, nil)
+var _ Store[*task.Task] = (*TaskStore[*task.Task])(nil)
+
+// OpenDb opens the bolt database that persistent stores keep their buckets
+// in, creating it if needed.
+func OpenDb(file string, mode os.FileMode) (*bolt.DB, error) {
+	db, err := bolt.Open(file, mode, &bolt.Options{Timeout: 5 * time.Second})
 	if err != nil {
-		return nil, fmt.Errorf("unable to open %v", file)
+		return nil, fmt.Errorf("unable to open %v: %v", file, err)
 	}
+	return db, nil
+}
 
-	t := TaskStore{
-		DbFile:   file,
-		FileMode: mode,
-		Db:       db,
-		Bucket:   bucket,
+func NewTaskStore[T any](db *bolt.DB, bucket string) (*TaskStore[T], error) {
+	t := TaskStore[T]{
+		Db:     db,
+		Bucket: bucket,
 	}
 
-	err = t.CreateBucket()
+	err := t.CreateBucket()
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (t *TaskStore[T]) CreateBucket() error {
+	return t.Db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(t.Bucket))
+		if err != nil {
+			return fmt.Errorf("create bucket %s: %s", t.Bucket, err)
+		}
+		return nil
+	})
+}
 
+func (t *TaskStore[T]) Put(key string, value T) error {
+	data, err := json.Marshal(value)
 	if err != nil {
-		log.Printf("bucket already exists, will use it instead of creating new one")
+		return err
 	}
+	return t.Db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(t.Bucket)).Put([]byte(key), data)
+	})
+}
 
-	return &t, nil
+func (t *TaskStore[T]) Get(key string) (T, error) {
+	var value T
+	err := t.Db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(t.Bucket)).Get([]byte(key))
+		if data == nil {
+			return notFound[T](key)
+		}
+		return json.Unmarshal(data, &value)
+	})
+	return value, err
+}
+
+func (t *TaskStore[T]) List() ([]T, error) {
+	var values []T
+	err := t.Db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(t.Bucket)).ForEach(func(k, data []byte) error {
+			var value T
+			err := json.Unmarshal(data, &value)
+			if err != nil {
+				return err
+			}
+			values = append(values, value)
+			return nil
+		})
+	})
+	return values, err
+}
+
+func (t *TaskStore[T]) Count() (int, error) {
+	n := 0
+	err := t.Db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket([]byte(t.Bucket)).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+func (t *TaskStore[T]) Delete(key string) error {
+	return t.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(t.Bucket))
+		if b.Get([]byte(key)) == nil {
+			return notFound[T](key)
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// BoltIndex keeps an index in a bucket of a bolt database.
+type BoltIndex struct {
+	store *TaskStore[[]string]
+}
+
+var _ Index = (*BoltIndex)(nil)
+
+func NewBoltIndex(db *bolt.DB, bucket string) (*BoltIndex, error) {
+	s, err := NewTaskStore[[]string](db, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltIndex{store: s}, nil
+}
+
+func (i *BoltIndex) Add(key string, id string) error {
+	return i.store.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(i.store.Bucket))
+		var ids []string
+		if data := b.Get([]byte(key)); data != nil {
+			err := json.Unmarshal(data, &ids)
+			if err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(append(ids, id))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+func (i *BoltIndex) Get(key string) ([]string, error) {
+	ids, err := i.store.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return []string{}, nil
+	}
+	return ids, err
+}
+
+// Delete removes the IDs of a key. Like InMemoryIndex, it doesn't mind keys
+// that aren't there.
+func (i *BoltIndex) Delete(key string) error {
+	return i.store.Db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(i.store.Bucket)).Delete([]byte(key))
+	})
+}
+
+func (i *BoltIndex) Trim(key string, max int) ([]string, error) {
+	var dropped []string
+	err := i.store.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(i.store.Bucket))
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		var ids []string
+		err := json.Unmarshal(data, &ids)
+		if err != nil {
+			return err
+		}
+		if len(ids) <= max {
+			return nil
+		}
+		dropped = ids[:len(ids)-max]
+		data, err = json.Marshal(ids[len(ids)-max:])
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dropped, nil
+}
+
+// Backend creates the stores of a manager or worker, either in memory or,
+// for the "bolt" type, in a bolt database.
+type Backend struct {
+	db  *bolt.DB
+	err error
+}
+
+func NewBackend(dbType, file string) (*Backend, error) {
+	switch dbType {
+	case "memory":
+		return &Backend{}, nil
+	case "bolt":
+		db, err := OpenDb(file, 0600)
+		if err != nil {
+			return nil, err
+		}
+		return &Backend{db: db}, nil
+	default:
+		return nil, fmt.Errorf("unknown store type %q", dbType)
+	}
+}
+
+// Persistent reports whether the stores outlive the process.
+func (b *Backend) Persistent() bool {
+	return b.db != nil
 }
 
-func (t *TaskStore) Close() {
-	t.Db.Close()
+// Err returns the first error met while opening stores.
+func (b *Backend) Err() error {
+	return b.err
+}
+
+// Open returns the store of one kind of value.
+func Open[T any](b *Backend, bucket string) Store[T] {
+	if b.db == nil {
+		return NewInMemoryStore[T]()
+	}
+	s, err := NewTaskStore[T](b.db, bucket)
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	return s
+}
+
+// OpenIndex returns an index.
+func OpenIndex(b *Backend, bucket string) Index {
+	if b.db == nil {
+		return NewInMemoryIndex()
+	}
+	i, err := NewBoltIndex(b.db, bucket)
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	return i
 }
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"cube/task"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNotFoundNamesKind(t *testing.T) {
+	db, err := OpenDb(filepath.Join(t.TempDir(), "cube.db"), 0600)
+	if err != nil {
+		t.Fatalf("OpenDb: %v", err)
+	}
+	defer db.Close()
+	bolt, err := NewTaskStore[*task.TaskEvent](db, "events")
+	if err != nil {
+		t.Fatalf("NewTaskStore: %v", err)
+	}
+
+	for name, s := range map[string]Store[*task.TaskEvent]{
+		"memory": NewInMemoryStore[*task.TaskEvent](),
+		"bolt":   bolt,
+	} {
+		_, err := s.Get("abc")
+		if !errors.Is(err, ErrNotFound) || !strings.HasPrefix(err.Error(), "task event with key abc") {
+			t.Errorf("%s Get: got %v", name, err)
+		}
+		err = s.Delete("abc")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s Delete: got %v", name, err)
+		}
+	}
+}
+
+func TestBoltIndex(t *testing.T) {
+	db, err := OpenDb(filepath.Join(t.TempDir(), "cube.db"), 0600)
+	if err != nil {
+		t.Fatalf("OpenDb: %v", err)
+	}
+	defer db.Close()
+	i, err := NewBoltIndex(db, "task_events")
+	if err != nil {
+		t.Fatalf("NewBoltIndex: %v", err)
+	}
+
+	if err := i.Delete("missing"); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+	i.Add("t1", "e1")
+	i.Add("t1", "e2")
+	ids, err := i.Get("t1")
+	if err != nil || strings.Join(ids, ",") != "e1,e2" {
+		t.Errorf("Get: got %v, %v", ids, err)
+	}
+	if err := i.Delete("t1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	ids, err = i.Get("t1")
+	if err != nil || len(ids) != 0 {
+		t.Errorf("Get after Delete: got %v, %v", ids, err)
+	}
+
+	db.Close()
+	if err := i.Delete("t1"); err == nil {
+		t.Error("Delete on a closed database succeeded")
+	}
+}
+
+func TestIndexTrim(t *testing.T) {
+	db, err := OpenDb(filepath.Join(t.TempDir(), "cube.db"), 0600)
+	if err != nil {
+		t.Fatalf("OpenDb: %v", err)
+	}
+	defer db.Close()
+	bi, err := NewBoltIndex(db, "task_events")
+	if err != nil {
+		t.Fatalf("NewBoltIndex: %v", err)
+	}
+
+	for name, i := range map[string]Index{"memory": NewInMemoryIndex(), "bolt": bi} {
+		if dropped, err := i.Trim("missing", 2); err != nil || len(dropped) != 0 {
+			t.Errorf("%s Trim of a missing key: got %v, %v", name, dropped, err)
+		}
+		for _, id := range []string{"e1", "e2", "e3", "e4"} {
+			i.Add("t1", id)
+		}
+		dropped, err := i.Trim("t1", 2)
+		if err != nil || strings.Join(dropped, ",") != "e1,e2" {
+			t.Errorf("%s Trim: dropped %v, %v", name, dropped, err)
+		}
+		ids, _ := i.Get("t1")
+		if strings.Join(ids, ",") != "e3,e4" {
+			t.Errorf("%s Get after Trim: got %v", name, ids)
+		}
+		if dropped, _ := i.Trim("t1", 2); len(dropped) != 0 {
+			t.Errorf("%s Trim within the limit dropped %v", name, dropped)
+		}
+	}
+}
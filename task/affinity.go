@@ -0,0 +1,172 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operators for label requirements.
+const (
+	In     = "In"
+	NotIn  = "NotIn"
+	Exists = "Exists"
+)
+
+// Requirement matches a set of labels against a key, operator and values.
+type Requirement struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+// Selector matches labels when every requirement in it matches.
+type Selector []Requirement
+
+// PreferredTerm adds Weight to a node's preference when Selector matches.
+type PreferredTerm struct {
+	Weight   int
+	Selector Selector
+}
+
+// NodeAffinity constrains which nodes a task can run on, based on node labels.
+type NodeAffinity struct {
+	Required  Selector
+	Preferred []PreferredTerm
+}
+
+// TaskAffinity constrains placement relative to the tasks already running
+// on a node, based on their labels.
+type TaskAffinity struct {
+	Required  []Selector
+	Preferred []PreferredTerm
+}
+
+type Affinity struct {
+	NodeAffinity     *NodeAffinity
+	TaskAffinity     *TaskAffinity
+	TaskAntiAffinity *TaskAffinity
+}
+
+func (r Requirement) Matches(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+	switch r.Operator {
+	case In:
+		return ok && contains(r.Values, v)
+	case NotIn:
+		return !ok || !contains(r.Values, v)
+	case Exists:
+		return ok
+	}
+	return false
+}
+
+func (r Requirement) Validate() error {
+	if r.Key == "" {
+		return fmt.Errorf("requirement key must not be empty")
+	}
+	switch r.Operator {
+	case In, NotIn:
+		if len(r.Values) == 0 {
+			return fmt.Errorf("requirement %s %s needs at least one value", r.Key, r.Operator)
+		}
+	case Exists:
+		if len(r.Values) != 0 {
+			return fmt.Errorf("requirement %s %s does not take values", r.Key, r.Operator)
+		}
+	default:
+		return fmt.Errorf("unknown operator %q for requirement %s", r.Operator, r.Key)
+	}
+	return nil
+}
+
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) Validate() error {
+	for _, r := range s {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseSelector parses a comma separated list of label requirements in the
+// forms key=value, key!=value and key (the label exists).
+func ParseSelector(s string) (Selector, error) {
+	var selector Selector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var r Requirement
+		if k, v, ok := strings.Cut(part, "!="); ok {
+			r = Requirement{Key: k, Operator: NotIn, Values: []string{v}}
+		} else if k, v, ok := strings.Cut(part, "="); ok {
+			r = Requirement{Key: k, Operator: In, Values: []string{v}}
+		} else {
+			r = Requirement{Key: part, Operator: Exists}
+		}
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+		selector = append(selector, r)
+	}
+	return selector, nil
+}
+
+func (a *Affinity) Validate() error {
+	if a == nil {
+		return nil
+	}
+	if a.NodeAffinity != nil {
+		if err := a.NodeAffinity.Required.Validate(); err != nil {
+			return err
+		}
+		if err := validatePreferred(a.NodeAffinity.Preferred); err != nil {
+			return err
+		}
+	}
+	for _, ta := range []*TaskAffinity{a.TaskAffinity, a.TaskAntiAffinity} {
+		if ta == nil {
+			continue
+		}
+		for _, s := range ta.Required {
+			if err := s.Validate(); err != nil {
+				return err
+			}
+		}
+		if err := validatePreferred(ta.Preferred); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validatePreferred(terms []PreferredTerm) error {
+	for _, p := range terms {
+		if p.Weight <= 0 {
+			return fmt.Errorf("preferred term weight must be positive, got %d", p.Weight)
+		}
+		if err := p.Selector.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package task
+
+import (
+	"fmt"
+	"regexp"
+)
+
+type TaintEffect string
+
+const (
+	// NoSchedule keeps tasks that don't tolerate the taint off the node.
+	NoSchedule TaintEffect = "NoSchedule"
+	// PreferNoSchedule makes the scheduler avoid the node when it can.
+	PreferNoSchedule TaintEffect = "PreferNoSchedule"
+	// NoExecute also evicts running tasks that don't tolerate the taint.
+	NoExecute TaintEffect = "NoExecute"
+)
+
+// Taint keys and values use the characters of label keys and values:
+// alphanumerics, with '-', '_', '.' and, in keys, '/' inside.
+var (
+	taintKeyRe   = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_./]{0,251}[A-Za-z0-9])?$`)
+	taintValueRe = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// Equal is the default toleration operator.
+const Equal = "Equal"
+
+// Taint marks a node so that only tasks tolerating it are placed there.
+type Taint struct {
+	Key    string
+	Value  string
+	Effect TaintEffect
+}
+
+// Toleration allows a task to be placed on nodes with a matching taint. An
+// empty Key with the Exists operator matches every taint, and an empty
+// Effect matches every effect.
+type Toleration struct {
+	Key      string
+	Operator string
+	Value    string
+	Effect   TaintEffect
+}
+
+func (t Taint) Validate() error {
+	if t.Key == "" {
+		return fmt.Errorf("taint key must not be empty")
+	}
+	if !taintKeyRe.MatchString(t.Key) {
+		return fmt.Errorf("invalid taint key %q", t.Key)
+	}
+	if !taintValueRe.MatchString(t.Value) {
+		return fmt.Errorf("invalid taint value %q", t.Value)
+	}
+	return validateEffect(t.Effect)
+}
+
+// ToleratedBy reports whether any of the tolerations matches the taint.
+func (t Taint) ToleratedBy(tolerations []Toleration) bool {
+	for _, tol := range tolerations {
+		if tol.Tolerates(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (tol Toleration) Tolerates(t Taint) bool {
+	if tol.Effect != "" && tol.Effect != t.Effect {
+		return false
+	}
+	if tol.Key != "" && tol.Key != t.Key {
+		return false
+	}
+	switch tol.Operator {
+	case Exists:
+		return true
+	case Equal, "":
+		return tol.Key != "" && tol.Value == t.Value
+	}
+	return false
+}
+
+func (tol Toleration) Validate() error {
+	switch tol.Operator {
+	case Equal, "":
+		if tol.Key == "" {
+			return fmt.Errorf("toleration with operator %s needs a key", Equal)
+		}
+	case Exists:
+		if tol.Value != "" {
+			return fmt.Errorf("toleration with operator %s does not take a value", Exists)
+		}
+	default:
+		return fmt.Errorf("unknown toleration operator %q", tol.Operator)
+	}
+	if tol.Effect == "" {
+		return nil
+	}
+	return validateEffect(tol.Effect)
+}
+
+func validateEffect(e TaintEffect) error {
+	switch e {
+	case NoSchedule, PreferNoSchedule, NoExecute:
+		return nil
+	}
+	return fmt.Errorf("unknown taint effect %q", e)
+}
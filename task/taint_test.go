@@ -0,0 +1,51 @@
+package task
+
+import "testing"
+
+func TestTaintValidate(t *testing.T) {
+	valid := []Taint{
+		{Key: "gpu", Value: "true", Effect: NoSchedule},
+		{Key: "cube.io/dedicated", Effect: NoExecute},
+		{Key: "zone", Value: "eu-west_1.a", Effect: PreferNoSchedule},
+	}
+	for _, taint := range valid {
+		if err := taint.Validate(); err != nil {
+			t.Errorf("%+v: %v", taint, err)
+		}
+	}
+
+	invalid := []Taint{
+		{Key: "", Effect: NoSchedule},
+		{Key: "gpu", Effect: ""},
+		{Key: "gpu", Effect: "Never"},
+		{Key: "has space", Effect: NoSchedule},
+		{Key: "gpu", Value: "a:b", Effect: NoSchedule},
+		{Key: "gpu", Value: "a/b", Effect: NoSchedule},
+		{Key: "gpu.", Effect: NoSchedule},
+	}
+	for _, taint := range invalid {
+		if err := taint.Validate(); err == nil {
+			t.Errorf("%+v: want an error", taint)
+		}
+	}
+}
+
+func TestTolerates(t *testing.T) {
+	taint := Taint{Key: "gpu", Value: "true", Effect: NoSchedule}
+	tests := []struct {
+		tol  Toleration
+		want bool
+	}{
+		{Toleration{Key: "gpu", Value: "true"}, true},
+		{Toleration{Key: "gpu", Value: "false"}, false},
+		{Toleration{Key: "gpu", Operator: Exists}, true},
+		{Toleration{Operator: Exists}, true},
+		{Toleration{Key: "gpu", Value: "true", Effect: NoExecute}, false},
+		{Toleration{Key: "other", Operator: Exists}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.tol.Tolerates(taint); got != tt.want {
+			t.Errorf("%+v tolerates %+v = %v, want %v", tt.tol, taint, got, tt.want)
+		}
+	}
+}
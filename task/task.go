@@ -1,17 +1,22 @@
 package task
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"math"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/google/uuid"
 )
@@ -26,6 +31,32 @@ const (
 	Failed
 )
 
+var stateNames = map[State]string{
+	Pending:   "pending",
+	Scheduled: "scheduled",
+	Running:   "running",
+	Completed: "completed",
+	Failed:    "failed",
+}
+
+func (s State) String() string {
+	name, ok := stateNames[s]
+	if !ok {
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+	return name
+}
+
+// ParseState returns the state with the given name, such as "running".
+func ParseState(name string) (State, error) {
+	for s, n := range stateNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown task state %q", name)
+}
+
 var stateTransitionMap = map[State][]State{
 	Pending:   {Scheduled},
 	Scheduled: {Scheduled, Running, Failed},
@@ -38,27 +69,86 @@ type Task struct {
 	ID            uuid.UUID
 	ContainerId   string
 	Name          string
+	Namespace     string
 	State         State
 	Image         string
+	Cpu           float64
 	Memory        int
 	Disk          int
 	ExposedPort   nat.PortSet
 	HostPorts     nat.PortMap
 	PortBindings  map[string]string
 	RestartPolicy container.RestartPolicyMode
+	SubmitTime    time.Time
 	StartTime     time.Time
 	FinishTime    time.Time
 	HealthCheck   string
-	RestartCount  int
+	// Healthy is set by the manager once the task has passed its health
+	// check, and cleared when it fails or the task leaves the running state.
+	Healthy      bool
+	RestartCount int
+	// ExitCode is the exit code of the task's container once it exited.
+	ExitCode int
+	// Reason explains why the task is in its current state, for example
+	// why it could not be scheduled.
+	Reason string
+	// GracePeriod is how many seconds a container gets to exit after being
+	// asked to stop before it is killed.
+	GracePeriod  int
+	Labels       map[string]string
+	NodeSelector map[string]string
+	Affinity     *Affinity
+	Tolerations  []Toleration
+	// PriorityClass names the priority class of the task. Priority is set
+	// from it when the task is admitted; higher priorities are scheduled
+	// first and can preempt lower ones.
+	PriorityClass string
+	Priority      int
+	// Group names the gang the task belongs to within its namespace. The
+	// members of a group are only scheduled together, once GroupSize of
+	// them are pending or placed and all the pending ones fit at once.
+	Group     string
+	GroupSize int
+	// Owner names the controller that created the task, such as
+	// "deployment/web". It is empty for tasks submitted directly.
+	Owner string
+	// Secrets names secrets of the task's namespace whose data is added to
+	// the environment of its container. The manager resolves them into
+	// SecretEnv, as KEY=value, only in the copy it sends to the worker,
+	// which passes them to the container without storing or returning
+	// them, so the values are never stored with the task.
+	Secrets   []string
+	SecretEnv []string `json:",omitempty"`
 }
 
+type EventType string
+
+const (
+	EventSubmitted         EventType = "Submitted"
+	EventStopRequested     EventType = "StopRequested"
+	EventScheduled         EventType = "Scheduled"
+	EventUnschedulable     EventType = "Unschedulable"
+	EventStateChanged      EventType = "StateChanged"
+	EventRestarted         EventType = "Restarted"
+	EventHealthCheckFailed EventType = "HealthCheckFailed"
+	EventEvicted           EventType = "Evicted"
+	EventRescheduled       EventType = "Rescheduled"
+	EventPreempted         EventType = "Preempted"
+)
+
 type TaskEvent struct {
 	ID        uuid.UUID
 	State     State
 	Timestamp time.Time
 	Task      Task
+	Type      EventType
+	Message   string
 }
 
+// DNSDomain is the domain the cluster DNS server answers for, with names
+// such as web.default.cube.
+const DNSDomain = "cube"
+
 type Config struct {
 	Name          string
 	AttachStdin   bool
@@ -73,6 +163,10 @@ type Config struct {
 	Disk          int64
 	Env           []string
 	RestartPolicy container.RestartPolicyMode
+	GracePeriod   int
+	// DNS and DNSSearch configure the resolver of the container.
+	DNS       []string
+	DNSSearch []string
 }
 
 type Docker struct {
@@ -85,6 +179,13 @@ type DockerInspectResponse struct {
 	Container *types.ContainerJSON
 }
 
+// ExecResult is the output of a command run in a task's container, with
+// stdout and stderr interleaved.
+type ExecResult struct {
+	Output   string
+	ExitCode int
+}
+
 type DockerResult struct {
 	Error       error
 	Action      string
@@ -105,6 +206,29 @@ func IsValidStateTransition(src State, dst State) bool {
 	return Contains(stateTransitionMap[src], dst)
 }
 
+// RunsToCompletion reports whether a task is a run of a job or cron job,
+// which is done once its container exits cleanly. Containers of other
+// tasks are expected to keep running, so they fail whenever they exit.
+func (t *Task) RunsToCompletion() bool {
+	return strings.HasPrefix(t.Owner, "job/") || strings.HasPrefix(t.Owner, "cronjob/")
+}
+
+// Validate checks the scheduling constraints of a task.
+func (t *Task) Validate() error {
+	if t.Group != "" && t.GroupSize < 1 {
+		return fmt.Errorf("task group %s needs a size of at least 1", t.Group)
+	}
+	if t.Group == "" && t.GroupSize != 0 {
+		return errors.New("a task group size needs a group name")
+	}
+	for _, tol := range t.Tolerations {
+		if err := tol.Validate(); err != nil {
+			return err
+		}
+	}
+	return t.Affinity.Validate()
+}
+
 func NewConfig(t *Task) *Config {
 	return &Config{
 		Name:          t.Name,
@@ -112,9 +236,20 @@ func NewConfig(t *Task) *Config {
 		RestartPolicy: t.RestartPolicy,
 		ExposedPorts:  t.ExposedPort,
 		PortBindings:  t.PortBindings,
+		Cpu:           t.Cpu,
+		Memory:        int64(t.Memory),
+		Disk:          int64(t.Disk),
+		GracePeriod:   t.GracePeriod,
+		Env:           t.SecretEnv,
 	}
 }
 
+// MemoryKb returns the memory requested by the task in kilobytes, the unit
+// used for node memory.
+func MemoryKb(t Task) int {
+	return t.Memory / 1024
+}
+
 func NewDocker(config *Config) *Docker {
 	dc, err := client.NewClientWithOpts(client.FromEnv)
 	if err != nil {
@@ -160,6 +295,8 @@ func (d *Docker) Run() DockerResult {
 		RestartPolicy:   rp,
 		Resources:       r,
 		PublishAllPorts: true,
+		DNS:             d.Config.DNS,
+		DNSSearch:       d.Config.DNSSearch,
 	}
 
 	resp, err := d.Client.ContainerCreate(ctx, &cc, &hc, nil, nil, d.Config.Name)
@@ -194,26 +331,36 @@ func (d *Docker) Run() DockerResult {
 	}
 }
 
+// Stop stops a container. The container is left behind so that its logs
+// can still be read; it is removed with Remove.
 func (d *Docker) Stop(id string) DockerResult {
 	log.Printf("Attempting to stop container %s", id)
 
 	ctx := context.Background()
 
-	err := d.Client.ContainerStop(ctx, id, container.StopOptions{})
+	opts := container.StopOptions{}
+	if d.Config.GracePeriod > 0 {
+		opts.Timeout = &d.Config.GracePeriod
+	}
+
+	err := d.Client.ContainerStop(ctx, id, opts)
 
 	if err != nil {
 		log.Printf("Error stopping the container %s: %v", id, err)
 		return DockerResult{Error: err}
 	}
+	return DockerResult{Action: "stop", Result: "success"}
+}
 
-	err = d.Client.ContainerRemove(ctx, id, container.RemoveOptions{
-		RemoveVolumes: true, Force: false})
-
+// Remove removes a container that has exited.
+func (d *Docker) Remove(id string) DockerResult {
+	err := d.Client.ContainerRemove(context.Background(), id, container.RemoveOptions{
+		RemoveVolumes: true, Force: true})
 	if err != nil {
-		log.Printf("Error removing the contaienr %s: %v", id, err)
+		log.Printf("Error removing the container %s: %v", id, err)
 		return DockerResult{Error: err}
 	}
-	return DockerResult{Action: "stop", Result: "success"}
+	return DockerResult{Action: "remove", Result: "success"}
 }
 
 func (d *Docker) Inspect(containerId string) DockerInspectResponse {
@@ -224,3 +371,54 @@ func (d *Docker) Inspect(containerId string) DockerInspectResponse {
 	}
 	return DockerInspectResponse{Container: &resp}
 }
+
+// Logs streams the stdout and stderr of a container. tail limits the output
+// to the last lines ("all" for everything), and with follow set the stream
+// stays open for new output until ctx is done.
+func (d *Docker) Logs(ctx context.Context, containerId, tail string, follow bool) (io.ReadCloser, error) {
+	reader, err := d.Client.ContainerLogs(ctx, containerId, container.LogsOptions{
+		ShowStdout: true, ShowStderr: true, Follow: follow, Tail: tail})
+	if err != nil {
+		log.Printf("Error fetching container logs for container %s: %v\n", containerId, err)
+		return nil, err
+	}
+
+	// Containers run without a TTY, so docker multiplexes the two streams.
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(pw, pw, reader)
+		reader.Close()
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// Exec runs a command in a container and waits for it to exit.
+func (d *Docker) Exec(containerId string, cmd []string) (ExecResult, error) {
+	ctx := context.Background()
+	resp, err := d.Client.ContainerExecCreate(ctx, containerId, container.ExecOptions{
+		Cmd: cmd, AttachStdout: true, AttachStderr: true})
+	if err != nil {
+		log.Printf("Error creating exec in container %s: %v\n", containerId, err)
+		return ExecResult{}, err
+	}
+
+	attach, err := d.Client.ContainerExecAttach(ctx, resp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		log.Printf("Error attaching to exec %s: %v\n", resp.ID, err)
+		return ExecResult{}, err
+	}
+	defer attach.Close()
+
+	var out bytes.Buffer
+	_, err = stdcopy.StdCopy(&out, &out, attach.Reader)
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	inspect, err := d.Client.ContainerExecInspect(ctx, resp.ID)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	return ExecResult{Output: out.String(), ExitCode: inspect.ExitCode}, nil
+}
@@ -0,0 +1,39 @@
+package task
+
+import "testing"
+
+func TestIsValidStateTransition(t *testing.T) {
+	states := []State{Pending, Scheduled, Running, Completed, Failed}
+	valid := map[[2]State]bool{
+		{Pending, Scheduled}:   true,
+		{Scheduled, Scheduled}: true,
+		{Scheduled, Running}:   true,
+		{Scheduled, Failed}:    true,
+		{Running, Running}:     true,
+		{Running, Completed}:   true,
+		{Running, Failed}:      true,
+	}
+	for _, src := range states {
+		for _, dst := range states {
+			want := valid[[2]State{src, dst}]
+			if got := IsValidStateTransition(src, dst); got != want {
+				t.Errorf("IsValidStateTransition(%v, %v) = %v, want %v", src, dst, got, want)
+			}
+		}
+	}
+}
+
+func TestRunsToCompletion(t *testing.T) {
+	for owner, want := range map[string]bool{
+		"":                  false,
+		"deployment/web":    false,
+		"job/backup":        true,
+		"cronjob/nightly":   true,
+		"jobs-are-not-this": false,
+	} {
+		tk := Task{Owner: owner}
+		if got := tk.RunsToCompletion(); got != want {
+			t.Errorf("task owned by %q runs to completion: %v, want %v", owner, got, want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+)
+
+// StreamCopy copies src to an HTTP response, flushing after every write so
+// that the client sees the output as it arrives.
+func StreamCopy(w http.ResponseWriter, src io.Reader) error {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package worker
 
 import (
+	"crypto/tls"
+	"cube/pki"
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -12,16 +15,25 @@ type Api struct {
 	Port    int
 	Worker  *Worker
 	Router  *chi.Mux
+	// TLS serves the API over TLS when set. Only requests with a client
+	// certificate issued to ManagerName are then accepted.
+	TLS         *tls.Config
+	ManagerName string
 }
 
 func (a *Api) initRouter() {
 	a.Router = chi.NewRouter()
+	if a.TLS != nil {
+		a.Router.Use(a.requireManager)
+	}
 
 	a.Router.Route("/task", func(r chi.Router) {
 		r.Post("/", a.StartTaskHandler)
 		r.Get("/", a.GetTaskHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
 			r.Delete("/", a.StopTaskHandler)
+			r.Get("/logs", a.GetTaskLogsHandler)
+			r.Post("/exec", a.ExecTaskHandler)
 		})
 	})
 
@@ -30,7 +42,26 @@ func (a *Api) initRouter() {
 	})
 }
 
-func (a *Api) Start() {
+// requireManager rejects requests whose client certificate wasn't issued
+// to the manager.
+func (a *Api) requireManager(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cn, err := pki.PeerName(r)
+		if err != nil || cn != a.ManagerName {
+			log.Printf("Rejected request from %s with certificate %q\n", r.RemoteAddr, cn)
+			sendError(w, http.StatusForbidden, "only the manager can call the worker API")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Api) Start() error {
 	a.initRouter()
-	http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	addr := fmt.Sprintf("%s:%d", a.Address, a.Port)
+	if a.TLS == nil {
+		return http.ListenAndServe(addr, a.Router)
+	}
+	s := &http.Server{Addr: addr, Handler: a.Router, TLSConfig: a.TLS}
+	return s.ListenAndServeTLS("", "")
 }
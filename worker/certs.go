@@ -0,0 +1,195 @@
+package worker
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"cube/pki"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// CertRequest asks the manager's CA for a certificate.
+type CertRequest struct {
+	// CSR is the PEM certificate request, whose common name is the name of
+	// the node.
+	CSR string
+	// Address is the host:port the node advertises. The certificate is
+	// only issued for its host.
+	Address string
+}
+
+// CertResponse holds a certificate issued by the manager's CA.
+type CertResponse struct {
+	Certificate string
+	CA          string
+}
+
+// Bootstrap tells a worker how to get its first certificate from the
+// manager's CA.
+type Bootstrap struct {
+	// Manager is the base URL of the manager API.
+	Manager string
+	// Token is a one-time join token created on the manager.
+	Token string
+	// CAHash pins the CA certificate fetched from the manager when CAFile
+	// doesn't exist yet.
+	CAHash string
+	// Advertise is the host:port the manager reaches the worker at, whose
+	// host the certificate is for.
+	Advertise string
+	CertFile  string
+	KeyFile   string
+	CAFile    string
+}
+
+// Bootstrap gets the worker a certificate from the manager's CA, unless it
+// already has one. The CA is read from its file or fetched from the
+// manager and checked against its hash.
+func (w *Worker) Bootstrap(b Bootstrap) error {
+	if _, err := os.Stat(b.CertFile); err == nil {
+		return nil
+	}
+
+	pool, err := pki.LoadPool(b.CAFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		pool, err = fetchCA(b.Manager, b.CAHash, b.CAFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	keyPEM, csrPEM, err := newCertRequest(w.Name, b.Advertise)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(CertRequest{CSR: string(csrPEM), Address: b.Advertise})
+	if err != nil {
+		return err
+	}
+	client := pki.NewClient(pki.ClientConfig(nil, pool))
+	req, err := http.NewRequest(http.MethodPost, b.Manager+"/pki/csr", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(JoinTokenHeader, b.Token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %v", b.Manager, err)
+	}
+	defer resp.Body.Close()
+	cr, err := decodeCert(resp)
+	if err != nil {
+		return err
+	}
+
+	err = pki.WriteKeyPair(b.CertFile, b.KeyFile, []byte(cr.Certificate), keyPEM)
+	if err != nil {
+		return err
+	}
+	log.Printf("Worker %s got a certificate from %s\n", w.Name, b.Manager)
+	return nil
+}
+
+// fetchCA gets the CA certificate from the manager, trusts it if it has
+// the expected hash, and saves it to caFile.
+func fetchCA(manager, hash, caFile string) (*x509.CertPool, error) {
+	if hash == "" {
+		return nil, fmt.Errorf("%s doesn't exist and no CA hash is set to fetch it", caFile)
+	}
+	// The certificate is checked against its hash instead of a CA.
+	client := pki.NewClient(&tls.Config{InsecureSkipVerify: true})
+	resp, err := client.Get(manager + "/pki/ca")
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", manager, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := pki.ParseCertificate(data)
+	if err != nil {
+		return nil, err
+	}
+	if got := pki.CertHash(cert); got != hash {
+		return nil, fmt.Errorf("CA of %s has hash %s, not %s", manager, got, hash)
+	}
+	err = pki.WriteFile(caFile, data, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return pki.LoadPool(caFile)
+}
+
+// RotateCertificates renews the worker's certificate from the manager's
+// CA before it expires. The new key pair is used for the connections made
+// after it is saved.
+func (w *Worker) RotateCertificates(manager string, kp *pki.KeyPair, advertise string) {
+	for {
+		if kp.NeedsRenewal(time.Now()) {
+			err := w.renewCertificate(manager, kp, advertise)
+			if err != nil {
+				log.Printf("Error renewing the certificate of worker %s: %v\n", w.Name, err)
+			} else {
+				log.Printf("Renewed the certificate of worker %s, valid until %v\n", w.Name, kp.Leaf().NotAfter)
+			}
+		}
+		time.Sleep(w.Intervals.Certificates)
+	}
+}
+
+func (w *Worker) renewCertificate(manager string, kp *pki.KeyPair, advertise string) error {
+	keyPEM, csrPEM, err := newCertRequest(w.Name, advertise)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(CertRequest{CSR: string(csrPEM), Address: advertise})
+	if err != nil {
+		return err
+	}
+	resp, err := w.Client.Post(manager+"/pki/renew", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %v", manager, err)
+	}
+	defer resp.Body.Close()
+	cr, err := decodeCert(resp)
+	if err != nil {
+		return err
+	}
+	return kp.Update([]byte(cr.Certificate), keyPEM)
+}
+
+// newCertRequest creates a key and a certificate request for the node name
+// at the host of its advertised address.
+func newCertRequest(name, advertise string) ([]byte, []byte, error) {
+	host, _, err := net.SplitHostPort(advertise)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid advertised address %q: %v", advertise, err)
+	}
+	return pki.NewCSR(name, []string{host})
+}
+
+func decodeCert(resp *http.Response) (*CertResponse, error) {
+	if resp.StatusCode != http.StatusCreated {
+		return nil, decodeError(resp)
+	}
+	cr := CertResponse{}
+	err := json.NewDecoder(resp.Body).Decode(&cr)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding certificate: %v", err)
+	}
+	return &cr, nil
+}
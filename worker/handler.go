@@ -2,6 +2,7 @@ package worker
 
 import (
 	"cube/task"
+	"cube/utils"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -16,6 +17,17 @@ type ErrorResponse struct {
 	Message        string
 }
 
+// ExecRequest is the command to run in a task's container.
+type ExecRequest struct {
+	Command []string
+}
+
+func sendError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{HttpStatusCode: status, Message: msg})
+}
+
 func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 	d := json.NewDecoder(r.Body)
 	d.DisallowUnknownFields()
@@ -34,17 +46,26 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a.Worker.AddTask(te.Task)
+	a.Worker.AcceptTask(te.Task)
 	log.Printf("Task added: %v\n", te.Task.ID)
 
+	// Secret values go no further than the container.
+	te.Task.SecretEnv = nil
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(te.Task)
 }
 
 func (a *Api) GetTaskHandler(w http.ResponseWriter, h *http.Request) {
+	// Tasks stored before secrets were left out may still carry them.
+	tasks := []task.Task{}
+	for _, t := range a.Worker.GetTasks() {
+		c := *t
+		c.SecretEnv = nil
+		tasks = append(tasks, c)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(a.Worker.GetTasks())
+	json.NewEncoder(w).Encode(tasks)
 }
 
 func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -65,14 +86,9 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 
 	taskToStop, err := a.Worker.Db.Get(tID.String())
 	if err != nil {
-		msg := fmt.Sprintf("No task found with id %v\n", tID)
-		log.Print(msg)
-		e := ErrorResponse{
-			HttpStatusCode: http.StatusNotFound,
-			Message:        msg,
-		}
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(e)
+		msg := fmt.Sprintf("No task found with id %v", tID)
+		log.Println(msg)
+		sendError(w, http.StatusNotFound, msg)
 		return
 	}
 
@@ -92,3 +108,74 @@ func (a *Api) GetStatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 	json.NewEncoder(w).Encode(a.Worker.Stats)
 }
+
+// runningTask looks up the task of a request, answering with an error and
+// returning false unless it has a container.
+func (a *Api) runningTask(w http.ResponseWriter, r *http.Request) (*task.Task, bool) {
+	taskID := chi.URLParam(r, "taskID")
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid task id %s", taskID))
+		return nil, false
+	}
+
+	t, err := a.Worker.Db.Get(tID.String())
+	if err != nil {
+		sendError(w, http.StatusNotFound, fmt.Sprintf("No task found with id %v", tID))
+		return nil, false
+	}
+	if t.ContainerId == "" {
+		sendError(w, http.StatusConflict, fmt.Sprintf("Task %v has no container", tID))
+		return nil, false
+	}
+	return t, true
+}
+
+func (a *Api) GetTaskLogsHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.runningTask(w, r)
+	if !ok {
+		return
+	}
+
+	tail := r.URL.Query().Get("tail")
+	if tail == "" {
+		tail = "all"
+	}
+	follow := r.URL.Query().Get("follow") == "true"
+
+	logs, err := a.Worker.TaskLogs(r.Context(), *t, tail, follow)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, fmt.Sprintf("Error fetching logs of task %v: %v", t.ID, err))
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	utils.StreamCopy(w, logs)
+}
+
+func (a *Api) ExecTaskHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.runningTask(w, r)
+	if !ok {
+		return
+	}
+
+	req := ExecRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || len(req.Command) == 0 {
+		sendError(w, http.StatusBadRequest, "Body must hold the command to run")
+		return
+	}
+
+	result, err := a.Worker.ExecTask(*t, req.Command)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, fmt.Sprintf("Error running command in task %v: %v", t.ID, err))
+		return
+	}
+	log.Printf("Ran %v in task %v\n", req.Command, t.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,143 @@
+package worker
+
+import (
+	"bytes"
+	"cube/task"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// JoinTokenHeader carries the shared join token on node registration requests.
+const JoinTokenHeader = "X-Cube-Join-Token"
+
+type Registration struct {
+	Name    string
+	Address string
+	Cores   int
+	Memory  int
+	Disk    int
+	Labels  map[string]string
+	Taints  []task.Taint
+	// Services tells whether the worker runs the proxies of services
+	// served from the workers.
+	Services bool
+}
+
+func (w *Worker) NewRegistration(address string) Registration {
+	stats := GetStats()
+	return Registration{
+		Name:     w.Name,
+		Address:  address,
+		Cores:    runtime.NumCPU(),
+		Memory:   int(stats.MemTotalKb()),
+		Disk:     int(stats.DiskTotal()),
+		Labels:   w.Labels,
+		Taints:   w.Taints,
+		Services: w.ServesServices,
+	}
+}
+
+// Register announces the worker to the manager so it can be scheduled on.
+// manager is the base URL of the manager API, such as
+// https://manager:5555.
+func (w *Worker) Register(manager, address, token string) error {
+	data, err := json.Marshal(w.NewRegistration(address))
+	if err != nil {
+		return fmt.Errorf("unable to marshal registration: %v", err)
+	}
+
+	url := fmt.Sprintf("%s/nodes", manager)
+	resp, err := w.sendWithToken(http.MethodPost, url, token, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return decodeError(resp)
+	}
+	log.Printf("Registered worker %s with manager %s\n", w.Name, manager)
+	return nil
+}
+
+// Deregister removes the worker from the manager's node list.
+func (w *Worker) Deregister(manager, token string) error {
+	url := fmt.Sprintf("%s/nodes/%s", manager, w.Name)
+	resp, err := w.sendWithToken(http.MethodDelete, url, token, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return decodeError(resp)
+	}
+	log.Printf("Deregistered worker %s from manager %s\n", w.Name, manager)
+	return nil
+}
+
+func (w *Worker) heartbeat(manager, token string) (int, error) {
+	url := fmt.Sprintf("%s/nodes/%s/heartbeat", manager, w.Name)
+	resp, err := w.sendWithToken(http.MethodPost, url, token, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// SendHeartbeats registers the worker and then keeps reporting to the
+// manager, registering again whenever the manager no longer knows about it.
+func (w *Worker) SendHeartbeats(manager, address, token string) {
+	registered := false
+	for {
+		if !registered {
+			err := w.Register(manager, address, token)
+			if err != nil {
+				log.Printf("Error registering worker %s: %v\n", w.Name, err)
+			} else {
+				registered = true
+			}
+		} else {
+			status, err := w.heartbeat(manager, token)
+			if err != nil {
+				log.Printf("Error sending heartbeat to %s: %v\n", manager, err)
+			} else if status == http.StatusNotFound {
+				log.Printf("Manager %s does not know worker %s, registering again\n", manager, w.Name)
+				registered = false
+				continue
+			} else if status != http.StatusNoContent {
+				log.Printf("Manager %s refused the heartbeat of worker %s with status %d\n", manager, w.Name, status)
+			}
+		}
+		time.Sleep(w.Intervals.Heartbeat)
+	}
+}
+
+func (w *Worker) sendWithToken(method, url, token string, data []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request to %s: %v", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(JoinTokenHeader, token)
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", url, err)
+	}
+	return resp, nil
+}
+
+func decodeError(resp *http.Response) error {
+	e := ErrorResponse{}
+	err := json.NewDecoder(resp.Body).Decode(&e)
+	if err != nil {
+		return fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return fmt.Errorf("response error (%d): %s", e.HttpStatusCode, e.Message)
+}
@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"cube/proxy"
+	"cube/service"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// SyncServices runs a proxy on the worker for every service that is served
+// from the workers, with the endpoints the manager reports for it. The join
+// token authenticates the worker to managers that check their callers.
+func (w *Worker) SyncServices(manager, token string) {
+	proxies := make(map[string]*proxy.Proxy)
+	for {
+		services, err := w.fetchServices(manager, token)
+		if err != nil {
+			log.Printf("Error fetching services from %s: %v\n", manager, err)
+		} else {
+			w.syncProxies(proxies, services)
+		}
+		time.Sleep(w.Intervals.SyncServices)
+	}
+}
+
+func (w *Worker) syncProxies(proxies map[string]*proxy.Proxy, services []*service.Service) {
+	served := make(map[string]bool)
+	for _, s := range services {
+		if s.Mode != service.OnWorkers {
+			continue
+		}
+		key := s.Namespace + "/" + s.Name
+		p, ok := proxies[key]
+		if ok && (p.Port != s.Port || p.Protocol != s.Protocol) {
+			p.Stop()
+			ok = false
+		}
+		if !ok {
+			p = proxy.New(key, s.Protocol, s.Port)
+			err := p.Start()
+			if err != nil {
+				log.Printf("Error starting proxy for service %s on worker %s: %v\n", key, w.Name, err)
+				continue
+			}
+			proxies[key] = p
+		}
+		p.SetEndpoints(s.Addresses())
+		served[key] = true
+	}
+
+	for name, p := range proxies {
+		if !served[name] {
+			p.Stop()
+			delete(proxies, name)
+		}
+	}
+}
+
+func (w *Worker) fetchServices(manager, token string) ([]*service.Service, error) {
+	resp, err := w.sendWithToken(http.MethodGet, manager+"/services", token, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
+	var services []*service.Service
+	err = json.NewDecoder(resp.Body).Decode(&services)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding services: %v", err)
+	}
+	return services, nil
+}
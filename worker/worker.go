@@ -1,14 +1,18 @@
 package worker
 
 import (
+	"context"
 	"cube/queue"
 	"cube/store"
 	"cube/task"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"time"
 
+	"github.com/docker/docker/client"
 	"github.com/google/uuid"
 )
 
@@ -18,20 +22,62 @@ type Worker struct {
 	Db        store.Store[*task.Task]
 	TaskCount int
 	Stats     *Stats
+	Labels    map[string]string
+	Taints    []task.Taint
+	// Nameserver is the IP address of the cluster DNS server that
+	// containers use as their resolver. Docker's default is used if empty.
+	Nameserver string
+	// ServesServices tells the manager that the worker runs the proxies of
+	// services served from the workers.
+	ServesServices bool
+	Intervals      Intervals
+	// Client makes the requests to the manager API.
+	Client *http.Client
 }
 
-func New(name string, taskDbType string) *Worker {
+// Intervals are how often the loops of the worker run.
+type Intervals struct {
+	RunTasks     time.Duration
+	UpdateTasks  time.Duration
+	Stats        time.Duration
+	Heartbeat    time.Duration
+	SyncServices time.Duration
+	// Certificates is how often the certificate is checked for renewal.
+	Certificates time.Duration
+}
+
+var DefaultIntervals = Intervals{
+	RunTasks:     10 * time.Second,
+	UpdateTasks:  15 * time.Second,
+	Stats:        15 * time.Second,
+	Heartbeat:    15 * time.Second,
+	SyncServices: 10 * time.Second,
+	Certificates: time.Hour,
+}
+
+// FinishedContainerTTL is how long the container of a finished task is
+// kept, so that its logs can still be read, before it is removed.
+var FinishedContainerTTL = time.Hour
+
+// New creates a worker with a task store of the given type, "memory" or
+// "bolt". A bolt store is kept in dbFile.
+func New(name, taskDbType, dbFile string) (*Worker, error) {
+	b, err := store.NewBackend(taskDbType, dbFile)
+	if err != nil {
+		return nil, err
+	}
 	w := Worker{
-		Name:  name,
-		Queue: queue.New[task.Task](),
+		Name:      name,
+		Queue:     queue.New[task.Task](),
+		Db:        store.Open[*task.Task](b, "tasks"),
+		Labels:    make(map[string]string),
+		Intervals: DefaultIntervals,
+		Client:    http.DefaultClient,
 	}
-	var s store.Store[*task.Task]
-	switch taskDbType {
-	case "memory":
-		s = store.NewInMemoryStore[*task.Task]()
+	if b.Err() != nil {
+		return nil, b.Err()
 	}
-	w.Db = s
-	return &w
+	return &w, nil
 }
 
 func (w *Worker) CollectStats() {
@@ -39,7 +85,7 @@ func (w *Worker) CollectStats() {
 		log.Println("Collecting stats")
 		w.Stats = GetStats()
 		w.Stats.TaskCount = w.TaskCount
-		time.Sleep(15 * time.Second)
+		time.Sleep(w.Intervals.Stats)
 	}
 }
 
@@ -51,9 +97,14 @@ func (w *Worker) runTask() task.DockerResult {
 	}
 
 	taskPersisted, err := w.Db.Get(t.ID.String())
-	if err != nil {
+	if err != nil || (t.State == task.Scheduled && isFinished(taskPersisted.State)) {
+		// The task finished after it was accepted; its container is removed
+		// as in AcceptTask.
+		if err == nil && t.ContainerId == "" {
+			t.ContainerId = taskPersisted.ContainerId
+		}
 		taskPersisted = &t
-		w.Db.Put(t.ID.String(), taskPersisted)
+		w.saveTask(*taskPersisted)
 	}
 
 	var result task.DockerResult
@@ -62,7 +113,9 @@ func (w *Worker) runTask() task.DockerResult {
 		case task.Scheduled:
 			result = w.StartTask(t)
 		case task.Completed:
-			result = w.StopTask(t)
+			// A stop can be asked for before the task has started, so the
+			// container to stop is the one on record now.
+			result = w.StopTask(*taskPersisted)
 		default:
 			result.Error = errors.New("not reachable")
 		}
@@ -74,6 +127,12 @@ func (w *Worker) runTask() task.DockerResult {
 	return result
 }
 
+// isFinished reports whether a task has stopped running. A finished task
+// can be scheduled on the same worker again when it is restarted or moved.
+func isFinished(s task.State) bool {
+	return s == task.Completed || s == task.Failed
+}
+
 func (w *Worker) RunTasks() {
 	for {
 		if w.Queue.Length() != 0 {
@@ -85,8 +144,8 @@ func (w *Worker) RunTasks() {
 			log.Printf("No task to run currently\n")
 		}
 
-		log.Printf("Sleeping for 10 sec\n")
-		time.Sleep(10 * time.Second)
+		log.Printf("Sleeping for %v\n", w.Intervals.RunTasks)
+		time.Sleep(w.Intervals.RunTasks)
 	}
 }
 
@@ -94,10 +153,37 @@ func (w *Worker) AddTask(t task.Task) {
 	w.Queue.Enqueue(t)
 }
 
+// AcceptTask stores a task sent by the manager and queues it to be
+// started. The task is stored right away so that it can be stopped before
+// it starts. A task that runs here again left the container of its last run
+// behind, holding the container's name; the manager no longer knows its ID,
+// so it is taken from this worker's record for StartTask to remove.
+func (w *Worker) AcceptTask(t task.Task) {
+	persisted, err := w.Db.Get(t.ID.String())
+	if err != nil || isFinished(persisted.State) {
+		if err == nil && t.ContainerId == "" {
+			t.ContainerId = persisted.ContainerId
+		}
+		w.saveTask(t)
+	}
+	w.AddTask(t)
+}
+
 func (w *Worker) StartTask(t task.Task) task.DockerResult {
+	// A task that is restarted leaves the container of its last run behind.
+	if t.ContainerId != "" {
+		w.removeContainer(&t)
+	}
 	t.StartTime = time.Now().UTC()
 
 	config := task.NewConfig(&t)
+	// A task moving between workers that share a Docker host runs on both
+	// for a while, so container names include the worker.
+	config.Name = fmt.Sprintf("%s-%s", t.Name, w.Name)
+	if w.Nameserver != "" {
+		config.DNS = []string{w.Nameserver}
+		config.DNSSearch = []string{t.Namespace + "." + task.DNSDomain}
+	}
 	d := task.NewDocker(config)
 
 	result := d.Run()
@@ -105,12 +191,12 @@ func (w *Worker) StartTask(t task.Task) task.DockerResult {
 		log.Printf("error starting the container %v: %v\n", t.ID,
 			result.Error)
 		t.State = task.Failed
-		w.Db.Put(t.ID.String(), &t)
+		w.saveTask(t)
 		return result
 	}
 	t.ContainerId = result.ContainerId
 	t.State = task.Running
-	w.Db.Put(t.ID.String(), &t)
+	w.saveTask(t)
 
 	return result
 }
@@ -125,20 +211,29 @@ func (w *Worker) StopTask(t task.Task) task.DockerResult {
 		log.Printf("error stopping container %s: %v\n", t.ContainerId,
 			result.Error)
 		t.State = task.Failed
-		w.Db.Put(t.ID.String(), &t)
+		w.saveTask(t)
 		return result
 	}
 
 	t.FinishTime = time.Now().UTC()
 	t.State = task.Completed
-	w.Db.Put(t.ID.String(), &t)
+	w.saveTask(t)
 
-	log.Printf("stopped and removed container %s for task %s\n",
+	// The container is removed along with those of the other finished
+	// tasks once FinishedContainerTTL has passed.
+	log.Printf("stopped container %s for task %s\n",
 		t.ContainerId, t.ID)
 
 	return result
 }
 
+// saveTask stores a task without its secret environment, which is only
+// needed to create its container.
+func (w *Worker) saveTask(t task.Task) {
+	t.SecretEnv = nil
+	w.Db.Put(t.ID.String(), &t)
+}
+
 func (w *Worker) GetTasks() []*task.Task {
 	tasks, _ := w.Db.List()
 	return tasks
@@ -150,13 +245,27 @@ func (w *Worker) InspectTask(t task.Task) task.DockerInspectResponse {
 	return d.Inspect(t.ContainerId)
 }
 
+// TaskLogs streams the output of a task's container.
+func (w *Worker) TaskLogs(ctx context.Context, t task.Task, tail string, follow bool) (io.ReadCloser, error) {
+	config := task.NewConfig(&t)
+	d := task.NewDocker(config)
+	return d.Logs(ctx, t.ContainerId, tail, follow)
+}
+
+// ExecTask runs a command in a task's container.
+func (w *Worker) ExecTask(t task.Task, cmd []string) (task.ExecResult, error) {
+	config := task.NewConfig(&t)
+	d := task.NewDocker(config)
+	return d.Exec(t.ContainerId, cmd)
+}
+
 func (w *Worker) UpdateTasks() {
 	for {
 		log.Println("Checking status of tasks")
 		w.updateTasks()
 		log.Println("Task updates completed")
-		log.Println("Sleeping for 15 seconds")
-		time.Sleep(15 * time.Second)
+		log.Printf("Sleeping for %v\n", w.Intervals.UpdateTasks)
+		time.Sleep(w.Intervals.UpdateTasks)
 	}
 }
 
@@ -174,14 +283,43 @@ func (w *Worker) updateTasks() {
 			if resp.Container == nil {
 				log.Printf("No container for running task %d\n", id)
 				t.State = task.Failed
-			} else if resp.Container.State.Status == "exited" {
+				t.FinishTime = time.Now().UTC()
+				w.saveTask(*t)
+				continue
+			}
+
+			if resp.Container.State.Status == "exited" {
 				log.Printf("Container for task %d in non-running state %s", id, resp.Container.State.Status)
-				t.State = task.Failed
+				// The container of a job's task that exits cleanly has run to
+				// completion.
+				t.ExitCode = resp.Container.State.ExitCode
+				t.FinishTime = time.Now().UTC()
+				if t.ExitCode == 0 && t.RunsToCompletion() {
+					t.State = task.Completed
+				} else {
+					t.State = task.Failed
+				}
 			}
 
 			t.HostPorts = resp.Container.NetworkSettings.NetworkSettingsBase.Ports
 
-			w.Db.Put(t.ID.String(), t)
+			w.saveTask(*t)
+		} else if isFinished(t.State) && t.ContainerId != "" && time.Since(t.FinishTime) > FinishedContainerTTL {
+			w.removeContainer(t)
 		}
 	}
 }
+
+// removeContainer removes the exited container of a finished task.
+func (w *Worker) removeContainer(t *task.Task) {
+	d := task.NewDocker(task.NewConfig(t))
+	result := d.Remove(t.ContainerId)
+	// A container that is already gone needs no removing.
+	if result.Error != nil && !client.IsErrNotFound(result.Error) {
+		log.Printf("Error removing the container of task %v: %v\n", t.ID, result.Error)
+		return
+	}
+	log.Printf("Removed the container %s of finished task %v\n", t.ContainerId, t.ID)
+	t.ContainerId = ""
+	w.saveTask(*t)
+}